@@ -0,0 +1,158 @@
+package timerheap
+
+import (
+	"time"
+)
+
+// WithAck configures the heap for at-least-once delivery. Each event received from the results
+// channel is a *Delivery, which must be acknowledged with Ack within the timeout, otherwise the
+// event is delivered again. An event remains pending, and counts towards the limit set with
+// WithMaxPending, until it is acknowledged.
+//
+// Events delivered to topics, subscribers and AfterChan channels do not need acknowledging.
+func WithAck(timeout time.Duration) Option {
+	return func(t *timerHeap) {
+		t.ackTimeout = timeout
+	}
+}
+
+// WithMaxReceives limits the number of times an event is delivered when the heap is created with
+// WithAck. An event that has been delivered n times without being acknowledged is sent to the
+// dead letter channel, if there is one, instead of being delivered again.
+func WithMaxReceives(n int) Option {
+	return func(t *timerHeap) {
+		t.maxReceives = n
+	}
+}
+
+// Delivery is sent on the results channel in place of the pushed value when the heap is
+// created with the WithAck option.
+type Delivery struct {
+	// The value that was pushed, or a TimedResult if the heap was also created with
+	// WithTimedResults.
+	Value interface{}
+	// The time the event was scheduled to pop. For a redelivery this is the time the previous
+	// delivery needed acknowledging by.
+	ScheduledAt time.Time
+	// Attempt is 1 for the first delivery of the event, and is incremented each time it is
+	// redelivered.
+	Attempt int
+	// The metadata attached to the event, see WithMetadata.
+	Metadata Metadata
+	// The sequence number of the event, and of the event delivered on the results channel
+	// before it, if the heap was created with WithSequenceNumbers.
+	Seq     uint64
+	PrevSeq uint64
+
+	heap *timerHeap
+	seq  uint64
+	// handle locates the event in the heap while it awaits acknowledgement, see
+	// insertReadyLocked.
+	handle *Handle
+}
+
+// Ack acknowledges the delivery, so that the event is not delivered again. It fails with
+// ErrAckExpired if the acknowledgement timeout has passed and the event has been, or is about to
+// be, delivered again, or if the delivery has already been acknowledged.
+func (d *Delivery) Ack() error {
+	ti, ok, err := d.settle(earlyAck{acked: true})
+	if err != nil || !ok {
+		return err
+	}
+	d.heap.retired(ti)
+	if d.heap.debug {
+		d.heap.log.Debug("Acknowledged event", "seq", ti.seq, "attempt", d.Attempt)
+	}
+	return nil
+}
+
+// Extend changes the time the delivery must be acknowledged by to timeout from now, after which
+// the event is delivered again. A timeout of zero makes the event due for redelivery
+// immediately. It fails with ErrAckExpired in the same cases as Ack.
+func (d *Delivery) Extend(timeout time.Duration) error {
+	_, _, err := d.settle(earlyAck{visible: d.heap.stamp(time.Now().Add(timeout))})
+	return err
+}
+
+// earlyAck is an acknowledgement, or a change to the time an acknowledgement is needed by, for
+// an event that has been received but not yet pushed back to await acknowledgement.
+type earlyAck struct {
+	acked   bool
+	visible time.Time
+}
+
+// settle acknowledges the delivery, or changes when it must be acknowledged by, returning the
+// event if it was acknowledged and removed from the heap.
+func (d *Delivery) settle(req earlyAck) (timedItem, bool, error) {
+	t := d.heap
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if awaiting := t.valueHeap.lookup(d.handle); awaiting == nil || awaiting.seq != d.seq || awaiting.attempt != d.Attempt {
+		if len(t.ready) == 0 || t.ready[0].seq != d.seq || t.ready[0].attempt != d.Attempt-1 {
+			return timedItem{}, false, ErrAckExpired
+		}
+		// The event has been received, but the event goroutine has not yet pushed it back
+		// to await the acknowledgement.
+		if t.early == nil {
+			t.early = map[uint64]earlyAck{}
+		}
+		if prev := t.early[d.seq]; prev.acked {
+			return timedItem{}, false, ErrAckExpired
+		}
+		t.early[d.seq] = req
+		return timedItem{}, false, nil
+	}
+	var ti timedItem
+	if !req.acked {
+		t.valueHeap.rescheduleHandle(d.handle, req.visible)
+	} else {
+		ti = t.valueHeap.removeHandle(d.handle)
+		t.space.Signal()
+	}
+	if !t.terminated {
+		t.wake()
+	}
+	return ti, req.acked, nil
+}
+
+// delivery wraps the result for an item in a Delivery.
+func (t *timerHeap) delivery(ti timedItem, value interface{}) *Delivery {
+	d := &Delivery{
+		Value:       value,
+		ScheduledAt: ti.expire,
+		Attempt:     ti.attempt + 1,
+		Metadata:    ti.metadata,
+		heap:        t,
+		seq:         ti.seq,
+		handle:      ti.handle,
+	}
+	if t.sequenced {
+		d.Seq, d.PrevSeq = t.lastSeq+1, t.lastDelivered
+	}
+	return d
+}
+
+// awaitAckLocked pushes a delivered item back onto the heap, to be delivered again unless it is
+// acknowledged before the timeout. It returns false if the item has already been acknowledged.
+// The caller must hold the lock.
+func (t *timerHeap) awaitAckLocked(ti timedItem) bool {
+	req, ok := t.early[ti.seq]
+	if ok {
+		delete(t.early, ti.seq)
+		if req.acked {
+			return false
+		}
+	}
+	ti.attempt++
+	ti.expire = t.stamp(time.Now().Add(t.ackTimeout))
+	if ok {
+		ti.expire = req.visible
+	}
+	ti.fired = time.Time{}
+	ti.handled, ti.output = false, nil
+	if next := t.valueHeap.peek(); next == nil || ti.expire.Before(next.expire) {
+		t.wake()
+	}
+	t.valueHeap.push(ti)
+	return true
+}
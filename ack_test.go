@@ -0,0 +1,145 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Acknowledged delivery", func() {
+	var th timerheap.TimerHeap
+
+	BeforeEach(func() {
+		th = timerheap.New(timerheap.WithAck(50 * time.Millisecond))
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	receive := func() *timerheap.Delivery {
+		var v interface{}
+		EventuallyWithOffset(1, th.TimedEvent(), "1s", "1ms").Should(Receive(&v))
+		ExpectWithOffset(1, v).To(BeAssignableToTypeOf(&timerheap.Delivery{}))
+		return v.(*timerheap.Delivery)
+	}
+
+	It("does not redeliver an acknowledged event", func() {
+		Expect(th.PushEvent(0, 1)).To(Succeed())
+		d := receive()
+		Expect(d.Value).To(Equal(1))
+		Expect(d.Attempt).To(Equal(1))
+		Expect(d.Ack()).To(Succeed())
+
+		Consistently(th.TimedEvent(), "150ms").ShouldNot(Receive())
+		Expect(th.Stats().Pending).To(Equal(0))
+		Expect(d.Ack()).To(Equal(timerheap.ErrAckExpired))
+	})
+
+	It("redelivers an event that is not acknowledged in time", func() {
+		Expect(th.PushEvent(0, 1)).To(Succeed())
+		first := receive()
+		Expect(th.Stats().Pending).To(Equal(1))
+
+		second := receive()
+		Expect(second.Value).To(Equal(1))
+		Expect(second.Attempt).To(Equal(2))
+		Expect(second.ScheduledAt).To(BeTemporally(">", first.ScheduledAt))
+		Expect(first.Ack()).To(Equal(timerheap.ErrAckExpired))
+
+		Expect(second.Ack()).To(Succeed())
+		Eventually(th.Idle()).Should(BeClosed())
+	})
+
+	It("is not idle until the delivery is acknowledged", func() {
+		Expect(th.PushEvent(0, 1)).To(Succeed())
+		d := receive()
+		Consistently(th.Idle(), "20ms").ShouldNot(BeClosed())
+		Expect(d.Ack()).To(Succeed())
+		Eventually(th.Idle()).Should(BeClosed())
+	})
+
+	DescribeTable("finds the events awaiting acknowledgement in each backend",
+		func(b timerheap.BackendType) {
+			th.Terminate()
+			th = timerheap.New(timerheap.WithAck(time.Minute), timerheap.WithBackend(b))
+			var deliveries []*timerheap.Delivery
+			for i := 0; i < 50; i++ {
+				Expect(th.PushEvent(0, i)).To(Succeed())
+			}
+			for i := 0; i < 50; i++ {
+				deliveries = append(deliveries, (<-th.TimedEvent()).(*timerheap.Delivery))
+			}
+
+			// Extending some of the deliveries moves their events within the heap.
+			for i := 0; i < 50; i += 3 {
+				Expect(deliveries[i].Extend(time.Duration(50-i) * time.Minute)).To(Succeed())
+			}
+			for i := 49; i >= 0; i-- {
+				Expect(deliveries[i].Ack()).To(Succeed())
+				Expect(deliveries[i].Ack()).To(Equal(timerheap.ErrAckExpired))
+			}
+			Eventually(th.Idle()).Should(BeClosed())
+		},
+		Entry("binary heap", timerheap.BinaryHeap),
+		Entry("4-ary heap", timerheap.QuaternaryHeap),
+		Entry("pairing heap", timerheap.PairingHeap),
+		Entry("min-max heap", timerheap.MinMaxHeap),
+	)
+})
+
+var _ = Describe("Visibility timeout", func() {
+	var th timerheap.TimerHeap
+
+	BeforeEach(func() {
+		th = timerheap.New(
+			timerheap.WithAck(50*time.Millisecond),
+			timerheap.WithMaxReceives(2),
+			timerheap.WithDeadLetters(),
+		)
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	receive := func() *timerheap.Delivery {
+		var v interface{}
+		EventuallyWithOffset(1, th.TimedEvent(), "1s", "1ms").Should(Receive(&v))
+		return v.(*timerheap.Delivery)
+	}
+
+	It("dead-letters an event delivered the maximum number of times", func() {
+		Expect(th.PushEvent(0, 1)).To(Succeed())
+		Expect(receive().Attempt).To(Equal(1))
+		Expect(receive().Attempt).To(Equal(2))
+
+		var dl timerheap.DeadLetter
+		Eventually(th.DeadLetters(), "1s").Should(Receive(&dl))
+		Expect(dl.Value).To(Equal(1))
+		Expect(dl.Reason).To(Equal(timerheap.DeadLetterMaxReceives))
+		Expect(th.TimedEvent()).NotTo(Receive())
+		Expect(th.Stats().Pending).To(Equal(0))
+	})
+
+	It("extends the visibility timeout", func() {
+		Expect(th.PushEvent(0, 1)).To(Succeed())
+		d := receive()
+		Expect(d.Extend(200 * time.Millisecond)).To(Succeed())
+		Consistently(th.TimedEvent(), "100ms").ShouldNot(Receive())
+		Expect(d.Ack()).To(Succeed())
+		Eventually(th.Idle()).Should(BeClosed())
+	})
+
+	It("makes an event visible again immediately", func() {
+		Expect(th.PushEvent(0, 1)).To(Succeed())
+		d := receive()
+		Expect(d.Extend(0)).To(Succeed())
+		Expect(receive().Attempt).To(Equal(2))
+		Expect(d.Ack()).To(Equal(timerheap.ErrAckExpired))
+	})
+})
@@ -0,0 +1,125 @@
+package timerheap
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	// defaultHintPending is the number of pending events the backends are benchmarked with if
+	// the hints do not give one, and maxHintPending is the most they are benchmarked with.
+	defaultHintPending = 1000
+	maxHintPending     = 1 << 16
+	// defaultHintBudget is how long the backends are benchmarked for if the hints do not say.
+	defaultHintBudget = 20 * time.Millisecond
+)
+
+// adaptiveBackends are the backends WithAdaptiveBackend selects from, in order of preference
+// should they perform the same.
+var adaptiveBackends = []BackendType{BinaryHeap, QuaternaryHeap, PairingHeap, MinMaxHeap}
+
+// BackendHints describes the expected workload of a heap, see WithAdaptiveBackend.
+type BackendHints struct {
+	// Pending is the typical number of pending events. The default is 1000, and the backends
+	// are benchmarked with at most 65536 events.
+	Pending int
+	// DropFarthest indicates that the heap often sheds its latest events, see PopLatest and
+	// OverflowDropFarthest.
+	DropFarthest bool
+	// Budget is how long the backends are benchmarked for. The default is 20ms. Each backend is
+	// benchmarked at least once, however long that takes.
+	Budget time.Duration
+}
+
+// WithAdaptiveBackend selects the backend of the heap, see WithBackend, by benchmarking each
+// backend when the heap is created, with a workload following the hints, and choosing the
+// fastest. The relative performance of the backends depends on the processor and its caches,
+// so the best choice differs between machines. The backend chosen is reported in Stats.
+//
+// The benchmark runs in New, delaying its return by around the budget set in the hints.
+func WithAdaptiveBackend(hints BackendHints) Option {
+	return func(t *timerHeap) {
+		t.adaptive = &hints
+	}
+}
+
+// selectBackend benchmarks the backends with a workload following the hints, returning the
+// fastest.
+func selectBackend(hints BackendHints) BackendType {
+	n := hints.Pending
+	if n <= 0 {
+		n = defaultHintPending
+	} else if n > maxHintPending {
+		n = maxHintPending
+	}
+	budget := hints.Budget
+	if budget <= 0 {
+		budget = defaultHintBudget
+	}
+	w := newBackendWorkload(n, hints.DropFarthest)
+
+	// The backends are benchmarked in turn for as many rounds as the budget allows, taking the
+	// fastest time of each, so that noise from other activity on the machine is spread across
+	// the backends rather than penalising one of them.
+	best := make([]time.Duration, len(adaptiveBackends))
+	deadline := time.Now().Add(budget)
+	for round := 0; round == 0 || time.Now().Before(deadline); round++ {
+		for i, b := range adaptiveBackends {
+			if d := w.run(newBackend(b)); round == 0 || d < best[i] {
+				best[i] = d
+			}
+		}
+	}
+	chosen := 0
+	for i := range best {
+		if best[i] < best[chosen] {
+			chosen = i
+		}
+	}
+	return adaptiveBackends[chosen]
+}
+
+// backendWorkload is the sequence of operations a backend is benchmarked with. The heap is
+// filled with the initial items, and then an item is popped, or the farthest item is popped if
+// dropFarthest is set for every other item, before pushing each of the churn items. Finally the
+// remaining items are popped.
+type backendWorkload struct {
+	initial      []timedItem
+	churn        []timedItem
+	dropFarthest bool
+}
+
+// newBackendWorkload returns a workload with n pending items. The items are the same for every
+// call, so that each backend is measured with the same workload.
+func newBackendWorkload(n int, dropFarthest bool) *backendWorkload {
+	rng := rand.New(rand.NewSource(1))
+	items := make([]timedItem, 2*n)
+	for i := range items {
+		// The churn items expire among the initial items still pending, or after them.
+		items[i] = timedItem{
+			expire: time.Unix(0, int64(i)+rng.Int63n(int64(2*n))),
+			seq:    uint64(i),
+		}
+	}
+	return &backendWorkload{initial: items[:n], churn: items[n:], dropFarthest: dropFarthest}
+}
+
+// run runs the workload against the backend, returning how long it took.
+func (w *backendWorkload) run(h backend) time.Duration {
+	start := time.Now()
+	for _, ti := range w.initial {
+		h.push(ti)
+	}
+	for i, ti := range w.churn {
+		if w.dropFarthest && i%2 == 1 {
+			h.popFarthest()
+		} else {
+			h.pop()
+		}
+		h.push(ti)
+	}
+	for h.Len() > 0 {
+		h.pop()
+	}
+	return time.Since(start)
+}
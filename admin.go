@@ -0,0 +1,298 @@
+package timerheap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// adminPush is the body of a request to push a test event.
+type adminPush struct {
+	// Delay is the time until the event pops, in the format accepted by time.ParseDuration.
+	Delay string `json:"delay"`
+	// Type is the name of the registered type to decode the value into. If it is empty the
+	// value is pushed as decoded by encoding/json.
+	Type  string          `json:"type,omitempty"`
+	Value json.RawMessage `json:"value"`
+	Topic string          `json:"topic,omitempty"`
+	// Key is the idempotency key of the event, see WithKey.
+	Key string `json:"key,omitempty"`
+}
+
+// adminPushed is the response to a request to push a test event. ID identifies the event to
+// cancel it, and is zero if the event cannot be cancelled by ID because the heap does not
+// support handles.
+type adminPushed struct {
+	ID uint64 `json:"id,omitempty"`
+}
+
+// adminEvents tracks the test events pushed through the admin handler with handles, so that they
+// can be cancelled by ID until they leave the pending state.
+type adminEvents struct {
+	lock    sync.Mutex
+	nextID  uint64
+	handles map[uint64]*Handle
+}
+
+// track records the handle of a pushed test event, returning its ID.
+func (e *adminEvents) track(h *Handle) uint64 {
+	e.lock.Lock()
+	e.nextID++
+	id := e.nextID
+	e.handles[id] = h
+	e.lock.Unlock()
+	go func() {
+		<-h.Done()
+		e.lock.Lock()
+		delete(e.handles, id)
+		e.lock.Unlock()
+	}()
+	return id
+}
+
+// cancel cancels the pending test event with the ID, returning false if there is none.
+func (e *adminEvents) cancel(id uint64) bool {
+	e.lock.Lock()
+	h := e.handles[id]
+	e.lock.Unlock()
+	return h != nil && h.Cancel()
+}
+
+// NewAdminHandler returns an http.Handler for operating the heap, with the following endpoints
+// relative to where it is mounted:
+//
+//	GET  /events     lists the pending events, see MarshalJSON
+//	POST /events     pushes a test event, see below
+//	POST /cancel     cancels a pending event, see below
+//	GET  /export     exports a page of the pending events, see below
+//	POST /import     imports exported events, see below
+//	GET  /stats      returns the Stats of the heap
+//	POST /flush      waits for the pending events to be delivered, see Flush
+//	POST /terminate  terminates the heap
+//
+// A test event is pushed with a JSON body holding the delay until it pops, the value, and
+// optionally the topic and the name of the registered type to decode the value into, for
+// example {"delay": "5s", "type": "retry", "value": {"ID": "a"}}, and its key may be given as
+// "key". The response holds the ID of the event, for example {"id": 1}, unless the heap does not
+// support handles, see WithHandle.
+//
+// An event is cancelled with the id query parameter, for a test event, or the key query
+// parameter, for any event pushed with WithKey, and the response is 404 Not Found if there is no
+// such pending event. A flush waits for up to the duration given by the timeout query parameter,
+// if there is one, otherwise until the request is cancelled.
+//
+// An export returns up to 100 of the pending events in the order they are due, or as many as
+// the limit query parameter gives, along with a cursor for the next page if there are more, for
+// example {"events": [...], "next": "..."}. The next page is requested by passing the cursor as
+// the cursor query parameter. The events may be filtered by their expiration with the from and
+// to query parameters, in RFC 3339 format, and by their metadata with label query parameters of
+// the form name=value, or name for events with the label whatever its value. The values of the
+// events are encoded with encoding/json, along with the name of their registered type if they
+// have one.
+//
+// An import pushes the events in a body of the same form as an export. The conflict query
+// parameter sets what is done with an event whose key is taken by a pending or recently
+// completed event, see WithKey: skip, the default, skips the event, replace cancels the pending
+// event and imports the event in its place, and fail rejects the whole import with 409 Conflict
+// before any event is imported. An event whose key is taken by an event that has already been
+// delivered is skipped even if it would be replaced, so that it is not delivered twice. The
+// response holds the number of events imported, how many of those replaced an event, and the
+// number skipped, for example {"imported": 3, "replaced": 0, "skipped": 1}. Exporting and
+// importing are not supported for heaps other than those created by this package.
+//
+// The conformance package holds golden vectors of these requests and their responses, for
+// checking other implementations of the protocol and clients written for it.
+//
+// The handler does not authenticate requests, so it should only be served to operators.
+func NewAdminHandler(th TimerHeap) http.Handler {
+	events := &adminEvents{handles: map[uint64]*Handle{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			data, err := th.MarshalJSON()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(data)
+		case http.MethodPost:
+			adminPushEvent(th, events, w, r)
+		default:
+			adminMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+	})
+	mux.HandleFunc("/cancel", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			adminMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		adminCancelEvent(th, events, w, r)
+	})
+	mux.HandleFunc("/export", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			adminMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		adminExportEvents(th, w, r)
+	})
+	mux.HandleFunc("/import", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			adminMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		adminImportEvents(th, w, r)
+	})
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			adminMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(th.Stats())
+	})
+	mux.HandleFunc("/flush", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			adminMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		ctx := r.Context()
+		if timeout := r.URL.Query().Get("timeout"); timeout != "" {
+			d, err := time.ParseDuration(timeout)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, d)
+			defer cancel()
+		}
+		if err := th.Flush(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/terminate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			adminMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		th.Terminate()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+// adminPushEvent handles a request to push a test event.
+func adminPushEvent(th TimerHeap, events *adminEvents, w http.ResponseWriter, r *http.Request) {
+	var req adminPush
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	delay, err := time.ParseDuration(req.Delay)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	value, err := adminValue(th, req.Type, req.Value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var opts []PushOption
+	if req.Topic != "" {
+		opts = append(opts, WithTopic(req.Topic))
+	}
+	if req.Key != "" {
+		opts = append(opts, WithKey(req.Key))
+	}
+	h := &Handle{}
+	err = th.PushEvent(delay, value, append(opts, WithHandle(h))...)
+	if errors.Is(err, ErrHandleUnsupported) {
+		h = nil
+		err = th.PushEvent(delay, value, opts...)
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrFull) || errors.Is(err, ErrTerminated) {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	var resp adminPushed
+	if h != nil && h.State() == EventPending {
+		resp.ID = events.track(h)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// adminCancelEvent handles a request to cancel an event by the ID of a test event or by key.
+func adminCancelEvent(th TimerHeap, events *adminEvents, w http.ResponseWriter, r *http.Request) {
+	var cancelled bool
+	query := r.URL.Query()
+	switch {
+	case query.Get("id") != "":
+		id, err := strconv.ParseUint(query.Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cancelled = events.cancel(id)
+	case query.Get("key") != "":
+		t, ok := th.(*timerHeap)
+		if !ok {
+			http.Error(w, "cancelling by key is not supported", http.StatusNotImplemented)
+			return
+		}
+		cancelled = t.removeKey(query.Get("key"))
+	default:
+		http.Error(w, "an id or key is required", http.StatusBadRequest)
+		return
+	}
+	if !cancelled {
+		http.Error(w, ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminValue decodes the value of an event, into the registered type if one is named.
+func adminValue(th TimerHeap, name string, data json.RawMessage) (interface{}, error) {
+	if name == "" {
+		var value interface{}
+		err := json.Unmarshal(data, &value)
+		return value, err
+	}
+	t, ok := th.(*timerHeap)
+	if !ok || t.types == nil {
+		return nil, ErrNoTypeRegistry
+	}
+	typ, ok := t.types.typeOf(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnregisteredType, name)
+	}
+	value := reflect.New(typ)
+	if err := json.Unmarshal(data, value.Interface()); err != nil {
+		return nil, err
+	}
+	return value.Elem().Interface(), nil
+}
+
+// adminMethodNotAllowed rejects a request with a method the endpoint does not support.
+func adminMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
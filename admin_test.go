@@ -0,0 +1,283 @@
+package timerheap_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Admin handler", func() {
+	var th timerheap.TimerHeap
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		registry := timerheap.NewTypeRegistry()
+		Expect(registry.Register("retry", retry{}, nil)).To(Succeed())
+		th = timerheap.New(timerheap.WithTypeRegistry(registry, false))
+		server = httptest.NewServer(timerheap.NewAdminHandler(th))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		th.Terminate()
+	})
+
+	post := func(path, body string) *http.Response {
+		resp, err := http.Post(server.URL+path, "application/json", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		return resp
+	}
+
+	It("pushes test events and lists them", func() {
+		Expect(post("/events", `{"delay": "1h", "type": "retry", "value": {"ID": "a", "Attempt": 2}}`).StatusCode).To(Equal(http.StatusAccepted))
+		Expect(post("/events", `{"delay": "2h", "value": "text"}`).StatusCode).To(Equal(http.StatusAccepted))
+
+		resp, err := http.Get(server.URL + "/events")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		var dump struct {
+			Events []map[string]interface{} `json:"events"`
+		}
+		Expect(json.NewDecoder(resp.Body).Decode(&dump)).To(Succeed())
+		Expect(dump.Events).To(HaveLen(2))
+		Expect(dump.Events[0]).To(HaveKeyWithValue("type", "retry"))
+		Expect(dump.Events[1]).To(HaveKeyWithValue("value", "text"))
+	})
+
+	It("delivers pushed test events with the registered type", func() {
+		Expect(post("/events", `{"delay": "0s", "type": "retry", "value": {"ID": "a"}}`).StatusCode).To(Equal(http.StatusAccepted))
+		Eventually(th.TimedEvent()).Should(Receive(Equal(retry{ID: "a"})))
+	})
+
+	It("rejects invalid test events", func() {
+		Expect(post("/events", `{"delay": "soon", "value": 1}`).StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(post("/events", `{"delay": "1s", "type": "unknown", "value": 1}`).StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("cancels test events by ID", func() {
+		resp, err := http.Post(server.URL+"/events", "application/json", strings.NewReader(`{"delay": "1h", "value": 1}`))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+		var pushed struct {
+			ID uint64 `json:"id"`
+		}
+		Expect(json.NewDecoder(resp.Body).Decode(&pushed)).To(Succeed())
+		Expect(pushed.ID).NotTo(BeZero())
+
+		Expect(post(fmt.Sprintf("/cancel?id=%d", pushed.ID), "").StatusCode).To(Equal(http.StatusNoContent))
+		Expect(th.Stats().Pending).To(BeZero())
+		Expect(post(fmt.Sprintf("/cancel?id=%d", pushed.ID), "").StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("cancels events by key", func() {
+		Expect(th.PushEvent(time.Hour, 1, timerheap.WithKey("a"))).To(Succeed())
+		Expect(post("/events", `{"delay": "1h", "value": 2, "key": "b"}`).StatusCode).To(Equal(http.StatusAccepted))
+		Expect(post("/cancel?key=a", "").StatusCode).To(Equal(http.StatusNoContent))
+		Expect(post("/cancel?key=b", "").StatusCode).To(Equal(http.StatusNoContent))
+		Expect(th.Stats().Pending).To(BeZero())
+		Expect(post("/cancel?key=c", "").StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("rejects invalid cancellations", func() {
+		Expect(post("/cancel", "").StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(post("/cancel?id=first", "").StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	type exported struct {
+		Events []struct {
+			Expire   time.Time          `json:"expire"`
+			Key      string             `json:"key"`
+			Metadata timerheap.Metadata `json:"metadata"`
+			Type     string             `json:"type"`
+			Value    json.RawMessage    `json:"value"`
+		} `json:"events"`
+		Next string `json:"next"`
+	}
+
+	export := func(query string) exported {
+		resp, err := http.Get(server.URL + "/export?" + query)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		var page exported
+		Expect(json.NewDecoder(resp.Body).Decode(&page)).To(Succeed())
+		return page
+	}
+
+	importEvents := func(query, body string) (int, map[string]int) {
+		resp, err := http.Post(server.URL+"/import?"+query, "application/json", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		var counts map[string]int
+		if resp.StatusCode == http.StatusOK {
+			Expect(json.NewDecoder(resp.Body).Decode(&counts)).To(Succeed())
+		}
+		return resp.StatusCode, counts
+	}
+
+	It("exports the pending events in pages", func() {
+		for i := 0; i < 5; i++ {
+			Expect(th.PushEvent(time.Duration(5-i)*time.Hour, i)).To(Succeed())
+		}
+		var values []string
+		page := export("limit=2")
+		for {
+			Expect(len(page.Events)).To(BeNumerically("<=", 2))
+			for _, ev := range page.Events {
+				values = append(values, string(ev.Value))
+			}
+			if page.Next == "" {
+				break
+			}
+			page = export("limit=2&cursor=" + page.Next)
+		}
+		Expect(values).To(Equal([]string{"4", "3", "2", "1", "0"}))
+	})
+
+	It("filters the exported events by label and time", func() {
+		now := time.Now()
+		Expect(th.PushEventAt(now.Add(time.Hour), 1, timerheap.WithMetadata(timerheap.Metadata{"tenant": "a"}))).To(Succeed())
+		Expect(th.PushEventAt(now.Add(2*time.Hour), 2, timerheap.WithMetadata(timerheap.Metadata{"tenant": "b"}))).To(Succeed())
+		Expect(th.PushEventAt(now.Add(3*time.Hour), 3, timerheap.WithMetadata(timerheap.Metadata{"tenant": "a"}))).To(Succeed())
+		Expect(th.PushEventAt(now.Add(4*time.Hour), 4)).To(Succeed())
+
+		values := func(page exported) []string {
+			var values []string
+			for _, ev := range page.Events {
+				values = append(values, string(ev.Value))
+			}
+			return values
+		}
+		Expect(values(export("label=tenant=a"))).To(Equal([]string{"1", "3"}))
+		Expect(values(export("label=tenant"))).To(Equal([]string{"1", "2", "3"}))
+		from := now.Add(90 * time.Minute).Format(time.RFC3339Nano)
+		to := now.Add(4 * time.Hour).Format(time.RFC3339Nano)
+		Expect(values(export("from=" + from + "&to=" + to))).To(Equal([]string{"2", "3"}))
+		Expect(values(export("label=tenant=a&from=" + from))).To(Equal([]string{"3"}))
+	})
+
+	It("imports exported events", func() {
+		Expect(th.PushEvent(50*time.Millisecond, retry{ID: "a"}, timerheap.WithKey("a"),
+			timerheap.WithMetadata(timerheap.Metadata{"tenant": "a"}))).To(Succeed())
+		Expect(th.PushEvent(time.Hour, "text")).To(Succeed())
+		resp, err := http.Get(server.URL + "/export")
+		Expect(err).NotTo(HaveOccurred())
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(post("/terminate", "").StatusCode).To(Equal(http.StatusNoContent))
+
+		registry := timerheap.NewTypeRegistry()
+		Expect(registry.Register("retry", retry{}, nil)).To(Succeed())
+		th = timerheap.New(timerheap.WithTypeRegistry(registry, false), timerheap.WithTimedResults())
+		server.Close()
+		server = httptest.NewServer(timerheap.NewAdminHandler(th))
+		status, counts := importEvents("", string(body))
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(counts).To(Equal(map[string]int{"imported": 2, "replaced": 0, "skipped": 0}))
+
+		var r timerheap.TimedResult
+		Eventually(th.TimedEvent(), "1s").Should(Receive(&r))
+		Expect(r.Value).To(Equal(retry{ID: "a"}))
+		Expect(r.Metadata).To(Equal(timerheap.Metadata{"tenant": "a"}))
+		Eventually(func() int { return th.Stats().Pending }).Should(Equal(1))
+		Expect(export("").Events[0].Value).To(MatchJSON(`"text"`))
+	})
+
+	It("applies the conflict policy to the imported events", func() {
+		Expect(th.PushEvent(time.Hour, 1, timerheap.WithKey("a"))).To(Succeed())
+		expire := time.Now().Add(time.Hour).Format(time.RFC3339Nano)
+		body := fmt.Sprintf(`{"events": [{"expire": %q, "key": "a", "value": 2}, {"expire": %q, "key": "b", "value": 3}]}`, expire, expire)
+
+		status, _ := importEvents("conflict=fail", body)
+		Expect(status).To(Equal(http.StatusConflict))
+		Expect(th.Stats().Pending).To(Equal(1))
+
+		status, counts := importEvents("", body)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(counts).To(Equal(map[string]int{"imported": 1, "replaced": 0, "skipped": 1}))
+
+		status, counts = importEvents("conflict=replace", body)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(counts).To(Equal(map[string]int{"imported": 2, "replaced": 2, "skipped": 0}))
+		page := export("")
+		Expect(page.Events).To(HaveLen(2))
+		for _, ev := range page.Events {
+			if ev.Key == "a" {
+				Expect(ev.Value).To(MatchJSON("2"))
+			}
+		}
+	})
+
+	It("does not replace events that have been delivered", func() {
+		Expect(th.PushEvent(0, 1, timerheap.WithKey("a"))).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		expire := time.Now().Add(time.Hour).Format(time.RFC3339Nano)
+		status, counts := importEvents("conflict=replace", fmt.Sprintf(`{"events": [{"expire": %q, "key": "a", "value": 2}]}`, expire))
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(counts).To(Equal(map[string]int{"imported": 0, "replaced": 0, "skipped": 1}))
+		Expect(th.Stats().Pending).To(BeZero())
+	})
+
+	It("rejects invalid exports and imports", func() {
+		for _, query := range []string{"limit=0", "from=today", "cursor=1.2", "label==a"} {
+			resp, err := http.Get(server.URL + "/export?" + query)
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest), query)
+		}
+		status, _ := importEvents("conflict=merge", `{"events": []}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+		status, _ = importEvents("", `{"events": [{"type": "unknown", "value": 1}]}`)
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(th.Stats().Pending).To(BeZero())
+	})
+
+	It("reports the stats", func() {
+		Expect(th.PushEvent(time.Hour, 1)).To(Succeed())
+		resp, err := http.Get(server.URL + "/stats")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		var stats timerheap.Stats
+		Expect(json.NewDecoder(resp.Body).Decode(&stats)).To(Succeed())
+		Expect(stats.Pending).To(Equal(1))
+	})
+
+	It("flushes the pending events", func() {
+		Expect(th.PushEvent(0, 1)).To(Succeed())
+		go func() {
+			defer GinkgoRecover()
+			Eventually(th.TimedEvent(), "2s").Should(Receive())
+		}()
+		Expect(post("/flush?timeout=2s", "").StatusCode).To(Equal(http.StatusNoContent))
+	})
+
+	It("times out flushing", func() {
+		Expect(th.PushEvent(time.Hour, 1)).To(Succeed())
+		Expect(post("/flush?timeout=10ms", "").StatusCode).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("terminates the heap", func() {
+		Expect(post("/terminate", "").StatusCode).To(Equal(http.StatusNoContent))
+		Eventually(th.TimedEvent()).Should(BeClosed())
+	})
+
+	It("rejects unsupported methods", func() {
+		resp, err := http.Get(server.URL + "/terminate")
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+		Expect(resp.Header.Get("Allow")).To(Equal(http.MethodPost))
+	})
+})
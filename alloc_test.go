@@ -0,0 +1,49 @@
+package timerheap_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("timer heap allocation tests", func() {
+	var value interface{} = "event"
+	var pushErr error
+
+	BeforeEach(func() {
+		pushErr = nil
+	})
+
+	// pushAndFire returns a function that pushes an event due after popAfter and receives it.
+	// Any push error is saved in pushErr, since checking it with Expect would allocate.
+	pushAndFire := func(th timerheap.TimerHeap, popAfter time.Duration) func() {
+		return func() {
+			if err := th.PushEvent(popAfter, value); err != nil {
+				pushErr = err
+			}
+			<-th.TimedEvent()
+		}
+	}
+
+	DescribeTable("pushes and fires events without allocating",
+		func(popAfter time.Duration, opts ...timerheap.Option) {
+			th := timerheap.New(opts...)
+			defer th.Terminate()
+			fire := pushAndFire(th, popAfter)
+			// Fill the pools of reused items before counting.
+			for i := 0; i < 10; i++ {
+				fire()
+			}
+			Expect(testing.AllocsPerRun(100, fire)).To(BeZero())
+			Expect(pushErr).NotTo(HaveOccurred())
+		},
+		Entry("due events", time.Duration(0)),
+		Entry("future events", time.Millisecond),
+		Entry("a limited heap", time.Duration(0), timerheap.WithMaxPending(10)),
+		Entry("a sharded heap", time.Duration(0), timerheap.WithShards(4)),
+	)
+})
@@ -0,0 +1,427 @@
+package timerheap
+
+import (
+	"time"
+	"unsafe"
+)
+
+// BackendType selects the data structure used to hold the pending events of a heap.
+type BackendType int
+
+const (
+	// BinaryHeap holds the pending events in a binary heap. This is the default.
+	BinaryHeap BackendType = iota
+	// QuaternaryHeap holds the pending events in a 4-ary heap. This has half the levels of a
+	// binary heap and keeps the children of each node together in memory, which reduces the
+	// cost of pushes and pops for heaps holding a large number of events.
+	QuaternaryHeap
+	// PairingHeap holds the pending events in a pairing heap. Each event is held in its own
+	// node, which is less cache friendly than the slice based heaps, but heaps can be merged
+	// and events rescheduled earlier in constant time.
+	PairingHeap
+	// MinMaxHeap holds the pending events in a min-max heap. This costs a little more than a
+	// binary heap for each push and pop, but the event that pops last can be found in constant
+	// time and removed in logarithmic time, rather than searching half of the events. This
+	// suits heaps that often shed their latest events, see PopLatest and OverflowDropFarthest.
+	MinMaxHeap
+)
+
+func (b BackendType) String() string {
+	switch b {
+	case BinaryHeap:
+		return "binary"
+	case QuaternaryHeap:
+		return "4-ary"
+	case PairingHeap:
+		return "pairing"
+	case MinMaxHeap:
+		return "min-max"
+	default:
+		return "unknown"
+	}
+}
+
+// WithBackend sets the data structure used to hold the pending events of the heap.
+func WithBackend(b BackendType) Option {
+	return func(t *timerHeap) {
+		t.valueHeap = newBackend(b)
+		t.backendType = b
+		t.adaptive = nil
+	}
+}
+
+// newBackend returns an empty backend of the type.
+func newBackend(b BackendType) backend {
+	switch b {
+	case QuaternaryHeap:
+		return &quaternaryHeap{}
+	case PairingHeap:
+		return &pairingHeap{}
+	case MinMaxHeap:
+		return &minMaxHeap{}
+	default:
+		return &timedItemHeap{}
+	}
+}
+
+// backend is the storage and ordering layer for the pending items of a heap. Items are popped
+// in the order defined by timedItem.before, so that items pop in time order and items with the
+// same expiration pop in the order they were pushed. The event goroutine, wakeups and delivery
+// only depend on this interface, so alternative data structures may be used in place of the
+// default binary heap. The heap lock is held for all calls.
+type backend interface {
+	// Len returns the number of items.
+	Len() int
+	// push adds an item.
+	push(ti timedItem)
+	// pushAll adds the items, in a single pass where that is cheaper than pushing each in turn.
+	pushAll(items []timedItem)
+	// peek returns the item that pops next, or nil if there are no items. The returned item
+	// must not be modified.
+	peek() *timedItem
+	// pop removes and returns the item that pops next. There must be at least one item.
+	pop() timedItem
+	// peekFarthest returns the item that pops last, or nil if there are no items. The returned
+	// item must not be modified.
+	peekFarthest() *timedItem
+	// popFarthest removes and returns the item that pops last. There must be at least one item.
+	popFarthest() timedItem
+	// removeWhere removes and returns an item for which match returns true, searching every
+	// item if necessary.
+	removeWhere(match func(ti *timedItem) bool) (timedItem, bool)
+	// removeAll removes the items for which match returns true, appending them, in no
+	// particular order, to dst.
+	removeAll(match func(ti *timedItem) bool, dst []timedItem) []timedItem
+	// first returns the item that pops first of the items for which match returns true, or
+	// nil if there is no such item. The returned item must not be modified.
+	first(match func(ti *timedItem) bool) *timedItem
+	// appendTo appends all the items, in no particular order, to dst.
+	appendTo(dst []timedItem) []timedItem
+	// shift moves every item by d, see timedItem.shift. This does not change their order.
+	shift(d time.Duration)
+	// deadline returns the earliest deadline of the items, see timedItem.deadline, or best if
+	// none is earlier.
+	deadline(best time.Time) time.Time
+	// grow preallocates room for n items in total, so that pushing up to n items does not
+	// allocate.
+	grow(n int)
+	// shrink releases unused room once most of it is unused, keeping room for at least min
+	// items.
+	shrink(min int)
+	// footprint returns the number of items the backend has room for, and an estimate of the
+	// bytes it uses to hold them.
+	footprint() (capacity int, bytes uintptr)
+	// lookup returns the item tracked by the handle, or nil if the handle does not track an
+	// item held by the backend. Only the fields that do not affect the order of the items may
+	// be modified through the returned item.
+	lookup(h *Handle) *timedItem
+	// removeHandle removes and returns the item tracked by the handle, which must have been
+	// found with lookup.
+	removeHandle(h *Handle) timedItem
+	// rescheduleHandle changes the expiration time of the item tracked by the handle, which
+	// must have been found with lookup.
+	rescheduleHandle(h *Handle, expire time.Time)
+}
+
+// timedItemHeap is the default backend, a binary min-heap held in a slice. The children of the
+// item at index i are at indexes 2i+1 and 2i+2.
+var _ backend = &timedItemHeap{}
+
+func (h *timedItemHeap) push(ti timedItem) {
+	*h = append(*h, ti)
+	placed(*h, len(*h)-1)
+	siftUp(*h, len(*h)-1, 2)
+}
+
+func (h *timedItemHeap) pushAll(items []timedItem) {
+	pushAll((*[]timedItem)(h), items, 2)
+}
+
+func (h *timedItemHeap) pop() timedItem {
+	return removeAt((*[]timedItem)(h), 0, 2)
+}
+
+func (h timedItemHeap) peekFarthest() *timedItem {
+	if i := h.farthest(); i >= 0 {
+		return &h[i]
+	}
+	return nil
+}
+
+func (h *timedItemHeap) popFarthest() timedItem {
+	return removeAt((*[]timedItem)(h), h.farthest(), 2)
+}
+
+func (h *timedItemHeap) removeWhere(match func(ti *timedItem) bool) (timedItem, bool) {
+	return removeWhere((*[]timedItem)(h), match, 2)
+}
+
+func (h *timedItemHeap) removeAll(match func(ti *timedItem) bool, dst []timedItem) []timedItem {
+	return removeAll((*[]timedItem)(h), match, 2, dst)
+}
+
+func (h timedItemHeap) first(match func(ti *timedItem) bool) *timedItem {
+	if i := firstWhere(h, 0, 2, match, -1); i >= 0 {
+		return &h[i]
+	}
+	return nil
+}
+
+func (h *timedItemHeap) appendTo(dst []timedItem) []timedItem {
+	return append(dst, *h...)
+}
+
+func (h timedItemHeap) shift(d time.Duration) {
+	for i := range h {
+		h[i].shift(d)
+	}
+}
+
+func (h timedItemHeap) deadline(best time.Time) time.Time {
+	return heapDeadline(h, 0, 2, best)
+}
+
+func (h *timedItemHeap) grow(n int) {
+	grow((*[]timedItem)(h), n)
+}
+
+func (h *timedItemHeap) shrink(min int) {
+	shrink((*[]timedItem)(h), min)
+}
+
+func (h timedItemHeap) footprint() (int, uintptr) {
+	return footprint(h)
+}
+
+func (h timedItemHeap) lookup(hd *Handle) *timedItem {
+	return lookupHandle(h, hd)
+}
+
+func (h *timedItemHeap) removeHandle(hd *Handle) timedItem {
+	return removeAt((*[]timedItem)(h), hd.index, 2)
+}
+
+func (h timedItemHeap) rescheduleHandle(hd *Handle, expire time.Time) {
+	rescheduleAt(h, hd.index, 2, expire)
+}
+
+// farthest returns the index of the item that would be popped last, or -1 if the heap is
+// empty. The last item must be a leaf, so only the second half of the heap is searched.
+func (h timedItemHeap) farthest() int {
+	if len(h) == 0 {
+		return -1
+	}
+	far := len(h) / 2
+	for i := far + 1; i < len(h); i++ {
+		if h[far].before(&h[i]) {
+			far = i
+		}
+	}
+	return far
+}
+
+// siftUp moves the item at index i of a d-ary heap towards the top until it is in order.
+//
+// The slice heaps implement the heap operations directly, rather than using container/heap,
+// to avoid boxing each item in an interface on every push and pop. As with the index kept by
+// the users of container/heap, the index of each item with a handle is kept up to date as the
+// item moves, so that the item can be found without searching the heap.
+func siftUp(h []timedItem, i, d int) {
+	for i > 0 {
+		parent := (i - 1) / d
+		if !h[i].before(&h[parent]) {
+			return
+		}
+		swap(h, i, parent)
+		i = parent
+	}
+}
+
+// siftDown moves the item at index i of a d-ary heap towards the bottom until it is in order. It
+// returns true if the item moved.
+func siftDown(h []timedItem, i, d int) bool {
+	start := i
+	for {
+		first := d*i + 1
+		if first >= len(h) {
+			break
+		}
+		smallest := first
+		for c := first + 1; c < first+d && c < len(h); c++ {
+			if h[c].before(&h[smallest]) {
+				smallest = c
+			}
+		}
+		if !h[smallest].before(&h[i]) {
+			break
+		}
+		swap(h, i, smallest)
+		i = smallest
+	}
+	return i > start
+}
+
+// removeAt removes and returns the item at index i of a d-ary heap.
+func removeAt(h *[]timedItem, i, d int) timedItem {
+	old := *h
+	n := len(old) - 1
+	ti := old[i]
+	old[i] = old[n]
+	old[n] = timedItem{}
+	*h = old[:n]
+	if i < n {
+		placed(*h, i)
+		if !siftDown(*h, i, d) {
+			siftUp(*h, i, d)
+		}
+	}
+	return ti
+}
+
+// pushAll adds items to a d-ary heap. Pushing each item costs logarithmic time, while rebuilding
+// the heap costs linear time in the size of the whole heap, so the heap is only rebuilt once the
+// items are at least as many as those it already holds.
+func pushAll(h *[]timedItem, items []timedItem, d int) {
+	n := len(*h)
+	*h = append(*h, items...)
+	rebuild := len(items) >= n
+	for i := n; i < len(*h); i++ {
+		placed(*h, i)
+		if !rebuild {
+			siftUp(*h, i, d)
+		}
+	}
+	if rebuild {
+		for i := (len(*h) - 2) / d; i >= 0; i-- {
+			siftDown(*h, i, d)
+		}
+	}
+}
+
+// grow preallocates room for n items in a slice heap.
+func grow(h *[]timedItem, n int) {
+	if cap(*h) < n {
+		grown := make([]timedItem, len(*h), n)
+		copy(grown, *h)
+		*h = grown
+	}
+}
+
+// shrinkFloor is the number of items below which a slice heap is never shrunk, since the room
+// saved is not worth the copy.
+const shrinkFloor = 1024
+
+// shrink reallocates a slice heap with its room halved, as many times as needed, until at least
+// a quarter of it is used, keeping room for at least min items. Leaving twice the room the items
+// need lets the heap grow again without immediately reallocating.
+func shrink(h *[]timedItem, min int) {
+	c := cap(*h)
+	n := c
+	for n > shrinkFloor && n > min && len(*h) < n/4 {
+		n /= 2
+	}
+	if n == c {
+		return
+	}
+	if n < min {
+		n = min
+	}
+	shrunk := make([]timedItem, len(*h), n)
+	copy(shrunk, *h)
+	*h = shrunk
+}
+
+// footprint returns the room in a slice heap, and the bytes used by its backing array.
+func footprint(h []timedItem) (int, uintptr) {
+	return cap(h), uintptr(cap(h)) * unsafe.Sizeof(timedItem{})
+}
+
+// swap exchanges the items at indexes i and j of a heap.
+func swap(h []timedItem, i, j int) {
+	h[i], h[j] = h[j], h[i]
+	placed(h, i)
+	placed(h, j)
+}
+
+// placed records the index of the item at index i of a heap in its handle, if it has one.
+func placed(h []timedItem, i int) {
+	if hd := h[i].handle; hd != nil {
+		hd.index = i
+	}
+}
+
+// lookupHandle returns the item of a heap tracked by the handle, or nil if there is none. The
+// index of a handle is not cleared when its item leaves the heap, so the item at the index must
+// be checked.
+func lookupHandle(h []timedItem, hd *Handle) *timedItem {
+	if hd.index < len(h) && h[hd.index].handle == hd {
+		return &h[hd.index]
+	}
+	return nil
+}
+
+// rescheduleAt changes the expiration time of the item at index i of a d-ary heap, and moves it
+// back into order.
+func rescheduleAt(h []timedItem, i, d int, expire time.Time) {
+	h[i].expire = expire
+	if !siftDown(h, i, d) {
+		siftUp(h, i, d)
+	}
+}
+
+// firstWhere returns the index of the item that pops first of the items for which match returns
+// true in the subtree of a d-ary heap rooted at index i, or best if none pops before the item at
+// index best. Since a parent never pops after its children, the children of a matching item are
+// not searched, nor are the subtrees whose root pops after best.
+func firstWhere(h []timedItem, i, d int, match func(ti *timedItem) bool, best int) int {
+	if i >= len(h) || (best >= 0 && h[best].before(&h[i])) {
+		return best
+	}
+	if match(&h[i]) {
+		return i
+	}
+	for c := d*i + 1; c <= d*i+d && c < len(h); c++ {
+		best = firstWhere(h, c, d, match, best)
+	}
+	return best
+}
+
+// removeAll removes the items of a d-ary heap for which match returns true, appending them to
+// dst. The remaining items are put back in order in linear time, rather than removing each item
+// in turn.
+func removeAll(h *[]timedItem, match func(ti *timedItem) bool, d int, dst []timedItem) []timedItem {
+	old := *h
+	n := 0
+	for i := range old {
+		if match(&old[i]) {
+			dst = append(dst, old[i])
+			continue
+		}
+		old[n] = old[i]
+		n++
+	}
+	if n == len(old) {
+		return dst
+	}
+	for i := n; i < len(old); i++ {
+		old[i] = timedItem{}
+	}
+	*h = old[:n]
+	for i := range *h {
+		placed(*h, i)
+	}
+	for i := (n - 2) / d; i >= 0; i-- {
+		siftDown(*h, i, d)
+	}
+	return dst
+}
+
+// removeWhere removes and returns the first item of a d-ary heap for which match returns true.
+func removeWhere(h *[]timedItem, match func(ti *timedItem) bool, d int) (timedItem, bool) {
+	for i := range *h {
+		if match(&(*h)[i]) {
+			return removeAt(h, i, d), true
+		}
+	}
+	return timedItem{}, false
+}
@@ -0,0 +1,134 @@
+package timerheap_test
+
+import (
+	"math/rand"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Backends", func() {
+	DescribeTable("delivers events in time order",
+		func(b timerheap.BackendType) {
+			th := timerheap.New(timerheap.WithBackend(b), timerheap.WithTimedResults())
+			defer th.Terminate()
+
+			By("adding events in a random order")
+			start := time.Now().Add(50 * time.Millisecond)
+			for _, i := range rand.Perm(200) {
+				Expect(th.PushEventAt(start.Add(time.Duration(i)*time.Millisecond), testdata{index: i})).To(Succeed())
+			}
+
+			By("Checking the events are received in order")
+			for i := 0; i < 200; i++ {
+				var value interface{}
+				Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(&value))
+				Expect(value.(timerheap.TimedResult).Value).To(Equal(testdata{index: i}))
+			}
+		},
+		Entry("binary heap", timerheap.BinaryHeap),
+		Entry("4-ary heap", timerheap.QuaternaryHeap),
+		Entry("pairing heap", timerheap.PairingHeap),
+		Entry("min-max heap", timerheap.MinMaxHeap),
+	)
+
+	DescribeTable("drops the farthest event when full",
+		func(b timerheap.BackendType) {
+			th := timerheap.New(
+				timerheap.WithBackend(b),
+				timerheap.WithMaxPending(50),
+				timerheap.WithOverflowPolicy(timerheap.OverflowDropFarthest),
+				timerheap.WithDeadLetters(),
+			)
+			defer th.Terminate()
+
+			By("adding more events than the heap holds, latest first")
+			for i := 99; i >= 0; i-- {
+				Expect(th.PushEvent(time.Hour+time.Duration(i)*time.Second, testdata{index: i})).To(Succeed())
+			}
+
+			By("Checking the latest events were dropped")
+			dropped := map[int]bool{}
+			for i := 0; i < 50; i++ {
+				var dl timerheap.DeadLetter
+				Eventually(th.DeadLetters(), "1s", "1ms").Should(Receive(&dl))
+				dropped[dl.Value.(testdata).index] = true
+			}
+			for i := 50; i < 100; i++ {
+				Expect(dropped).To(HaveKey(i))
+			}
+		},
+		Entry("binary heap", timerheap.BinaryHeap),
+		Entry("4-ary heap", timerheap.QuaternaryHeap),
+		Entry("pairing heap", timerheap.PairingHeap),
+		Entry("min-max heap", timerheap.MinMaxHeap),
+	)
+
+	DescribeTable("delivers expired events by priority class",
+		func(b timerheap.BackendType) {
+			th := timerheap.New(timerheap.WithBackend(b))
+			defer th.Terminate()
+
+			By("adding a backlog of events with a critical event scheduled last")
+			Expect(th.PushEvent(10*time.Millisecond, testdata{index: 0})).To(Succeed())
+			for _, i := range rand.Perm(20) {
+				Expect(th.PushEvent(time.Duration(20+i)*time.Millisecond, testdata{index: i + 1})).To(Succeed())
+			}
+			Expect(th.PushEvent(50*time.Millisecond, testdata{index: 21}, timerheap.WithPriorityClass(1))).To(Succeed())
+			time.Sleep(100 * time.Millisecond)
+
+			By("Checking the critical event is received after the first popped event")
+			for _, i := range append([]int{0, 21}, seq(1, 20)...) {
+				var value interface{}
+				Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(&value))
+				Expect(value).To(Equal(testdata{index: i}))
+			}
+		},
+		Entry("binary heap", timerheap.BinaryHeap),
+		Entry("4-ary heap", timerheap.QuaternaryHeap),
+		Entry("pairing heap", timerheap.PairingHeap),
+		Entry("min-max heap", timerheap.MinMaxHeap),
+	)
+
+	It("reports the backend in the stats", func() {
+		th := timerheap.New(timerheap.WithBackend(timerheap.PairingHeap))
+		defer th.Terminate()
+		Expect(th.Stats().Backend).To(Equal(timerheap.PairingHeap))
+	})
+
+	It("selects a backend by benchmarking them", func() {
+		start := time.Now()
+		th := timerheap.New(
+			timerheap.WithAdaptiveBackend(timerheap.BackendHints{Pending: 100, DropFarthest: true, Budget: 10 * time.Millisecond}),
+			timerheap.WithTimedResults(),
+		)
+		defer th.Terminate()
+		Expect(time.Since(start)).To(BeNumerically(">=", 10*time.Millisecond))
+		Expect(th.Stats().Backend).To(BeElementOf(
+			timerheap.BinaryHeap, timerheap.QuaternaryHeap, timerheap.PairingHeap, timerheap.MinMaxHeap,
+		))
+
+		start = time.Now().Add(20 * time.Millisecond)
+		for _, i := range rand.Perm(20) {
+			Expect(th.PushEventAt(start.Add(time.Duration(i)*time.Millisecond), testdata{index: i})).To(Succeed())
+		}
+		for i := 0; i < 20; i++ {
+			var r timerheap.TimedResult
+			Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(&r))
+			Expect(r.Value).To(Equal(testdata{index: i}))
+		}
+	})
+})
+
+// seq returns the integers from first to last inclusive.
+func seq(first, last int) []int {
+	var s []int
+	for i := first; i <= last; i++ {
+		s = append(s, i)
+	}
+	return s
+}
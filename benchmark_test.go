@@ -0,0 +1,113 @@
+package timerheap
+
+import (
+	"testing"
+	"time"
+)
+
+// benchmarkBackend pushes and pops items on a backend that holds size items, reporting the
+// allocations per push and pop.
+func benchmarkBackend(b *testing.B, h backend, size int) {
+	now := time.Now()
+	for i := 0; i < size; i++ {
+		h.push(timedItem{expire: now.Add(time.Duration(i*7919%size) * time.Millisecond), seq: uint64(i)})
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ti := h.pop()
+		ti.expire = ti.expire.Add(time.Duration(size) * time.Millisecond)
+		h.push(ti)
+	}
+}
+
+func BenchmarkBinaryHeap(b *testing.B) {
+	benchmarkBackend(b, &timedItemHeap{}, 100000)
+}
+
+func BenchmarkQuaternaryHeap(b *testing.B) {
+	benchmarkBackend(b, &quaternaryHeap{}, 100000)
+}
+
+func BenchmarkPairingHeap(b *testing.B) {
+	benchmarkBackend(b, &pairingHeap{}, 100000)
+}
+
+func BenchmarkMinMaxHeap(b *testing.B) {
+	benchmarkBackend(b, &minMaxHeap{}, 100000)
+}
+
+func BenchmarkPushEvent(b *testing.B) {
+	t := New()
+	defer t.Terminate()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := t.PushEvent(time.Hour, i); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDeliver(b *testing.B) {
+	t := New()
+	defer t.Terminate()
+	// The value is boxed once, so that only the allocations of the heap are reported.
+	var value interface{} = "event"
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := t.PushEvent(time.Microsecond, value); err != nil {
+			b.Fatal(err)
+		}
+		<-t.TimedEvent()
+	}
+}
+
+func BenchmarkPushEventParallel(b *testing.B) {
+	t := New()
+	defer t.Terminate()
+	b.ReportAllocs()
+	b.SetParallelism(32)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := t.PushEvent(time.Hour, 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// benchmarkReschedule reschedules an item with a handle on a backend that holds size items.
+func benchmarkReschedule(b *testing.B, h backend, size int) {
+	now := time.Now()
+	handles := make([]*Handle, size)
+	for i := 0; i < size; i++ {
+		handles[i] = &Handle{}
+		h.push(timedItem{expire: now.Add(time.Duration(i*7919%size) * time.Millisecond), seq: uint64(i), handle: handles[i]})
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hd := handles[i*7919%size]
+		ti := h.lookup(hd)
+		h.rescheduleHandle(hd, ti.expire.Add(time.Duration(i%1000-500)*time.Millisecond))
+	}
+}
+
+func BenchmarkBinaryHeapReschedule(b *testing.B) {
+	benchmarkReschedule(b, &timedItemHeap{}, 100000)
+}
+
+func BenchmarkQuaternaryHeapReschedule(b *testing.B) {
+	benchmarkReschedule(b, &quaternaryHeap{}, 100000)
+}
+
+func BenchmarkPairingHeapReschedule(b *testing.B) {
+	benchmarkReschedule(b, &pairingHeap{}, 100000)
+}
+
+func BenchmarkMinMaxHeapReschedule(b *testing.B) {
+	benchmarkReschedule(b, &minMaxHeap{}, 100000)
+}
@@ -0,0 +1,81 @@
+package timerheap
+
+import (
+	"time"
+)
+
+// Blackout describes the windows of time during which a heap holds its events, see
+// WithBlackouts. It returns the end of the window that includes the time, or the zero time if
+// the time is not in a window.
+type Blackout func(tm time.Time) time.Time
+
+// WithBlackouts configures windows of time during which no events pop, such as nightly
+// maintenance or a deploy freeze. Events that become due during a window are held in the heap
+// and pop in order once it ends, as do AfterChan timers. Events that popped before the window
+// started are still delivered, and events continue to be pushed. The heap does not wake for
+// events during a window. Windows may overlap, in which case events are held until the last of
+// them ends.
+//
+// The not-after time of an event is not extended, so an event whose window for delivery falls
+// within a blackout is discarded.
+func WithBlackouts(windows ...Blackout) Option {
+	return func(t *timerHeap) {
+		t.blackouts = append(t.blackouts, windows...)
+	}
+}
+
+// BlackoutBetween returns a single window from start until end, such as a deploy freeze.
+func BlackoutBetween(start, end time.Time) Blackout {
+	return func(tm time.Time) time.Time {
+		if tm.Before(start) || !tm.Before(end) {
+			return time.Time{}
+		}
+		return end
+	}
+}
+
+// DailyBlackout returns a window that recurs every day, starting at the offset from midnight in
+// the location and lasting for the duration, such as nightly maintenance. The window may run
+// past midnight. The offset is measured on the wall clock, so the window starts at the same
+// local time on the days the clocks change. A nil location is treated as UTC.
+func DailyBlackout(offset, length time.Duration, loc *time.Location) Blackout {
+	return DailyBlackoutIn(offset, length, FixedZone(loc))
+}
+
+// DailyBlackoutIn is DailyBlackout with the location given by the source, which is looked up
+// each time the window is checked, see ZoneSource.
+func DailyBlackoutIn(offset, length time.Duration, zone ZoneSource) Blackout {
+	return func(tm time.Time) time.Time {
+		loc := zoneLocation(zone)
+		y, m, d := tm.In(loc).Date()
+		// The window that includes the time started either today or, if it runs past midnight,
+		// on a previous day.
+		for day := 0; time.Duration(day)*24*time.Hour < offset+length; day++ {
+			start := wallClock(y, m, d-day, offset, loc)
+			if end := start.Add(length); !tm.Before(start) && tm.Before(end) {
+				return end
+			}
+		}
+		return time.Time{}
+	}
+}
+
+// afterBlackouts returns the time the blackout windows that include the time end, or the time
+// itself if it is not in a window.
+func (t *timerHeap) afterBlackouts(tm time.Time) time.Time {
+	for moved := len(t.blackouts) > 0; moved; {
+		moved = false
+		for _, window := range t.blackouts {
+			if end := window(tm); end.After(tm) {
+				tm, moved = end, true
+			}
+		}
+	}
+	return tm
+}
+
+// wallClock returns the time on the day that the wall clock in the location reads the offset
+// from midnight. The day may be out of range for the month, as with time.Date.
+func wallClock(y int, m time.Month, d int, offset time.Duration, loc *time.Location) time.Time {
+	return time.Date(y, m, d, 0, 0, int(offset/time.Second), int(offset%time.Second), loc)
+}
@@ -0,0 +1,75 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Blackouts", func() {
+	It("holds events due during a window until it ends", func() {
+		start := time.Now()
+		end := start.Add(100 * time.Millisecond)
+		th := timerheap.New(timerheap.WithBlackouts(timerheap.BlackoutBetween(start, end)))
+		defer th.Terminate()
+
+		Expect(th.PushEvent(20*time.Millisecond, "b")).To(Succeed())
+		Expect(th.PushEvent(10*time.Millisecond, "a")).To(Succeed())
+		Expect(th.PushEvent(200*time.Millisecond, "c")).To(Succeed())
+		Consistently(th.TimedEvent(), "50ms").ShouldNot(Receive())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("a")))
+		Expect(time.Now()).To(BeTemporally(">=", end))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("b")))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("c")))
+	})
+
+	It("holds events until the last of overlapping windows ends", func() {
+		start := time.Now()
+		end := start.Add(100 * time.Millisecond)
+		th := timerheap.New(timerheap.WithBlackouts(
+			timerheap.BlackoutBetween(start, start.Add(50*time.Millisecond)),
+			timerheap.BlackoutBetween(start.Add(40*time.Millisecond), end),
+		))
+		defer th.Terminate()
+
+		Expect(th.PushEvent(0, "a")).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("a")))
+		Expect(time.Now()).To(BeTemporally(">=", end))
+	})
+
+	It("holds AfterChan timers", func() {
+		start := time.Now()
+		end := start.Add(50 * time.Millisecond)
+		th := timerheap.New(timerheap.WithBlackouts(timerheap.BlackoutBetween(start, end)))
+		defer th.Terminate()
+
+		Eventually(th.AfterChan(0), "1s").Should(BeClosed())
+		Expect(time.Now()).To(BeTemporally(">=", end))
+	})
+
+	It("recurs daily windows", func() {
+		loc := time.FixedZone("test", 2*60*60)
+		nightly := timerheap.DailyBlackout(23*time.Hour, 2*time.Hour, loc)
+		at := func(day, hour, min int) time.Time {
+			return time.Date(2024, 3, day, hour, min, 0, 0, loc)
+		}
+		Expect(nightly(at(10, 22, 59))).To(BeZero())
+		Expect(nightly(at(10, 23, 0))).To(Equal(at(11, 1, 0)))
+		Expect(nightly(at(11, 0, 30))).To(Equal(at(11, 1, 0)))
+		Expect(nightly(at(11, 0, 30).UTC())).To(BeTemporally("==", at(11, 1, 0)))
+		Expect(nightly(at(11, 1, 0))).To(BeZero())
+
+		early := timerheap.DailyBlackout(2*time.Hour, time.Hour, loc)
+		Expect(early(at(10, 2, 30))).To(Equal(at(10, 3, 0)))
+		Expect(early(at(10, 3, 30))).To(BeZero())
+	})
+
+	It("treats a nil location as UTC", func() {
+		nightly := timerheap.DailyBlackout(23*time.Hour, 2*time.Hour, nil)
+		Expect(nightly(time.Date(2024, 3, 10, 23, 30, 0, 0, time.UTC))).To(Equal(time.Date(2024, 3, 11, 1, 0, 0, 0, time.UTC)))
+		Expect(nightly(time.Date(2024, 3, 10, 22, 30, 0, 0, time.UTC))).To(BeZero())
+	})
+})
@@ -0,0 +1,277 @@
+// Package boltstore stores the events of a timerheap.TimerHeap in a bolt database, so that
+// pending events survive a restart. Every pushed event is stored, but only the events due within
+// a window are held in memory.
+package boltstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var (
+	// eventsBucket is the bucket the events are stored in.
+	eventsBucket = []byte("events")
+	// keysBucket is the bucket the idempotency keys of completed events are stored in, keyed
+	// by the time they completed followed by the key.
+	keysBucket = []byte("keys")
+)
+
+// store holds the events of a bolt-backed heap. Every event is stored, keyed by its expiration
+// and a unique id, but only those due within the window are held in the heap.
+type store struct {
+	// lock is held while an event is stored and it is decided whether to push it to the heap,
+	// and while the window is advanced, so that each event is pushed to the heap exactly once.
+	lock   sync.Mutex
+	db     *bolt.DB
+	window time.Duration
+	loader timerheap.Loader
+	// loaded is the end of the window, events that expire before this have been pushed to the
+	// heap.
+	loaded time.Time
+	// exit stops the loader, which closes stopped once it has returned.
+	exit    chan struct{}
+	stopped chan struct{}
+}
+
+// New creates a heap that stores every pushed event in the bolt database at path, so that
+// pending events survive a restart. Only the events due within the window are held in memory,
+// the database is checked for events that have come within the window every half window. The
+// heap must be configured with a TypeRegistry, see timerheap.NewWithStore.
+//
+// Events are deleted from the database once they have been delivered, dropped or discarded.
+// Events pending when the heap is terminated remain in the database, and are not sent to the
+// dead letter channel unless they were within the window. Stats, Save and MarshalJSON only
+// cover the events within the window, as does the limit set with WithMaxPending.
+func New(path string, window time.Duration, opts ...timerheap.Option) (timerheap.TimerHeap, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("boltstore: invalid window %v", window)
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(eventsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(keysBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &store{
+		db:      db,
+		window:  window,
+		exit:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	th, err := timerheap.NewWithStore(s, opts...)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return th, nil
+}
+
+// key returns the key of an event, which orders the events by expiration. Events that expire
+// before the Unix epoch are ordered as if they expire at it.
+func key(expire time.Time, id uint64) []byte {
+	k := make([]byte, 16)
+	nanos := expire.UnixNano()
+	if nanos < 0 {
+		nanos = 0
+	}
+	binary.BigEndian.PutUint64(k, uint64(nanos))
+	binary.BigEndian.PutUint64(k[8:], id)
+	return k
+}
+
+// Start claims the idempotency keys of the stored events, remembers the keys of the events that
+// completed within the retention period, and loads the events that are already due, or due
+// within the window, before starting the loader.
+func (s *store) Start(l timerheap.Loader) error {
+	s.loader = l
+	if err := s.restoreKeys(); err != nil {
+		return err
+	}
+	s.load()
+	go s.run()
+	return nil
+}
+
+// Put stores a pushed event, assigning its id, and claims its key. It returns true if the event
+// is within the window and should be pushed to the heap.
+func (s *store) Put(ev *timerheap.StoredEvent) (bool, error) {
+	if ev.Key != "" && !s.loader.ClaimKey(ev.Key) {
+		return false, timerheap.ErrDuplicateKey
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(eventsBucket)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		ev.ID = id
+		return b.Put(key(ev.Expire, id), ev.Data)
+	})
+	if err != nil {
+		if ev.Key != "" {
+			s.loader.ReleaseKey(ev.Key)
+		}
+		if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+			return false, timerheap.ErrTerminated
+		}
+		return false, err
+	}
+	return ev.Expire.Before(s.loaded), nil
+}
+
+// Delete removes an event from the database, recording its idempotency key if it has one.
+func (s *store) Delete(ev timerheap.StoredEvent, done time.Time) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if ev.Key != "" {
+			k := append(key(done, 0)[:8], ev.Key...)
+			if err := tx.Bucket(keysBucket).Put(k, nil); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(eventsBucket).Delete(key(ev.Expire, ev.ID))
+	})
+	if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+		// The heap has been terminated, so the event remains pending.
+		return nil
+	}
+	return err
+}
+
+// Close stops the loader and closes the database, after which pushes fail.
+func (s *store) Close() error {
+	close(s.exit)
+	<-s.stopped
+	return s.db.Close()
+}
+
+// restoreKeys claims the idempotency keys of the stored events, and remembers the keys of the
+// events that completed within the retention period.
+func (s *store) restoreKeys() error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		err := tx.Bucket(eventsBucket).ForEach(func(k, v []byte) error {
+			key, err := s.loader.Key(v)
+			if err != nil {
+				return err
+			}
+			if key != "" {
+				s.loader.ClaimKey(key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(keysBucket).ForEach(func(k, v []byte) error {
+			done := time.Unix(0, int64(binary.BigEndian.Uint64(k)))
+			s.loader.RememberKey(string(k[8:]), done)
+			return nil
+		})
+	})
+}
+
+// pruneKeys deletes the idempotency keys of the events that completed before the retention
+// period.
+func (s *store) pruneKeys() error {
+	end := key(time.Now().Add(-s.loader.KeyRetention()), 0)[:8]
+	var expired bool
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		k, _ := tx.Bucket(keysBucket).Cursor().First()
+		expired = k != nil && bytes.Compare(k[:8], end) < 0
+		return nil
+	}); err != nil || !expired {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(keysBucket).Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k[:8], end) < 0; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// advance moves the end of the window to the supplied time, returning the stored events that
+// are now within the window.
+func (s *store) advance(until time.Time) ([]timerheap.StoredEvent, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !until.After(s.loaded) {
+		return nil, nil
+	}
+
+	var events []timerheap.StoredEvent
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(eventsBucket).Cursor()
+		k, v := c.First()
+		if !s.loaded.IsZero() {
+			k, v = c.Seek(key(s.loaded, 0))
+		}
+		end := key(until, 0)
+		for ; k != nil && bytes.Compare(k, end) < 0; k, v = c.Next() {
+			events = append(events, timerheap.StoredEvent{
+				ID:     binary.BigEndian.Uint64(k[8:]),
+				Expire: time.Unix(0, int64(binary.BigEndian.Uint64(k))),
+				// The value is only valid for the life of the transaction.
+				Data: append([]byte(nil), v...),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.loaded = until
+	return events, nil
+}
+
+// load pushes the stored events that have come within the window to the heap.
+func (s *store) load() {
+	events, err := s.advance(time.Now().Add(s.window))
+	if err != nil {
+		s.loader.Fault("failed to load stored events", err)
+		return
+	}
+	// The events are pushed without holding the store lock, since a push may block waiting for
+	// events to be delivered, and deliveries delete the events from the store.
+	for _, ev := range events {
+		s.loader.Load(ev)
+	}
+}
+
+// run loads the stored events every half window until the store is closed.
+func (s *store) run() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(s.window / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.load()
+			if err := s.pruneKeys(); err != nil {
+				s.loader.Fault("failed to prune stored keys", err)
+			}
+		case <-s.exit:
+			return
+		}
+	}
+}
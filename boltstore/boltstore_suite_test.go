@@ -0,0 +1,13 @@
+package boltstore_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestBoltStore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "boltstore suite")
+}
@@ -0,0 +1,147 @@
+package boltstore_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+	"github.com/robbrockbank/timerheap/boltstore"
+)
+
+// retry is the type of the values pushed to the heaps.
+type retry struct {
+	ID      string
+	Attempt int
+}
+
+var _ = Describe("Bolt-backed heap", func() {
+	var dir, path string
+	var registry *timerheap.TypeRegistry
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "timerheap")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "events.db")
+		registry = timerheap.NewTypeRegistry()
+		Expect(registry.Register("retry", retry{}, nil)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	open := func(window time.Duration) timerheap.TimerHeap {
+		th, err := boltstore.New(path, window, timerheap.WithTypeRegistry(registry, true))
+		Expect(err).NotTo(HaveOccurred())
+		return th
+	}
+
+	It("only holds the events within the window in memory", func() {
+		th := open(100 * time.Millisecond)
+		defer th.Terminate()
+		Expect(th.PushEvent(10*time.Millisecond, retry{ID: "near"})).To(Succeed())
+		Expect(th.PushEvent(300*time.Millisecond, retry{ID: "far"})).To(Succeed())
+		Expect(th.Stats().Pending).To(Equal(1))
+
+		Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(Equal(retry{ID: "near"})))
+		Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(Equal(retry{ID: "far"})))
+	})
+
+	It("restores pending events after a restart", func() {
+		th := open(50 * time.Millisecond)
+		Expect(th.PushEvent(10*time.Millisecond, retry{ID: "delivered"})).To(Succeed())
+		Expect(th.PushEvent(20*time.Millisecond, retry{ID: "a"})).To(Succeed())
+		Expect(th.PushEvent(time.Hour, retry{ID: "b"})).To(Succeed())
+		Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(Equal(retry{ID: "delivered"})))
+		Eventually(func() uint64 { return th.Stats().Delivered }).Should(BeEquivalentTo(1))
+		th.Terminate()
+
+		By("reopening the database and checking only the due event is loaded")
+		th = open(50 * time.Millisecond)
+		defer th.Terminate()
+		Expect(th.Stats().Pending).To(Equal(1))
+		Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(Equal(retry{ID: "a"})))
+		Consistently(th.TimedEvent(), "100ms").ShouldNot(Receive())
+	})
+
+	It("deletes events that are dropped", func() {
+		th, err := boltstore.New(path, time.Minute,
+			timerheap.WithTypeRegistry(registry, true),
+			timerheap.WithMaxPending(1),
+			timerheap.WithOverflowPolicy(timerheap.OverflowDropFarthest),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(th.PushEvent(50*time.Millisecond, retry{ID: "a"})).To(Succeed())
+		Expect(th.PushEvent(40*time.Millisecond, retry{ID: "b"})).To(Succeed())
+		Expect(th.Stats().Dropped).To(BeEquivalentTo(1))
+		th.Terminate()
+
+		th = open(time.Minute)
+		defer th.Terminate()
+		Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(Equal(retry{ID: "b"})))
+		Consistently(th.TimedEvent(), "100ms").ShouldNot(Receive())
+	})
+
+	It("deletes events that are acknowledged", func() {
+		th, err := boltstore.New(path, time.Minute,
+			timerheap.WithTypeRegistry(registry, true),
+			timerheap.WithAck(50*time.Millisecond),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(th.PushEvent(0, retry{ID: "acked"})).To(Succeed())
+		// The redelivery is scheduled after the time the event was stored with.
+		var d *timerheap.Delivery
+		Eventually(th.TimedEvent(), "1s").Should(Receive(&d))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(&d))
+		Expect(d.Value).To(Equal(retry{ID: "acked"}))
+		Expect(d.Attempt).To(Equal(2))
+		Expect(d.Ack()).To(Succeed())
+		Eventually(th.Idle()).Should(BeClosed())
+		th.Terminate()
+
+		th = open(time.Minute)
+		defer th.Terminate()
+		Expect(th.Stats().Pending).To(BeZero())
+		Consistently(th.TimedEvent(), "100ms").ShouldNot(Receive())
+	})
+
+	It("remembers keys across a restart", func() {
+		th := open(time.Minute)
+		Expect(th.PushEvent(0, retry{ID: "a"}, timerheap.WithKey("a"))).To(Succeed())
+		Expect(th.PushEvent(time.Hour, retry{ID: "b"}, timerheap.WithKey("b"))).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(retry{ID: "a"})))
+		Eventually(func() uint64 { return th.Stats().Delivered }).Should(BeEquivalentTo(1))
+		th.Terminate()
+
+		By("pushing the events again after a restart")
+		th = open(time.Minute)
+		defer th.Terminate()
+		Expect(th.PushEvent(0, retry{ID: "a"}, timerheap.WithKey("a"))).To(Succeed())
+		Expect(th.PushEvent(0, retry{ID: "b"}, timerheap.WithKey("b"))).To(Succeed())
+		Expect(th.PushEvent(0, retry{ID: "c"}, timerheap.WithKey("c"))).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(retry{ID: "c"})))
+		Consistently(th.TimedEvent(), "50ms").ShouldNot(Receive())
+	})
+
+	It("does not support handles", func() {
+		th := open(time.Minute)
+		defer th.Terminate()
+		err := th.PushEvent(0, retry{ID: "a"}, timerheap.WithHandle(&timerheap.Handle{}))
+		Expect(err).To(MatchError(timerheap.ErrHandleUnsupported))
+	})
+
+	It("requires a type registry", func() {
+		_, err := boltstore.New(path, time.Minute)
+		Expect(err).To(Equal(timerheap.ErrNoTypeRegistry))
+	})
+
+	It("requires a positive window", func() {
+		_, err := boltstore.New(path, 0, timerheap.WithTypeRegistry(registry, true))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,17 @@
+package timerheap
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// bootTime returns the time since boot including time spent suspended, which the monotonic clock
+// used by the time package excludes.
+func bootTime() (time.Duration, bool) {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_BOOTTIME, &ts); err != nil {
+		return 0, false
+	}
+	return time.Duration(ts.Nano()), true
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package timerheap
+
+import (
+	"time"
+)
+
+// bootTime is not available on this platform, so a suspend cannot be told apart from the wall
+// clock jumping forward.
+func bootTime() (time.Duration, bool) {
+	return 0, false
+}
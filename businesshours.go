@@ -0,0 +1,97 @@
+package timerheap
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BusinessHours is a weekly calendar of opening hours in a location, used to keep events from
+// popping out of hours, see WithinBusinessHours.
+type BusinessHours struct {
+	lock sync.RWMutex
+	zone ZoneSource
+	// days holds the opening hours of each day of the week, in order of opening time.
+	days [7][]openHours
+}
+
+// openHours is a period of a day during which the business is open, as wall clock times since
+// midnight.
+type openHours struct {
+	open, close time.Duration
+}
+
+// NewBusinessHours returns a calendar in the location with no opening hours. A nil location is
+// treated as UTC.
+func NewBusinessHours(loc *time.Location) *BusinessHours {
+	return NewBusinessHoursIn(FixedZone(loc))
+}
+
+// NewBusinessHoursIn returns a calendar with no opening hours in the location given by the
+// source, which is looked up each time the next opening is computed, see ZoneSource.
+func NewBusinessHoursIn(zone ZoneSource) *BusinessHours {
+	return &BusinessHours{zone: zone}
+}
+
+// Add opens the business on the day of the week from open until close, given as times on the
+// wall clock since midnight, for example 9*time.Hour and 17*time.Hour. A day may have several
+// periods of opening hours, which must not overlap.
+func (b *BusinessHours) Add(day time.Weekday, open, close time.Duration) error {
+	if day < time.Sunday || day > time.Saturday {
+		return fmt.Errorf("timerheap: invalid day of the week %d", day)
+	}
+	if open < 0 || close > 24*time.Hour || open >= close {
+		return fmt.Errorf("timerheap: invalid opening hours %s to %s", open, close)
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	hours := b.days[day]
+	for _, h := range hours {
+		if open < h.close && h.open < close {
+			return fmt.Errorf("timerheap: opening hours %s to %s overlap %s to %s on %s", open, close, h.open, h.close, day)
+		}
+	}
+	hours = append(hours, openHours{open: open, close: close})
+	sort.Slice(hours, func(i, j int) bool {
+		return hours[i].open < hours[j].open
+	})
+	b.days[day] = hours
+	return nil
+}
+
+// Next returns the time itself if it is within the opening hours, or otherwise the next time
+// the business opens. It returns the zero time if there are no opening hours.
+func (b *BusinessHours) Next(tm time.Time) time.Time {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	loc := zoneLocation(b.zone)
+	y, m, d := tm.In(loc).Date()
+	// A week on from the day of the time, the opening hours of that day come round again.
+	for i := 0; i <= 7; i++ {
+		day := time.Date(y, m, d+i, 0, 0, 0, 0, loc).Weekday()
+		for _, h := range b.days[day] {
+			if !tm.Before(wallClock(y, m, d+i, h.close, loc)) {
+				continue
+			}
+			if open := wallClock(y, m, d+i, h.open, loc); tm.Before(open) {
+				return open
+			}
+			return tm
+		}
+	}
+	return time.Time{}
+}
+
+// WithinBusinessHours moves an event that would pop outside the opening hours of the calendar
+// to pop when the business next opens. The not-after time of the event is not moved, so an
+// event whose window for delivery falls outside the opening hours is discarded. If the calendar
+// has no opening hours the event is not moved.
+func WithinBusinessHours(b *BusinessHours) PushOption {
+	return func(ti *timedItem) {
+		if next := b.Next(ti.expire); !next.IsZero() {
+			ti.expire = next
+		}
+	}
+}
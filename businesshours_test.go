@@ -0,0 +1,76 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("BusinessHours", func() {
+	var loc *time.Location
+	var hours *timerheap.BusinessHours
+
+	// at returns a time in March 2024, when the 4th is a Monday.
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2024, 3, day, hour, min, 0, 0, loc)
+	}
+
+	BeforeEach(func() {
+		loc = time.FixedZone("test", -5*60*60)
+		hours = timerheap.NewBusinessHours(loc)
+		for day := time.Monday; day <= time.Friday; day++ {
+			Expect(hours.Add(day, 9*time.Hour, 12*time.Hour)).To(Succeed())
+			Expect(hours.Add(day, 13*time.Hour, 17*time.Hour)).To(Succeed())
+		}
+	})
+
+	It("moves times outside the opening hours to the next opening", func() {
+		Expect(hours.Next(at(4, 10, 0))).To(Equal(at(4, 10, 0)))
+		Expect(hours.Next(at(4, 3, 0))).To(Equal(at(4, 9, 0)))
+		Expect(hours.Next(at(4, 12, 30))).To(Equal(at(4, 13, 0)))
+		Expect(hours.Next(at(4, 17, 0))).To(Equal(at(5, 9, 0)))
+		Expect(hours.Next(at(8, 18, 0))).To(Equal(at(11, 9, 0)))
+		Expect(hours.Next(at(9, 12, 0))).To(Equal(at(11, 9, 0)))
+		Expect(hours.Next(at(4, 8, 0).UTC())).To(BeTemporally("==", at(4, 9, 0)))
+	})
+
+	It("rejects invalid opening hours", func() {
+		Expect(hours.Add(time.Monday, 11*time.Hour, 14*time.Hour)).To(HaveOccurred())
+		Expect(hours.Add(time.Saturday, 14*time.Hour, 11*time.Hour)).To(HaveOccurred())
+		Expect(hours.Add(time.Saturday, 0, 25*time.Hour)).To(HaveOccurred())
+		Expect(hours.Add(time.Weekday(7), 0, time.Hour)).To(HaveOccurred())
+	})
+
+	It("returns the zero time with no opening hours", func() {
+		Expect(timerheap.NewBusinessHours(loc).Next(at(4, 10, 0))).To(BeZero())
+	})
+
+	It("treats a nil location as UTC", func() {
+		utc := timerheap.NewBusinessHours(nil)
+		Expect(utc.Add(time.Monday, 9*time.Hour, 17*time.Hour)).To(Succeed())
+		Expect(utc.Next(time.Date(2024, 3, 4, 3, 0, 0, 0, time.UTC))).To(Equal(time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)))
+	})
+
+	It("keeps the opening time on the wall clock when the clocks change", func() {
+		ny, err := time.LoadLocation("America/New_York")
+		if err != nil {
+			Skip("time zone database is not available")
+		}
+		sundays := timerheap.NewBusinessHours(ny)
+		Expect(sundays.Add(time.Sunday, 9*time.Hour, 17*time.Hour)).To(Succeed())
+		// The clocks went forward at 2am on Sunday 10 March 2024.
+		Expect(sundays.Next(time.Date(2024, 3, 10, 0, 30, 0, 0, ny))).To(Equal(time.Date(2024, 3, 10, 9, 0, 0, 0, ny)))
+	})
+
+	It("delays pushed events until the next opening", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		Expect(th.PushEventAt(at(9, 3, 0), "a", timerheap.WithinBusinessHours(hours))).To(Succeed())
+		events := th.Snapshot()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].ScheduledAt).To(BeTemporally("==", at(11, 9, 0)))
+	})
+})
@@ -0,0 +1,72 @@
+package timerheap
+
+// NewChild creates a heap that is a child of this heap. The child inherits the delivery mode,
+// middleware, hooks, logger, late delivery and panic handlers, type registry, latency histogram
+// bounds and dispatcher of the parent, any of which may be overridden with the supplied
+// options. Middleware added to the child runs inside that of the parent. The child has its own
+// results channel.
+//
+// Terminating the parent terminates all of its children, and the Stats of the parent include
+// the stats of its children. A child may be terminated independently of its parent. A child
+// created once the parent has been terminated is returned already terminated.
+func (t *timerHeap) NewChild(opts ...Option) TimerHeap {
+	c := newTimerHeap()
+	c.parent = t
+	c.timedResults = t.timedResults
+	c.sequenced = t.sequenced
+	// The slice is capped so that middleware added to the child is not added to the parent.
+	c.middleware = t.middleware[:len(t.middleware):len(t.middleware)]
+	c.log = t.log
+	c.lateThreshold = t.lateThreshold
+	c.lateHandler = t.lateHandler
+	c.hooks = t.hooks
+	c.panicHandler = t.panicHandler
+	c.types = t.types
+	c.strictTypes = t.strictTypes
+	c.dispatcher = t.dispatcher
+	if t.latency != nil {
+		c.latency = newLatencyHistogram(t.latency.Bounds)
+	}
+	c.start(opts)
+
+	// The parent is terminated after it is marked as terminated, under the lock, so a child
+	// added before then is terminated along with it.
+	t.lock.Lock()
+	terminated := t.terminated
+	if !terminated {
+		t.children[c] = struct{}{}
+	}
+	t.lock.Unlock()
+	if terminated {
+		c.Terminate()
+	}
+	return c
+}
+
+// childList returns the current children. The caller must hold the lock.
+func (t *timerHeap) childList() []*timerHeap {
+	if len(t.children) == 0 {
+		return nil
+	}
+	children := make([]*timerHeap, 0, len(t.children))
+	for c := range t.children {
+		children = append(children, c)
+	}
+	return children
+}
+
+// takeChildren removes and returns all of the children.
+func (t *timerHeap) takeChildren() []*timerHeap {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	children := t.childList()
+	t.children = map[*timerHeap]struct{}{}
+	return children
+}
+
+// removeChild removes a terminated child.
+func (t *timerHeap) removeChild(c *timerHeap) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.children, c)
+}
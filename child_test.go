@@ -0,0 +1,99 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("timer heap child tests", func() {
+
+	var th timerheap.TimerHeap
+
+	BeforeEach(func() {
+		th = timerheap.New(timerheap.WithTimedResults())
+	})
+
+	It("delivers child events on the child results channel", func() {
+		defer th.Terminate()
+		var value interface{}
+
+		By("creating a child that inherits the parent options")
+		c := th.NewChild()
+		Expect(c.PushEvent(0, 1)).To(Succeed())
+
+		By("Checking the event is delivered by the child")
+		Eventually(c.TimedEvent(), "1s", "10ms").Should(Receive(&value))
+		r, ok := value.(timerheap.TimedResult)
+		Expect(ok).To(BeTrue())
+		Expect(r.Value).To(Equal(1))
+		Consistently(th.TimedEvent(), "100ms", "10ms").ShouldNot(Receive())
+	})
+
+	It("aggregates stats from children and grandchildren", func() {
+		defer th.Terminate()
+
+		By("creating a child and a grandchild")
+		c := th.NewChild()
+		gc := c.NewChild()
+		now := time.Now()
+		Expect(th.PushEventAt(now.Add(3*time.Hour), 1)).To(Succeed())
+		Expect(c.PushEventAt(now.Add(2*time.Hour), 2)).To(Succeed())
+		Expect(gc.PushEventAt(now.Add(time.Hour), 3)).To(Succeed())
+		Expect(gc.PushEventAt(now.Add(4*time.Hour), 4)).To(Succeed())
+
+		By("Checking the stats at each level")
+		s := th.Stats()
+		Expect(s.Pending).To(Equal(4))
+		Expect(s.Pushed).To(Equal(uint64(4)))
+		Expect(s.NextFire).To(Equal(now.Add(time.Hour)))
+		s = c.Stats()
+		Expect(s.Pending).To(Equal(3))
+		Expect(s.NextFire).To(Equal(now.Add(time.Hour)))
+		Expect(gc.Stats().Pending).To(Equal(2))
+
+		By("Terminating the grandchild and checking it is removed from the stats")
+		gc.Terminate()
+		Expect(th.Stats().Pending).To(Equal(2))
+		Expect(th.Stats().NextFire).To(Equal(now.Add(2 * time.Hour)))
+	})
+
+	It("terminates children when the parent is terminated", func() {
+		By("creating a child and a grandchild")
+		c := th.NewChild()
+		gc := c.NewChild()
+
+		By("Terminating the parent")
+		th.Terminate()
+
+		By("Checking the child results channels are closed")
+		Eventually(c.TimedEvent()).Should(BeClosed())
+		Eventually(gc.TimedEvent()).Should(BeClosed())
+
+		By("Checking a repeated terminate is ignored")
+		c.Terminate()
+		th.Terminate()
+	})
+
+	It("terminates children created while the parent terminates", func() {
+		By("creating children concurrently with terminating the parent")
+		children := make(chan timerheap.TimerHeap, 20)
+		go func() {
+			defer GinkgoRecover()
+			defer close(children)
+			for i := 0; i < 20; i++ {
+				children <- th.NewChild()
+			}
+		}()
+		th.Terminate()
+
+		By("Checking every child is terminated")
+		for c := range children {
+			Eventually(c.TimedEvent()).Should(BeClosed())
+			Expect(c.PushEvent(0, 1)).To(MatchError(timerheap.ErrTerminated))
+		}
+		Expect(th.NewChild().PushEvent(0, 1)).To(MatchError(timerheap.ErrTerminated))
+	})
+})
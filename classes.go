@@ -0,0 +1,229 @@
+package timerheap
+
+import (
+	"time"
+)
+
+// classedBackend is the backend of a heap once items with priority classes have been pushed. It
+// holds the items of each priority class in a backend of their own, so that the most urgent of
+// the expired items, the first to pop in the highest class with an expired item, is found at
+// the top of one of them rather than by searching every expired item. The other operations
+// combine the results of each class, at a cost proportional to the number of classes, which is
+// expected to be small.
+type classedBackend struct {
+	backendType BackendType
+	// classes holds the backend of each priority class that has had items, highest class first.
+	// A class is kept once it is empty, since items of the same class are likely to be pushed
+	// again.
+	classes []priorityClass
+}
+
+// priorityClass is the backend holding the items of a priority class.
+type priorityClass struct {
+	priority int
+	backend
+}
+
+// newClassedBackend returns a classed backend holding the items of h, with the items of each
+// class held in a backend of the type.
+func newClassedBackend(h backend, b BackendType) *classedBackend {
+	c := &classedBackend{backendType: b}
+	c.pushAll(h.appendTo(nil))
+	return c
+}
+
+// class returns the backend of the priority class, adding it if there is none.
+func (c *classedBackend) class(priority int) backend {
+	i := 0
+	for i < len(c.classes) && c.classes[i].priority > priority {
+		i++
+	}
+	if i == len(c.classes) || c.classes[i].priority != priority {
+		c.classes = append(c.classes, priorityClass{})
+		copy(c.classes[i+1:], c.classes[i:])
+		c.classes[i] = priorityClass{priority: priority, backend: newBackend(c.backendType)}
+	}
+	return c.classes[i].backend
+}
+
+// next returns the class whose top item pops first, or nil if there are no items.
+func (c *classedBackend) next() backend {
+	var next backend
+	var top *timedItem
+	for _, pc := range c.classes {
+		if ti := pc.peek(); ti != nil && (top == nil || ti.before(top)) {
+			next, top = pc.backend, ti
+		}
+	}
+	return next
+}
+
+// farthest returns the class whose farthest item pops last, or nil if there are no items.
+func (c *classedBackend) farthest() backend {
+	var farthest backend
+	var far *timedItem
+	for _, pc := range c.classes {
+		if ti := pc.peekFarthest(); ti != nil && (far == nil || far.before(ti)) {
+			farthest, far = pc.backend, ti
+		}
+	}
+	return farthest
+}
+
+// handleClass returns the class holding the item tracked by the handle and the item, or nil if
+// no class holds it. The classes hold backends of the same type, so the item found by each is
+// checked to be of its class.
+func (c *classedBackend) handleClass(hd *Handle) (backend, *timedItem) {
+	for _, pc := range c.classes {
+		if ti := pc.lookup(hd); ti != nil && ti.priority == pc.priority {
+			return pc.backend, ti
+		}
+	}
+	return nil, nil
+}
+
+// popMostUrgent removes and returns the most urgent of the items that have expired by now, the
+// first to pop in the highest class with an expired item. At least one item must have expired.
+func (c *classedBackend) popMostUrgent(now time.Time) timedItem {
+	for _, pc := range c.classes {
+		if ti := pc.peek(); ti != nil && !ti.expire.After(now) {
+			return pc.pop()
+		}
+	}
+	panic("timerheap: no expired items")
+}
+
+func (c *classedBackend) Len() int {
+	n := 0
+	for _, pc := range c.classes {
+		n += pc.Len()
+	}
+	return n
+}
+
+func (c *classedBackend) push(ti timedItem) {
+	c.class(ti.priority).push(ti)
+}
+
+func (c *classedBackend) pushAll(items []timedItem) {
+	for i := range items {
+		if items[i].priority != items[0].priority {
+			for _, ti := range items {
+				c.push(ti)
+			}
+			return
+		}
+	}
+	if len(items) > 0 {
+		c.class(items[0].priority).pushAll(items)
+	}
+}
+
+func (c *classedBackend) peek() *timedItem {
+	if next := c.next(); next != nil {
+		return next.peek()
+	}
+	return nil
+}
+
+func (c *classedBackend) pop() timedItem {
+	return c.next().pop()
+}
+
+func (c *classedBackend) peekFarthest() *timedItem {
+	if farthest := c.farthest(); farthest != nil {
+		return farthest.peekFarthest()
+	}
+	return nil
+}
+
+func (c *classedBackend) popFarthest() timedItem {
+	return c.farthest().popFarthest()
+}
+
+func (c *classedBackend) removeWhere(match func(ti *timedItem) bool) (timedItem, bool) {
+	for _, pc := range c.classes {
+		if ti, ok := pc.removeWhere(match); ok {
+			return ti, true
+		}
+	}
+	return timedItem{}, false
+}
+
+func (c *classedBackend) removeAll(match func(ti *timedItem) bool, dst []timedItem) []timedItem {
+	for _, pc := range c.classes {
+		dst = pc.removeAll(match, dst)
+	}
+	return dst
+}
+
+func (c *classedBackend) first(match func(ti *timedItem) bool) *timedItem {
+	var found *timedItem
+	for _, pc := range c.classes {
+		if ti := pc.first(match); ti != nil && (found == nil || ti.before(found)) {
+			found = ti
+		}
+	}
+	return found
+}
+
+func (c *classedBackend) appendTo(dst []timedItem) []timedItem {
+	for _, pc := range c.classes {
+		dst = pc.appendTo(dst)
+	}
+	return dst
+}
+
+func (c *classedBackend) shift(d time.Duration) {
+	for _, pc := range c.classes {
+		pc.shift(d)
+	}
+}
+
+func (c *classedBackend) deadline(best time.Time) time.Time {
+	for _, pc := range c.classes {
+		best = pc.deadline(best)
+	}
+	return best
+}
+
+func (c *classedBackend) grow(n int) {
+	// The room is preallocated for the default class, which most items are expected to be in.
+	c.class(0).grow(n)
+}
+
+func (c *classedBackend) shrink(min int) {
+	for _, pc := range c.classes {
+		if pc.priority == 0 {
+			pc.shrink(min)
+		} else {
+			pc.shrink(0)
+		}
+	}
+}
+
+func (c *classedBackend) footprint() (int, uintptr) {
+	var capacity int
+	var bytes uintptr
+	for _, pc := range c.classes {
+		n, b := pc.footprint()
+		capacity += n
+		bytes += b
+	}
+	return capacity, bytes
+}
+
+func (c *classedBackend) lookup(hd *Handle) *timedItem {
+	_, ti := c.handleClass(hd)
+	return ti
+}
+
+func (c *classedBackend) removeHandle(hd *Handle) timedItem {
+	class, _ := c.handleClass(hd)
+	return class.removeHandle(hd)
+}
+
+func (c *classedBackend) rescheduleHandle(hd *Handle, expire time.Time) {
+	class, _ := c.handleClass(hd)
+	class.rescheduleHandle(hd, expire)
+}
@@ -0,0 +1,108 @@
+package timerheap
+
+import (
+	"math/rand"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Classed backend", func() {
+	var base time.Time
+
+	at := func(i int) time.Time {
+		return base.Add(time.Duration(i) * time.Second)
+	}
+
+	// fill returns a classed backend holding 300 items, spread across three priority classes,
+	// with a handle for each item.
+	fill := func(b BackendType) (*classedBackend, []*Handle) {
+		h := newBackend(b)
+		handles := make([]*Handle, 300)
+		for i, n := range rand.Perm(300) {
+			handles[i] = &Handle{}
+			h.push(timedItem{expire: at(n), seq: uint64(i), priority: n % 3, handle: handles[i]})
+		}
+		return newClassedBackend(h, b), handles
+	}
+
+	BeforeEach(func() {
+		base = time.Now()
+	})
+
+	for _, b := range []BackendType{BinaryHeap, QuaternaryHeap, PairingHeap, MinMaxHeap} {
+		b := b
+
+		It("pops the expired items of the highest class first with the "+b.String()+" backend", func() {
+			c, _ := fill(b)
+			Expect(c.Len()).To(Equal(300))
+			Expect(c.peek().expire).To(Equal(at(0)))
+			Expect(c.peekFarthest().expire).To(Equal(at(299)))
+
+			// Of the 150 expired items, those of class 2 pop first, then class 1, then class 0,
+			// each in the order they expired.
+			var last *timedItem
+			for i := 0; i < 150; i++ {
+				ti := c.popMostUrgent(at(149))
+				Expect(ti.expire.After(at(149))).To(BeFalse())
+				if last != nil {
+					Expect(ti.priority).To(BeNumerically("<=", last.priority))
+					if ti.priority == last.priority {
+						Expect(ti.before(last)).To(BeFalse())
+					}
+				}
+				last = &ti
+			}
+			Expect(c.peek().expire).To(Equal(at(150)))
+			for i := 150; i < 300; i++ {
+				Expect(c.pop().expire).To(Equal(at(i)))
+			}
+			Expect(c.Len()).To(BeZero())
+			Expect(c.peek()).To(BeNil())
+		})
+
+		It("finds, removes and reschedules items by handle with the "+b.String()+" backend", func() {
+			c, handles := fill(b)
+			for i, hd := range handles {
+				ti := c.lookup(hd)
+				Expect(ti).NotTo(BeNil())
+				Expect(ti.handle).To(BeIdenticalTo(hd))
+				switch i % 3 {
+				case 0:
+					Expect(c.removeHandle(hd).handle).To(BeIdenticalTo(hd))
+					Expect(c.lookup(hd)).To(BeNil())
+				case 1:
+					c.rescheduleHandle(hd, at(1000+i))
+				}
+			}
+			Expect(c.Len()).To(Equal(200))
+			Expect(c.peekFarthest().expire).To(Equal(at(1000 + 298)))
+
+			var last *timedItem
+			for c.Len() > 0 {
+				ti := c.pop()
+				if last != nil {
+					Expect(ti.before(last)).To(BeFalse())
+				}
+				last = &ti
+			}
+		})
+	}
+
+	It("takes over the items of the backend it replaces", func() {
+		h := newBackend(BinaryHeap)
+		h.push(timedItem{expire: at(2), seq: 0})
+		h.push(timedItem{expire: at(1), seq: 1, priority: 1})
+		c := newClassedBackend(h, BinaryHeap)
+		c.push(timedItem{expire: at(0), seq: 2, priority: -1})
+		Expect(c.classes).To(HaveLen(3))
+		Expect(c.deadline(at(10))).To(Equal(at(0)))
+		Expect(c.first(func(ti *timedItem) bool { return ti.priority >= 0 }).expire).To(Equal(at(1)))
+		Expect(c.appendTo(nil)).To(HaveLen(3))
+
+		removed := c.removeAll(func(ti *timedItem) bool { return ti.priority != 0 }, nil)
+		Expect(removed).To(HaveLen(2))
+		Expect(c.popMostUrgent(at(2)).seq).To(Equal(uint64(0)))
+	})
+})
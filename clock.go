@@ -0,0 +1,163 @@
+package timerheap
+
+import (
+	"time"
+)
+
+// ClockJumpPolicy determines how a heap handles a change to the wall clock, such as an NTP step
+// or a manual adjustment, see WithClockJumpPolicy.
+type ClockJumpPolicy int
+
+const (
+	// ClockJumpIgnore leaves the expiration times as they are. Events pushed with a duration
+	// hold their duration, while events pushed at a time without a monotonic clock reading,
+	// for example one parsed or loaded from storage, pop at that wall clock time, although a
+	// jump may not be noticed until the heap is next processed. This is the default.
+	ClockJumpIgnore ClockJumpPolicy = iota
+	// ClockJumpFollowWall makes every pending event pop at its wall clock time, so a jump
+	// forward pops the events that are now in the past, and a jump back delays the events.
+	ClockJumpFollowWall
+	// ClockJumpHoldDurations shifts every pending event by the size of the jump, so that
+	// events pop after the duration they were due in when the clock jumped.
+	ClockJumpHoldDurations
+)
+
+func (p ClockJumpPolicy) String() string {
+	switch p {
+	case ClockJumpIgnore:
+		return "ignore"
+	case ClockJumpFollowWall:
+		return "follow wall"
+	case ClockJumpHoldDurations:
+		return "hold durations"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	// clockCheckInterval is how often the wall clock is checked for jumps and suspends when a
+	// policy is set.
+	clockCheckInterval = time.Second
+	// defaultClockThreshold is the smallest jump handled if the threshold is not set.
+	defaultClockThreshold = time.Second
+)
+
+// WithClockJumpPolicy sets how the heap handles the wall clock jumping by at least threshold
+// relative to the monotonic clock, where a threshold of 0 means 1 second. The clock is checked
+// each time the heap is processed, and at least every second, and jumps are logged. The
+// expiration times of the events are held without monotonic clock readings, so that every event
+// is ordered by its wall clock time.
+//
+// The policy applies to the events held by the heap, events held in a Store until they are due
+// are loaded at their wall clock time.
+func WithClockJumpPolicy(policy ClockJumpPolicy, threshold time.Duration) Option {
+	return func(t *timerHeap) {
+		if threshold <= 0 {
+			threshold = defaultClockThreshold
+		}
+		t.clockPolicy = policy
+		t.clockThreshold = threshold
+	}
+}
+
+// stamp returns the time to hold as an expiration time, which is the wall clock time if a clock
+// jump, leap second or suspend policy is set.
+func (t *timerHeap) stamp(tm time.Time) time.Time {
+	if !t.checksClock() {
+		return tm
+	}
+	return tm.Round(0)
+}
+
+// checksClock returns true if the heap checks the wall clock, because a policy is set for clock
+// jumps, leap seconds or suspends.
+func (t *timerHeap) checksClock() bool {
+	return t.clockPolicy != ClockJumpIgnore || t.leapPolicy != LeapSecondAsJump || t.suspendPolicy != SuspendIgnore
+}
+
+// clock tracks the wall clock against the monotonic clock, to detect the wall clock jumping and
+// the system being suspended.
+type clock struct {
+	// mono is when the clock was last checked, with a monotonic clock reading, wall is the wall
+	// clock time it was last checked, and boot is the time since boot it was last checked, if
+	// hasBoot is set.
+	mono    time.Time
+	wall    time.Time
+	boot    time.Duration
+	hasBoot bool
+}
+
+// check returns how far the wall clock has moved relative to the monotonic clock since it was
+// last checked, and how long the system was suspended for in that time if that is known, and
+// records that it was checked now.
+func (c *clock) check(now time.Time) (jump, suspended time.Duration) {
+	wall := now.Round(0)
+	boot, hasBoot := bootTime()
+	if !c.mono.IsZero() {
+		mono := now.Sub(c.mono)
+		jump = wall.Sub(c.wall) - mono
+		if hasBoot && c.hasBoot {
+			suspended = boot - c.boot - mono
+		}
+	}
+	c.mono, c.wall, c.boot, c.hasBoot = now, wall, boot, hasBoot
+	return jump, suspended
+}
+
+// checkClockLocked checks for the wall clock jumping, and the system resuming from a suspend,
+// and handles them according to the policies. It returns the size of the jump and how long the
+// system was suspended for, each of which is 0 if it was below its threshold or there is no
+// policy for it, and whether the jump was handled as the step of a leap second. The caller must
+// hold the lock.
+func (t *timerHeap) checkClockLocked(now time.Time) (jump, suspended time.Duration, leap bool) {
+	jump, suspended = t.clock.check(now)
+	switch {
+	case t.suspendPolicy == SuspendIgnore:
+		// A suspend is handled as a jump of the wall clock.
+		suspended = 0
+	case !t.clock.hasBoot && jump > 0:
+		// A suspend cannot be told apart from a jump forward.
+		suspended = jump
+	}
+	if suspended < minSuspend {
+		suspended = 0
+	}
+	jump -= suspended
+	policy, threshold := t.clockPolicy, t.clockThreshold
+	if t.leapPolicy != LeapSecondAsJump && leapSecondStep(now, jump) {
+		policy, leap = t.leapPolicy.clockPolicy(), true
+		// A step of a second may be measured as slightly less.
+		if threshold > time.Second-leapSecondTolerance {
+			threshold = time.Second - leapSecondTolerance
+		}
+	}
+	if policy == ClockJumpIgnore || jump < threshold && -jump < threshold {
+		jump, leap = 0, false
+	}
+
+	if jump != 0 {
+		t.clockJumps++
+		if policy == ClockJumpHoldDurations {
+			t.valueHeap.shift(jump)
+			for i := range t.ready {
+				t.ready[i].shift(jump)
+			}
+		}
+	}
+	if suspended != 0 {
+		t.suspends++
+		if t.suspendPolicy == SuspendRespace {
+			t.respaceLocked(now)
+		}
+	}
+	return jump, suspended, leap
+}
+
+// shift moves the expiration and not-after times of the item by d.
+func (ti *timedItem) shift(d time.Duration) {
+	ti.expire = ti.expire.Add(d)
+	if !ti.notAfter.IsZero() {
+		ti.notAfter = ti.notAfter.Add(d)
+	}
+}
@@ -0,0 +1,96 @@
+package timerheap
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Clock jumps", func() {
+	// simulateJump makes the heap see the wall clock as having jumped by d the next time it
+	// is checked, by moving the wall clock time it was last checked at back by d.
+	simulateJump := func(t *timerHeap, d time.Duration) {
+		Eventually(func() bool {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			return !t.clock.mono.IsZero()
+		}).Should(BeTrue())
+		t.lock.Lock()
+		t.clock.wall = t.clock.wall.Add(-d)
+		t.lock.Unlock()
+		t.wake()
+	}
+
+	It("measures the wall clock against the monotonic clock", func() {
+		var c clock
+		jump := func() time.Duration {
+			d, _ := c.check(time.Now())
+			return d
+		}
+		Expect(jump()).To(BeZero())
+		Expect(jump()).To(BeNumerically("~", 0, time.Millisecond))
+		c.wall = c.wall.Add(-time.Hour)
+		Expect(jump()).To(BeNumerically("~", time.Hour, time.Millisecond))
+		c.wall = c.wall.Add(time.Minute)
+		Expect(jump()).To(BeNumerically("~", -time.Minute, time.Millisecond))
+	})
+
+	It("holds the durations of the pending events", func() {
+		th := New(WithClockJumpPolicy(ClockJumpHoldDurations, time.Second), WithTimedResults())
+		defer th.Terminate()
+		Expect(th.PushEvent(time.Hour, 1)).To(Succeed())
+		Expect(th.PushEvent(time.Hour+time.Millisecond, 2)).To(Succeed())
+
+		// The wall clock jumping back by almost an hour leaves the events due within that
+		// time, as measured by the wall clock.
+		simulateJump(th.(*timerHeap), -(time.Hour - 100*time.Millisecond))
+		var r TimedResult
+		Eventually(th.TimedEvent(), "1s").Should(Receive(&r))
+		Expect(r.Value).To(Equal(1))
+		Expect(r.ScheduledAt.Sub(time.Now())).To(BeNumerically("<", time.Second))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(&r))
+		Expect(r.Value).To(Equal(2))
+		Expect(th.Stats().ClockJumps).To(Equal(uint64(1)))
+	})
+
+	It("deletes the stored events it has held the durations of", func() {
+		th, s := newMemStoreHeap(WithClockJumpPolicy(ClockJumpHoldDurations, time.Second))
+		defer th.Terminate()
+		Expect(th.PushEvent(time.Hour, 1)).To(Succeed())
+
+		simulateJump(th, -(time.Hour - 100*time.Millisecond))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		Eventually(s.stored).Should(BeZero())
+	})
+
+	It("leaves the events at their wall clock times", func() {
+		th := New(WithClockJumpPolicy(ClockJumpFollowWall, time.Second))
+		defer th.Terminate()
+		Expect(th.PushEvent(200*time.Millisecond, 1)).To(Succeed())
+		simulateJump(th.(*timerHeap), -time.Hour)
+		Consistently(th.TimedEvent(), "100ms").ShouldNot(Receive())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		Expect(th.Stats().ClockJumps).To(Equal(uint64(1)))
+	})
+
+	It("ignores changes below the threshold", func() {
+		th := New(WithClockJumpPolicy(ClockJumpHoldDurations, time.Second))
+		defer th.Terminate()
+		Expect(th.PushEvent(200*time.Millisecond, 1)).To(Succeed())
+		simulateJump(th.(*timerHeap), -500*time.Millisecond)
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		Expect(th.Stats().ClockJumps).To(BeZero())
+	})
+
+	It("holds events without monotonic clock readings", func() {
+		th := New(WithClockJumpPolicy(ClockJumpFollowWall, time.Second)).(*timerHeap)
+		defer th.Terminate()
+		Expect(th.PushEvent(time.Hour, 1)).To(Succeed())
+		th.lock.Lock()
+		th.drainPushedLocked()
+		expire := th.valueHeap.peek().expire
+		th.lock.Unlock()
+		Expect(expire).To(Equal(expire.Round(0)))
+	})
+})
@@ -0,0 +1,233 @@
+// Package cluster shares the events of a timerheap.TimerHeap between replicas through etcd. Events
+// may be pushed to any replica, but only the replica elected leader holds them in memory and
+// delivers them.
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+const (
+	// sessionTTL is the TTL in seconds of the lease held by the leader. If the leader stops
+	// renewing it, another replica takes over once it expires.
+	sessionTTL = 10
+	// retry is how long a replica waits before campaigning again after an error.
+	retry = time.Second
+)
+
+// errLeadershipLost is returned when the session of the leader expires.
+var errLeadershipLost = errors.New("cluster: leadership lost")
+
+// store holds the events of a clustered heap in etcd.
+type store struct {
+	client *clientv3.Client
+	prefix string
+	loader timerheap.Loader
+	// ctx is cancelled when the heap is terminated, which stops the campaign goroutine, which
+	// closes stopped once it has returned.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped chan struct{}
+	// lock protects election, which is set while this replica is the leader.
+	lock     sync.Mutex
+	election *concurrency.Election
+}
+
+// New creates a heap whose pending events are stored in etcd under the key prefix, and shared by
+// every replica created with the same prefix. Events may be pushed to any replica, but only the
+// replica elected leader holds them in memory and delivers them, on its results channel. If the
+// leader fails, another replica is elected within the session TTL of ten seconds and takes over
+// the pending events. The heap must be configured with a TypeRegistry, see
+// timerheap.NewWithStore.
+//
+// Events are deleted from etcd by the leader once they have been delivered, dropped or
+// discarded. Delivery is at least once: an event delivered by a leader just as it loses the
+// leadership may be delivered again by the next leader. Events pending when a replica is
+// terminated remain in etcd. Stats, Idle, Flush, Save and MarshalJSON only cover the events
+// held by the replica, which has none unless it is the leader.
+func New(client *clientv3.Client, prefix string, opts ...timerheap.Option) (timerheap.TimerHeap, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &store{
+		client:  client,
+		prefix:  strings.TrimSuffix(prefix, "/"),
+		ctx:     ctx,
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+	}
+	th, err := timerheap.NewWithStore(s, opts...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return th, nil
+}
+
+// key returns the key of an event, which orders the events by expiration.
+func (s *store) key(expire time.Time, id uint64) string {
+	nanos := expire.UnixNano()
+	if nanos < 0 {
+		nanos = 0
+	}
+	return fmt.Sprintf("%s/events/%016x/%016x", s.prefix, nanos, id)
+}
+
+// Start campaigns for the leadership until the heap is terminated.
+func (s *store) Start(l timerheap.Loader) error {
+	s.loader = l
+	go s.run()
+	return nil
+}
+
+// Put stores a pushed event in etcd, from where the leader loads it. Its key is claimed by the
+// leader when it loads it, so it is never held by the heap it is pushed to.
+func (s *store) Put(ev *timerheap.StoredEvent) (bool, error) {
+	for ev.ID == 0 {
+		ev.ID = rand.Uint64()
+	}
+	_, err := s.client.Put(s.ctx, s.key(ev.Expire, ev.ID), string(ev.Data))
+	if s.ctx.Err() != nil {
+		return false, timerheap.ErrTerminated
+	}
+	return false, err
+}
+
+// Delete removes an event from etcd, provided this replica is still the leader. Otherwise the
+// event is left for the new leader.
+func (s *store) Delete(ev timerheap.StoredEvent, done time.Time) error {
+	s.lock.Lock()
+	e := s.election
+	s.lock.Unlock()
+	if e == nil {
+		return nil
+	}
+	_, err := s.client.Txn(s.ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(e.Key()), "=", e.Rev())).
+		Then(clientv3.OpDelete(s.key(ev.Expire, ev.ID))).
+		Commit()
+	if s.ctx.Err() != nil {
+		// The heap has been terminated, so the event remains pending.
+		return nil
+	}
+	return err
+}
+
+// Close stops campaigning, resigning the leadership if this replica holds it.
+func (s *store) Close() error {
+	s.cancel()
+	<-s.stopped
+	return nil
+}
+
+// run campaigns for the leadership until the heap is terminated.
+func (s *store) run() {
+	defer close(s.stopped)
+	for {
+		err := s.lead()
+		if s.ctx.Err() != nil {
+			return
+		}
+		s.loader.Logger().Warn("Not leading cluster, campaigning again", "error", err)
+		select {
+		case <-time.After(retry):
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// lead waits to be elected leader, then loads the pending events from etcd and watches for
+// events pushed to other replicas, until the leadership is lost.
+func (s *store) lead() error {
+	// The session is not bound to the context of the heap, so that it can still revoke its
+	// lease when it is closed once the heap is terminated, handing over to the next leader.
+	session, err := concurrency.NewSession(s.client, concurrency.WithTTL(sessionTTL))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	election := concurrency.NewElection(session, s.prefix+"/leader")
+	if err := election.Campaign(s.ctx, ""); err != nil {
+		return err
+	}
+	s.loader.Logger().Debug("Elected cluster leader", "prefix", s.prefix)
+	s.lock.Lock()
+	s.election = election
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		s.election = nil
+		s.lock.Unlock()
+		s.loader.Discard()
+	}()
+
+	events := s.prefix + "/events/"
+	resp, err := s.client.Get(s.ctx, events, clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+	for _, kv := range resp.Kvs {
+		s.load(string(kv.Key), kv.Value)
+	}
+	watch := s.client.Watch(s.ctx, events, clientv3.WithPrefix(),
+		clientv3.WithRev(resp.Header.Revision+1), clientv3.WithFilterDelete())
+	for {
+		select {
+		case <-session.Done():
+			return errLeadershipLost
+		case wr, ok := <-watch:
+			if !ok {
+				return s.ctx.Err()
+			}
+			if err := wr.Err(); err != nil {
+				return err
+			}
+			for _, ev := range wr.Events {
+				if ev.IsCreate() {
+					s.load(string(ev.Kv.Key), ev.Kv.Value)
+				}
+			}
+		}
+	}
+}
+
+// load pushes an event loaded from etcd to the heap, claiming its key. Events that cannot be
+// decoded are reported and left in etcd, and events whose key is pending or completed recently
+// are deleted.
+func (s *store) load(key string, value []byte) {
+	parts := strings.Split(key, "/")
+	var ev timerheap.StoredEvent
+	nanos, err := strconv.ParseUint(parts[len(parts)-2], 16, 64)
+	if err == nil {
+		ev.ID, err = strconv.ParseUint(parts[len(parts)-1], 16, 64)
+	}
+	var claim string
+	if err == nil {
+		claim, err = s.loader.Key(value)
+	}
+	if err != nil {
+		s.loader.Fault(fmt.Sprintf("failed to load clustered event %s", key), err)
+		return
+	}
+	ev.Expire = time.Unix(0, int64(nanos))
+	ev.Data = value
+	if claim != "" && !s.loader.ClaimKey(claim) {
+		// The event duplicates one that is pending or completed recently.
+		if err := s.Delete(ev, time.Now()); err != nil {
+			s.loader.Fault(fmt.Sprintf("failed to delete duplicate clustered event %s", key), err)
+		}
+		return
+	}
+	s.loader.Load(ev)
+}
@@ -0,0 +1,135 @@
+package cluster_test
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+
+	"github.com/robbrockbank/timerheap"
+	"github.com/robbrockbank/timerheap/cluster"
+)
+
+// retry is the type of the values pushed to the heaps.
+type retry struct {
+	ID      string
+	Attempt int
+}
+
+// freeURL returns a URL for a local port that is not in use.
+func freeURL() url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	defer l.Close()
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+var _ = Describe("Clustered heap", func() {
+	var dir string
+	var etcd *embed.Etcd
+	var client *clientv3.Client
+	var registry *timerheap.TypeRegistry
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "timerheap")
+		Expect(err).NotTo(HaveOccurred())
+		cfg := embed.NewConfig()
+		cfg.Dir = dir
+		cfg.LogLevel = "error"
+		clientURL, peerURL := freeURL(), freeURL()
+		cfg.ListenClientUrls = []url.URL{clientURL}
+		cfg.AdvertiseClientUrls = []url.URL{clientURL}
+		cfg.ListenPeerUrls = []url.URL{peerURL}
+		cfg.AdvertisePeerUrls = []url.URL{peerURL}
+		cfg.InitialCluster = fmt.Sprintf("%s=%s", cfg.Name, peerURL.String())
+		etcd, err = embed.StartEtcd(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(etcd.Server.ReadyNotify(), "10s").Should(BeClosed())
+
+		client, err = clientv3.New(clientv3.Config{Endpoints: []string{clientURL.String()}})
+		Expect(err).NotTo(HaveOccurred())
+		registry = timerheap.NewTypeRegistry()
+		Expect(registry.Register("retry", retry{}, nil)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		client.Close()
+		etcd.Close()
+		os.RemoveAll(dir)
+	})
+
+	open := func() timerheap.TimerHeap {
+		th, err := cluster.New(client, "/timers", timerheap.WithTypeRegistry(registry, true))
+		Expect(err).NotTo(HaveOccurred())
+		return th
+	}
+
+	// collect receives the events delivered by each replica until it is terminated.
+	type delivery struct {
+		replica int
+		value   interface{}
+	}
+	collect := func(lock *sync.Mutex, received *[]delivery, replicas ...timerheap.TimerHeap) {
+		for i, th := range replicas {
+			go func(i int, c <-chan interface{}) {
+				for v := range c {
+					lock.Lock()
+					*received = append(*received, delivery{replica: i, value: v})
+					lock.Unlock()
+				}
+			}(i, th.TimedEvent())
+		}
+	}
+
+	It("delivers each event once, from the leader", func() {
+		a, b := open(), open()
+		defer a.Terminate()
+		defer b.Terminate()
+		var lock sync.Mutex
+		var received []delivery
+		collect(&lock, &received, a, b)
+
+		Expect(a.PushEvent(50*time.Millisecond, retry{ID: "a"})).To(Succeed())
+		Expect(b.PushEvent(100*time.Millisecond, retry{ID: "b"})).To(Succeed())
+		Eventually(func() int {
+			lock.Lock()
+			defer lock.Unlock()
+			return len(received)
+		}, "5s").Should(Equal(2))
+		Consistently(func() int {
+			lock.Lock()
+			defer lock.Unlock()
+			return len(received)
+		}, "200ms").Should(Equal(2))
+
+		lock.Lock()
+		defer lock.Unlock()
+		Expect(received[0].value).To(Equal(retry{ID: "a"}))
+		Expect(received[1].value).To(Equal(retry{ID: "b"}))
+		Expect(received[0].replica).To(Equal(received[1].replica))
+	})
+
+	It("fails over to another replica", func() {
+		a := open()
+		Expect(a.PushEvent(300*time.Millisecond, retry{ID: "pending"})).To(Succeed())
+		Eventually(func() int { return a.Stats().Pending }, "5s").Should(Equal(1))
+		b := open()
+		defer b.Terminate()
+		a.Terminate()
+
+		Eventually(b.TimedEvent(), "5s").Should(Receive(Equal(retry{ID: "pending"})))
+	})
+
+	It("requires a type registry", func() {
+		_, err := cluster.New(client, "/timers")
+		Expect(err).To(Equal(timerheap.ErrNoTypeRegistry))
+	})
+})
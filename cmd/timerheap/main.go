@@ -0,0 +1,307 @@
+// Command timerheap operates a timer heap served by timerheap.NewAdminHandler, or runs a
+// standalone scheduler from a schedule file.
+//
+// Usage:
+//
+//	timerheap [-url URL] list
+//	timerheap [-url URL] stats
+//	timerheap [-url URL] push [-topic TOPIC] [-type TYPE] [-key KEY] DELAY VALUE
+//	timerheap [-url URL] cancel -id ID | -key KEY
+//	timerheap [-url URL] flush [-timeout DURATION]
+//	timerheap [-url URL] terminate
+//	timerheap [-url URL] watch [-interval DURATION]
+//	timerheap run [-addr ADDR] FILE
+//
+// VALUE is parsed as JSON, and is pushed as a string if it is not valid JSON. The push command
+// prints the ID of the event, which the cancel command cancels it by, as can the key of an event
+// pushed with one. The watch command polls the pending events, printing them whenever they
+// change.
+//
+// The run command pushes the events in the schedule file, a JSON array of objects with a delay
+// in the format accepted by time.ParseDuration, a value, and optionally a topic, for example:
+//
+//	[{"delay": "5s", "value": "hello"}, {"delay": "1m", "value": {"id": 1}, "topic": "jobs"}]
+//
+// Each event is printed as a line of JSON when it is delivered. If ADDR is set, the admin
+// endpoints are served on it and the scheduler runs until it is interrupted or terminated,
+// otherwise it exits once every event has been delivered. Only events on the results channel
+// and the topics in the schedule file are printed.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+// scheduledEvent is an event in a schedule file.
+type scheduledEvent struct {
+	Delay string      `json:"delay"`
+	Value interface{} `json:"value"`
+	Topic string      `json:"topic,omitempty"`
+}
+
+// deliveredEvent is printed for each event delivered by the run command.
+type deliveredEvent struct {
+	Time  time.Time   `json:"time"`
+	Topic string      `json:"topic,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+func main() {
+	base := flag.String("url", "http://localhost:8080", "base `URL` of the admin endpoints")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	c := client{base: strings.TrimSuffix(*base, "/")}
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+	var err error
+	switch cmd {
+	case "list":
+		err = c.get("/events", os.Stdout)
+	case "stats":
+		err = c.get("/stats", os.Stdout)
+	case "push":
+		err = c.push(args)
+	case "cancel":
+		err = c.cancel(args)
+	case "flush":
+		err = c.flush(args)
+	case "terminate":
+		err = c.post("/terminate", nil, nil)
+	case "watch":
+		err = c.watch(args)
+	case "run":
+		err = run(args)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "timerheap %s: %v\n", cmd, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: timerheap [-url URL] list|stats|push|cancel|flush|terminate|watch [args]\n")
+	fmt.Fprintf(os.Stderr, "       timerheap run [-addr ADDR] FILE\n")
+	flag.PrintDefaults()
+}
+
+// client calls the admin endpoints of a heap.
+type client struct {
+	base string
+}
+
+// get writes the body of the response to the GET request to w.
+func (c client) get(path string, w io.Writer) error {
+	resp, err := http.Get(c.base + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// post sends a POST request with the JSON encoding of the body, if it is not nil, writing the
+// body of the response to w if it is not nil.
+func (c client) post(path string, body interface{}, w io.Writer) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	resp, err := http.Post(c.base+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil || w == nil {
+		return err
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// checkResponse returns an error holding the body of the response if the request failed.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	msg, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+func (c client) push(args []string) error {
+	fs := flag.NewFlagSet("push", flag.ExitOnError)
+	topic := fs.String("topic", "", "`topic` to deliver the event to")
+	typ := fs.String("type", "", "registered `type` to decode the value into")
+	key := fs.String("key", "", "idempotency `key` of the event")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errors.New("expected DELAY and VALUE")
+	}
+	value := json.RawMessage(fs.Arg(1))
+	if !json.Valid(value) {
+		value, _ = json.Marshal(fs.Arg(1))
+	}
+	return c.post("/events", map[string]interface{}{
+		"delay": fs.Arg(0),
+		"value": value,
+		"topic": *topic,
+		"type":  *typ,
+		"key":   *key,
+	}, os.Stdout)
+}
+
+func (c client) cancel(args []string) error {
+	fs := flag.NewFlagSet("cancel", flag.ExitOnError)
+	id := fs.Uint64("id", 0, "`ID` of the test event to cancel, as printed by push")
+	key := fs.String("key", "", "`key` of the event to cancel")
+	fs.Parse(args)
+	query := url.Values{}
+	switch {
+	case *id != 0 && *key == "":
+		query.Set("id", strconv.FormatUint(*id, 10))
+	case *key != "" && *id == 0:
+		query.Set("key", *key)
+	default:
+		return errors.New("expected one of -id and -key")
+	}
+	return c.post("/cancel?"+query.Encode(), nil, nil)
+}
+
+func (c client) flush(args []string) error {
+	fs := flag.NewFlagSet("flush", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 0, "maximum `duration` to wait, or 0 to wait indefinitely")
+	fs.Parse(args)
+	path := "/flush"
+	if *timeout > 0 {
+		path += "?timeout=" + url.QueryEscape(timeout.String())
+	}
+	return c.post(path, nil, nil)
+}
+
+func (c client) watch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := fs.Duration("interval", time.Second, "`duration` between polls")
+	fs.Parse(args)
+	var last []byte
+	for ; ; time.Sleep(*interval) {
+		var buf bytes.Buffer
+		if err := c.get("/events", &buf); err != nil {
+			return err
+		}
+		if bytes.Equal(buf.Bytes(), last) {
+			continue
+		}
+		last = buf.Bytes()
+		fmt.Printf("%s %s\n", time.Now().Format(time.RFC3339), strings.TrimSpace(buf.String()))
+	}
+}
+
+// run runs a standalone scheduler for the events in a schedule file.
+func run(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	addr := fs.String("addr", "", "`address` to serve the admin endpoints on")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("expected a schedule FILE")
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var events []scheduledEvent
+	if err := json.Unmarshal(data, &events); err != nil {
+		return fmt.Errorf("cannot parse schedule %s: %w", fs.Arg(0), err)
+	}
+
+	th := timerheap.New()
+	defer th.Terminate()
+	topics := map[string]bool{}
+	for _, ev := range events {
+		d, err := time.ParseDuration(ev.Delay)
+		if err != nil {
+			return err
+		}
+		var opts []timerheap.PushOption
+		if ev.Topic != "" {
+			opts = append(opts, timerheap.WithTopic(ev.Topic))
+			topics[ev.Topic] = true
+		}
+		if err := th.PushEvent(d, ev.Value, opts...); err != nil {
+			return err
+		}
+	}
+
+	// Print the events delivered on the results channel and each topic, until the heap is
+	// terminated.
+	var printLock sync.Mutex
+	var wg sync.WaitGroup
+	enc := json.NewEncoder(os.Stdout)
+	printEvents := func(topic string, c <-chan interface{}) {
+		defer wg.Done()
+		for v := range c {
+			printLock.Lock()
+			enc.Encode(deliveredEvent{Time: time.Now(), Topic: topic, Value: v})
+			printLock.Unlock()
+		}
+	}
+	wg.Add(1 + len(topics))
+	go printEvents("", th.TimedEvent())
+	for topic := range topics {
+		go printEvents(topic, th.TimedEventFor(topic))
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	if *addr == "" {
+		select {
+		case <-th.Idle():
+		case <-interrupt:
+		}
+	} else {
+		server := &http.Server{Addr: *addr, Handler: timerheap.NewAdminHandler(th)}
+		serveErr := make(chan error, 1)
+		go func() { serveErr <- server.ListenAndServe() }()
+		terminated := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(terminated)
+		}()
+		select {
+		case err = <-serveErr:
+		case <-terminated:
+		case <-interrupt:
+		}
+		server.Close()
+	}
+	th.Terminate()
+	wg.Wait()
+	return err
+}
@@ -0,0 +1,220 @@
+// Package conformance holds golden vectors for the HTTP protocol of the admin handler, see
+// timerheap.NewAdminHandler, and checks a server against them, so that other implementations of
+// the protocol, and clients written for it in other languages, can be verified to be
+// compatible.
+//
+// Each vector is a sequence of requests to a server with no pending events, along with the
+// response expected to each. The vectors are held in vectors.json, which implementations in
+// other languages can read directly. A response matches if it has the expected status, the
+// expected headers, and a JSON body that includes the expected body: objects may have fields
+// that are not expected, but arrays must have the expected number of elements, and other
+// values must be equal. The body is not checked if none is expected, as for errors, which are
+// reported as text.
+//
+// A step may capture fields of its response body to use in later requests, such as the cursor
+// for the next page of an export, which is specific to the implementation. Each field named by
+// the values of the capture map is stored under its key, and is substituted verbatim for
+// ${key} in the paths and bodies of later requests.
+package conformance
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+//go:embed vectors.json
+var vectors []byte
+
+// Vector is a sequence of requests, and the responses expected to them.
+type Vector struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Steps       []Step `json:"steps"`
+}
+
+// Step is a request, the response expected to it, and the fields of the response body to
+// capture for later requests.
+type Step struct {
+	Request  Request           `json:"request"`
+	Response Response          `json:"response"`
+	Capture  map[string]string `json:"capture,omitempty"`
+}
+
+// Request is a request to a server, with its path relative to where the handler is mounted,
+// including any query parameters.
+type Request struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// Response is the expected response to a request.
+type Response struct {
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	Body   json.RawMessage   `json:"body,omitempty"`
+}
+
+// Vectors returns the golden vectors.
+func Vectors() ([]Vector, error) {
+	var vs []Vector
+	if err := json.Unmarshal(vectors, &vs); err != nil {
+		return nil, fmt.Errorf("conformance: invalid vectors: %w", err)
+	}
+	return vs, nil
+}
+
+// Check runs the vector against the server at the base URL, which must have no pending events,
+// returning an error describing the first response that does not match.
+func Check(client *http.Client, base string, v Vector) error {
+	captured := map[string]string{}
+	for i, step := range v.Steps {
+		got, err := send(client, base, step.Request, captured)
+		if err != nil {
+			return fmt.Errorf("%s: step %d: %w", v.Name, i, err)
+		}
+		if err := step.Response.match(got); err != nil {
+			return fmt.Errorf("%s: step %d: %s %s: %w", v.Name, i, step.Request.Method, step.Request.Path, err)
+		}
+		for name, field := range step.Capture {
+			value, err := capture(got.body, field)
+			if err != nil {
+				return fmt.Errorf("%s: step %d: %w", v.Name, i, err)
+			}
+			captured[name] = value
+		}
+	}
+	return nil
+}
+
+// received is a response received from the server.
+type received struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// send sends the request, with the captured values substituted, returning the response.
+func send(client *http.Client, base string, req Request, captured map[string]string) (received, error) {
+	path, body := substitute(req.Path, captured), substitute(string(req.Body), captured)
+	r, err := http.NewRequest(req.Method, strings.TrimSuffix(base, "/")+path, strings.NewReader(body))
+	if err != nil {
+		return received{}, err
+	}
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return received{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return received{}, err
+	}
+	return received{status: resp.StatusCode, header: resp.Header, body: data}, nil
+}
+
+// substitute replaces ${name} in s with each captured value.
+func substitute(s string, captured map[string]string) string {
+	for name, value := range captured {
+		s = strings.ReplaceAll(s, "${"+name+"}", value)
+	}
+	return s
+}
+
+// capture returns the field of the JSON object in the body, which must be a string.
+func capture(body []byte, field string) (string, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "", fmt.Errorf("cannot capture %q: %w", field, err)
+	}
+	value, ok := fields[field].(string)
+	if !ok {
+		return "", fmt.Errorf("cannot capture %q: not a string in %s", field, body)
+	}
+	return value, nil
+}
+
+// match returns an error if the response received does not match.
+func (want Response) match(got received) error {
+	if got.status != want.Status {
+		return fmt.Errorf("status %d, expected %d: %s", got.status, want.Status, bytes.TrimSpace(got.body))
+	}
+	names := make([]string, 0, len(want.Header))
+	for name := range want.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if value := got.header.Get(name); value != want.Header[name] {
+			return fmt.Errorf("header %s is %q, expected %q", name, value, want.Header[name])
+		}
+	}
+	if len(want.Body) == 0 {
+		return nil
+	}
+	var w, g interface{}
+	if err := json.Unmarshal(want.Body, &w); err != nil {
+		return fmt.Errorf("invalid expected body: %w", err)
+	}
+	if err := json.Unmarshal(got.body, &g); err != nil {
+		return fmt.Errorf("body is not JSON: %w: %s", err, bytes.TrimSpace(got.body))
+	}
+	if err := includes("body", w, g); err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(got.body))
+	}
+	return nil
+}
+
+// includes returns an error if the decoded JSON value got does not include want, see the
+// package documentation. The path locates the values in the body for the error.
+func includes(path string, want, got interface{}) error {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is %v, expected an object", path, got)
+		}
+		names := make([]string, 0, len(w))
+		for name := range w {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value, ok := g[name]
+			if !ok {
+				return fmt.Errorf("%s.%s is missing", path, name)
+			}
+			if err := includes(path+"."+name, w[name], value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s is %v, expected an array", path, got)
+		}
+		if len(g) != len(w) {
+			return fmt.Errorf("%s has %d elements, expected %d", path, len(g), len(w))
+		}
+		for i := range w {
+			if err := includes(fmt.Sprintf("%s[%d]", path, i), w[i], g[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		if !reflect.DeepEqual(want, got) {
+			return fmt.Errorf("%s is %v, expected %v", path, got, want)
+		}
+	}
+	return nil
+}
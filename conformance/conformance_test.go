@@ -0,0 +1,60 @@
+package conformance_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+	"github.com/robbrockbank/timerheap/conformance"
+)
+
+var _ = Describe("Admin handler conformance", func() {
+	var th timerheap.TimerHeap
+	var server *httptest.Server
+
+	BeforeEach(func() {
+		th = timerheap.New()
+		server = httptest.NewServer(timerheap.NewAdminHandler(th))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		th.Terminate()
+	})
+
+	vectors, err := conformance.Vectors()
+	if err != nil {
+		panic(err)
+	}
+	for _, v := range vectors {
+		v := v
+		It("matches the "+v.Name+" vector", func() {
+			Expect(conformance.Check(server.Client(), server.URL, v)).To(Succeed())
+		})
+	}
+
+	It("reports responses that do not match", func() {
+		step := func(status int, body string) conformance.Step {
+			s := conformance.Step{
+				Request:  conformance.Request{Method: http.MethodPost, Path: "/events", Body: json.RawMessage(`{"delay": "1h", "value": "a"}`)},
+				Response: conformance.Response{Status: status},
+			}
+			if body != "" {
+				s.Response.Body = json.RawMessage(body)
+			}
+			return s
+		}
+		v := conformance.Vector{Name: "mismatch", Steps: []conformance.Step{step(200, "")}}
+		Expect(conformance.Check(server.Client(), server.URL, v)).To(MatchError(ContainSubstring("status 202, expected 200")))
+
+		v.Steps = []conformance.Step{step(202, `{"id": 5}`)}
+		Expect(conformance.Check(server.Client(), server.URL, v)).To(MatchError(ContainSubstring("body.id is 2, expected 5")))
+
+		v.Steps = []conformance.Step{step(202, `{"id": 3, "extra": true}`)}
+		Expect(conformance.Check(server.Client(), server.URL, v)).To(MatchError(ContainSubstring("body.extra is missing")))
+	})
+})
@@ -0,0 +1,92 @@
+package timerheap
+
+import (
+	"time"
+)
+
+// DeadLetterReason is the reason an event was sent to the dead letter channel.
+type DeadLetterReason int
+
+const (
+	// DeadLetterFull is used for events dropped by the overflow policy because the heap was
+	// full.
+	DeadLetterFull DeadLetterReason = iota
+	// DeadLetterExpired is used for events that could not be delivered before their
+	// not-after time.
+	DeadLetterExpired
+	// DeadLetterTerminated is used for events that were still pending when the heap was
+	// terminated.
+	DeadLetterTerminated
+	// DeadLetterMaxReceives is used for events that were delivered the maximum number of times
+	// set with WithMaxReceives without being acknowledged.
+	DeadLetterMaxReceives
+)
+
+func (r DeadLetterReason) String() string {
+	switch r {
+	case DeadLetterFull:
+		return "full"
+	case DeadLetterExpired:
+		return "expired"
+	case DeadLetterTerminated:
+		return "terminated"
+	case DeadLetterMaxReceives:
+		return "max receives"
+	default:
+		return "unknown"
+	}
+}
+
+// DeadLetter is an event that will never be delivered on the results channel, as received
+// from the DeadLetters channel.
+type DeadLetter struct {
+	// The value that was pushed.
+	Value interface{}
+	// The time the event was scheduled to pop.
+	ScheduledAt time.Time
+	// Why the event was not delivered.
+	Reason DeadLetterReason
+	// The metadata attached to the event, see WithMetadata.
+	Metadata Metadata
+}
+
+// DeadLetters returns the channel that events that will never be delivered are sent to. This
+// is nil unless the heap was created with the WithDeadLetters option.
+//
+// Dead letters are queued without limit so that reporting them never blocks the heap. The
+// channel is closed once the heap is terminated and every dead letter, including those for
+// the events pending at termination, has been received.
+func (t *timerHeap) DeadLetters() <-chan DeadLetter {
+	if t.deadLetters == nil {
+		return nil
+	}
+	return t.deadLetters.out
+}
+
+// deadLetter sends the item to the dead letter queue, if there is one.
+func (t *timerHeap) deadLetter(ti timedItem, reason DeadLetterReason) {
+	if reason != DeadLetterTerminated {
+		// Events pending when the heap is terminated remain in the write-ahead log.
+		t.retired(ti)
+	}
+	if ti.deliver != nil {
+		// Items with their own delivery function, such as those for AfterChan, are internal
+		// to the heap.
+		return
+	}
+	ti.handle.finish(EventDropped)
+	dl := DeadLetter{
+		Value:       ti.value,
+		ScheduledAt: ti.expire,
+		Reason:      reason,
+		Metadata:    ti.metadata,
+	}
+	if t.hooks.OnDrop != nil {
+		t.protect(ti, func() {
+			t.hooks.OnDrop(dl)
+		})
+	}
+	if t.deadLetters != nil {
+		t.deadLetters.add(dl)
+	}
+}
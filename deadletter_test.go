@@ -0,0 +1,54 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("timer heap dead letter tests", func() {
+
+	var th timerheap.TimerHeap
+
+	It("has no dead letter channel by default", func() {
+		th = timerheap.New()
+		defer th.Terminate()
+		Expect(th.DeadLetters()).To(BeNil())
+	})
+
+	It("sends dropped, expired and terminated events to the dead letter channel", func() {
+		var dl timerheap.DeadLetter
+		th = timerheap.New(
+			timerheap.WithDeadLetters(),
+			timerheap.WithMaxPending(2),
+			timerheap.WithOverflowPolicy(timerheap.OverflowDropFarthest),
+		)
+		now := time.Now()
+
+		By("adding an event that will expire before it is received")
+		Expect(th.PushEventWindow(now, now.Add(50*time.Millisecond), testdata{index: 0})).To(Succeed())
+		Eventually(th.DeadLetters(), "1s", "10ms").Should(Receive(&dl))
+		Expect(dl.Value).To(Equal(testdata{index: 0}))
+		Expect(dl.ScheduledAt).To(Equal(now))
+		Expect(dl.Reason).To(Equal(timerheap.DeadLetterExpired))
+
+		By("filling the heap and pushing an event that will be dropped")
+		Expect(th.PushEventAt(now.Add(time.Hour), testdata{index: 1})).To(Succeed())
+		Expect(th.PushEventAt(now.Add(2*time.Hour), testdata{index: 2})).To(Succeed())
+		Expect(th.PushEventAt(now.Add(3*time.Hour), testdata{index: 3})).To(Succeed())
+		Eventually(th.DeadLetters(), "1s", "10ms").Should(Receive(&dl))
+		Expect(dl.Value).To(Equal(testdata{index: 3}))
+		Expect(dl.Reason).To(Equal(timerheap.DeadLetterFull))
+
+		By("Terminating the heap and checking the pending events are dead-lettered")
+		th.Terminate()
+		var values []interface{}
+		for dl := range th.DeadLetters() {
+			Expect(dl.Reason).To(Equal(timerheap.DeadLetterTerminated))
+			values = append(values, dl.Value)
+		}
+		Expect(values).To(ConsistOf(testdata{index: 1}, testdata{index: 2}))
+	})
+})
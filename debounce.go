@@ -0,0 +1,104 @@
+package timerheap
+
+import (
+	"sync"
+	"time"
+)
+
+// Debounced is a value delivered by a Debouncer.
+type Debounced struct {
+	Key   string
+	Value interface{}
+}
+
+// Debouncer delivers the latest value signalled for each key once the key has been quiet for a
+// period, so that a burst of signals results in a single delivery. The timers are scheduled on
+// a heap without being delivered on its results channel.
+type Debouncer struct {
+	th    TimerHeap
+	quiet time.Duration
+	// lock protects pending, which holds the latest value and generation of each key with a
+	// delivery pending. Each signal schedules a timer for the key, only the timer for the
+	// latest generation delivers the value.
+	lock    sync.Mutex
+	pending map[string]*debounced
+	gen     uint64
+	closed  bool
+	out     *queue[Debounced]
+}
+
+type debounced struct {
+	value interface{}
+	gen   uint64
+}
+
+// NewDebouncer returns a Debouncer that delivers the latest value for a key once no signal has
+// been received for the key for the quiet period.
+func NewDebouncer(th TimerHeap, quiet time.Duration) *Debouncer {
+	return &Debouncer{
+		th:      th,
+		quiet:   quiet,
+		pending: map[string]*debounced{},
+		out:     newQueue[Debounced](0),
+	}
+}
+
+// C returns the channel the values are delivered on. Values are queued without limit, so a
+// slow consumer does not delay the heap.
+func (d *Debouncer) C() <-chan Debounced {
+	return d.out.out
+}
+
+// Signal records the latest value for the key, and restarts the quiet period for the key. The
+// timer for each signal remains on the heap until it pops, even if it is superseded.
+func (d *Debouncer) Signal(key string, value interface{}) error {
+	d.lock.Lock()
+	if d.closed {
+		d.lock.Unlock()
+		return ErrTerminated
+	}
+	d.gen++
+	gen := d.gen
+	p, ok := d.pending[key]
+	if !ok {
+		p = &debounced{}
+		d.pending[key] = p
+	}
+	p.value, p.gen = value, gen
+	d.lock.Unlock()
+
+	err := push(d.th, d.quiet, nil, func(interface{}) {
+		d.fire(key, gen)
+	})
+	if err != nil {
+		d.lock.Lock()
+		if p, ok := d.pending[key]; ok && p.gen == gen {
+			delete(d.pending, key)
+		}
+		d.lock.Unlock()
+	}
+	return err
+}
+
+// fire delivers the value for the key if the timer is for its latest signal.
+func (d *Debouncer) fire(key string, gen uint64) {
+	d.lock.Lock()
+	p, ok := d.pending[key]
+	if !ok || p.gen != gen {
+		d.lock.Unlock()
+		return
+	}
+	delete(d.pending, key)
+	d.lock.Unlock()
+	d.out.add(Debounced{Key: key, Value: p.value})
+}
+
+// Close discards the pending values, and closes the channel once the delivered values have been
+// received. Signals after Close fail with ErrTerminated.
+func (d *Debouncer) Close() {
+	d.lock.Lock()
+	d.closed = true
+	d.pending = map[string]*debounced{}
+	d.lock.Unlock()
+	d.out.close()
+}
@@ -0,0 +1,53 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Debouncer", func() {
+	var th timerheap.TimerHeap
+	var d *timerheap.Debouncer
+
+	BeforeEach(func() {
+		th = timerheap.New()
+		d = timerheap.NewDebouncer(th, 50*time.Millisecond)
+	})
+
+	AfterEach(func() {
+		d.Close()
+		th.Terminate()
+	})
+
+	It("delivers the latest value once the key is quiet", func() {
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			Expect(d.Signal("config", i)).To(Succeed())
+			time.Sleep(20 * time.Millisecond)
+		}
+		var v timerheap.Debounced
+		Eventually(d.C(), "1s").Should(Receive(&v))
+		Expect(v).To(Equal(timerheap.Debounced{Key: "config", Value: 4}))
+		Expect(time.Since(start)).To(BeNumerically(">=", 130*time.Millisecond))
+		Consistently(d.C(), "100ms").ShouldNot(Receive())
+	})
+
+	It("debounces each key independently", func() {
+		Expect(d.Signal("a", 1)).To(Succeed())
+		Expect(d.Signal("b", 2)).To(Succeed())
+		Expect(d.Signal("a", 3)).To(Succeed())
+		Eventually(d.C(), "1s").Should(Receive(Equal(timerheap.Debounced{Key: "b", Value: 2})))
+		Eventually(d.C(), "1s").Should(Receive(Equal(timerheap.Debounced{Key: "a", Value: 3})))
+	})
+
+	It("discards pending values when closed", func() {
+		Expect(d.Signal("a", 1)).To(Succeed())
+		d.Close()
+		Eventually(d.C(), "1s").Should(BeClosed())
+		Expect(d.Signal("a", 2)).To(Equal(timerheap.ErrTerminated))
+	})
+})
@@ -0,0 +1,156 @@
+package timerheap
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultDedupRetention is how long the key of a completed event is remembered by default.
+const defaultDedupRetention = 24 * time.Hour
+
+// WithKey sets an idempotency key for the event. Pushing an event with the same key as an event
+// that is pending, or that completed within the retention period set with WithDedupRetention,
+// succeeds without pushing the event, so that an event pushed again, for example after a crash,
+// is not delivered twice. An event completes when it is delivered, or acknowledged if the heap
+// was created with WithAck, or is dropped or discarded.
+//
+// The keys of durable and bolt-backed heaps are stored with the events, so they are remembered
+// across restarts. The keys of other heaps, including clustered heaps, are only held in memory.
+func WithKey(key string) PushOption {
+	return func(ti *timedItem) {
+		ti.key = key
+	}
+}
+
+// WithDedupRetention sets how long the key of a completed event is remembered, see WithKey. The
+// default is 24 hours.
+func WithDedupRetention(d time.Duration) Option {
+	return func(t *timerHeap) {
+		t.dedup.retention = d
+	}
+}
+
+// dedup holds the keys of the pending events, and of the events completed within the retention
+// period.
+type dedup struct {
+	lock      sync.Mutex
+	retention time.Duration
+	pending   map[string]struct{}
+	completed map[string]time.Time
+	// order holds the completed keys in the order they completed, so that they can be
+	// forgotten once the retention period has passed.
+	order []completedKey
+}
+
+// completedKey is the key of a completed event, and when it completed.
+type completedKey struct {
+	key  string
+	done time.Time
+}
+
+func newDedup() *dedup {
+	return &dedup{
+		retention: defaultDedupRetention,
+		pending:   map[string]struct{}{},
+		completed: map[string]time.Time{},
+	}
+}
+
+// claim records the key of an event being pushed. It returns false if an event with the key is
+// pending or completed recently, in which case the event should not be pushed.
+func (d *dedup) claim(key string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.takenLocked(key) {
+		return false
+	}
+	d.pending[key] = struct{}{}
+	return true
+}
+
+// taken returns true if an event with the key is pending or completed recently, so that the key
+// cannot be claimed.
+func (d *dedup) taken(key string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.takenLocked(key)
+}
+
+// takenLocked is taken for a caller that holds the lock.
+func (d *dedup) takenLocked(key string) bool {
+	if _, ok := d.pending[key]; ok {
+		return true
+	}
+	done, ok := d.completed[key]
+	return ok && time.Since(done) < d.retention
+}
+
+// release forgets the key of a pending event that was not pushed after all.
+func (d *dedup) release(key string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.pending, key)
+}
+
+// forget forgets that an event with the key completed, so that the key can be claimed again
+// before the retention period has passed.
+func (d *dedup) forget(key string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.completed, key)
+}
+
+// complete records that the pending event with the key completed at the supplied time.
+func (d *dedup) complete(key string, done time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, ok := d.pending[key]; !ok {
+		return
+	}
+	delete(d.pending, key)
+	d.rememberLocked(key, done)
+}
+
+// remember records that an event with the key completed at the supplied time, as restored from
+// storage.
+func (d *dedup) remember(key string, done time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.rememberLocked(key, done)
+}
+
+func (d *dedup) rememberLocked(key string, done time.Time) {
+	d.completed[key] = done
+	d.order = append(d.order, completedKey{key: key, done: done})
+	d.pruneLocked()
+}
+
+// pruneLocked forgets the keys that completed before the retention period. The caller must hold
+// the lock.
+func (d *dedup) pruneLocked() {
+	cutoff := time.Now().Add(-d.retention)
+	n := 0
+	for n < len(d.order) && d.order[n].done.Before(cutoff) {
+		ck := d.order[n]
+		if d.completed[ck.key].Equal(ck.done) {
+			delete(d.completed, ck.key)
+		}
+		d.order[n] = completedKey{}
+		n++
+	}
+	d.order = d.order[n:]
+}
+
+// recent returns the keys completed within the retention period, in the order they completed.
+func (d *dedup) recent() []completedKey {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.pruneLocked()
+	keys := make([]completedKey, 0, len(d.order))
+	for _, ck := range d.order {
+		if d.completed[ck.key].Equal(ck.done) {
+			keys = append(keys, ck)
+		}
+	}
+	return keys
+}
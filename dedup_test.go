@@ -0,0 +1,109 @@
+package timerheap_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Idempotency keys", func() {
+	It("ignores an event with the key of a pending event", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		Expect(th.PushEvent(20*time.Millisecond, 1, timerheap.WithKey("a"))).To(Succeed())
+		Expect(th.PushEvent(10*time.Millisecond, 2, timerheap.WithKey("a"))).To(Succeed())
+		Expect(th.PushEvent(30*time.Millisecond, 3, timerheap.WithKey("b"))).To(Succeed())
+		Expect(th.Stats().Pending).To(Equal(2))
+
+		Eventually(th.TimedEvent()).Should(Receive(Equal(1)))
+		Eventually(th.TimedEvent()).Should(Receive(Equal(3)))
+	})
+
+	It("remembers the keys of completed events for the retention period", func() {
+		th := timerheap.New(timerheap.WithDedupRetention(100 * time.Millisecond))
+		defer th.Terminate()
+		Expect(th.PushEvent(0, 1, timerheap.WithKey("a"))).To(Succeed())
+		Eventually(th.TimedEvent()).Should(Receive(Equal(1)))
+		Eventually(func() uint64 { return th.Stats().Delivered }).Should(BeEquivalentTo(1))
+
+		Expect(th.PushEvent(0, 2, timerheap.WithKey("a"))).To(Succeed())
+		Consistently(th.TimedEvent(), "50ms").ShouldNot(Receive())
+
+		time.Sleep(100 * time.Millisecond)
+		Expect(th.PushEvent(0, 3, timerheap.WithKey("a"))).To(Succeed())
+		Eventually(th.TimedEvent()).Should(Receive(Equal(3)))
+	})
+
+	It("completes the key of an acknowledged event when it is acknowledged", func() {
+		th := timerheap.New(timerheap.WithAck(time.Hour))
+		defer th.Terminate()
+		Expect(th.PushEvent(0, 1, timerheap.WithKey("a"))).To(Succeed())
+		var d interface{}
+		Eventually(th.TimedEvent()).Should(Receive(&d))
+		Expect(th.PushEvent(0, 2, timerheap.WithKey("a"))).To(Succeed())
+		Expect(d.(*timerheap.Delivery).Ack()).To(Succeed())
+		Expect(th.PushEvent(0, 3, timerheap.WithKey("a"))).To(Succeed())
+		Consistently(th.TimedEvent(), "50ms").ShouldNot(Receive())
+	})
+
+	It("releases the key of an event that is rejected", func() {
+		th := timerheap.New(timerheap.WithMaxPending(1))
+		defer th.Terminate()
+		Expect(th.PushEvent(0, 1)).To(Succeed())
+		Expect(th.PushEvent(0, 2, timerheap.WithKey("a"))).To(Equal(timerheap.ErrFull))
+		Eventually(th.TimedEvent()).Should(Receive(Equal(1)))
+		Eventually(func() int { return th.Stats().Pending }).Should(BeZero())
+
+		Expect(th.PushEvent(0, 2, timerheap.WithKey("a"))).To(Succeed())
+		Eventually(th.TimedEvent()).Should(Receive(Equal(2)))
+	})
+
+	Describe("with persistent heaps", func() {
+		var dir string
+		var registry *timerheap.TypeRegistry
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "timerheap")
+			Expect(err).NotTo(HaveOccurred())
+			registry = timerheap.NewTypeRegistry()
+			Expect(registry.Register("retry", retry{}, nil)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		checkRestart := func(open func() timerheap.TimerHeap) {
+			th := open()
+			Expect(th.PushEvent(0, retry{ID: "a"}, timerheap.WithKey("a"))).To(Succeed())
+			Expect(th.PushEvent(time.Hour, retry{ID: "b"}, timerheap.WithKey("b"))).To(Succeed())
+			Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(retry{ID: "a"})))
+			Eventually(func() uint64 { return th.Stats().Delivered }).Should(BeEquivalentTo(1))
+			th.Terminate()
+
+			By("pushing the events again after a restart")
+			th = open()
+			defer th.Terminate()
+			Expect(th.PushEvent(0, retry{ID: "a"}, timerheap.WithKey("a"))).To(Succeed())
+			Expect(th.PushEvent(0, retry{ID: "b"}, timerheap.WithKey("b"))).To(Succeed())
+			Expect(th.PushEvent(0, retry{ID: "c"}, timerheap.WithKey("c"))).To(Succeed())
+			Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(retry{ID: "c"})))
+			Consistently(th.TimedEvent(), "50ms").ShouldNot(Receive())
+		}
+
+		It("remembers keys across a restart of a durable heap", func() {
+			path := filepath.Join(dir, "events.wal")
+			checkRestart(func() timerheap.TimerHeap {
+				th, err := timerheap.NewDurable(path, timerheap.WithTypeRegistry(registry, true))
+				Expect(err).NotTo(HaveOccurred())
+				return th
+			})
+		})
+	})
+})
@@ -0,0 +1,65 @@
+package timerheap
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultTimers holds the package level heap used by the After helpers, created on first use.
+var defaultTimers struct {
+	once sync.Once
+	th   TimerHeap
+}
+
+// defaultHeap returns the package level heap, creating it on first use. The heap is not
+// exported, so that it cannot be terminated or have events pushed to it that are delivered on
+// its results channel. Its delivery does not block, so a timer whose channel is not read does
+// not delay the others.
+func defaultHeap() TimerHeap {
+	defaultTimers.once.Do(func() {
+		defaultTimers.th = New(WithNonBlockingDelivery(0))
+	})
+	return defaultTimers.th
+}
+
+// After returns a channel that receives the current time once d has elapsed, like time.After.
+// The timer is scheduled on the default heap, so many timers share a single goroutine and
+// runtime timer.
+func After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	push(defaultHeap(), d, nil, func(interface{}) {
+		ch <- time.Now()
+	})
+	return ch
+}
+
+// AfterValue returns a channel that receives v once d has elapsed. The timer is scheduled on
+// the default heap, so many timers share a single goroutine and runtime timer.
+func AfterValue(d time.Duration, v interface{}) <-chan interface{} {
+	ch := make(chan interface{}, 1)
+	push(defaultHeap(), d, v, func(value interface{}) {
+		ch <- value
+	})
+	return ch
+}
+
+// AfterChan returns a channel that is closed once d has elapsed. Many of these may be
+// outstanding at once, sharing the goroutine and timer of the heap, rather than each using its
+// own runtime timer as time.After does. The channel is never closed if the heap is full, is
+// quiescing or has been terminated.
+func (t *timerHeap) AfterChan(d time.Duration) <-chan struct{} {
+	ch := make(chan struct{})
+	push(t, d, nil, func(interface{}) {
+		close(ch)
+	})
+	return ch
+}
+
+// push pushes an event that is delivered by calling deliver rather than on the results channel
+// of the heap. Pushing to the default heap cannot fail since it has no limit on the number of
+// pending events and no type registry.
+func push(th TimerHeap, d time.Duration, v interface{}, deliver func(interface{})) error {
+	return th.PushEvent(d, v, func(ti *timedItem) {
+		ti.deliver = deliver
+	})
+}
@@ -0,0 +1,70 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Default heap", func() {
+	It("delivers timers whose channels are not read without delaying the others", func() {
+		for i := 0; i < 10; i++ {
+			timerheap.AfterValue(time.Duration(i)*time.Millisecond, testdata{index: i})
+		}
+		Eventually(timerheap.After(20*time.Millisecond), "500ms", "1ms").Should(Receive())
+	})
+
+	It("delivers values to their own channels in time order", func() {
+		start := time.Now()
+		later := timerheap.AfterValue(100*time.Millisecond, testdata{index: 2})
+		sooner := timerheap.AfterValue(50*time.Millisecond, testdata{index: 1})
+
+		Eventually(sooner, "1s", "1ms").Should(Receive(Equal(testdata{index: 1})))
+		Expect(later).NotTo(Receive())
+		Eventually(later, "1s", "1ms").Should(Receive(Equal(testdata{index: 2})))
+		Expect(time.Since(start)).To(BeNumerically(">=", 100*time.Millisecond))
+	})
+
+	It("sends the time after the duration has elapsed", func() {
+		start := time.Now()
+		var fired time.Time
+		Eventually(timerheap.After(50*time.Millisecond), "1s", "1ms").Should(Receive(&fired))
+		Expect(fired).To(BeTemporally("~", start.Add(50*time.Millisecond), accuracy))
+	})
+})
+
+var _ = Describe("AfterChan", func() {
+	var th timerheap.TimerHeap
+
+	BeforeEach(func() {
+		th = timerheap.New(timerheap.WithDeadLetters())
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("closes the channel once the duration has elapsed", func() {
+		start := time.Now()
+		ch := th.AfterChan(50 * time.Millisecond)
+		Expect(ch).NotTo(BeClosed())
+		Eventually(ch, "1s", "1ms").Should(BeClosed())
+		Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+	})
+
+	It("does not deliver on the results channel", func() {
+		ch := th.AfterChan(10 * time.Millisecond)
+		Expect(th.PushEvent(20*time.Millisecond, testdata{index: 1})).To(Succeed())
+		Eventually(ch, "1s", "1ms").Should(BeClosed())
+		Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(Equal(testdata{index: 1})))
+	})
+
+	It("does not dead-letter pending channels on termination", func() {
+		th.AfterChan(time.Hour)
+		th.Terminate()
+		Eventually(th.DeadLetters()).Should(BeClosed())
+	})
+})
@@ -0,0 +1,77 @@
+package timerheap
+
+import (
+	"sort"
+)
+
+// DepthCrossing describes the number of pending events crossing a threshold set with
+// WithDepthThresholds.
+type DepthCrossing struct {
+	// The threshold that was crossed.
+	Threshold int
+	// The number of pending events once the threshold was crossed.
+	Pending int
+	// Rising is true if the number of pending events rose to reach the threshold, and false if
+	// it fell back below it.
+	Rising bool
+}
+
+// WithDepthThresholds calls the handler whenever the number of pending events, as reported by
+// Stats.Pending, rises to reach one of the thresholds or falls back below it, so that the depth
+// of the heap can be fed to a metrics system without polling. The number of pending events is
+// checked each time the heap is processed, and every push wakes the heap to check it, so a
+// burst of pushes is seen as soon as it is drained onto the heap. If a burst crosses several
+// thresholds at once, the handler is called for each of them in the order they were crossed.
+// Thresholds of zero or less are ignored.
+//
+// The handler is called from the event goroutine and should not block.
+func WithDepthThresholds(handler func(DepthCrossing), thresholds ...int) Option {
+	return func(t *timerHeap) {
+		var levels []int
+		for _, n := range thresholds {
+			if n > 0 {
+				levels = append(levels, n)
+			}
+		}
+		sort.Ints(levels)
+		t.depth = &depthGauge{
+			handler:    handler,
+			thresholds: levels,
+		}
+	}
+}
+
+// depthGauge tracks the thresholds reached by the number of pending events. It is only accessed
+// by the event goroutine.
+type depthGauge struct {
+	handler    func(DepthCrossing)
+	thresholds []int
+	// reached is the number of thresholds the number of pending events had reached when it was
+	// last checked.
+	reached int
+}
+
+// check is called by the event goroutine each time the heap is processed, with the number of
+// pending events, and calls the handler for each threshold crossed since the last check.
+func (g *depthGauge) check(t *timerHeap, pending int) {
+	for g.reached < len(g.thresholds) && pending >= g.thresholds[g.reached] {
+		g.report(t, DepthCrossing{Threshold: g.thresholds[g.reached], Pending: pending, Rising: true})
+		g.reached++
+	}
+	for g.reached > 0 && pending < g.thresholds[g.reached-1] {
+		g.reached--
+		g.report(t, DepthCrossing{Threshold: g.thresholds[g.reached], Pending: pending})
+	}
+}
+
+// report calls the handler with the crossing, recovering any panic.
+func (g *depthGauge) report(t *timerHeap, c DepthCrossing) {
+	if t.debug {
+		t.log.Debug("Pending events crossed threshold", "threshold", c.Threshold, "pending", c.Pending, "rising", c.Rising)
+	}
+	if g.handler != nil {
+		t.protect(timedItem{}, func() {
+			g.handler(c)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("timer heap depth threshold tests", func() {
+
+	var crossings chan timerheap.DepthCrossing
+
+	BeforeEach(func() {
+		crossings = make(chan timerheap.DepthCrossing, 10)
+	})
+
+	handler := func(c timerheap.DepthCrossing) {
+		crossings <- c
+	}
+
+	It("reports the pending count rising to and falling below each threshold", func() {
+		th := timerheap.New(timerheap.WithDepthThresholds(handler, 10, 5, 0))
+		defer th.Terminate()
+
+		By("pushing events past both thresholds")
+		for i := 0; i < 10; i++ {
+			Expect(th.PushEvent(time.Hour, i)).To(Succeed())
+		}
+		Eventually(crossings, "1s").Should(Receive(HaveField("Threshold", 5)))
+		var c timerheap.DepthCrossing
+		Eventually(crossings, "1s").Should(Receive(&c))
+		Expect(c).To(Equal(timerheap.DepthCrossing{Threshold: 10, Pending: 10, Rising: true}))
+
+		By("removing events until the count falls below both thresholds")
+		Expect(th.Remove(9)).To(BeTrue())
+		Eventually(crossings, "1s").Should(Receive(Equal(timerheap.DepthCrossing{Threshold: 10, Pending: 9})))
+		for i := 0; i < 4; i++ {
+			Expect(th.Remove(i)).To(BeTrue())
+		}
+		Consistently(crossings, "50ms").ShouldNot(Receive())
+		Expect(th.Remove(4)).To(BeTrue())
+		Eventually(crossings, "1s").Should(Receive(Equal(timerheap.DepthCrossing{Threshold: 5, Pending: 4})))
+	})
+
+	It("reports the pending count falling as events are delivered", func() {
+		th := timerheap.New(timerheap.WithDepthThresholds(handler, 3))
+		defer th.Terminate()
+
+		Expect(th.PushEvent(50*time.Millisecond, "a")).To(Succeed())
+		Expect(th.PushEvent(time.Hour, "b")).To(Succeed())
+		Consistently(crossings, "20ms").ShouldNot(Receive())
+		Expect(th.PushEvent(time.Hour, "c")).To(Succeed())
+		Eventually(crossings, "1s").Should(Receive(Equal(timerheap.DepthCrossing{Threshold: 3, Pending: 3, Rising: true})))
+
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("a")))
+		Eventually(crossings, "1s").Should(Receive(Equal(timerheap.DepthCrossing{Threshold: 3, Pending: 2})))
+	})
+
+	It("sees every push to a heap with a limit on the pending events", func() {
+		th := timerheap.New(timerheap.WithMaxPending(100), timerheap.WithDepthThresholds(handler, 2))
+		defer th.Terminate()
+
+		Expect(th.PushEvent(time.Minute, "a")).To(Succeed())
+		Expect(th.PushEvent(time.Hour, "b")).To(Succeed())
+		Eventually(crossings, "1s").Should(Receive(Equal(timerheap.DepthCrossing{Threshold: 2, Pending: 2, Rising: true})))
+	})
+})
@@ -0,0 +1,275 @@
+package timerheap
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// dispatchRetry is the interval at which a dispatcher retries delivery to a heap whose results
+// channel is full.
+const dispatchRetry = time.Millisecond
+
+// Dispatcher processes many heaps on a single goroutine with a single timer, rather than each
+// heap running its own goroutine. This reduces the overhead of using a large number of heaps
+// that each hold few events. Heaps are added to a dispatcher with the WithDispatcher option.
+//
+// Since the dispatcher cannot wait for the consumer of any one heap, the results channel of a
+// dispatched heap holds one event. If the consumer has not received it by the time the next
+// event is ready, delivery of the next event is retried periodically until there is room.
+type Dispatcher struct {
+	// lock protects the registered heaps. It is not held while the heaps are processed, since
+	// the callbacks run while processing a heap may terminate it, which removes it.
+	lock       sync.Mutex
+	heaps      map[*timerHeap]struct{}
+	queue      dispatchQueue
+	terminated bool
+	// dirty holds the heaps that have been woken since they were last processed, and is
+	// protected by dirtyLock so that waking a heap does not wait for processing to finish.
+	dirtyLock sync.Mutex
+	dirty     []*timerHeap
+	// wakeup is used to wake the dispatcher goroutine when a heap has been woken, and exit to
+	// stop it.
+	wakeup chan struct{}
+	exit   chan struct{}
+	// thread, if set, is the configuration of the OS thread the goroutine is locked to.
+	thread *threadConfig
+}
+
+// NewDispatcher creates a Dispatcher and starts its goroutine. The dispatcher runs until it is
+// terminated.
+func NewDispatcher(opts ...DispatcherOption) *Dispatcher {
+	d := &Dispatcher{
+		heaps:  map[*timerHeap]struct{}{},
+		wakeup: make(chan struct{}, 1),
+		exit:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	go d.run()
+	return d
+}
+
+// WithDispatcher configures the heap to be processed by the dispatcher instead of its own
+// goroutine. The dispatcher must not have been terminated. Children of the heap are also
+// processed by the dispatcher, unless overridden.
+func WithDispatcher(d *Dispatcher) Option {
+	return func(t *timerHeap) {
+		t.dispatcher = d
+	}
+}
+
+// Terminate terminates all of the heaps processed by the dispatcher and stops the dispatcher
+// goroutine.
+func (d *Dispatcher) Terminate() {
+	d.lock.Lock()
+	if d.terminated {
+		d.lock.Unlock()
+		return
+	}
+	d.terminated = true
+	heaps := make([]*timerHeap, 0, len(d.heaps))
+	for t := range d.heaps {
+		heaps = append(heaps, t)
+	}
+	d.lock.Unlock()
+
+	for _, t := range heaps {
+		t.Terminate()
+	}
+	close(d.exit)
+}
+
+// add registers a heap to be processed by the dispatcher.
+func (d *Dispatcher) add(t *timerHeap) {
+	d.lock.Lock()
+	t.dispatchIndex = -1
+	d.heaps[t] = struct{}{}
+	d.lock.Unlock()
+	d.notify(t)
+}
+
+// remove stops the dispatcher processing a heap. Processing of the heap that is in progress is
+// not waited for, since the heap may be removed by a callback run while processing it, but a
+// terminated heap no longer sends on its results channel, see dispatch.
+func (d *Dispatcher) remove(t *timerHeap) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.heaps, t)
+	if t.dispatchIndex >= 0 {
+		heap.Remove(&d.queue, t.dispatchIndex)
+	}
+}
+
+// notify marks a heap as needing to be processed, and wakes the dispatcher goroutine.
+func (d *Dispatcher) notify(t *timerHeap) {
+	d.dirtyLock.Lock()
+	if !t.dirty {
+		t.dirty = true
+		d.dirty = append(d.dirty, t)
+	}
+	d.dirtyLock.Unlock()
+
+	select {
+	case d.wakeup <- struct{}{}:
+		// Wakeup sent.
+	default:
+		// Wakeup already pending.
+	}
+}
+
+// takeDirty appends the heaps that need processing to heaps, and clears them.
+func (d *Dispatcher) takeDirty(heaps []*timerHeap) []*timerHeap {
+	d.dirtyLock.Lock()
+	defer d.dirtyLock.Unlock()
+	for i, t := range d.dirty {
+		t.dirty = false
+		heaps = append(heaps, t)
+		d.dirty[i] = nil
+	}
+	d.dirty = d.dirty[:0]
+	return heaps
+}
+
+func (d *Dispatcher) run() {
+	if d.thread != nil {
+		// The dispatcher has no logger, a priority that cannot be set is ignored.
+		_ = d.thread.lock()
+	}
+
+	// The timer is reset for the heap that next needs processing. armed is the time the timer
+	// is armed for, or the zero time if it is not armed.
+	tm := time.NewTimer(time.Hour)
+	tm.Stop()
+	defer tm.Stop()
+	var armed time.Time
+
+	// due holds the heaps to process, reused for each iteration.
+	var due []*timerHeap
+	for {
+		now := time.Now()
+		d.lock.Lock()
+		due = d.takeDirty(due[:0])
+		for len(d.queue) > 0 && !d.queue[0].dispatchWake.After(now) {
+			due = append(due, heap.Pop(&d.queue).(*timerHeap))
+		}
+		d.lock.Unlock()
+
+		for i, t := range due {
+			wake := t.dispatch(now)
+			d.lock.Lock()
+			if _, ok := d.heaps[t]; ok {
+				d.schedule(t, wake)
+			}
+			d.lock.Unlock()
+			due[i] = nil
+		}
+
+		d.lock.Lock()
+		var wake time.Time
+		if len(d.queue) > 0 {
+			wake = d.queue[0].dispatchWake
+		}
+		d.lock.Unlock()
+
+		if !wake.Equal(armed) {
+			if !armed.IsZero() && !tm.Stop() {
+				select {
+				case <-tm.C:
+				default:
+				}
+			}
+			armed = wake
+			if !wake.IsZero() {
+				tm.Reset(wake.Sub(now))
+			}
+		}
+		var timerC <-chan time.Time
+		if !armed.IsZero() {
+			timerC = tm.C
+		}
+
+		select {
+		case <-timerC:
+			armed = time.Time{}
+		case <-d.wakeup:
+		case <-d.exit:
+			return
+		}
+	}
+}
+
+// schedule sets the time a heap next needs processing, which is the zero time if it only needs
+// processing once it is woken. The caller must hold the lock.
+func (d *Dispatcher) schedule(t *timerHeap, wake time.Time) {
+	t.dispatchWake = wake
+	switch {
+	case t.dispatchIndex >= 0 && wake.IsZero():
+		heap.Remove(&d.queue, t.dispatchIndex)
+	case t.dispatchIndex >= 0:
+		heap.Fix(&d.queue, t.dispatchIndex)
+	case !wake.IsZero():
+		heap.Push(&d.queue, t)
+	}
+}
+
+// dispatch processes a heap that is run by a dispatcher, delivering as many ready items as
+// the results channel has room for, and returns the time the heap next needs processing.
+func (t *timerHeap) dispatch(now time.Time) time.Time {
+	for {
+		st := t.step(now)
+		if st.results == nil {
+			return st.wake
+		}
+		// The heap may be terminated while it is processed, after which the results channel
+		// may be closed, so the event is only sent if it has not been terminated.
+		sent, terminated := false, false
+		t.lock.Lock()
+		if terminated = t.terminated; !terminated {
+			select {
+			case st.results <- st.value:
+				sent = true
+			default:
+			}
+		}
+		t.lock.Unlock()
+		switch {
+		case terminated:
+			return time.Time{}
+		case sent:
+			t.delivered(st.head)
+		default:
+			// The consumer has not received the previous event, try again later.
+			return earliest(st.wake, now.Add(dispatchRetry))
+		}
+	}
+}
+
+// dispatchQueue is a min-heap of the heaps run by a dispatcher, ordered by the time they next
+// need processing. Heaps that only need processing once they are woken are not held.
+type dispatchQueue []*timerHeap
+
+func (q dispatchQueue) Len() int           { return len(q) }
+func (q dispatchQueue) Less(i, j int) bool { return q[i].dispatchWake.Before(q[j].dispatchWake) }
+func (q dispatchQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].dispatchIndex = i
+	q[j].dispatchIndex = j
+}
+
+func (q *dispatchQueue) Push(x interface{}) {
+	t := x.(*timerHeap)
+	t.dispatchIndex = len(*q)
+	*q = append(*q, t)
+}
+
+func (q *dispatchQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	t := old[n-1]
+	old[n-1] = nil
+	t.dispatchIndex = -1
+	*q = old[:n-1]
+	return t
+}
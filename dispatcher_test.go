@@ -0,0 +1,106 @@
+package timerheap_test
+
+import (
+	"runtime"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Dispatcher", func() {
+	var d *timerheap.Dispatcher
+
+	BeforeEach(func() {
+		d = timerheap.NewDispatcher()
+	})
+
+	AfterEach(func() {
+		d.Terminate()
+	})
+
+	It("processes many heaps on a single goroutine", func() {
+		goroutines := runtime.NumGoroutine()
+
+		By("creating heaps on the dispatcher and adding an event to each")
+		var heaps []timerheap.TimerHeap
+		for i := 0; i < 100; i++ {
+			th := timerheap.New(timerheap.WithDispatcher(d))
+			Expect(th.PushEvent(time.Duration(100-i)*time.Millisecond, testdata{index: i})).To(Succeed())
+			heaps = append(heaps, th)
+		}
+		Expect(runtime.NumGoroutine()).To(BeNumerically("<", goroutines+10))
+
+		By("Checking each heap delivers its event")
+		for i, th := range heaps {
+			var value interface{}
+			Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(&value))
+			Expect(value).To(Equal(testdata{index: i}))
+		}
+	})
+
+	It("delivers events in order to a slow consumer", func() {
+		th := timerheap.New(timerheap.WithDispatcher(d))
+		for i := 0; i < 3; i++ {
+			Expect(th.PushEvent(10*time.Millisecond, testdata{index: i})).To(Succeed())
+		}
+
+		By("Pausing without reading the results channel")
+		time.Sleep(100 * time.Millisecond)
+		Expect(th.Stats().Pending).To(Equal(2))
+
+		for i := 0; i < 3; i++ {
+			var value interface{}
+			Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(&value))
+			Expect(value).To(Equal(testdata{index: i}))
+		}
+	})
+
+	It("wakes up for an event pushed before the next one due", func() {
+		th := timerheap.New(timerheap.WithDispatcher(d))
+		Expect(th.PushEvent(time.Hour, testdata{index: 1})).To(Succeed())
+		Expect(th.PushEvent(10*time.Millisecond, testdata{index: 2})).To(Succeed())
+
+		var value interface{}
+		Eventually(th.TimedEvent(), "500ms", "1ms").Should(Receive(&value))
+		Expect(value).To(Equal(testdata{index: 2}))
+	})
+
+	It("terminates its heaps when terminated", func() {
+		th := timerheap.New(timerheap.WithDispatcher(d))
+		child := th.NewChild()
+		d.Terminate()
+		Eventually(th.TimedEvent()).Should(BeClosed())
+		Eventually(child.TimedEvent()).Should(BeClosed())
+	})
+
+	It("stops processing a heap when it is terminated", func() {
+		th := timerheap.New(timerheap.WithDispatcher(d))
+		other := timerheap.New(timerheap.WithDispatcher(d))
+		Expect(th.PushEvent(10*time.Millisecond, testdata{index: 1})).To(Succeed())
+		th.Terminate()
+		Expect(other.PushEvent(10*time.Millisecond, testdata{index: 2})).To(Succeed())
+		Eventually(other.TimedEvent(), "1s", "1ms").Should(Receive(Equal(testdata{index: 2})))
+	})
+
+	It("terminates a heap from a callback", func() {
+		var th timerheap.TimerHeap
+		th = timerheap.New(
+			timerheap.WithDispatcher(d),
+			timerheap.WithHooks(timerheap.Hooks{
+				OnFire: func(timerheap.TimedResult) {
+					th.Terminate()
+				},
+			}),
+		)
+		other := timerheap.New(timerheap.WithDispatcher(d))
+		Expect(th.PushEvent(0, testdata{index: 1})).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(BeClosed())
+
+		// The dispatcher carries on processing its other heaps.
+		Expect(other.PushEvent(0, testdata{index: 2})).To(Succeed())
+		Eventually(other.TimedEvent(), "1s", "1ms").Should(Receive(Equal(testdata{index: 2})))
+	})
+})
@@ -0,0 +1,137 @@
+package timerheap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// dumpedEvent is the JSON rendering of a pending event.
+type dumpedEvent struct {
+	Expire   time.Time  `json:"expire"`
+	NotAfter *time.Time `json:"notAfter,omitempty"`
+	Priority int        `json:"priority,omitempty"`
+	Tiebreak int        `json:"tiebreak,omitempty"`
+	Topic    string     `json:"topic,omitempty"`
+	Metadata Metadata   `json:"metadata,omitempty"`
+	// Popped is set if the event has popped and is waiting to be received.
+	Popped bool   `json:"popped,omitempty"`
+	Type   string `json:"type"`
+	// Value is the JSON encoding of the value, or if it cannot be encoded Text is the value
+	// formatted with fmt.
+	Value json.RawMessage `json:"value,omitempty"`
+	Text  string          `json:"text,omitempty"`
+}
+
+// MarshalJSON renders the pending events of the heap as JSON, in the order they are due to
+// pop, for debugging. The type of each value is given by the name it is registered under if
+// the heap has a TypeRegistry, and each value is rendered as JSON if possible, otherwise as
+// text. Events created by AfterChan are not included.
+func (t *timerHeap) MarshalJSON() ([]byte, error) {
+	items, popped := t.pendingItems()
+	events := make([]dumpedEvent, 0, len(items))
+	for i, ti := range items {
+		ev := dumpedEvent{
+			Expire:   ti.expire,
+			Priority: ti.priority,
+			Tiebreak: ti.tiebreak,
+			Topic:    ti.topic,
+			Metadata: ti.metadata,
+			Popped:   i < popped,
+			Type:     t.typeName(ti.value),
+		}
+		if !ti.notAfter.IsZero() {
+			notAfter := ti.notAfter
+			ev.NotAfter = &notAfter
+		}
+		if value, err := json.Marshal(ti.value); err == nil {
+			ev.Value = value
+		} else {
+			ev.Text = fmt.Sprintf("%+v", ti.value)
+		}
+		events = append(events, ev)
+	}
+	return json.Marshal(struct {
+		Events []dumpedEvent `json:"events"`
+	}{events})
+}
+
+// String summarises the heap for logging, with the number of pending events, as counted by
+// Stats.Pending, and when the next one is due. The events of child heaps are not included.
+func (t *timerHeap) String() string {
+	t.lock.Lock()
+	t.drainPushedLocked()
+	terminated := t.terminated
+	pending := t.pendingLocked()
+	next := t.nextFireLocked()
+	t.lock.Unlock()
+
+	switch {
+	case terminated:
+		return "TimerHeap(terminated)"
+	case next.IsZero():
+		return fmt.Sprintf("TimerHeap(%d pending)", pending)
+	default:
+		return fmt.Sprintf("TimerHeap(%d pending, next in %s)", pending, relative(time.Until(next)))
+	}
+}
+
+// Dump writes the pending events of the heap to w as a table, in the order they are due to pop,
+// for debugging. Each event is listed with how long until it is due and its scheduled time, its
+// type and value, and its topic, priority, tiebreak and not-after time if it has them. Events
+// that have popped and are waiting to be received are marked as popped. Events created by
+// AfterChan are not included.
+func (t *timerHeap) Dump(w io.Writer) error {
+	items, popped := t.pendingItems()
+	now := time.Now()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%d pending events at %s\n", len(items), now.Format(time.RFC3339Nano))
+	if len(items) > 0 {
+		fmt.Fprintln(tw, "#\tDUE IN\tEXPIRE\tTYPE\tVALUE\tDETAILS")
+	}
+	for i, ti := range items {
+		var details []string
+		if i < popped {
+			details = append(details, "popped")
+		}
+		if ti.topic != "" {
+			details = append(details, "topic="+ti.topic)
+		}
+		if ti.priority != 0 {
+			details = append(details, fmt.Sprintf("priority=%d", ti.priority))
+		}
+		if ti.tiebreak != 0 {
+			details = append(details, fmt.Sprintf("tiebreak=%d", ti.tiebreak))
+		}
+		if !ti.notAfter.IsZero() {
+			details = append(details, "notAfter="+ti.notAfter.Format(time.RFC3339Nano))
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%+v\t%s\n", i+1, relative(ti.expire.Sub(now)),
+			ti.expire.Format(time.RFC3339Nano), t.typeName(ti.value), ti.value, strings.Join(details, " "))
+	}
+	return tw.Flush()
+}
+
+// typeName returns the name the type of the value is registered under, if the heap has a
+// TypeRegistry, or the name of the Go type.
+func (t *timerHeap) typeName(value interface{}) string {
+	if t.types != nil {
+		if name, ok := t.types.Name(value); ok {
+			return name
+		}
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// relative formats how long until an event is due, rounded to the millisecond. Events that are
+// overdue have a negative duration.
+func relative(d time.Duration) string {
+	d = d.Round(time.Millisecond)
+	if d >= 0 {
+		return "+" + d.String()
+	}
+	return d.String()
+}
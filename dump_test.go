@@ -0,0 +1,99 @@
+package timerheap_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("JSON export", func() {
+	var th timerheap.TimerHeap
+
+	BeforeEach(func() {
+		registry := timerheap.NewTypeRegistry()
+		Expect(registry.Register("retry", retry{}, nil)).To(Succeed())
+		th = timerheap.New(timerheap.WithTypeRegistry(registry, false))
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("lists the pending events in the order they pop", func() {
+		now := time.Now().UTC().Truncate(time.Second)
+		Expect(th.PushEventAt(now.Add(2*time.Hour), retry{ID: "a"}, timerheap.WithTopic("retries"))).To(Succeed())
+		Expect(th.PushEventAt(now.Add(time.Hour), testdata{index: 1}, timerheap.WithStaleAfter(time.Minute))).To(Succeed())
+		Expect(th.PushEventAt(now.Add(3*time.Hour), func() {})).To(Succeed())
+
+		data, err := json.Marshal(th)
+		Expect(err).NotTo(HaveOccurred())
+
+		var dump struct {
+			Events []map[string]interface{} `json:"events"`
+		}
+		Expect(json.Unmarshal(data, &dump)).To(Succeed())
+		Expect(dump.Events).To(HaveLen(3))
+		Expect(dump.Events[0]).To(HaveKeyWithValue("type", "timerheap_test.testdata"))
+		Expect(dump.Events[0]).To(HaveKeyWithValue("expire", now.Add(time.Hour).Format(time.RFC3339)))
+		Expect(dump.Events[0]).To(HaveKeyWithValue("notAfter", now.Add(time.Hour+time.Minute).Format(time.RFC3339)))
+		Expect(dump.Events[1]).To(HaveKeyWithValue("type", "retry"))
+		Expect(dump.Events[1]).To(HaveKeyWithValue("topic", "retries"))
+		Expect(dump.Events[1]).To(HaveKeyWithValue("value", map[string]interface{}{"ID": "a", "Attempt": 0.0}))
+		Expect(dump.Events[2]).To(HaveKey("text"))
+	})
+})
+
+var _ = Describe("Dump", func() {
+	It("lists the pending events in the order they pop", func() {
+		registry := timerheap.NewTypeRegistry()
+		Expect(registry.Register("retry", retry{}, nil)).To(Succeed())
+		th := timerheap.New(timerheap.WithTypeRegistry(registry, false))
+		defer th.Terminate()
+
+		now := time.Now().UTC().Truncate(time.Second)
+		Expect(th.PushEventAt(now.Add(2*time.Hour), retry{ID: "a"}, timerheap.WithTopic("retries"))).To(Succeed())
+		Expect(th.PushEventAt(now.Add(time.Hour), 42, timerheap.WithPriorityClass(2))).To(Succeed())
+		Expect(th.PushEventAt(now.Add(-time.Second), "due")).To(Succeed())
+		th.AfterChan(time.Minute)
+		// The summary counts the timer of AfterChan, as Stats does.
+		Expect(th.String()).To(HavePrefix("TimerHeap(4 pending, next in -"))
+
+		dump := func() string {
+			var out bytes.Buffer
+			Expect(th.Dump(&out)).To(Succeed())
+			return out.String()
+		}
+		Eventually(dump, "1s").Should(ContainSubstring("popped"))
+		lines := strings.Split(strings.TrimSpace(dump()), "\n")
+		Expect(lines).To(HaveLen(5))
+		Expect(lines[0]).To(HavePrefix("3 pending events at "))
+		Expect(strings.Fields(lines[1])).To(Equal([]string{"#", "DUE", "IN", "EXPIRE", "TYPE", "VALUE", "DETAILS"}))
+		Expect(strings.Fields(lines[2])).To(ContainElements("1", "string", "due", "popped"))
+		Expect(strings.Fields(lines[3])).To(ContainElements("2", now.Add(time.Hour).Format(time.RFC3339Nano),
+			"int", "42", "priority=2"))
+		Expect(lines[3]).To(MatchRegexp(`^2\s+\+59m5\d(\.\d+)?s\s`))
+		Expect(strings.Fields(lines[4])).To(ContainElements("3", "retry", "{ID:a", "Attempt:0}", "topic=retries"))
+	})
+
+	It("writes just the heading for an empty heap", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		Expect(th.String()).To(Equal("TimerHeap(0 pending)"))
+
+		var out bytes.Buffer
+		Expect(th.Dump(&out)).To(Succeed())
+		Expect(out.String()).To(MatchRegexp(`^0 pending events at [^\n]+\n$`))
+	})
+
+	It("describes a terminated heap", func() {
+		th := timerheap.New()
+		th.Terminate()
+		Expect(th.String()).To(Equal("TimerHeap(terminated)"))
+	})
+})
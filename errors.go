@@ -0,0 +1,59 @@
+package timerheap
+
+import (
+	"errors"
+)
+
+var (
+	// ErrUnregisteredType is returned when pushing a value whose type is not registered with a
+	// strict TypeRegistry.
+	ErrUnregisteredType = errors.New("timerheap: unregistered payload type")
+
+	// ErrFull is returned when pushing an event to a heap that already holds the maximum
+	// number of pending events.
+	ErrFull = errors.New("timerheap: heap is full")
+
+	// ErrPastDeadline is returned when pushing an event that is already due to a heap created
+	// with WithStrictDeadlines.
+	ErrPastDeadline = errors.New("timerheap: event deadline is not in the future")
+
+	// ErrTerminated is returned when a push cannot complete because the heap has been
+	// terminated.
+	ErrTerminated = errors.New("timerheap: heap is terminated")
+
+	// ErrQuiescing is returned when pushing an event to a heap that is no longer accepting new
+	// events, see Quiesce.
+	ErrQuiescing = errors.New("timerheap: heap is quiescing")
+
+	// ErrNoTypeRegistry is returned when saving or loading the events of a heap that was not
+	// created with a TypeRegistry.
+	ErrNoTypeRegistry = errors.New("timerheap: no type registry")
+
+	// ErrAckExpired is returned when acknowledging a delivery too late to prevent the event
+	// being delivered again, or that has already been acknowledged.
+	ErrAckExpired = errors.New("timerheap: acknowledgement expired")
+
+	// ErrHandleUnsupported is returned when pushing an event with a Handle to a heap with a
+	// Store, and ends a recurrence pushed with a Handle, see Recur.
+	ErrHandleUnsupported = errors.New("timerheap: handles are not supported by this heap")
+
+	// ErrMergeUnsupported is returned when moving events between heaps that cannot be merged,
+	// see Merge and Transfer.
+	ErrMergeUnsupported = errors.New("timerheap: heaps cannot be merged")
+
+	// ErrNotFound is returned when transferring an event that is not pending in the heap.
+	ErrNotFound = errors.New("timerheap: no such pending event")
+
+	// ErrDuplicateKey is returned when transferring an event to a heap that already has a
+	// pending or recently completed event with the same key. Pushing a duplicate event is not
+	// an error, see WithKey.
+	ErrDuplicateKey = errors.New("timerheap: duplicate event key")
+
+	// ErrOffsetUnavailable is returned when resuming a subscription from an offset the fired
+	// log does not hold the events after, see SubscribeFrom.
+	ErrOffsetUnavailable = errors.New("timerheap: offset is not available in the fired log")
+
+	// ErrThreadPriorityUnsupported is reported when the event goroutine cannot be given a
+	// thread priority on this platform, see WithLockedThread.
+	ErrThreadPriorityUnsupported = errors.New("timerheap: thread priority is not supported on this platform")
+)
@@ -0,0 +1,306 @@
+package timerheap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultExportLimit is the number of events exported in a page if the request does not give a
+// limit.
+const defaultExportLimit = 100
+
+// exportedEvent is a pending event as exported and imported by the admin handler.
+type exportedEvent struct {
+	Expire time.Time `json:"expire"`
+	// NotAfter is the latest time the event may be delivered, see PushEventWindow, or nil if
+	// there is no limit.
+	NotAfter *time.Time `json:"notAfter,omitempty"`
+	Priority int        `json:"priority,omitempty"`
+	Tiebreak int        `json:"tiebreak,omitempty"`
+	Topic    string     `json:"topic,omitempty"`
+	Key      string     `json:"key,omitempty"`
+	Metadata Metadata   `json:"metadata,omitempty"`
+	// Type is the name the type of the value is registered under, or empty if it is not
+	// registered, in which case the value is imported as decoded by encoding/json.
+	Type  string          `json:"type,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+// adminExport is a page of exported events, and the body of a request to import events. Next is
+// the cursor for the next page, or empty if there are no more events.
+type adminExport struct {
+	Events []exportedEvent `json:"events"`
+	Next   string          `json:"next,omitempty"`
+}
+
+// adminImported is the response to a request to import events.
+type adminImported struct {
+	Imported int `json:"imported"`
+	Replaced int `json:"replaced"`
+	Skipped  int `json:"skipped"`
+}
+
+// importConflict is what an import does with an event whose key is taken.
+type importConflict string
+
+const (
+	importSkip    importConflict = "skip"
+	importReplace importConflict = "replace"
+	importFail    importConflict = "fail"
+)
+
+// exportFilter selects the events to export.
+type exportFilter struct {
+	// from and to bound the expiration of the events, from inclusive and to exclusive, and are
+	// ignored if zero.
+	from, to time.Time
+	// labels are the metadata the events must have. An empty value matches any value.
+	labels map[string]string
+	// after is the position of the last event of the previous page, or nil for the first page.
+	after *timedItem
+}
+
+// match returns true if the item passes the filter.
+func (f *exportFilter) match(ti *timedItem) bool {
+	if !f.from.IsZero() && ti.expire.Before(f.from) {
+		return false
+	}
+	if !f.to.IsZero() && !ti.expire.Before(f.to) {
+		return false
+	}
+	for name, value := range f.labels {
+		v, ok := ti.metadata[name]
+		if !ok || (value != "" && v != value) {
+			return false
+		}
+	}
+	return f.after == nil || f.after.before(ti)
+}
+
+// parseExportFilter parses the query parameters of an export request.
+func parseExportFilter(r *http.Request) (exportFilter, int, error) {
+	query := r.URL.Query()
+	f := exportFilter{labels: map[string]string{}}
+	var err error
+	if from := query.Get("from"); from != "" {
+		if f.from, err = time.Parse(time.RFC3339Nano, from); err != nil {
+			return f, 0, err
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if f.to, err = time.Parse(time.RFC3339Nano, to); err != nil {
+			return f, 0, err
+		}
+	}
+	for _, label := range query["label"] {
+		name, value := label, ""
+		if i := strings.IndexByte(label, '='); i >= 0 {
+			name, value = label[:i], label[i+1:]
+		}
+		if name == "" {
+			return f, 0, fmt.Errorf("invalid label %q", label)
+		}
+		f.labels[name] = value
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		if f.after, err = parseExportCursor(cursor); err != nil {
+			return f, 0, err
+		}
+	}
+	limit := defaultExportLimit
+	if l := query.Get("limit"); l != "" {
+		if limit, err = strconv.Atoi(l); err != nil {
+			return f, 0, err
+		}
+		if limit <= 0 {
+			return f, 0, fmt.Errorf("invalid limit %d", limit)
+		}
+	}
+	return f, limit, nil
+}
+
+// exportCursor returns the cursor for the page after the item. It holds the fields the items
+// are ordered by, see timedItem.before, so that the next page starts after the item even if it
+// is no longer pending.
+func exportCursor(ti *timedItem) string {
+	return fmt.Sprintf("%d.%d.%d", ti.expire.UnixNano(), ti.tiebreak, ti.seq)
+}
+
+// parseExportCursor parses a cursor returned by exportCursor into an item at its position.
+func parseExportCursor(cursor string) (*timedItem, error) {
+	invalid := fmt.Errorf("invalid cursor %q", cursor)
+	fields := strings.Split(cursor, ".")
+	if len(fields) != 3 {
+		return nil, invalid
+	}
+	expire, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return nil, invalid
+	}
+	tiebreak, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, invalid
+	}
+	seq, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil {
+		return nil, invalid
+	}
+	return &timedItem{expire: time.Unix(0, expire), tiebreak: tiebreak, seq: seq}, nil
+}
+
+// exportEvent returns the item as exported by the admin handler.
+func (t *timerHeap) exportEvent(ti *timedItem) (exportedEvent, error) {
+	value, err := json.Marshal(ti.value)
+	if err != nil {
+		return exportedEvent{}, fmt.Errorf("failed to encode the value of event %d: %w", ti.seq, err)
+	}
+	ev := exportedEvent{
+		Expire:   ti.expire.Round(0),
+		Priority: ti.priority,
+		Tiebreak: ti.tiebreak,
+		Topic:    ti.topic,
+		Key:      ti.key,
+		Metadata: ti.metadata,
+		Value:    value,
+	}
+	if !ti.notAfter.IsZero() {
+		notAfter := ti.notAfter.Round(0)
+		ev.NotAfter = &notAfter
+	}
+	if t.types != nil {
+		ev.Type, _ = t.types.Name(ti.value)
+	}
+	return ev, nil
+}
+
+// adminExportEvents handles a request to export a page of the pending events.
+func adminExportEvents(th TimerHeap, w http.ResponseWriter, r *http.Request) {
+	t, ok := th.(*timerHeap)
+	if !ok {
+		http.Error(w, "exporting events is not supported", http.StatusNotImplemented)
+		return
+	}
+	filter, limit, err := parseExportFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The events that have popped are exported in the order they are due along with the rest,
+	// so that a cursor marks the same position whatever has popped since the previous page.
+	items, _ := t.pendingItems()
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].before(&items[j])
+	})
+	resp := adminExport{Events: []exportedEvent{}}
+	var last *timedItem
+	for i := range items {
+		ti := &items[i]
+		if !filter.match(ti) {
+			continue
+		}
+		if len(resp.Events) == limit {
+			resp.Next = exportCursor(last)
+			break
+		}
+		last = ti
+		ev, err := t.exportEvent(ti)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.Events = append(resp.Events, ev)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// adminImportEvents handles a request to import events.
+func adminImportEvents(th TimerHeap, w http.ResponseWriter, r *http.Request) {
+	t, ok := th.(*timerHeap)
+	if !ok {
+		http.Error(w, "importing events is not supported", http.StatusNotImplemented)
+		return
+	}
+	conflict := importConflict(r.URL.Query().Get("conflict"))
+	switch conflict {
+	case "":
+		conflict = importSkip
+	case importSkip, importReplace, importFail:
+	default:
+		http.Error(w, fmt.Sprintf("invalid conflict policy %q", conflict), http.StatusBadRequest)
+		return
+	}
+	var req adminExport
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Every event is decoded, and checked for conflicts if the import fails on them, before
+	// any is pushed, so that a request that is rejected imports nothing.
+	values := make([]interface{}, len(req.Events))
+	keys := map[string]bool{}
+	for i, ev := range req.Events {
+		value, err := adminValue(t, ev.Type, ev.Value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("event %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		values[i] = value
+		if conflict != importFail || ev.Key == "" {
+			continue
+		}
+		if keys[ev.Key] || t.dedup.taken(ev.Key) {
+			http.Error(w, fmt.Sprintf("event %d: key %q is taken", i, ev.Key), http.StatusConflict)
+			return
+		}
+		keys[ev.Key] = true
+	}
+
+	var resp adminImported
+	for i, ev := range req.Events {
+		if ev.Key != "" && t.dedup.taken(ev.Key) {
+			// Only a pending event is replaced. The key of an event that has been delivered,
+			// or has popped and is waiting to be, is kept so that the event is not delivered
+			// again.
+			if conflict != importReplace || !t.removeKey(ev.Key) {
+				resp.Skipped++
+				continue
+			}
+			t.dedup.forget(ev.Key)
+			resp.Replaced++
+		}
+		opts := []PushOption{WithPriorityClass(ev.Priority), WithTiebreak(ev.Tiebreak)}
+		if ev.Topic != "" {
+			opts = append(opts, WithTopic(ev.Topic))
+		}
+		if ev.Key != "" {
+			opts = append(opts, WithKey(ev.Key))
+		}
+		if ev.Metadata != nil {
+			opts = append(opts, WithMetadata(ev.Metadata))
+		}
+		var notAfter time.Time
+		if ev.NotAfter != nil {
+			notAfter = *ev.NotAfter
+		}
+		if err := t.PushEventWindow(ev.Expire, notAfter, values[i], opts...); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrFull) || errors.Is(err, ErrTerminated) {
+				status = http.StatusServiceUnavailable
+			}
+			http.Error(w, fmt.Sprintf("event %d: %v, after importing %d events", i, err, resp.Imported), status)
+			return
+		}
+		resp.Imported++
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
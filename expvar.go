@@ -0,0 +1,50 @@
+package timerheap
+
+import (
+	"expvar"
+	"sync"
+)
+
+var (
+	// expvarHeaps maps each expvar name to the heap currently published under that name. An
+	// expvar cannot be removed once published, so the expvar for a name is registered once
+	// and looks up the heap each time it is read. A nil entry means the heap published under
+	// that name has been terminated.
+	expvarLock  sync.Mutex
+	expvarHeaps = map[string]*timerHeap{}
+)
+
+// publishExpvar publishes the stats of the heap under the supplied name.
+func publishExpvar(name string, t *timerHeap) {
+	expvarLock.Lock()
+	defer expvarLock.Unlock()
+
+	if _, ok := expvarHeaps[name]; !ok {
+		expvar.Publish(name, expvar.Func(func() interface{} {
+			return expvarStats(name)
+		}))
+	}
+	expvarHeaps[name] = t
+}
+
+// unpublishExpvar removes the heap from the expvar with the supplied name. The expvar itself
+// remains and reports null until another heap is published with the same name.
+func unpublishExpvar(name string, t *timerHeap) {
+	expvarLock.Lock()
+	defer expvarLock.Unlock()
+
+	if expvarHeaps[name] == t {
+		expvarHeaps[name] = nil
+	}
+}
+
+func expvarStats(name string) interface{} {
+	expvarLock.Lock()
+	t := expvarHeaps[name]
+	expvarLock.Unlock()
+
+	if t == nil {
+		return nil
+	}
+	return t.Stats()
+}
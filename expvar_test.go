@@ -0,0 +1,47 @@
+package timerheap_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("timer heap expvar tests", func() {
+
+	getStats := func() *timerheap.Stats {
+		v := expvar.Get("timerheap-test")
+		Expect(v).NotTo(BeNil())
+		var s *timerheap.Stats
+		Expect(json.Unmarshal([]byte(v.String()), &s)).To(Succeed())
+		return s
+	}
+
+	It("publishes the heap stats and can republish under the same name", func() {
+		By("creating a heap publishing its stats")
+		th := timerheap.New(timerheap.WithExpvar("timerheap-test"))
+
+		By("adding a past event and receiving it")
+		th.PushEvent(-time.Second, 1)
+		Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive())
+
+		By("Checking the published stats")
+		Eventually(func() uint64 { return getStats().Delivered }).Should(Equal(uint64(1)))
+		s := getStats()
+		Expect(s.Pending).To(BeZero())
+		Expect(s.LastLateness).To(BeNumerically(">=", time.Second))
+
+		By("Terminating the heap and checking the stats are no longer published")
+		th.Terminate()
+		Expect(getStats()).To(BeNil())
+
+		By("Creating a new heap with the same name")
+		th = timerheap.New(timerheap.WithExpvar("timerheap-test"))
+		defer th.Terminate()
+		th.PushEvent(time.Hour, 2)
+		Expect(getStats().Pending).To(Equal(1))
+	})
+})
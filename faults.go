@@ -0,0 +1,101 @@
+package timerheap
+
+import (
+	"fmt"
+)
+
+// FaultKind is the kind of an internal anomaly reported on the Errors channel.
+type FaultKind int
+
+const (
+	// FaultClockJump is reported when the wall clock jumps, see WithClockJumpPolicy.
+	FaultClockJump FaultKind = iota
+	// FaultSuspend is reported when the system resumes from a suspend, see
+	// WithSuspendPolicy.
+	FaultSuspend
+	// FaultDropped is reported when an event is dropped because the heap or its delivery
+	// buffer is full.
+	FaultDropped
+	// FaultPersistence is reported when an event cannot be written to, read from or removed
+	// from the write-ahead log or Store of a persistent heap, including events that cannot be
+	// decoded.
+	FaultPersistence
+	// FaultSlowConsumer is reported when the slow consumer watchdog trips, see
+	// WithSlowConsumerWatchdog.
+	FaultSlowConsumer
+	// FaultPanic is reported when a panic is recovered from a callback, see
+	// WithPanicHandler.
+	FaultPanic
+)
+
+func (k FaultKind) String() string {
+	switch k {
+	case FaultClockJump:
+		return "clock jump"
+	case FaultSuspend:
+		return "suspend"
+	case FaultDropped:
+		return "dropped"
+	case FaultPersistence:
+		return "persistence"
+	case FaultSlowConsumer:
+		return "slow consumer"
+	case FaultPanic:
+		return "panic"
+	default:
+		return "unknown"
+	}
+}
+
+// Fault is an internal anomaly of a heap, as received from the Errors channel.
+type Fault struct {
+	// The kind of anomaly.
+	Kind FaultKind
+	// A description of the anomaly.
+	Detail string
+	// The error that caused the anomaly, if there is one.
+	Err error
+}
+
+func (f *Fault) Error() string {
+	if f.Err != nil {
+		return fmt.Sprintf("timerheap: %s: %v", f.Detail, f.Err)
+	}
+	return "timerheap: " + f.Detail
+}
+
+// Unwrap returns the error that caused the anomaly, so that it can be matched with errors.Is
+// and errors.As.
+func (f *Fault) Unwrap() error {
+	return f.Err
+}
+
+// WithErrors configures the heap to report internal anomalies, which are otherwise only
+// logged, on the Errors channel. See FaultKind for the anomalies reported. If limit is greater
+// than 0 at most limit faults are queued, and the oldest is dropped to make room for a new one,
+// so that a heap whose faults are not received does not grow without bound.
+func WithErrors(limit int) Option {
+	return func(t *timerHeap) {
+		t.faults = newQueue[error](limit)
+	}
+}
+
+// Errors returns the channel that internal anomalies are reported on, each as a *Fault. This is
+// nil unless the heap was created with the WithErrors option.
+//
+// Reporting a fault never blocks the heap. The channel is closed once the heap is terminated
+// and every queued fault has been received.
+func (t *timerHeap) Errors() <-chan error {
+	if t.faults == nil {
+		return nil
+	}
+	return t.faults.out
+}
+
+// fault reports an anomaly on the Errors channel, if there is one. The anomaly is logged by the
+// caller.
+func (t *timerHeap) fault(kind FaultKind, detail string, err error) {
+	if t.faults != nil {
+		t.faults.add(&Fault{Kind: kind, Detail: detail, Err: err})
+	}
+}
@@ -0,0 +1,91 @@
+package timerheap_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("timer heap errors channel tests", func() {
+
+	// receiveFault receives the next fault from the heap.
+	receiveFault := func(th timerheap.TimerHeap) *timerheap.Fault {
+		var err error
+		EventuallyWithOffset(1, th.Errors(), "1s").Should(Receive(&err))
+		var f *timerheap.Fault
+		ExpectWithOffset(1, errors.As(err, &f)).To(BeTrue())
+		return f
+	}
+
+	It("has no errors channel by default", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		Expect(th.Errors()).To(BeNil())
+	})
+
+	It("reports events dropped because the heap is full", func() {
+		th := timerheap.New(
+			timerheap.WithErrors(0),
+			timerheap.WithMaxPending(1),
+			timerheap.WithOverflowPolicy(timerheap.OverflowDropFarthest),
+		)
+		defer th.Terminate()
+		Expect(th.PushEvent(time.Hour, "a")).To(Succeed())
+		Expect(th.PushEvent(2*time.Hour, "b")).To(Succeed())
+		f := receiveFault(th)
+		Expect(f.Kind).To(Equal(timerheap.FaultDropped))
+		Expect(f.Error()).To(Equal("timerheap: event dropped, heap is full"))
+	})
+
+	It("reports panics recovered from callbacks", func() {
+		cause := errors.New("hook failed")
+		th := timerheap.New(timerheap.WithErrors(0), timerheap.WithHooks(timerheap.Hooks{
+			OnFire: func(timerheap.TimedResult) { panic(cause) },
+		}))
+		defer th.Terminate()
+		Expect(th.PushEvent(0, "a")).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("a")))
+		f := receiveFault(th)
+		Expect(f.Kind).To(Equal(timerheap.FaultPanic))
+		Expect(f).To(MatchError(cause))
+		Expect(f.Error()).To(Equal("timerheap: recovered panic in callback: hook failed"))
+	})
+
+	It("reports slow consumers", func() {
+		th := timerheap.New(timerheap.WithErrors(0), timerheap.WithSlowConsumerWatchdog(20*time.Millisecond, nil))
+		defer th.Terminate()
+		Expect(th.PushEvent(0, "a")).To(Succeed())
+		Expect(receiveFault(th).Kind).To(Equal(timerheap.FaultSlowConsumer))
+	})
+
+	It("keeps only the latest faults up to the limit", func() {
+		th := timerheap.New(
+			timerheap.WithErrors(1),
+			timerheap.WithMaxPending(1),
+			timerheap.WithOverflowPolicy(timerheap.OverflowDropFarthest),
+			timerheap.WithSlowConsumerWatchdog(20*time.Millisecond, nil),
+		)
+		Expect(th.PushEvent(0, "a")).To(Succeed())
+		for i := 0; i < 5; i++ {
+			Expect(th.PushEvent(time.Hour, i)).To(Succeed())
+		}
+		time.Sleep(100 * time.Millisecond)
+		th.Terminate()
+
+		var faults []error
+		for err := range th.Errors() {
+			faults = append(faults, err)
+		}
+		Expect(len(faults)).To(BeNumerically("<=", 2))
+		Expect(faults[len(faults)-1].(*timerheap.Fault).Kind).To(Equal(timerheap.FaultSlowConsumer))
+	})
+
+	It("closes the errors channel once the heap is terminated", func() {
+		th := timerheap.New(timerheap.WithErrors(0))
+		th.Terminate()
+		Eventually(th.Errors(), "1s").Should(BeClosed())
+	})
+})
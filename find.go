@@ -0,0 +1,36 @@
+package timerheap
+
+import (
+	"time"
+)
+
+// Contains returns true if there is a pending event whose value match returns true for. See
+// Find.
+func (t *timerHeap) Contains(match func(value interface{}) bool) bool {
+	_, _, ok := t.Find(match)
+	return ok
+}
+
+// Find returns the value and scheduled time of the pending event whose value match returns
+// true for, or false if there is no such event. If several events match, the one that is
+// delivered first is returned. Events that have popped but not been received are included.
+//
+// Only the events held by the heap are searched, in the same way as Remove. The match function
+// is called with the heap locked, so it must not call the heap.
+func (t *timerHeap) Find(match func(value interface{}) bool) (interface{}, time.Time, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.drainPushedLocked()
+	for i := range t.ready {
+		if ti := &t.ready[i]; ti.deliver == nil && match(ti.value) {
+			return ti.value, ti.expire, true
+		}
+	}
+	ti := t.valueHeap.first(func(ti *timedItem) bool {
+		return ti.deliver == nil && match(ti.value)
+	})
+	if ti == nil {
+		return nil, time.Time{}, false
+	}
+	return ti.value, ti.expire, true
+}
@@ -0,0 +1,67 @@
+package timerheap_test
+
+import (
+	"math/rand"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Find", func() {
+	even := func(v interface{}) bool {
+		d, ok := v.(testdata)
+		return ok && d.index%2 == 0
+	}
+
+	DescribeTable("finds the first matching event",
+		func(b timerheap.BackendType) {
+			th := timerheap.New(timerheap.WithBackend(b))
+			defer th.Terminate()
+
+			start := time.Now().Add(time.Hour)
+			for _, i := range rand.Perm(100) {
+				Expect(th.PushEventAt(start.Add(time.Duration(i)*time.Second), testdata{index: 2*i + 1})).To(Succeed())
+			}
+			Expect(th.Contains(even)).To(BeFalse())
+			_, _, ok := th.Find(even)
+			Expect(ok).To(BeFalse())
+
+			for _, i := range []int{70, 30, 50} {
+				Expect(th.PushEventAt(start.Add(time.Duration(i)*time.Second), testdata{index: 2 * i})).To(Succeed())
+			}
+			Expect(th.Contains(even)).To(BeTrue())
+			value, expire, ok := th.Find(even)
+			Expect(ok).To(BeTrue())
+			Expect(value).To(Equal(testdata{index: 60}))
+			Expect(expire).To(Equal(start.Add(30 * time.Second)))
+		},
+		Entry("binary heap", timerheap.BinaryHeap),
+		Entry("4-ary heap", timerheap.QuaternaryHeap),
+		Entry("pairing heap", timerheap.PairingHeap),
+		Entry("min-max heap", timerheap.MinMaxHeap),
+	)
+
+	It("finds events that have popped but not been received", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		Expect(th.PushEvent(0, "a")).To(Succeed())
+		Expect(th.PushEvent(time.Hour, "b")).To(Succeed())
+		time.Sleep(10 * time.Millisecond)
+		Expect(th.Contains(func(v interface{}) bool { return v == "a" })).To(BeTrue())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("a")))
+		Eventually(func() bool {
+			return th.Contains(func(v interface{}) bool { return v == "a" })
+		}, "1s").Should(BeFalse())
+	})
+
+	It("does not find internal timers", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		th.AfterChan(time.Hour)
+		Expect(th.Contains(func(interface{}) bool { return true })).To(BeFalse())
+	})
+})
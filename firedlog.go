@@ -0,0 +1,206 @@
+package timerheap
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FiredEvent is sent to the subscribers of a heap created with WithFiredLog in place of the
+// fired value.
+type FiredEvent struct {
+	// The offset of the event in the fired log. Offsets start at 1 and increase by one for
+	// each fired event.
+	Offset uint64
+	// The value that was pushed, or the TimedResult if the heap was created with
+	// WithTimedResults.
+	Value interface{}
+}
+
+// WithFiredLog keeps a log of the events fired by the heap for the retention period, so that a
+// subscriber that disconnects can later resume from where it left off, see SubscribeFrom and
+// Subscription.Offset.
+//
+// Every fired event is recorded in the log and sent to the subscribers, as a FiredEvent holding
+// its offset in the log, whether or not there are any subscribers at the time. Events are not
+// delivered on the results channel. Subscribers read the events from the log rather than
+// buffering them, so a slow subscriber receives every event that is still retained when it
+// gets to it. The log is held in memory, so the retention period should be kept short for heaps
+// firing a large number of events.
+func WithFiredLog(retention time.Duration) Option {
+	return func(t *timerHeap) {
+		t.firedLog = &firedLog{retention: retention, next: 1}
+	}
+}
+
+// firedLog holds the events fired within the retention period. The lock is held while an event
+// is recorded and the subscribers are woken, and while a subscriber is added or removed, so that
+// a subscriber resuming from an offset receives every event after it exactly once. The lock
+// must be acquired before the heap lock.
+type firedLog struct {
+	lock      sync.Mutex
+	retention time.Duration
+	// entries holds the retained events, oldest first, and next is the offset of the next
+	// event to be fired.
+	entries []firedEntry
+	next    uint64
+}
+
+// firedEntry is a fired event, and when it was recorded in the log.
+type firedEntry struct {
+	event FiredEvent
+	fired time.Time
+}
+
+// appendLocked records the value in the log, returning it as a FiredEvent. The caller must
+// hold the lock.
+func (l *firedLog) appendLocked(value interface{}, now time.Time) FiredEvent {
+	l.pruneLocked(now)
+	ev := FiredEvent{Offset: l.next, Value: value}
+	l.next++
+	l.entries = append(l.entries, firedEntry{event: ev, fired: now})
+	return ev
+}
+
+// availableLocked returns ErrOffsetUnavailable if some of the events after the offset are no
+// longer retained, or the offset has not been reached. The caller must hold the lock.
+func (l *firedLog) availableLocked(offset uint64) error {
+	l.pruneLocked(time.Now())
+	if offset+1 < l.oldestLocked() || offset >= l.next {
+		return ErrOffsetUnavailable
+	}
+	return nil
+}
+
+// oldestLocked returns the offset of the oldest retained event, or of the next event if none
+// are retained. The caller must hold the lock.
+func (l *firedLog) oldestLocked() uint64 {
+	return l.next - uint64(len(l.entries))
+}
+
+// pruneLocked forgets the events recorded before the retention period. The caller must hold
+// the lock.
+func (l *firedLog) pruneLocked(now time.Time) {
+	cutoff := now.Add(-l.retention)
+	n := 0
+	for n < len(l.entries) && l.entries[n].fired.Before(cutoff) {
+		l.entries[n] = firedEntry{}
+		n++
+	}
+	l.entries = l.entries[n:]
+}
+
+// logReader sends the events in the fired log to a subscriber, reading them from the log in
+// turn rather than buffering copies, so that a subscriber that falls behind does not miss any
+// event still retained. If the subscriber falls so far behind that the next event is no longer
+// retained, the events that were pruned are counted as dropped and the out channel is closed,
+// leaving the offset at the last event received.
+type logReader struct {
+	l *firedLog
+	// offset is the offset of the last event received, see Subscription.Offset.
+	offset  *atomic.Uint64
+	lock    sync.Mutex
+	dropped uint64
+	closed  bool
+	stopped bool
+	// notify is used to wake the reader when an event is recorded in the log. It is of
+	// capacity 1 because only a single backed-up notification is needed.
+	notify chan struct{}
+	// done is closed to terminate the reader immediately.
+	done chan struct{}
+	out  chan interface{}
+}
+
+// newLogReader returns a reader that sends the events after the offset, which must be retained.
+func newLogReader(l *firedLog, offset *atomic.Uint64) *logReader {
+	r := &logReader{
+		l:      l,
+		offset: offset,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		out:    make(chan interface{}),
+	}
+	go r.run(offset.Load() + 1)
+	return r
+}
+
+// add wakes the reader, the event has been recorded in the log.
+func (r *logReader) add(interface{}) {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// close marks the reader as closed, the out channel is closed once the reader has sent the last
+// event in the log.
+func (r *logReader) close() {
+	r.lock.Lock()
+	r.closed = true
+	r.lock.Unlock()
+	r.add(nil)
+}
+
+// stop closes the out channel without sending any more events.
+func (r *logReader) stop() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.done)
+	}
+}
+
+// droppedCount returns the number of events pruned from the log before they were sent.
+func (r *logReader) droppedCount() uint64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.dropped
+}
+
+// events returns the out channel.
+func (r *logReader) events() <-chan interface{} {
+	return r.out
+}
+
+// run sends the events in the log from the offset next.
+func (r *logReader) run(next uint64) {
+	defer close(r.out)
+	for {
+		r.l.lock.Lock()
+		r.l.pruneLocked(time.Now())
+		oldest := r.l.oldestLocked()
+		if next < oldest {
+			r.l.lock.Unlock()
+			r.lock.Lock()
+			r.dropped += oldest - next
+			r.lock.Unlock()
+			return
+		}
+		if next == r.l.next {
+			r.l.lock.Unlock()
+			r.lock.Lock()
+			closed := r.closed
+			r.lock.Unlock()
+			if closed {
+				return
+			}
+			select {
+			case <-r.notify:
+				continue
+			case <-r.done:
+				return
+			}
+		}
+		ev := r.l.entries[next-oldest].event
+		r.l.lock.Unlock()
+
+		select {
+		case r.out <- ev:
+			r.offset.Store(ev.Offset)
+			next++
+		case <-r.done:
+			return
+		}
+	}
+}
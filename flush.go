@@ -0,0 +1,103 @@
+package timerheap
+
+import (
+	"context"
+	"math"
+)
+
+// flushWaiter is a call to Flush waiting for the events pushed before it to be delivered.
+type flushWaiter struct {
+	// seq is the sequence number of the first event pushed after the call.
+	seq uint64
+	// done is closed once the events have been delivered, or the heap is terminated, in which
+	// case err is set.
+	done chan struct{}
+	err  error
+}
+
+// Flush blocks until every event pushed before the call has been delivered, dropped or
+// discarded, or the context is done. Events pushed after the call do not delay it. It returns
+// ErrTerminated if the heap is terminated first, or the context error if the context is done
+// first.
+//
+// While there are calls to Flush waiting, the pending events are scanned each time the heap
+// is processed, so this is intended for tests and shutdown rather than regular use on large
+// heaps.
+func (t *timerHeap) Flush(ctx context.Context) error {
+	t.lock.Lock()
+	if t.terminated {
+		t.lock.Unlock()
+		return ErrTerminated
+	}
+	t.drainPushedLocked()
+	w := &flushWaiter{
+		seq:  t.nextSeq.Load(),
+		done: make(chan struct{}),
+	}
+	if t.minSeqLocked() >= w.seq {
+		t.lock.Unlock()
+		return nil
+	}
+	t.flushes = append(t.flushes, w)
+	t.lock.Unlock()
+
+	select {
+	case <-w.done:
+		return w.err
+	case <-ctx.Done():
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		for i, other := range t.flushes {
+			if other == w {
+				t.flushes = append(t.flushes[:i], t.flushes[i+1:]...)
+				break
+			}
+		}
+		return ctx.Err()
+	}
+}
+
+// checkFlushesLocked releases the calls to Flush whose events have all been delivered. If the
+// heap has been terminated all calls are released with ErrTerminated. The caller must hold the
+// lock.
+func (t *timerHeap) checkFlushesLocked() {
+	if len(t.flushes) == 0 {
+		return
+	}
+	lowest := uint64(0)
+	if !t.terminated {
+		lowest = t.minSeqLocked()
+	}
+	remaining := t.flushes[:0]
+	for _, w := range t.flushes {
+		switch {
+		case t.terminated:
+			w.err = ErrTerminated
+			close(w.done)
+		case w.seq <= lowest:
+			close(w.done)
+		default:
+			remaining = append(remaining, w)
+		}
+	}
+	for i := len(remaining); i < len(t.flushes); i++ {
+		t.flushes[i] = nil
+	}
+	t.flushes = remaining
+}
+
+// minSeqLocked returns the lowest sequence number of the pending events, or the maximum
+// sequence number if there are none. Pushed events must have been moved onto the heap. The
+// caller must hold the lock.
+func (t *timerHeap) minSeqLocked() uint64 {
+	lowest := uint64(math.MaxUint64)
+	t.seqScan = t.valueHeap.appendTo(append(t.seqScan[:0], t.ready...))
+	for i := range t.seqScan {
+		if t.seqScan[i].seq < lowest {
+			lowest = t.seqScan[i].seq
+		}
+		t.seqScan[i] = timedItem{}
+	}
+	t.seqScan = t.seqScan[:0]
+	return lowest
+}
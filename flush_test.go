@@ -0,0 +1,62 @@
+package timerheap_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Flush", func() {
+	var th timerheap.TimerHeap
+
+	BeforeEach(func() {
+		th = timerheap.New(timerheap.WithNonBlockingDelivery(0))
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("returns immediately when there are no pending events", func() {
+		Expect(th.Flush(context.Background())).To(Succeed())
+	})
+
+	It("waits for the events pushed before the call to be delivered", func() {
+		Expect(th.PushEvent(10*time.Millisecond, testdata{index: 1})).To(Succeed())
+		Expect(th.PushEvent(20*time.Millisecond, testdata{index: 2})).To(Succeed())
+
+		flushed := make(chan error, 1)
+		go func() {
+			flushed <- th.Flush(context.Background())
+		}()
+
+		By("adding an event after the flush that is not waited for")
+		time.Sleep(5 * time.Millisecond)
+		Expect(th.PushEvent(time.Hour, testdata{index: 3})).To(Succeed())
+
+		Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(Equal(testdata{index: 1})))
+		Consistently(flushed, "50ms", "1ms").ShouldNot(Receive())
+		Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(Equal(testdata{index: 2})))
+		Eventually(flushed, "1s", "1ms").Should(Receive(BeNil()))
+	})
+
+	It("returns the context error if the context is done first", func() {
+		Expect(th.PushEvent(time.Hour, testdata{index: 1})).To(Succeed())
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		Expect(th.Flush(ctx)).To(Equal(context.DeadlineExceeded))
+	})
+
+	It("returns ErrTerminated if the heap is terminated first", func() {
+		Expect(th.PushEvent(time.Hour, testdata{index: 1})).To(Succeed())
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			th.Terminate()
+		}()
+		Expect(th.Flush(context.Background())).To(Equal(timerheap.ErrTerminated))
+	})
+})
@@ -0,0 +1,257 @@
+package timerheap
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// EventState is the state of an event tracked by a Handle.
+type EventState int
+
+const (
+	// EventPending is the state of an event that has not yet been delivered.
+	EventPending EventState = iota
+	// EventFired is the state of an event that has been delivered.
+	EventFired
+	// EventCancelled is the state of an event that was cancelled with Handle.Cancel, or removed
+	// with Remove, before it fired.
+	EventCancelled
+	// EventDropped is the state of an event that will never be delivered, for the reasons given
+	// by the dead letters, or because it was not scheduled.
+	EventDropped
+)
+
+func (s EventState) String() string {
+	switch s {
+	case EventPending:
+		return "pending"
+	case EventFired:
+		return "fired"
+	case EventCancelled:
+		return "cancelled"
+	case EventDropped:
+		return "dropped"
+	default:
+		return "unknown"
+	}
+}
+
+// Handle tracks a single event, pushed with WithHandle. The zero value is ready to use, but a
+// Handle must not be copied or used for more than one event.
+type Handle struct {
+	lock  sync.Mutex
+	heap  *timerHeap
+	state EventState
+	// done is created on the first call to Done, and closed once the event leaves the pending
+	// state.
+	done chan struct{}
+
+	// index and node locate the event in the slice based and pairing heap backends, so that it
+	// can be cancelled or rescheduled without searching the heap. They are protected by the
+	// heap lock rather than the lock of the handle, and may be stale once the event has left
+	// the heap, see backend.lookup.
+	index int
+	node  *pairingNode
+}
+
+// WithHandle tracks the event with the handle. If the event is not scheduled, because the push
+// fails or the event is a duplicate of one with the same key, the handle is dropped. Handles
+// are not supported by heaps with a Store, such as bolt-backed and clustered heaps, which may
+// hold events outside the heap, pushes to these fail with ErrHandleUnsupported.
+func WithHandle(h *Handle) PushOption {
+	return func(ti *timedItem) {
+		ti.handle = h
+	}
+}
+
+// Done returns a channel that is closed once the event has been delivered, cancelled or
+// dropped.
+func (h *Handle) Done() <-chan struct{} {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.done == nil {
+		h.done = make(chan struct{})
+		if h.state != EventPending {
+			close(h.done)
+		}
+	}
+	return h.done
+}
+
+// State returns the state of the event.
+func (h *Handle) State() EventState {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.state
+}
+
+// Wait waits until the event is delivered, cancelled or dropped, returning its state, or until
+// the context is done, in which case it returns EventPending and the error of the context.
+func (h *Handle) Wait(ctx context.Context) (EventState, error) {
+	select {
+	case <-h.Done():
+		return h.State(), nil
+	case <-ctx.Done():
+		if state := h.State(); state != EventPending {
+			return state, nil
+		}
+		return EventPending, ctx.Err()
+	}
+}
+
+// Cancel removes the event from the heap if it has not yet fired, returning true if it was
+// cancelled. An event that has popped but is waiting to be received from the results channel
+// has fired, and is not cancelled.
+func (h *Handle) Cancel() bool {
+	return h.apply(func(t *timerHeap) bool {
+		return t.cancel(h)
+	})
+}
+
+// Reschedule moves the event so that it pops after the given duration, returning true if it was
+// rescheduled. As with Cancel, an event that has popped cannot be rescheduled. The latest time
+// the event may be delivered, if it has one, moves with it.
+func (h *Handle) Reschedule(popAfter time.Duration) bool {
+	expire := time.Now().Add(popAfter)
+	return h.apply(func(t *timerHeap) bool {
+		return t.reschedule(h, expire)
+	})
+}
+
+// PushEventCtx adds an event that is cancelled if the context is done before the event fires,
+// so that an event scheduled for a request does not outlive the request. The event is tracked
+// with a Handle, which is the one supplied with WithHandle if there is one, so it cannot be
+// pushed to a bolt-backed or clustered heap. If the context is already done the event is not
+// pushed and the error of the context is returned.
+func (t *timerHeap) PushEventCtx(ctx context.Context, popAfter time.Duration, value interface{}, opts ...PushOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	h := &Handle{}
+	opts = append(opts[:len(opts):len(opts)], func(ti *timedItem) {
+		if ti.handle == nil {
+			ti.handle = h
+		} else {
+			h = ti.handle
+		}
+	})
+	if err := t.PushEvent(popAfter, value, opts...); err != nil {
+		return err
+	}
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				h.Cancel()
+			case <-h.Done():
+			}
+		}()
+	}
+	return nil
+}
+
+// attach associates the handle with the heap the event is pushed to.
+func (h *Handle) attach(t *timerHeap) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.heap = t
+}
+
+// apply calls fn with the heap the event was pushed to, returning true if fn does. If fn returns
+// false because the event has been moved to another heap by Merge, fn is called again with that
+// heap.
+func (h *Handle) apply(fn func(t *timerHeap) bool) bool {
+	h.lock.Lock()
+	t := h.heap
+	h.lock.Unlock()
+	for t != nil {
+		if fn(t) {
+			return true
+		}
+		h.lock.Lock()
+		moved := h.heap
+		h.lock.Unlock()
+		if moved == t {
+			return false
+		}
+		t = moved
+	}
+	return false
+}
+
+// finish moves the handle out of the pending state, if it is still pending. The handle may be
+// nil.
+func (h *Handle) finish(state EventState) {
+	if h == nil {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.state != EventPending {
+		return
+	}
+	h.state = state
+	if h.done != nil {
+		close(h.done)
+	}
+}
+
+// track prepares the heap to push an event with a handle.
+func (t *timerHeap) track(h *Handle) error {
+	if t.store != nil {
+		return ErrHandleUnsupported
+	}
+	h.attach(t)
+	if !t.handles.Load() {
+		t.handles.Store(true)
+	}
+	return nil
+}
+
+// cancel removes the pending item with the handle from the heap, returning false if there is
+// no such item.
+func (t *timerHeap) cancel(h *Handle) bool {
+	return t.removePending(func() (timedItem, bool) {
+		if ti := t.valueHeap.lookup(h); ti == nil || ti.attempt > 0 {
+			return timedItem{}, false
+		}
+		return t.valueHeap.removeHandle(h), true
+	})
+}
+
+// reschedule moves the pending item with the handle to expire at the given time, returning false
+// if there is no such item.
+func (t *timerHeap) reschedule(h *Handle, expire time.Time) bool {
+	expire = t.stamp(expire)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.drainPushedLocked()
+	ti := t.valueHeap.lookup(h)
+	if ti == nil || ti.attempt > 0 {
+		// An item waiting to be acknowledged has already fired.
+		return false
+	}
+	if !ti.notAfter.IsZero() {
+		ti.notAfter = ti.notAfter.Add(expire.Sub(ti.expire))
+	}
+	seq := ti.seq
+	t.valueHeap.rescheduleHandle(h, expire)
+	if t.wal != nil {
+		// The item is logged again while the lock is held, so that it cannot pop and be
+		// marked done before the new record is written.
+		if err := t.wal.pushed(t.valueHeap.lookup(h)); err != nil {
+			t.log.Warn("Failed to log rescheduled event", "seq", seq, "error", err)
+			t.fault(FaultPersistence, "failed to log rescheduled event", err)
+		}
+	}
+	if !t.terminated {
+		// The heap may need to wake up earlier or later.
+		t.wake()
+	}
+	if t.debug {
+		t.log.Debug("Rescheduled event", "seq", seq, "expire", expire)
+	}
+	return true
+}
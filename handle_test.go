@@ -0,0 +1,201 @@
+package timerheap_test
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("event handles", func() {
+	var th timerheap.TimerHeap
+	var h *timerheap.Handle
+
+	BeforeEach(func() {
+		th = timerheap.New()
+		h = &timerheap.Handle{}
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("is done once the event is delivered", func() {
+		Expect(th.PushEvent(20*time.Millisecond, 1, timerheap.WithHandle(h))).To(Succeed())
+		Expect(h.State()).To(Equal(timerheap.EventPending))
+		Consistently(h.Done(), "10ms").ShouldNot(BeClosed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		Eventually(h.Done(), "1s").Should(BeClosed())
+		Expect(h.State()).To(Equal(timerheap.EventFired))
+		Expect(h.Cancel()).To(BeFalse())
+	})
+
+	It("cancels a pending event", func() {
+		var cancelled []interface{}
+		th.Terminate()
+		th = timerheap.New(timerheap.WithHooks(timerheap.Hooks{
+			OnCancel: func(r timerheap.TimedResult) {
+				cancelled = append(cancelled, r.Value)
+			},
+		}))
+		done := h.Done()
+		Expect(th.PushEvent(20*time.Millisecond, 1, timerheap.WithHandle(h))).To(Succeed())
+		Expect(th.PushEvent(40*time.Millisecond, 2)).To(Succeed())
+		Expect(h.Cancel()).To(BeTrue())
+		Expect(done).To(BeClosed())
+		Expect(h.State()).To(Equal(timerheap.EventCancelled))
+		Expect(cancelled).To(Equal([]interface{}{1}))
+		Expect(h.Cancel()).To(BeFalse())
+
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(2)))
+		Eventually(func() int { return th.Stats().Pending }, "1s").Should(BeZero())
+	})
+
+	It("does not cancel an event that has popped", func() {
+		Expect(th.PushEvent(0, 1, timerheap.WithHandle(h))).To(Succeed())
+		time.Sleep(10 * time.Millisecond)
+		Expect(h.Cancel()).To(BeFalse())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		Eventually(h.State, "1s").Should(Equal(timerheap.EventFired))
+	})
+
+	It("is dropped when the event will never be delivered", func() {
+		now := time.Now()
+		Expect(th.PushEventWindow(now, now, 1, timerheap.WithHandle(h))).To(Succeed())
+		Eventually(h.Done(), "1s").Should(BeClosed())
+		Expect(h.State()).To(Equal(timerheap.EventDropped))
+
+		pending := &timerheap.Handle{}
+		Expect(th.PushEvent(time.Hour, 2, timerheap.WithHandle(pending))).To(Succeed())
+		th.Terminate()
+		Expect(pending.Done()).To(BeClosed())
+		Expect(pending.State()).To(Equal(timerheap.EventDropped))
+	})
+
+	It("is dropped when the event is not scheduled", func() {
+		Expect(th.PushEvent(time.Hour, 1, timerheap.WithKey("a"))).To(Succeed())
+		Expect(th.PushEvent(time.Hour, 2, timerheap.WithKey("a"), timerheap.WithHandle(h))).To(Succeed())
+		Expect(h.State()).To(Equal(timerheap.EventDropped))
+		Expect(h.Done()).To(BeClosed())
+	})
+
+	It("reschedules a pending event", func() {
+		Expect(th.PushEvent(time.Hour, 1, timerheap.WithHandle(h))).To(Succeed())
+		Expect(th.PushEvent(50*time.Millisecond, 2)).To(Succeed())
+		Expect(h.Reschedule(10 * time.Millisecond)).To(BeTrue())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(2)))
+		Eventually(h.State, "1s").Should(Equal(timerheap.EventFired))
+		Expect(h.Reschedule(time.Hour)).To(BeFalse())
+	})
+
+	It("moves the latest delivery time with the event", func() {
+		now := time.Now()
+		Expect(th.PushEventWindow(now.Add(time.Hour), now.Add(time.Hour+time.Second), 1, timerheap.WithHandle(h))).To(Succeed())
+		Expect(h.Reschedule(10 * time.Millisecond)).To(BeTrue())
+		events := th.Snapshot()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].NotAfter.Sub(events[0].ScheduledAt)).To(Equal(time.Second))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+	})
+
+	DescribeTable("cancels and reschedules events among many others",
+		func(b timerheap.BackendType) {
+			th.Terminate()
+			th = timerheap.New(timerheap.WithBackend(b))
+
+			start := time.Now().Add(time.Hour)
+			handles := make([]*timerheap.Handle, 1000)
+			for _, i := range rand.Perm(len(handles)) {
+				handles[i] = &timerheap.Handle{}
+				Expect(th.PushEventAt(start.Add(time.Duration(i)*time.Second), i, timerheap.WithHandle(handles[i]))).To(Succeed())
+			}
+
+			// Move every third event before the others, in reverse order, and cancel every
+			// fifth event that has not moved.
+			var expected []interface{}
+			for i := len(handles) - 1; i >= 0; i-- {
+				if i%3 == 0 {
+					Expect(handles[i].Reschedule(time.Minute + time.Duration(len(handles)-i)*time.Millisecond)).To(BeTrue())
+					expected = append(expected, i)
+				}
+			}
+			for i := range handles {
+				if i%3 == 0 {
+					continue
+				}
+				if i%5 == 0 {
+					Expect(handles[i].Cancel()).To(BeTrue())
+					Expect(handles[i].State()).To(Equal(timerheap.EventCancelled))
+					Expect(handles[i].Reschedule(time.Minute)).To(BeFalse())
+					continue
+				}
+				expected = append(expected, i)
+			}
+
+			var values []interface{}
+			for _, ev := range th.Snapshot() {
+				values = append(values, ev.Value)
+			}
+			Expect(values).To(Equal(expected))
+		},
+		Entry("binary heap", timerheap.BinaryHeap),
+		Entry("4-ary heap", timerheap.QuaternaryHeap),
+		Entry("pairing heap", timerheap.PairingHeap),
+		Entry("min-max heap", timerheap.MinMaxHeap),
+	)
+
+	It("waits for the event to fire", func() {
+		Expect(th.PushEvent(20*time.Millisecond, 1, timerheap.WithHandle(h))).To(Succeed())
+		go func() {
+			defer GinkgoRecover()
+			Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		}()
+		start := time.Now()
+		Expect(h.Wait(context.Background())).To(Equal(timerheap.EventFired))
+		Expect(time.Since(start)).To(BeNumerically(">=", 20*time.Millisecond))
+	})
+
+	It("waits for the event to be cancelled", func() {
+		Expect(th.PushEvent(time.Hour, 1, timerheap.WithHandle(h))).To(Succeed())
+		time.AfterFunc(10*time.Millisecond, func() {
+			h.Cancel()
+		})
+		Expect(h.Wait(context.Background())).To(Equal(timerheap.EventCancelled))
+	})
+
+	It("stops waiting when the context is done", func() {
+		Expect(th.PushEvent(time.Hour, 1, timerheap.WithHandle(h))).To(Succeed())
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		state, err := h.Wait(ctx)
+		Expect(state).To(Equal(timerheap.EventPending))
+		Expect(err).To(Equal(context.DeadlineExceeded))
+	})
+
+	It("cancels an event pushed with a context once the context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		Expect(th.PushEventCtx(ctx, 50*time.Millisecond, 1, timerheap.WithHandle(h))).To(Succeed())
+		Expect(th.PushEventCtx(ctx, 0, 2)).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(2)))
+		cancel()
+		Expect(h.Wait(context.Background())).To(Equal(timerheap.EventCancelled))
+		Consistently(th.TimedEvent(), "100ms").ShouldNot(Receive())
+		Expect(th.Stats().Pending).To(BeZero())
+
+		Expect(th.PushEventCtx(ctx, 0, 3)).To(Equal(context.Canceled))
+	})
+
+	It("delivers an event pushed with a context that is not done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		Expect(th.PushEventCtx(ctx, 10*time.Millisecond, 1, timerheap.WithHandle(h))).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		Eventually(h.State, "1s").Should(Equal(timerheap.EventFired))
+	})
+})
@@ -0,0 +1,67 @@
+package timerheap
+
+// Hooks are functions called at each stage of the life of an event, for instrumentation and
+// auditing. Any of the hooks may be nil. The hooks are called on the goroutine pushing the
+// event or processing the heap, so they must not block or call the heap.
+//
+// Events created by AfterChan and timers used internally by helpers such as Debouncer are not
+// reported.
+type Hooks struct {
+	// OnSchedule is called when an event is pushed, before it is added to the heap, so it is
+	// always called before the other hooks for the event. If the push then fails no other hook
+	// is called for the event. FiredAt is not set.
+	OnSchedule func(TimedResult)
+	// OnFire is called when an event pops, before it is delivered. It is called again for each
+	// redelivery of an event that has not been acknowledged.
+	OnFire func(TimedResult)
+	// OnCancel is called when a pending event is cancelled with Handle.Cancel, or removed with
+	// Remove, before it fires. FiredAt is not set.
+	OnCancel func(TimedResult)
+	// OnDrop is called when an event will never be delivered, with the same reasons as the
+	// dead letters, whether or not the heap was created with WithDeadLetters.
+	OnDrop func(DeadLetter)
+}
+
+// WithHooks sets the lifecycle hooks of the heap. Children of the heap inherit its hooks.
+func WithHooks(h Hooks) Option {
+	return func(t *timerHeap) {
+		t.hooks = h
+	}
+}
+
+// hookResult returns the TimedResult describing the item to a hook.
+func hookResult(ti timedItem) TimedResult {
+	r := TimedResult{
+		Value:       ti.value,
+		ScheduledAt: ti.expire,
+		Metadata:    ti.metadata,
+	}
+	if !ti.fired.IsZero() {
+		r.FiredAt = ti.fired
+		r.Lateness = ti.fired.Sub(ti.expire)
+	}
+	return r
+}
+
+// reportScheduled reports a pushed item to the OnSchedule hook.
+func (t *timerHeap) reportScheduled(ti timedItem) {
+	if t.hooks.OnSchedule != nil && ti.deliver == nil {
+		t.hooks.OnSchedule(hookResult(ti))
+	}
+}
+
+// reportCancelled reports a cancelled item to the OnCancel hook.
+func (t *timerHeap) reportCancelled(ti timedItem) {
+	if t.hooks.OnCancel != nil && ti.deliver == nil {
+		t.hooks.OnCancel(hookResult(ti))
+	}
+}
+
+// reportFired reports a popped item to the OnFire hook.
+func (t *timerHeap) reportFired(ti timedItem) {
+	if t.hooks.OnFire != nil && ti.deliver == nil {
+		t.protect(ti, func() {
+			t.hooks.OnFire(hookResult(ti))
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package timerheap_test
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("lifecycle hooks", func() {
+	var th timerheap.TimerHeap
+	var lock sync.Mutex
+	var events []string
+
+	record := func(format string, args ...interface{}) {
+		lock.Lock()
+		defer lock.Unlock()
+		events = append(events, fmt.Sprintf(format, args...))
+	}
+	recorded := func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string(nil), events...)
+	}
+	hooks := timerheap.Hooks{
+		OnSchedule: func(r timerheap.TimedResult) {
+			Expect(r.FiredAt.IsZero()).To(BeTrue())
+			record("schedule %v", r.Value)
+		},
+		OnFire: func(r timerheap.TimedResult) {
+			Expect(r.FiredAt.IsZero()).To(BeFalse())
+			record("fire %v", r.Value)
+		},
+		OnDrop: func(dl timerheap.DeadLetter) {
+			record("drop %v %v", dl.Value, dl.Reason)
+		},
+	}
+
+	BeforeEach(func() {
+		events = nil
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("reports each stage of the life of an event", func() {
+		th = timerheap.New(timerheap.WithHooks(hooks))
+		Expect(th.PushEvent(10*time.Millisecond, 1)).To(Succeed())
+		Expect(recorded()).To(Equal([]string{"schedule 1"}))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		Expect(recorded()).To(Equal([]string{"schedule 1", "fire 1"}))
+
+		now := time.Now()
+		Expect(th.PushEventWindow(now, now, 2)).To(Succeed())
+		Eventually(recorded, "1s").Should(Equal([]string{
+			"schedule 1", "fire 1", "schedule 2", "fire 2", "drop 2 expired",
+		}))
+
+		Expect(th.PushEvent(time.Hour, 3)).To(Succeed())
+		th.Terminate()
+		Expect(recorded()).To(HaveLen(7))
+		Expect(recorded()[6]).To(Equal("drop 3 terminated"))
+	})
+
+	It("does not report internal timers", func() {
+		th = timerheap.New(timerheap.WithHooks(hooks))
+		Eventually(th.AfterChan(0), "1s").Should(BeClosed())
+		Consistently(recorded, "50ms").Should(BeEmpty())
+	})
+
+	It("reports events dropped from a full heap", func() {
+		th = timerheap.New(
+			timerheap.WithHooks(hooks),
+			timerheap.WithMaxPending(1),
+			timerheap.WithOverflowPolicy(timerheap.OverflowDropFarthest),
+		)
+		Expect(th.PushEvent(time.Hour, 1)).To(Succeed())
+		Expect(th.PushEvent(2*time.Hour, 2)).To(Succeed())
+		Expect(recorded()).To(Equal([]string{"schedule 1", "schedule 2", "drop 2 full"}))
+	})
+
+	It("is inherited by children", func() {
+		th = timerheap.New(timerheap.WithHooks(hooks))
+		child := th.NewChild()
+		Expect(child.PushEvent(0, 1)).To(Succeed())
+		Eventually(child.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		Expect(recorded()).To(Equal([]string{"schedule 1", "fire 1"}))
+	})
+})
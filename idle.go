@@ -0,0 +1,29 @@
+package timerheap
+
+// Idle returns a channel that is closed when the heap has no pending events, that is when all
+// of the events that have been pushed have been delivered, dropped or discarded. If the heap
+// has no pending events the returned channel is already closed. Once closed, a later call
+// returns a new channel if events have since been pushed. The channel is also closed when the
+// heap is terminated.
+//
+// This does not include child heaps.
+func (t *timerHeap) Idle() <-chan struct{} {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.drainPushedLocked()
+	if t.idle == nil {
+		t.idle = make(chan struct{})
+	}
+	ch := t.idle
+	t.checkIdleLocked()
+	return ch
+}
+
+// checkIdleLocked closes the idle channel if there is one and the heap has no pending events.
+// The caller must hold the lock.
+func (t *timerHeap) checkIdleLocked() {
+	if t.idle != nil && (t.terminated || t.pendingLocked() == 0) {
+		close(t.idle)
+		t.idle = nil
+	}
+}
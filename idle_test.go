@@ -0,0 +1,50 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Idle notification", func() {
+	var th timerheap.TimerHeap
+
+	BeforeEach(func() {
+		th = timerheap.New()
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("returns a closed channel when there are no pending events", func() {
+		Expect(th.Idle()).To(BeClosed())
+	})
+
+	It("closes the channel once all events have been delivered", func() {
+		Expect(th.PushEvent(10*time.Millisecond, testdata{index: 1})).To(Succeed())
+		Expect(th.PushEvent(20*time.Millisecond, testdata{index: 2})).To(Succeed())
+		idle := th.Idle()
+
+		By("Checking the channel is not closed while an event is waiting to be received")
+		Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(Equal(testdata{index: 1})))
+		Consistently(idle, "50ms", "1ms").ShouldNot(BeClosed())
+
+		Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(Equal(testdata{index: 2})))
+		Eventually(idle, "1s", "1ms").Should(BeClosed())
+
+		By("Checking a new channel is returned once events are pushed again")
+		Expect(th.PushEvent(time.Hour, testdata{index: 3})).To(Succeed())
+		Expect(th.Idle()).NotTo(BeClosed())
+	})
+
+	It("closes the channel on termination", func() {
+		Expect(th.PushEvent(time.Hour, testdata{index: 1})).To(Succeed())
+		idle := th.Idle()
+		th.Terminate()
+		Expect(idle).To(BeClosed())
+	})
+})
@@ -0,0 +1,84 @@
+package timerheap
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// intake is a lock-free multi-producer queue of pushed items, drained by the event goroutine.
+// Items are pushed onto a linked stack with compare-and-swap, and the event goroutine takes the
+// whole stack at once. Since each item has its sequence number assigned when it is pushed, the
+// order the items are taken in does not matter.
+type intake struct {
+	head atomic.Pointer[intakeNode]
+}
+
+// intakeNode holds an item in the intake queue.
+type intakeNode struct {
+	item timedItem
+	next *intakeNode
+}
+
+// intakeNodes holds unused nodes for reuse, to avoid an allocation for every push.
+var intakeNodes = sync.Pool{
+	New: func() interface{} {
+		return &intakeNode{}
+	},
+}
+
+// pushIntake adds the item to the intake queue without taking the heap lock. The event goroutine
+// publishes the time it next wakes up in nearest, and is only woken if the item expires before
+// then, or if the depth of the heap is being watched, since it drains the intake queue every
+// time it wakes.
+func (t *timerHeap) pushIntake(ti timedItem) {
+	n := intakeNodes.Get().(*intakeNode)
+	n.item = ti
+	for {
+		n.next = t.intake.head.Load()
+		if t.intake.head.CompareAndSwap(n.next, n) {
+			break
+		}
+	}
+
+	if t.depth != nil || ti.expire.UnixNano() < t.nearest.Load() {
+		t.wake()
+	}
+}
+
+// drainIntakeLocked moves the items in the intake queue onto the heap. The caller must hold the
+// lock.
+func (t *timerHeap) drainIntakeLocked() {
+	n := t.intake.head.Swap(nil)
+	for n != nil {
+		t.valueHeap.push(n.item)
+		t.pushed++
+		if n.item.priority != 0 {
+			t.prioritised = true
+		}
+		next := n.next
+		*n = intakeNode{}
+		intakeNodes.Put(n)
+		n = next
+	}
+}
+
+// drainPushedLocked moves any pushed items that are held in the intake queue or the shards onto
+// the heap. The caller must hold the lock.
+func (t *timerHeap) drainPushedLocked() {
+	t.drainIntakeLocked()
+	t.drainShardsLocked()
+}
+
+// setNearestLocked publishes the time the event goroutine next wakes up, or the zero time if
+// it is only woken by a push, and returns true if there are items in the intake queue that
+// might have missed the update and must be drained first. The caller must hold the lock.
+func (t *timerHeap) setNearestLocked(wake time.Time) bool {
+	nearest := int64(math.MaxInt64)
+	if !wake.IsZero() {
+		nearest = wake.UnixNano()
+	}
+	t.nearest.Store(nearest)
+	return t.intake.head.Load() != nil
+}
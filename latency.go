@@ -0,0 +1,95 @@
+package timerheap
+
+import (
+	"sort"
+	"time"
+)
+
+// defaultLatencyBounds are the bucket bounds used by WithLatencyHistogram if none are supplied.
+var defaultLatencyBounds = []time.Duration{
+	100 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// LatencyHistogram counts fired events by how late they fired, measured from the scheduled time
+// to the time the event popped from the heap.
+type LatencyHistogram struct {
+	// The upper bounds of the buckets, in increasing order.
+	Bounds []time.Duration
+	// The number of events in each bucket. Counts[i] is the number of events that fired no more
+	// than Bounds[i] late, and more than the bound of the previous bucket. The last count, with
+	// no bound, is the number of events that fired later than every bound.
+	Counts []uint64
+}
+
+// WithLatencyHistogram configures the heap to count fired events in a histogram of how late
+// they fired, reported in Stats.Latency. Each bound is the upper bound of a bucket, and events
+// later than every bound are counted in a final bucket. If no bounds are supplied, buckets from
+// 100µs to 1s are used. Unlike the lateness reported by MaxLateness, this does not include any
+// time spent waiting for the consumer, and an event is counted again each time it is
+// redelivered. Internal timers, such as those of AfterChan, are not counted.
+func WithLatencyHistogram(bounds ...time.Duration) Option {
+	return func(t *timerHeap) {
+		t.latency = newLatencyHistogram(bounds)
+	}
+}
+
+// newLatencyHistogram returns an empty histogram with the bounds, or the default bounds if there
+// are none.
+func newLatencyHistogram(bounds []time.Duration) *LatencyHistogram {
+	if len(bounds) == 0 {
+		bounds = defaultLatencyBounds
+	}
+	h := &LatencyHistogram{
+		Bounds: append([]time.Duration(nil), bounds...),
+	}
+	sort.Slice(h.Bounds, func(i, j int) bool { return h.Bounds[i] < h.Bounds[j] })
+	h.Counts = make([]uint64, len(h.Bounds)+1)
+	return h
+}
+
+// observe counts an event that fired the given duration late.
+func (h *LatencyHistogram) observe(lateness time.Duration) {
+	h.Counts[sort.Search(len(h.Bounds), func(i int) bool { return lateness <= h.Bounds[i] })]++
+}
+
+// snapshot returns a copy of the histogram, or the zero histogram if it is nil.
+func (h *LatencyHistogram) snapshot() LatencyHistogram {
+	if h == nil {
+		return LatencyHistogram{}
+	}
+	return LatencyHistogram{
+		Bounds: append([]time.Duration(nil), h.Bounds...),
+		Counts: append([]uint64(nil), h.Counts...),
+	}
+}
+
+// add aggregates the histogram of a child heap into this one. Histograms with different bounds
+// cannot be aggregated, so the child is ignored unless it has the same bounds.
+func (h *LatencyHistogram) add(c LatencyHistogram) {
+	if len(c.Counts) == 0 {
+		return
+	}
+	if len(h.Counts) == 0 {
+		h.Bounds = c.Bounds
+		h.Counts = append([]uint64(nil), c.Counts...)
+		return
+	}
+	if len(h.Bounds) != len(c.Bounds) {
+		return
+	}
+	for i := range h.Bounds {
+		if h.Bounds[i] != c.Bounds[i] {
+			return
+		}
+	}
+	for i := range h.Counts {
+		h.Counts[i] += c.Counts[i]
+	}
+}
@@ -0,0 +1,63 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("timer heap latency histogram tests", func() {
+
+	It("has no histogram unless configured", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		Expect(th.PushEvent(0, "a")).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive())
+		Expect(th.Stats().Latency).To(Equal(timerheap.LatencyHistogram{}))
+	})
+
+	It("counts fired events by how late they fired", func() {
+		th := timerheap.New(timerheap.WithLatencyHistogram(time.Hour, time.Second))
+		defer th.Terminate()
+
+		now := time.Now()
+		Expect(th.PushEventAt(now, "on time")).To(Succeed())
+		Expect(th.PushEventAt(now.Add(-time.Minute), "late")).To(Succeed())
+		Expect(th.PushEventAt(now.Add(-2*time.Hour), "very late")).To(Succeed())
+		Expect(th.PushEvent(time.Hour, "pending")).To(Succeed())
+		for i := 0; i < 3; i++ {
+			Eventually(th.TimedEvent(), "1s").Should(Receive())
+		}
+
+		l := th.Stats().Latency
+		Expect(l.Bounds).To(Equal([]time.Duration{time.Second, time.Hour}))
+		Expect(l.Counts).To(Equal([]uint64{1, 1, 1}))
+	})
+
+	It("does not count internal timers", func() {
+		th := timerheap.New(timerheap.WithLatencyHistogram())
+		defer th.Terminate()
+		Eventually(th.AfterChan(0), "1s").Should(BeClosed())
+		l := th.Stats().Latency
+		Expect(l.Bounds).NotTo(BeEmpty())
+		Expect(l.Counts).To(Equal(make([]uint64, len(l.Bounds)+1)))
+	})
+
+	It("includes the histograms of children", func() {
+		th := timerheap.New(timerheap.WithLatencyHistogram(time.Second))
+		defer th.Terminate()
+		child := th.NewChild()
+		other := th.NewChild(timerheap.WithLatencyHistogram(time.Minute))
+
+		Expect(th.PushEvent(0, "parent")).To(Succeed())
+		Expect(child.PushEvent(-time.Hour, "child")).To(Succeed())
+		Expect(other.PushEvent(0, "other")).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive())
+		Eventually(child.TimedEvent(), "1s").Should(Receive())
+		Eventually(other.TimedEvent(), "1s").Should(Receive())
+
+		Expect(th.Stats().Latency.Counts).To(Equal([]uint64{1, 1}))
+	})
+})
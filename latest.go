@@ -0,0 +1,73 @@
+package timerheap
+
+import (
+	"time"
+)
+
+// PeekLatest returns the value and expiration time of the pending event that is due to pop last,
+// or false if there are no pending events, so that the least urgent event can be inspected. Events
+// that have popped or are awaiting acknowledgement are not included, nor are the events that Remove
+// does not search. This takes constant time with the MinMaxHeap backend, the other backends search
+// the events.
+func (t *timerHeap) PeekLatest() (interface{}, time.Time, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.drainPushedLocked()
+	ti, _ := t.latestLocked()
+	if ti == nil {
+		return nil, time.Time{}, false
+	}
+	return ti.value, ti.expire, true
+}
+
+// PopLatest removes the pending event that is due to pop last, as returned by PeekLatest, and
+// returns its value and expiration time, or false if there are no pending events. The removed
+// event is cancelled, see Handle.Cancel. This takes logarithmic time with the MinMaxHeap backend.
+func (t *timerHeap) PopLatest() (interface{}, time.Time, bool) {
+	var latest timedItem
+	ok := t.removePending(func() (timedItem, bool) {
+		ti, last := t.latestLocked()
+		if ti == nil {
+			return timedItem{}, false
+		}
+		latest = t.removeLatestLocked(ti, last)
+		return latest, true
+	})
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	return latest.value, latest.expire, true
+}
+
+// latestLocked returns the pending item that pops last, other than items with their own delivery
+// function and items awaiting acknowledgement, or nil if there is none, along with true if it is
+// the item that pops last of all the items. The caller must hold the lock.
+func (t *timerHeap) latestLocked() (*timedItem, bool) {
+	far := t.valueHeap.peekFarthest()
+	if far == nil || (far.deliver == nil && far.attempt == 0) {
+		return far, true
+	}
+	// The last item is rarely one of these, so the other items are only searched when it is.
+	var latest *timedItem
+	items := t.valueHeap.appendTo(nil)
+	for i := range items {
+		ti := &items[i]
+		if ti.deliver == nil && ti.attempt == 0 && (latest == nil || latest.before(ti)) {
+			latest = ti
+		}
+	}
+	return latest, false
+}
+
+// removeLatestLocked removes and returns the item returned by latestLocked. The caller must hold
+// the lock.
+func (t *timerHeap) removeLatestLocked(latest *timedItem, last bool) timedItem {
+	if last {
+		return t.valueHeap.popFarthest()
+	}
+	seq := latest.seq
+	ti, _ := t.valueHeap.removeWhere(func(ti *timedItem) bool {
+		return ti.seq == seq
+	})
+	return ti
+}
@@ -0,0 +1,68 @@
+package timerheap_test
+
+import (
+	"math/rand"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("PeekLatest and PopLatest", func() {
+	DescribeTable("remove the events that pop last",
+		func(b timerheap.BackendType) {
+			th := timerheap.New(timerheap.WithBackend(b))
+			defer th.Terminate()
+			_, _, ok := th.PeekLatest()
+			Expect(ok).To(BeFalse())
+
+			start := time.Now().Add(time.Hour)
+			for _, i := range rand.Perm(100) {
+				Expect(th.PushEventAt(start.Add(time.Duration(i)*time.Second), i)).To(Succeed())
+			}
+			for i := 99; i >= 50; i-- {
+				value, expire, ok := th.PeekLatest()
+				Expect(ok).To(BeTrue())
+				Expect(value).To(Equal(i))
+				Expect(expire).To(Equal(start.Add(time.Duration(i) * time.Second)))
+				value, _, ok = th.PopLatest()
+				Expect(ok).To(BeTrue())
+				Expect(value).To(Equal(i))
+			}
+			Expect(th.Stats().Pending).To(Equal(50))
+			value, _, _ := th.Find(func(interface{}) bool { return true })
+			Expect(value).To(Equal(0))
+		},
+		Entry("binary heap", timerheap.BinaryHeap),
+		Entry("4-ary heap", timerheap.QuaternaryHeap),
+		Entry("pairing heap", timerheap.PairingHeap),
+		Entry("min-max heap", timerheap.MinMaxHeap),
+	)
+
+	It("cancels the popped event", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		h := &timerheap.Handle{}
+		Expect(th.PushEvent(time.Hour, 1, timerheap.WithHandle(h))).To(Succeed())
+		_, _, ok := th.PopLatest()
+		Expect(ok).To(BeTrue())
+		Expect(h.State()).To(Equal(timerheap.EventCancelled))
+		_, _, ok = th.PopLatest()
+		Expect(ok).To(BeFalse())
+	})
+
+	It("skips internal timers", func() {
+		th := timerheap.New(timerheap.WithBackend(timerheap.MinMaxHeap))
+		defer th.Terminate()
+		Expect(th.PushEvent(time.Hour, 1)).To(Succeed())
+		th.AfterChan(2 * time.Hour)
+		value, _, ok := th.PopLatest()
+		Expect(ok).To(BeTrue())
+		Expect(value).To(Equal(1))
+		_, _, ok = th.PeekLatest()
+		Expect(ok).To(BeFalse())
+	})
+})
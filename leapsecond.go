@@ -0,0 +1,95 @@
+package timerheap
+
+import (
+	"time"
+)
+
+// LeapSecondPolicy determines how a heap handles the wall clock being stepped for a leap
+// second, see WithLeapSecondPolicy.
+type LeapSecondPolicy int
+
+const (
+	// LeapSecondAsJump handles a leap second step as any other jump of the wall clock, as set
+	// with WithClockJumpPolicy. This is the default.
+	LeapSecondAsJump LeapSecondPolicy = iota
+	// LeapSecondFollowWall trusts the wall clock through a leap second, so the pending events
+	// pop at their wall clock times after a step, as with ClockJumpFollowWall. This suits a
+	// host that should fire at the same wall clock times as hosts whose clocks are smeared.
+	LeapSecondFollowWall
+	// LeapSecondHoldDurations trusts the monotonic clock through a leap second, so the pending
+	// events are shifted by a step and pop after the durations they were due in, as with
+	// ClockJumpHoldDurations.
+	LeapSecondHoldDurations
+)
+
+func (p LeapSecondPolicy) String() string {
+	switch p {
+	case LeapSecondAsJump:
+		return "as jump"
+	case LeapSecondFollowWall:
+		return "follow wall"
+	case LeapSecondHoldDurations:
+		return "hold durations"
+	default:
+		return "unknown"
+	}
+}
+
+// clockPolicy returns the clock jump policy that a leap second step is handled with.
+func (p LeapSecondPolicy) clockPolicy() ClockJumpPolicy {
+	if p == LeapSecondHoldDurations {
+		return ClockJumpHoldDurations
+	}
+	return ClockJumpFollowWall
+}
+
+const (
+	// leapSecondWindow is how close to the end of a day on which a leap second may be inserted
+	// a step is treated as being for the leap second. This covers the smearing of a leap
+	// second over the day around it, so that a host switching between smeared and stepped
+	// time sources makes a step of up to a second during the smear.
+	leapSecondWindow = 24 * time.Hour
+	// leapSecondTolerance is how far from a second a step may be measured as, and still be
+	// treated as a whole leap second.
+	leapSecondTolerance = 100 * time.Millisecond
+)
+
+// WithLeapSecondPolicy sets how the heap handles the wall clock being stepped for a leap
+// second, overriding the clock jump policy for such steps. A step is treated as being for a
+// leap second if it is no larger than a second, and is made within a day of the end of June or
+// December in UTC, when leap seconds are inserted. Steps smaller than the threshold set with
+// WithClockJumpPolicy are only handled if they are close to a second, so the threshold should
+// be lowered to handle the smaller steps made by a host switching to or from a smeared time
+// source partway through a smear.
+//
+// Setting a policy other than LeapSecondAsJump holds the expiration times of the events without
+// monotonic clock readings, as WithClockJumpPolicy does, so that they are ordered by their wall
+// clock times.
+func WithLeapSecondPolicy(policy LeapSecondPolicy) Option {
+	return func(t *timerHeap) {
+		t.leapPolicy = policy
+		if t.clockThreshold <= 0 {
+			// The threshold applies to leap second steps even without a clock jump policy.
+			t.clockThreshold = defaultClockThreshold
+		}
+	}
+}
+
+// leapSecondStep returns true if a jump of the wall clock at the time may be the step of a
+// leap second.
+func leapSecondStep(now time.Time, jump time.Duration) bool {
+	if jump > time.Second+leapSecondTolerance || -jump > time.Second+leapSecondTolerance {
+		return false
+	}
+	utc := now.UTC()
+	for _, at := range []time.Time{
+		time.Date(utc.Year(), time.January, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(utc.Year(), time.July, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(utc.Year()+1, time.January, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		if d := utc.Sub(at); d < leapSecondWindow && -d < leapSecondWindow {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package timerheap
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Leap seconds", func() {
+	// The leap second at the end of 2016.
+	leap := time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	DescribeTable("identifies leap second steps",
+		func(now time.Time, jump time.Duration, expected bool) {
+			Expect(leapSecondStep(now, jump)).To(Equal(expected))
+		},
+		Entry("step back at the leap second", leap, -time.Second, true),
+		Entry("step forward after a smear", leap.Add(-12*time.Hour), time.Second, true),
+		Entry("partial step during a smear", leap.Add(6*time.Hour), -400*time.Millisecond, true),
+		Entry("step at the end of June", time.Date(2015, time.July, 1, 0, 0, 0, 0, time.UTC), -time.Second, true),
+		Entry("step in the middle of the year", time.Date(2016, time.April, 1, 0, 0, 0, 0, time.UTC), -time.Second, false),
+		Entry("step too large", leap, -2*time.Second, false),
+	)
+
+	// checkJump makes the heap see the wall clock as having jumped by d relative to the
+	// monotonic clock at the time, and returns how far the pending event moved.
+	checkJump := func(t *timerHeap, now time.Time, d time.Duration) (time.Duration, bool) {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		t.drainPushedLocked()
+		before := t.valueHeap.peek().expire
+		t.clock.mono = now.Add(-time.Second)
+		t.clock.wall = now.Add(-time.Second).Add(-d)
+		t.clock.hasBoot = false
+		_, _, leapStep := t.checkClockLocked(now)
+		return t.valueHeap.peek().expire.Sub(before), leapStep
+	}
+
+	DescribeTable("overrides the clock jump policy for leap second steps",
+		func(leapPolicy LeapSecondPolicy, clockPolicy ClockJumpPolicy, now time.Time, shifted, isLeap bool) {
+			opts := []Option{WithLeapSecondPolicy(leapPolicy)}
+			if clockPolicy != ClockJumpIgnore {
+				opts = append(opts, WithClockJumpPolicy(clockPolicy, time.Second))
+			}
+			th := New(opts...).(*timerHeap)
+			defer th.Terminate()
+			Expect(th.PushEvent(time.Hour, 1)).To(Succeed())
+
+			moved, leapStep := checkJump(th, now, -time.Second)
+			Expect(leapStep).To(Equal(isLeap))
+			if shifted {
+				Expect(moved).To(Equal(-time.Second))
+			} else {
+				Expect(moved).To(BeZero())
+			}
+		},
+		Entry("holding durations", LeapSecondHoldDurations, ClockJumpFollowWall, leap, true, true),
+		Entry("holding durations without a clock jump policy", LeapSecondHoldDurations, ClockJumpIgnore, leap, true, true),
+		Entry("following the wall clock", LeapSecondFollowWall, ClockJumpHoldDurations, leap, false, true),
+		Entry("as a jump", LeapSecondAsJump, ClockJumpHoldDurations, leap, true, false),
+		Entry("away from a leap second", LeapSecondFollowWall, ClockJumpHoldDurations, leap.Add(-48*time.Hour), true, false),
+	)
+
+	It("handles a step measured as slightly less than a second", func() {
+		th := New(WithLeapSecondPolicy(LeapSecondHoldDurations)).(*timerHeap)
+		defer th.Terminate()
+		Expect(th.PushEvent(time.Hour, 1)).To(Succeed())
+		moved, leapStep := checkJump(th, leap, -999*time.Millisecond)
+		Expect(leapStep).To(BeTrue())
+		Expect(moved).To(Equal(-999 * time.Millisecond))
+	})
+
+	It("holds events without monotonic clock readings", func() {
+		th := New(WithLeapSecondPolicy(LeapSecondFollowWall)).(*timerHeap)
+		defer th.Terminate()
+		Expect(th.PushEvent(time.Hour, 1)).To(Succeed())
+		th.lock.Lock()
+		th.drainPushedLocked()
+		expire := th.valueHeap.peek().expire
+		th.lock.Unlock()
+		Expect(expire).To(Equal(expire.Round(0)))
+	})
+})
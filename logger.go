@@ -0,0 +1,21 @@
+package timerheap
+
+import (
+	"time"
+)
+
+// defaultLateThreshold is the lateness above which a delivery is logged as late.
+const defaultLateThreshold = 100 * time.Millisecond
+
+// Logger is the minimal structured logging interface used by the heap. The args are
+// alternating key/value pairs. This is satisfied by *slog.Logger.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+}
+
+// nopLogger is the Logger used when no logger is configured.
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, args ...interface{}) {}
+func (nopLogger) Warn(msg string, args ...interface{})  {}
@@ -0,0 +1,64 @@
+package timerheap_test
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robbrockbank/timerheap"
+)
+
+// A *slog.Logger may be used as the heap Logger.
+var _ timerheap.Logger = slog.Default()
+
+// testLogger records the messages logged at each level.
+type testLogger struct {
+	lock  sync.Mutex
+	debug []string
+	warn  []string
+}
+
+func (l *testLogger) Debug(msg string, args ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.debug = append(l.debug, msg)
+}
+
+func (l *testLogger) Warn(msg string, args ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.warn = append(l.warn, msg)
+}
+
+func (l *testLogger) messages() ([]string, []string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]string(nil), l.debug...), append([]string(nil), l.warn...)
+}
+
+var _ = Describe("timer heap logging tests", func() {
+
+	It("logs pushes, pops, deliveries and termination", func() {
+		log := &testLogger{}
+		th := timerheap.New(timerheap.WithLogger(log))
+
+		By("adding an event that is on time and an event that is late")
+		th.PushEvent(10*time.Millisecond, 1)
+		th.PushEvent(-time.Hour, 2)
+		Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive())
+		Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive())
+
+		By("Terminating the timer")
+		th.Terminate()
+
+		By("Checking the logs")
+		debug, warn := log.messages()
+		Expect(debug).To(ContainElement("Pushed event"))
+		Expect(debug).To(ContainElement("Popped event"))
+		Expect(debug).To(ContainElement("Delivered event"))
+		Expect(debug).To(ContainElement("Terminated timer heap"))
+		Expect(warn).To(Equal([]string{"Late delivery of event"}))
+	})
+})
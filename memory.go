@@ -0,0 +1,60 @@
+package timerheap
+
+import (
+	"unsafe"
+)
+
+// WithCapacity preallocates room for n pending events, so that a heap that is filled soon after
+// it is created does not repeatedly grow and copy the events it holds. The heap still grows
+// beyond n events if needed, and is not shrunk below room for n events once they have been
+// delivered. This has no effect with the PairingHeap backend, which holds each
+// event in its own node.
+func WithCapacity(n int) Option {
+	return func(t *timerHeap) {
+		t.capacity = n
+	}
+}
+
+// MemoryStats is an estimate of the memory used by a TimerHeap, as returned by MemoryStats().
+type MemoryStats struct {
+	// The number of events the heap has room for without allocating, including the events
+	// that have popped and are waiting to be delivered. With the PairingHeap backend each
+	// event is held in its own node, so there is only room for the events held.
+	Capacity int
+	// The number of events held by the heap, including those waiting to be delivered and the
+	// internal timers of AfterChan.
+	Live int
+	// An estimate of the bytes used to hold the events. This does not include the values of
+	// the events, or their keys and metadata, which are owned by the caller.
+	Bytes uint64
+}
+
+// MemoryStats returns an estimate of the memory used by the heap, aggregated with the estimates
+// of any child heaps.
+func (t *timerHeap) MemoryStats() MemoryStats {
+	m, children := t.ownMemoryStats()
+	for _, c := range children {
+		cm := c.MemoryStats()
+		m.Capacity += cm.Capacity
+		m.Live += cm.Live
+		m.Bytes += cm.Bytes
+	}
+	return m
+}
+
+// ownMemoryStats returns the memory stats of this heap excluding any children, and the current
+// set of children.
+func (t *timerHeap) ownMemoryStats() (MemoryStats, []*timerHeap) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.drainPushedLocked()
+	capacity, bytes := t.valueHeap.footprint()
+	capacity += cap(t.ready)
+	bytes += uintptr(cap(t.ready)) * unsafe.Sizeof(timedItem{})
+	return MemoryStats{
+		Capacity: capacity,
+		Live:     t.pendingLocked(),
+		Bytes:    uint64(bytes),
+	}, t.childList()
+}
@@ -0,0 +1,102 @@
+package timerheap
+
+import (
+	"time"
+	"unsafe"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memory", func() {
+	// capacity returns the number of items a backend has room for.
+	capacity := func(h backend) int {
+		c, _ := h.footprint()
+		return c
+	}
+
+	DescribeTable("preallocates room for the events",
+		func(b BackendType) {
+			th := New(WithCapacity(1000), WithBackend(b)).(*timerHeap)
+			defer th.Terminate()
+			th.lock.Lock()
+			defer th.lock.Unlock()
+			Expect(th.valueHeap.Len()).To(BeZero())
+			Expect(capacity(th.valueHeap)).To(Equal(1000))
+		},
+		Entry("binary heap", BinaryHeap),
+		Entry("4-ary heap", QuaternaryHeap),
+		Entry("min-max heap", MinMaxHeap),
+	)
+
+	DescribeTable("shrinks the backing array once the events are delivered",
+		func(b BackendType) {
+			th := New(WithBackend(b)).(*timerHeap)
+			defer th.Terminate()
+			for i := 0; i < 10000; i++ {
+				Expect(th.PushEvent(0, i)).To(Succeed())
+			}
+			for i := 0; i < 10000; i++ {
+				<-th.TimedEvent()
+			}
+			Eventually(func() int {
+				th.lock.Lock()
+				defer th.lock.Unlock()
+				return capacity(th.valueHeap)
+			}, "1s").Should(BeNumerically("<=", shrinkFloor))
+		},
+		Entry("binary heap", BinaryHeap),
+		Entry("4-ary heap", QuaternaryHeap),
+		Entry("min-max heap", MinMaxHeap),
+	)
+
+	It("does not shrink below the preallocated room", func() {
+		th := New(WithCapacity(5000)).(*timerHeap)
+		defer th.Terminate()
+		for i := 0; i < 20000; i++ {
+			Expect(th.PushEvent(0, i)).To(Succeed())
+		}
+		for i := 0; i < 20000; i++ {
+			<-th.TimedEvent()
+		}
+		Consistently(func() int {
+			th.lock.Lock()
+			defer th.lock.Unlock()
+			return capacity(th.valueHeap)
+		}, 50*time.Millisecond).Should(BeNumerically(">=", 5000))
+		th.lock.Lock()
+		defer th.lock.Unlock()
+		Expect(capacity(th.valueHeap)).To(BeNumerically("<", 20000))
+	})
+
+	DescribeTable("reports the memory used",
+		func(b BackendType) {
+			th := New(WithBackend(b)).(*timerHeap)
+			defer th.Terminate()
+			Expect(th.MemoryStats().Live).To(BeZero())
+			for i := 0; i < 100; i++ {
+				Expect(th.PushEvent(time.Hour, i)).To(Succeed())
+			}
+			m := th.MemoryStats()
+			Expect(m.Live).To(Equal(100))
+			Expect(m.Capacity).To(BeNumerically(">=", 100))
+			Expect(m.Bytes).To(BeNumerically(">=", 100*uint64(unsafe.Sizeof(timedItem{}))))
+		},
+		Entry("binary heap", BinaryHeap),
+		Entry("4-ary heap", QuaternaryHeap),
+		Entry("pairing heap", PairingHeap),
+		Entry("min-max heap", MinMaxHeap),
+	)
+
+	It("includes the memory used by children", func() {
+		th := New(WithCapacity(100))
+		defer th.Terminate()
+		child := th.NewChild(WithCapacity(200))
+		Expect(child.PushEvent(time.Hour, "a")).To(Succeed())
+		m := th.MemoryStats()
+		Expect(m.Live).To(Equal(1))
+		Expect(m.Capacity).To(Equal(300))
+		Expect(m.Bytes).To(Equal(300 * uint64(unsafe.Sizeof(timedItem{}))))
+	})
+})
@@ -0,0 +1,259 @@
+package timerheap
+
+import (
+	"sync"
+	"time"
+)
+
+// mergeLock is held while the events of a heap are moved into another, the only time the locks
+// of two heaps are held at once, so that concurrent merges cannot deadlock.
+var mergeLock sync.Mutex
+
+// Merge moves the pending events of the other heap into this one and terminates the other heap,
+// so that heaps can be consolidated without losing events or delivering any of them twice. The
+// other heap stops delivering events before they are moved, and the moved events appear in this
+// heap all at once. They keep their expiration times, so events that had popped but not been
+// received from the other heap are delivered immediately.
+//
+// The moved events may take this heap over the limit set with WithMaxPending, in which case it
+// is trimmed if the overflow policy is OverflowDropFarthest. Events with the same key as an event
+// pending or recently completed in this heap are dropped. Handles move
+// with their events. Events that are awaiting acknowledgement are delivered again unless they
+// are acknowledged first, which fails with ErrAckExpired once they have moved. Timers created by
+// AfterChan, the children of the other heap, and events pushed to it after the merge are handled
+// as when the other heap is terminated.
+//
+// Merge fails with ErrMergeUnsupported if the other heap is this heap or one of its ancestors,
+// was not created by this package, or either heap is durable, bolt-backed or clustered. It fails
+// with ErrTerminated if either heap has been terminated.
+func (t *timerHeap) Merge(other TimerHeap) error {
+	o, ok := other.(*timerHeap)
+	if !ok || o == t || t.persistent() || o.persistent() {
+		return ErrMergeUnsupported
+	}
+	for p := t.parent; p != nil; p = p.parent {
+		if p == o {
+			return ErrMergeUnsupported
+		}
+	}
+	t.lock.Lock()
+	terminated := t.terminated
+	t.lock.Unlock()
+	if terminated {
+		return ErrTerminated
+	}
+
+	merged := false
+	o.terminateOnce.Do(func() {
+		merged = true
+		o.mergeInto = t
+		o.terminate()
+	})
+	if !merged {
+		return ErrTerminated
+	}
+	return nil
+}
+
+// persistent returns true if the events of the heap are also held outside the heap.
+func (t *timerHeap) persistent() bool {
+	return t.wal != nil || t.store != nil
+}
+
+// absorb moves the pending items of a heap being merged into this one, whose event goroutine
+// has stopped. If this heap has been terminated in the meantime the items are returned instead.
+func (t *timerHeap) absorb(o *timerHeap) []timedItem {
+	mergeLock.Lock()
+	o.lock.Lock()
+	t.lock.Lock()
+	if t.terminated {
+		items := o.takePendingLocked()
+		t.lock.Unlock()
+		o.lock.Unlock()
+		mergeLock.Unlock()
+		return items
+	}
+	var moved int
+	var duplicates, trimmed []timedItem
+	from, fromPairing := o.valueHeap.(*pairingHeap)
+	to, toPairing := t.valueHeap.(*pairingHeap)
+	if fromPairing && toPairing {
+		moved, duplicates, trimmed = t.meldLocked(o, from, to)
+	} else {
+		items := o.takePendingLocked()
+		moved = len(items)
+		duplicates, trimmed = t.adoptLocked(items)
+	}
+	t.lock.Unlock()
+	o.lock.Unlock()
+	mergeLock.Unlock()
+
+	t.dropDuplicates(duplicates)
+	t.dropTrimmed(trimmed)
+	if t.debug {
+		t.log.Debug("Merged events", "count", moved-len(duplicates))
+	}
+	return nil
+}
+
+// adoptLocked pushes items moved from another heap. It returns those with the key of an event
+// already pending or recently completed in this heap, which are not pushed, and those trimmed by
+// trimLocked. The caller must hold the lock of this heap, and of the heap the items were held by
+// if it holds their handles.
+func (t *timerHeap) adoptLocked(items []timedItem) ([]timedItem, []timedItem) {
+	t.drainPushedLocked()
+	adopted, duplicates := t.claimKeysLocked(items)
+	var seqs seqRange
+	for _, ti := range adopted {
+		seqs.add(ti.seq)
+	}
+	offset := t.reserveSeqsLocked(seqs)
+	for i := range adopted {
+		t.adoptItemLocked(&adopted[i], offset)
+	}
+	t.valueHeap.pushAll(adopted)
+	if len(adopted) > 0 {
+		t.wake()
+	}
+	return duplicates, t.trimLocked()
+}
+
+// claimKeysLocked claims the keys of items moved from another heap, returning the items whose
+// keys were claimed, or that have none, and the duplicates whose keys were not. The caller must
+// hold the lock.
+func (t *timerHeap) claimKeysLocked(items []timedItem) ([]timedItem, []timedItem) {
+	var duplicates []timedItem
+	claimed := make([]timedItem, 0, len(items))
+	for _, ti := range items {
+		if ti.key != "" && !t.dedup.claim(ti.key) {
+			duplicates = append(duplicates, ti)
+			continue
+		}
+		claimed = append(claimed, ti)
+	}
+	return claimed, duplicates
+}
+
+// meldLocked moves the pending items of another heap into this one when both use the pairing
+// heap backend, melding the heaps rather than pushing each item. The items that are not moved,
+// the duplicates returned as by adoptLocked and those with their own delivery function, are
+// removed from the other heap first. The caller must hold the locks of both heaps.
+func (t *timerHeap) meldLocked(o *timerHeap, from, to *pairingHeap) (int, []timedItem, []timedItem) {
+	t.drainPushedLocked()
+	o.drainPushedLocked()
+	ready, duplicates := t.claimKeysLocked(o.takeReadyLocked())
+	removed := from.removeAll(func(ti *timedItem) bool {
+		// Each item is matched once, so keys are only claimed for the items that are moved.
+		return ti.deliver != nil || ti.key != "" && !t.dedup.claim(ti.key)
+	}, nil)
+	for _, ti := range removed {
+		if ti.deliver == nil {
+			duplicates = append(duplicates, ti)
+		}
+	}
+
+	// The moved items keep their order, whether they had popped in the other heap or not.
+	var seqs seqRange
+	for _, ti := range ready {
+		seqs.add(ti.seq)
+	}
+	from.walk(func(n *pairingNode) bool {
+		seqs.add(n.item.seq)
+		return true
+	})
+	offset := t.reserveSeqsLocked(seqs)
+	from.walk(func(n *pairingNode) bool {
+		t.adoptItemLocked(&n.item, offset)
+		return true
+	})
+	for i := range ready {
+		t.adoptItemLocked(&ready[i], offset)
+	}
+	to.meld(from)
+	to.pushAll(ready)
+	if seqs.n > 0 {
+		t.wake()
+	}
+	return seqs.n + len(duplicates), duplicates, t.trimLocked()
+}
+
+// seqRange is the range of sequence numbers of a set of items.
+type seqRange struct {
+	first, last uint64
+	n           int
+}
+
+func (r *seqRange) add(seq uint64) {
+	if r.n == 0 || seq < r.first {
+		r.first = seq
+	}
+	if r.n == 0 || seq > r.last {
+		r.last = seq
+	}
+	r.n++
+}
+
+// reserveSeqsLocked reserves sequence numbers for items moved from another heap, returning the
+// offset that moves their sequence numbers into the reserved range. The items keep their order,
+// and pop after the items of this heap with the same expiration time. The caller must hold the
+// lock.
+func (t *timerHeap) reserveSeqsLocked(r seqRange) uint64 {
+	if r.n == 0 {
+		return 0
+	}
+	span := r.last - r.first + 1
+	return t.nextSeq.Add(span) - span - r.first
+}
+
+// adoptItemLocked prepares an item moved from another heap to be held by this heap, moving its
+// sequence number by the offset from reserveSeqsLocked. The caller must hold the lock of this
+// heap, and of the heap the item was held by if it holds its handle.
+func (t *timerHeap) adoptItemLocked(ti *timedItem, offset uint64) {
+	ti.seq += offset
+	ti.fired = time.Time{}
+	ti.handled, ti.output = false, nil
+	if ti.handle != nil {
+		// The handle is moved while both heaps are locked, so that a call to cancel the event
+		// that finds it gone from the other heap finds it here instead.
+		ti.handle.attach(t)
+		t.handles.Store(true)
+	}
+	if ti.priority != 0 {
+		t.prioritised = true
+	}
+	t.pushed++
+}
+
+// dropDuplicates drops the items that adoptLocked did not push.
+func (t *timerHeap) dropDuplicates(duplicates []timedItem) {
+	for _, ti := range duplicates {
+		if t.debug {
+			t.log.Debug("Ignored duplicate moved event", "key", ti.key)
+		}
+		ti.handle.finish(EventDropped)
+	}
+}
+
+// takePendingLocked removes and returns the pending items, other than those with their own
+// delivery function, in no particular order. The caller must hold the lock.
+func (t *timerHeap) takePendingLocked() []timedItem {
+	t.drainPushedLocked()
+	items := t.takeReadyLocked()
+	return t.valueHeap.removeAll(func(ti *timedItem) bool {
+		return ti.deliver == nil
+	}, items)
+}
+
+// takeReadyLocked removes and returns the items that have popped but not been delivered, other
+// than those with their own delivery function. The caller must hold the lock.
+func (t *timerHeap) takeReadyLocked() []timedItem {
+	items := make([]timedItem, 0, t.pendingLocked())
+	for i, ti := range t.ready {
+		if ti.deliver == nil {
+			items = append(items, ti)
+		}
+		t.ready[i] = timedItem{}
+	}
+	t.ready = t.ready[:0]
+	return items
+}
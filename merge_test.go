@@ -0,0 +1,144 @@
+package timerheap_test
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Merge", func() {
+	var th, other timerheap.TimerHeap
+
+	BeforeEach(func() {
+		th = timerheap.New()
+		other = timerheap.New(timerheap.WithBackend(timerheap.PairingHeap))
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+		other.Terminate()
+	})
+
+	values := func(h timerheap.TimerHeap) []interface{} {
+		var vs []interface{}
+		for _, ev := range h.Snapshot() {
+			vs = append(vs, ev.Value)
+		}
+		return vs
+	}
+
+	It("moves the pending events and terminates the other heap", func() {
+		start := time.Now().Add(time.Hour)
+		Expect(th.PushEventAt(start.Add(time.Second), "a")).To(Succeed())
+		Expect(th.PushEventAt(start.Add(3*time.Second), "c")).To(Succeed())
+		Expect(other.PushEventAt(start.Add(2*time.Second), "b")).To(Succeed())
+		Expect(other.PushEventAt(start.Add(3*time.Second), "d")).To(Succeed())
+
+		Expect(th.Merge(other)).To(Succeed())
+		Expect(values(th)).To(Equal([]interface{}{"a", "b", "c", "d"}))
+		Expect(other.Stats().Pending).To(BeZero())
+		Eventually(other.TimedEvent(), "1s").Should(BeClosed())
+		Expect(th.Merge(other)).To(Equal(timerheap.ErrTerminated))
+	})
+
+	It("delivers events that popped in the other heap but were not received", func() {
+		Expect(other.PushEvent(0, 1)).To(Succeed())
+		Expect(other.PushEvent(0, 2)).To(Succeed())
+		time.Sleep(10 * time.Millisecond)
+		Expect(th.Merge(other)).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(2)))
+		Consistently(other.TimedEvent(), "20ms").ShouldNot(Receive(Not(BeNil())))
+	})
+
+	It("moves handles with their events", func() {
+		h := &timerheap.Handle{}
+		Expect(other.PushEvent(time.Hour, 1, timerheap.WithHandle(h))).To(Succeed())
+		Expect(th.Merge(other)).To(Succeed())
+		Expect(h.State()).To(Equal(timerheap.EventPending))
+		Expect(h.Reschedule(10 * time.Millisecond)).To(BeTrue())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		Eventually(h.State, "1s").Should(Equal(timerheap.EventFired))
+	})
+
+	It("drops events with the key of one already in the heap", func() {
+		h := &timerheap.Handle{}
+		Expect(th.PushEvent(time.Hour, 1, timerheap.WithKey("k"))).To(Succeed())
+		Expect(other.PushEvent(time.Hour, 2, timerheap.WithKey("k"), timerheap.WithHandle(h))).To(Succeed())
+		Expect(other.PushEvent(time.Hour, 3, timerheap.WithKey("l"))).To(Succeed())
+		Expect(th.Merge(other)).To(Succeed())
+		Expect(values(th)).To(Equal([]interface{}{1, 3}))
+		Expect(h.State()).To(Equal(timerheap.EventDropped))
+	})
+
+	DescribeTable("merges heaps with any backends",
+		func(to, from timerheap.BackendType) {
+			th.Terminate()
+			other.Terminate()
+			th = timerheap.New(timerheap.WithBackend(to))
+			other = timerheap.New(timerheap.WithBackend(from))
+
+			// Events with the same expiration time keep their order, with those moved from the
+			// other heap after those already in this one.
+			start := time.Now().Add(time.Hour)
+			var want []interface{}
+			handles := map[int]*timerheap.Handle{}
+			for i := 0; i < 100; i++ {
+				at := start.Add(time.Duration(i/4) * time.Second)
+				Expect(th.PushEventAt(at, i, timerheap.WithKey(fmt.Sprint(i)))).To(Succeed())
+				handles[i] = &timerheap.Handle{}
+				Expect(other.PushEventAt(at, 100+i, timerheap.WithHandle(handles[i]))).To(Succeed())
+				if i%4 == 3 {
+					want = append(want, i-3, i-2, i-1, i, 97+i, 98+i, 99+i, 100+i)
+				}
+			}
+			Expect(other.PushEventAt(start, "duplicate", timerheap.WithKey("0"))).To(Succeed())
+
+			Expect(th.Merge(other)).To(Succeed())
+			Expect(values(th)).To(Equal(want))
+			for i := 0; i < 100; i += 7 {
+				Expect(handles[i].Cancel()).To(BeTrue())
+			}
+			Expect(th.Stats().Pending).To(Equal(200 - 15))
+		},
+		Entry("binary heaps", timerheap.BinaryHeap, timerheap.BinaryHeap),
+		Entry("pairing heaps", timerheap.PairingHeap, timerheap.PairingHeap),
+		Entry("a pairing heap into a binary heap", timerheap.BinaryHeap, timerheap.PairingHeap),
+		Entry("a binary heap into a pairing heap", timerheap.PairingHeap, timerheap.BinaryHeap),
+		Entry("a 4-ary heap into a min-max heap", timerheap.MinMaxHeap, timerheap.QuaternaryHeap),
+	)
+
+	It("merges a few events into a larger heap", func() {
+		th.Terminate()
+		th = timerheap.New(timerheap.WithBackend(timerheap.QuaternaryHeap))
+		start := time.Now().Add(time.Hour)
+		var want []interface{}
+		for i := 0; i < 50; i++ {
+			Expect(th.PushEventAt(start.Add(time.Duration(i)*time.Second), i)).To(Succeed())
+			want = append(want, i)
+			if i%10 == 0 {
+				Expect(other.PushEventAt(start.Add(time.Duration(i)*time.Second), -i-1)).To(Succeed())
+				want = append(want, -i-1)
+			}
+		}
+		Expect(th.Merge(other)).To(Succeed())
+		Expect(values(th)).To(Equal(want))
+	})
+
+	It("does not merge heaps that cannot be merged", func() {
+		Expect(th.Merge(th)).To(Equal(timerheap.ErrMergeUnsupported))
+		child := th.NewChild()
+		Expect(child.Merge(th)).To(Equal(timerheap.ErrMergeUnsupported))
+		Expect(th.Merge(child)).To(Succeed())
+
+		th.Terminate()
+		Expect(th.Merge(other)).To(Equal(timerheap.ErrTerminated))
+		Expect(other.Stats().Pending).To(BeZero())
+		Consistently(other.TimedEvent(), "10ms").ShouldNot(BeClosed())
+	})
+})
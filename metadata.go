@@ -0,0 +1,42 @@
+package timerheap
+
+// Metadata is a set of tags attached to an event with WithMetadata. It is carried alongside the
+// value, so that it can be used to route, filter or count events without adding fields to the
+// value types.
+type Metadata map[string]string
+
+// WithMetadata attaches the metadata to the event. The metadata is copied, and merged with any
+// metadata from earlier options. It is included in the TimedResult, Delivery or DeadLetter for
+// the event, and is saved with the event by persistent heaps.
+func WithMetadata(md Metadata) PushOption {
+	return func(ti *timedItem) {
+		merged := make(Metadata, len(ti.metadata)+len(md))
+		for k, v := range ti.metadata {
+			merged[k] = v
+		}
+		for k, v := range md {
+			merged[k] = v
+		}
+		ti.metadata = merged
+	}
+}
+
+// WithRouter routes events by their value and metadata. The router is called when an event
+// without a topic is pushed, and the event is sent to the channel for the topic it returns, as
+// if it had been pushed with WithTopic. Events for which it returns an empty topic are
+// delivered on the results channel as usual. The router is called by the goroutine pushing the
+// event, and must not block.
+func WithRouter(router func(value interface{}, md Metadata) string) Option {
+	return func(t *timerHeap) {
+		t.router = router
+	}
+}
+
+// applyRouter sets the topic of the item from the router of the heap, if it has one and the
+// item has no topic or delivery function of its own.
+func (t *timerHeap) applyRouter(ti *timedItem) {
+	if t.router == nil || ti.topic != "" || ti.deliver != nil {
+		return
+	}
+	ti.topic = t.router(ti.value, ti.metadata)
+}
@@ -0,0 +1,82 @@
+package timerheap_test
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("event metadata", func() {
+	var th timerheap.TimerHeap
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("includes the metadata in the timed result", func() {
+		th = timerheap.New(timerheap.WithTimedResults())
+		md := timerheap.Metadata{"tenant": "a"}
+		Expect(th.PushEvent(10*time.Millisecond, 1,
+			timerheap.WithMetadata(md), timerheap.WithMetadata(timerheap.Metadata{"kind": "retry"}))).To(Succeed())
+		md["tenant"] = "b"
+
+		var r timerheap.TimedResult
+		Eventually(th.TimedEvent(), "1s").Should(Receive(&r))
+		Expect(r.Value).To(Equal(1))
+		Expect(r.Metadata).To(Equal(timerheap.Metadata{"tenant": "a", "kind": "retry"}))
+	})
+
+	It("includes the metadata in deliveries and dead letters", func() {
+		th = timerheap.New(timerheap.WithAck(time.Hour), timerheap.WithDeadLetters())
+		md := timerheap.Metadata{"tenant": "a"}
+		Expect(th.PushEvent(0, 1, timerheap.WithMetadata(md))).To(Succeed())
+		var d *timerheap.Delivery
+		Eventually(th.TimedEvent(), "1s").Should(Receive(&d))
+		Expect(d.Metadata).To(Equal(md))
+
+		now := time.Now()
+		Expect(th.PushEventWindow(now, now, 2, timerheap.WithMetadata(md))).To(Succeed())
+		var dl timerheap.DeadLetter
+		Eventually(th.DeadLetters(), "1s").Should(Receive(&dl))
+		Expect(dl.Value).To(Equal(2))
+		Expect(dl.Metadata).To(Equal(md))
+	})
+
+	It("routes events to topics by their metadata", func() {
+		th = timerheap.New(timerheap.WithRouter(func(value interface{}, md timerheap.Metadata) string {
+			return md["tenant"]
+		}))
+		Expect(th.PushEvent(0, 1, timerheap.WithMetadata(timerheap.Metadata{"tenant": "a"}))).To(Succeed())
+		Expect(th.PushEvent(0, 2, timerheap.WithMetadata(timerheap.Metadata{"tenant": "b"}))).To(Succeed())
+		Expect(th.PushEvent(0, 3)).To(Succeed())
+		Expect(th.PushEvent(0, 4, timerheap.WithMetadata(timerheap.Metadata{"tenant": "b"}), timerheap.WithTopic("c"))).To(Succeed())
+
+		Eventually(th.TimedEventFor("a"), "1s").Should(Receive(Equal(1)))
+		Eventually(th.TimedEventFor("b"), "1s").Should(Receive(Equal(2)))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(3)))
+		Eventually(th.TimedEventFor("c"), "1s").Should(Receive(Equal(4)))
+	})
+
+	It("saves and loads the metadata", func() {
+		registry := timerheap.NewTypeRegistry()
+		Expect(registry.Register("id", "", nil)).To(Succeed())
+		th = timerheap.New(timerheap.WithTypeRegistry(registry, false))
+		restored := timerheap.New(timerheap.WithTypeRegistry(registry, false), timerheap.WithTimedResults())
+		defer restored.Terminate()
+
+		md := timerheap.Metadata{"tenant": "a"}
+		Expect(th.PushEvent(20*time.Millisecond, "x", timerheap.WithMetadata(md))).To(Succeed())
+		var buf bytes.Buffer
+		Expect(th.Save(&buf)).To(Succeed())
+		Expect(restored.Load(&buf)).To(Succeed())
+
+		var r timerheap.TimedResult
+		Eventually(restored.TimedEvent(), "1s").Should(Receive(&r))
+		Expect(r.Value).To(Equal("x"))
+		Expect(r.Metadata).To(Equal(md))
+	})
+})
@@ -0,0 +1,113 @@
+package timerheap
+
+// Handler hands the value of a fired event on towards its consumer. The value is what the
+// consumer receives, which is a TimedResult if the heap was created with WithTimedResults, and
+// md is the metadata attached to the event.
+type Handler func(value interface{}, md Metadata)
+
+// Middleware wraps the Handler that delivers events, in the same way as HTTP middleware. A
+// middleware may observe the event before or after calling next, for example to log or count
+// it, call next with a different value to transform it, or not call next at all to drop it.
+type Middleware func(next Handler) Handler
+
+// WithMiddleware adds middleware to the delivery chain of the heap, the first middleware being
+// the outermost. Every event passes through the chain once per delivery when it pops, before it
+// is sent to the results channel, a topic channel or the subscribers. An event that is dropped
+// is treated as delivered. When acknowledgements are required the value passed on by the chain
+// is wrapped in the Delivery.
+//
+// The middleware is called on the goroutine processing the heap, so it must not block. Events
+// created by AfterChan and timers used internally by helpers such as Debouncer do not pass
+// through the chain.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(t *timerHeap) {
+		t.middleware = append(t.middleware, mw...)
+	}
+}
+
+// handle passes the result for the item through the middleware chain, returning the value to
+// deliver, or false if a middleware dropped the event or panicked. An item that has already
+// been handled returns the value it was given then.
+func (t *timerHeap) handle(ti timedItem) (interface{}, bool) {
+	if ti.handled {
+		return ti.output, true
+	}
+	value := t.result(ti)
+	if len(t.middleware) == 0 {
+		return value, true
+	}
+	var out interface{}
+	var ok bool
+	h := Handler(func(value interface{}, md Metadata) {
+		out, ok = value, true
+	})
+	chain := func() {
+		for i := len(t.middleware) - 1; i >= 0; i-- {
+			h = t.middleware[i](h)
+		}
+		h(value, ti.metadata)
+	}
+	if !t.protect(ti, chain) {
+		return nil, false
+	}
+	return out, ok
+}
+
+// unhandledReadyLocked appends the items on the ready queue that have not been passed through
+// the middleware chain to unhandled. The caller must hold the lock.
+func (t *timerHeap) unhandledReadyLocked(unhandled []timedItem) []timedItem {
+	if len(t.middleware) == 0 {
+		return unhandled
+	}
+	for _, ti := range t.ready {
+		if !ti.handled {
+			unhandled = append(unhandled, ti)
+		}
+	}
+	return unhandled
+}
+
+// handleReady passes the unhandled ready items through the middleware chain, storing the value
+// to deliver for each on the ready queue and removing those that were dropped. It returns the
+// results channel and the item at the head of the ready queue, or nil if there is nothing to
+// deliver.
+func (t *timerHeap) handleReady(unhandled []timedItem) (chan interface{}, timedItem) {
+	for i := range unhandled {
+		unhandled[i].output, unhandled[i].handled = t.handle(unhandled[i])
+	}
+
+	var dropped []timedItem
+	t.lock.Lock()
+	for _, ti := range unhandled {
+		for i := range t.ready {
+			if t.ready[i].seq != ti.seq {
+				continue
+			}
+			if ti.handled {
+				t.ready[i].output, t.ready[i].handled = ti.output, true
+			} else {
+				dropped = append(dropped, t.removeReadyLocked(i))
+				t.missedLocked()
+			}
+			break
+		}
+	}
+	var results chan interface{}
+	var head timedItem
+	if len(t.ready) > 0 {
+		results, head = t.results, t.ready[0]
+	}
+	if len(dropped) > 0 {
+		// There may be room on the ready queue for more expired items.
+		t.wake()
+	}
+	t.lock.Unlock()
+
+	for _, ti := range dropped {
+		if t.debug {
+			t.log.Debug("Event dropped by middleware", "seq", ti.seq)
+		}
+		t.recordDelivery(ti)
+	}
+	return results, head
+}
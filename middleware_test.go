@@ -0,0 +1,104 @@
+package timerheap_test
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+// tag returns middleware that appends the name to string values on the way in.
+func tag(name string) timerheap.Middleware {
+	return func(next timerheap.Handler) timerheap.Handler {
+		return func(value interface{}, md timerheap.Metadata) {
+			next(fmt.Sprintf("%v/%s", value, name), md)
+		}
+	}
+}
+
+var _ = Describe("delivery middleware", func() {
+	var th timerheap.TimerHeap
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("passes events through the chain in order", func() {
+		th = timerheap.New(timerheap.WithMiddleware(tag("a"), tag("b")), timerheap.WithMiddleware(tag("c")))
+		Expect(th.PushEvent(0, "x")).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("x/a/b/c")))
+		Consistently(th.TimedEvent(), "50ms").ShouldNot(Receive())
+	})
+
+	It("drops events that are not passed on", func() {
+		drop := func(next timerheap.Handler) timerheap.Handler {
+			return func(value interface{}, md timerheap.Metadata) {
+				if md["drop"] == "" {
+					next(value, md)
+				}
+			}
+		}
+		th = timerheap.New(timerheap.WithMiddleware(drop))
+		Expect(th.PushEvent(0, 1, timerheap.WithMetadata(timerheap.Metadata{"drop": "yes"}))).To(Succeed())
+		Expect(th.PushEvent(0, 2, timerheap.WithMetadata(timerheap.Metadata{"drop": "yes"}))).To(Succeed())
+		Expect(th.PushEvent(10*time.Millisecond, 3)).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(3)))
+		Eventually(func() timerheap.Stats { return th.Stats() }, "1s").Should(And(
+			HaveField("Pending", 0),
+			HaveField("Delivered", uint64(3)),
+		))
+	})
+
+	It("passes events for topics and subscribers through the chain once", func() {
+		var lock sync.Mutex
+		var seen []interface{}
+		record := func(next timerheap.Handler) timerheap.Handler {
+			return func(value interface{}, md timerheap.Metadata) {
+				lock.Lock()
+				seen = append(seen, value)
+				lock.Unlock()
+				next(value, md)
+			}
+		}
+		th = timerheap.New(timerheap.WithMiddleware(record, tag("m")))
+		Expect(th.PushEvent(0, "t", timerheap.WithTopic("topic"))).To(Succeed())
+		Eventually(th.TimedEventFor("topic"), "1s").Should(Receive(Equal("t/m")))
+
+		sub := th.Subscribe(0)
+		Expect(th.PushEvent(0, "s")).To(Succeed())
+		Eventually(sub.Events(), "1s").Should(Receive(Equal("s/m")))
+		sub.Unsubscribe()
+
+		Expect(th.PushEvent(0, "r")).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("r/m")))
+
+		lock.Lock()
+		defer lock.Unlock()
+		Expect(seen).To(Equal([]interface{}{"t", "s", "r"}))
+	})
+
+	It("wraps the value passed on in the delivery, and handles each redelivery", func() {
+		th = timerheap.New(timerheap.WithAck(30*time.Millisecond), timerheap.WithMiddleware(tag("m")))
+		Expect(th.PushEvent(0, "x")).To(Succeed())
+		var d *timerheap.Delivery
+		Eventually(th.TimedEvent(), "1s").Should(Receive(&d))
+		Expect(d.Value).To(Equal("x/m"))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(&d))
+		Expect(d.Value).To(Equal("x/m"))
+		Expect(d.Attempt).To(Equal(2))
+		Expect(d.Ack()).To(Succeed())
+	})
+
+	It("runs the middleware of a child inside that of its parent", func() {
+		th = timerheap.New(timerheap.WithMiddleware(tag("parent")))
+		child := th.NewChild(timerheap.WithMiddleware(tag("child")))
+		Expect(child.PushEvent(0, "x")).To(Succeed())
+		Eventually(child.TimedEvent(), "1s").Should(Receive(Equal("x/parent/child")))
+		Expect(th.PushEvent(0, "y")).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("y/parent")))
+	})
+})
@@ -0,0 +1,47 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("WithMinDelay", func() {
+	It("delays events pushed with a shorter delay to the minimum", func() {
+		th := timerheap.New(timerheap.WithMinDelay(50 * time.Millisecond))
+		defer th.Terminate()
+
+		start := time.Now()
+		Expect(th.PushEvent(0, "zero")).To(Succeed())
+		Expect(th.PushEventAt(start.Add(-time.Minute), "past")).To(Succeed())
+		Expect(th.PushEvent(100*time.Millisecond, "later")).To(Succeed())
+		Expect(th.Stats().Clamped).To(Equal(uint64(2)))
+
+		Consistently(th.TimedEvent(), "30ms").ShouldNot(Receive())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("zero")))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("past")))
+		Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("later")))
+		Expect(th.Stats().Clamped).To(Equal(uint64(2)))
+	})
+
+	It("does not clamp events rejected by WithStrictDeadlines", func() {
+		th := timerheap.New(timerheap.WithMinDelay(10*time.Millisecond), timerheap.WithStrictDeadlines())
+		defer th.Terminate()
+		Expect(th.PushEvent(0, "zero")).To(MatchError(timerheap.ErrPastDeadline))
+		Expect(th.PushEvent(time.Millisecond, "short")).To(Succeed())
+		Expect(th.Stats().Clamped).To(Equal(uint64(1)))
+	})
+
+	It("includes the clamped events of children", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		child := th.NewChild(timerheap.WithMinDelay(time.Millisecond))
+		Expect(th.PushEvent(0, "parent")).To(Succeed())
+		Expect(child.PushEvent(0, "child")).To(Succeed())
+		Expect(th.Stats().Clamped).To(Equal(uint64(1)))
+	})
+})
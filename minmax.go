@@ -0,0 +1,289 @@
+package timerheap
+
+import (
+	"math/bits"
+	"time"
+)
+
+// minMaxHeap is a min-max heap held in a slice. The children of the item at index i are at
+// indexes 2i+1 and 2i+2, as in a binary heap, but the levels alternate between min levels, whose
+// items never pop after the items below them, and max levels, whose items never pop before the
+// items below them. The root is the item that pops first, and the item that pops last is one of
+// its children, so both ends of the heap can be found in constant time.
+type minMaxHeap []timedItem
+
+var _ backend = &minMaxHeap{}
+
+func (h minMaxHeap) Len() int { return len(h) }
+
+func (h *minMaxHeap) push(ti timedItem) {
+	*h = append(*h, ti)
+	placed(*h, len(*h)-1)
+	h.bubbleUp(len(*h) - 1)
+}
+
+func (h *minMaxHeap) pushAll(items []timedItem) {
+	// As with the slice heaps, the heap is only rebuilt once the items are at least as many as
+	// those it already holds.
+	n := len(*h)
+	*h = append(*h, items...)
+	rebuild := len(items) >= n
+	for i := n; i < len(*h); i++ {
+		placed(*h, i)
+		if !rebuild {
+			h.bubbleUp(i)
+		}
+	}
+	if rebuild {
+		for i := len(*h)/2 - 1; i >= 0; i-- {
+			h.trickleDown(i)
+		}
+	}
+}
+
+func (h *minMaxHeap) peek() *timedItem {
+	if len(*h) == 0 {
+		return nil
+	}
+	return &(*h)[0]
+}
+
+func (h *minMaxHeap) pop() timedItem {
+	return h.removeAt(0)
+}
+
+func (h minMaxHeap) peekFarthest() *timedItem {
+	if i := h.farthest(); i >= 0 {
+		return &h[i]
+	}
+	return nil
+}
+
+func (h *minMaxHeap) popFarthest() timedItem {
+	return h.removeAt(h.farthest())
+}
+
+func (h *minMaxHeap) removeWhere(match func(ti *timedItem) bool) (timedItem, bool) {
+	for i := range *h {
+		if match(&(*h)[i]) {
+			return h.removeAt(i), true
+		}
+	}
+	return timedItem{}, false
+}
+
+func (h *minMaxHeap) removeAll(match func(ti *timedItem) bool, dst []timedItem) []timedItem {
+	old := *h
+	n := 0
+	for i := range old {
+		if match(&old[i]) {
+			dst = append(dst, old[i])
+			continue
+		}
+		old[n] = old[i]
+		n++
+	}
+	if n == len(old) {
+		return dst
+	}
+	for i := n; i < len(old); i++ {
+		old[i] = timedItem{}
+	}
+	*h = old[:n]
+	for i := range *h {
+		placed(*h, i)
+	}
+	for i := n/2 - 1; i >= 0; i-- {
+		h.trickleDown(i)
+	}
+	return dst
+}
+
+func (h minMaxHeap) first(match func(ti *timedItem) bool) *timedItem {
+	if i := h.firstWhere(0, match, -1); i >= 0 {
+		return &h[i]
+	}
+	return nil
+}
+
+func (h *minMaxHeap) appendTo(dst []timedItem) []timedItem {
+	return append(dst, *h...)
+}
+
+func (h minMaxHeap) shift(d time.Duration) {
+	for i := range h {
+		h[i].shift(d)
+	}
+}
+
+func (h minMaxHeap) deadline(best time.Time) time.Time {
+	return h.deadlineFrom(0, best)
+}
+
+func (h *minMaxHeap) grow(n int) {
+	grow((*[]timedItem)(h), n)
+}
+
+func (h *minMaxHeap) shrink(min int) {
+	shrink((*[]timedItem)(h), min)
+}
+
+func (h minMaxHeap) footprint() (int, uintptr) {
+	return footprint(h)
+}
+
+func (h minMaxHeap) lookup(hd *Handle) *timedItem {
+	return lookupHandle(h, hd)
+}
+
+func (h *minMaxHeap) removeHandle(hd *Handle) timedItem {
+	return h.removeAt(hd.index)
+}
+
+func (h minMaxHeap) rescheduleHandle(hd *Handle, expire time.Time) {
+	h[hd.index].expire = expire
+	h.fix(hd.index)
+}
+
+// minLevel returns true if index i is on a min level.
+func minLevel(i int) bool {
+	return bits.Len(uint(i+1))%2 == 1
+}
+
+// above returns true if the item at index i belongs above the item at index j on a min level, if
+// min is set, or on a max level otherwise.
+func (h minMaxHeap) above(i, j int, min bool) bool {
+	if min {
+		return h[i].before(&h[j])
+	}
+	return h[j].before(&h[i])
+}
+
+// farthest returns the index of the item that would be popped last, or -1 if the heap is empty.
+func (h minMaxHeap) farthest() int {
+	switch len(h) {
+	case 0:
+		return -1
+	case 1:
+		return 0
+	case 2:
+		return 1
+	}
+	if h[1].before(&h[2]) {
+		return 2
+	}
+	return 1
+}
+
+// removeAt removes and returns the item at index i.
+func (h *minMaxHeap) removeAt(i int) timedItem {
+	old := *h
+	n := len(old) - 1
+	ti := old[i]
+	old[i] = old[n]
+	old[n] = timedItem{}
+	*h = old[:n]
+	if i < n {
+		placed(*h, i)
+		h.fix(i)
+	}
+	return ti
+}
+
+// fix moves the item at index i, which may be out of order with both the items above and below
+// it, back into order. If the item moves up, the item that takes its place came from a level
+// above and may in turn be out of order with the items below it.
+func (h minMaxHeap) fix(i int) {
+	h.bubbleUp(i)
+	h.trickleDown(i)
+}
+
+// bubbleUp moves the item at index i towards the top until it is in order with the items above
+// it.
+func (h minMaxHeap) bubbleUp(i int) {
+	if i == 0 {
+		return
+	}
+	min := minLevel(i)
+	if parent := (i - 1) / 2; h.above(parent, i, min) {
+		// The item belongs on the other kind of level.
+		swap(h, i, parent)
+		i, min = parent, !min
+	}
+	for i > 2 {
+		grandparent := ((i-1)/2 - 1) / 2
+		if !h.above(i, grandparent, min) {
+			return
+		}
+		swap(h, i, grandparent)
+		i = grandparent
+	}
+}
+
+// trickleDown moves the item at index i towards the bottom until it is in order with the items
+// below it.
+func (h minMaxHeap) trickleDown(i int) {
+	min := minLevel(i)
+	for {
+		// Find the child or grandchild that belongs highest on the level of the item.
+		m := -1
+		for _, c := range [...]int{2*i + 1, 2*i + 2, 4*i + 3, 4*i + 4, 4*i + 5, 4*i + 6} {
+			if c < len(h) && (m < 0 || h.above(c, m, min)) {
+				m = c
+			}
+		}
+		if m < 0 || !h.above(m, i, min) {
+			return
+		}
+		swap(h, m, i)
+		if m <= 2*i+2 {
+			// A child is on the other kind of level, and has no items below it that belong
+			// above the item.
+			return
+		}
+		if parent := (m - 1) / 2; h.above(parent, m, min) {
+			swap(h, m, parent)
+		}
+		i = m
+	}
+}
+
+// firstWhere returns the index of the item that pops first of the items for which match returns
+// true in the subtree rooted at index i, or best if none pops before the item at index best. The
+// subtrees rooted at items on min levels that match, or that pop after best, are not searched.
+func (h minMaxHeap) firstWhere(i int, match func(ti *timedItem) bool, best int) int {
+	if i >= len(h) {
+		return best
+	}
+	min := minLevel(i)
+	if best < 0 || h[i].before(&h[best]) {
+		if match(&h[i]) {
+			best = i
+			if min {
+				return best
+			}
+		}
+	} else if min {
+		return best
+	}
+	best = h.firstWhere(2*i+1, match, best)
+	return h.firstWhere(2*i+2, match, best)
+}
+
+// deadlineFrom returns the earliest deadline of the items in the subtree rooted at index i, or
+// best if none is earlier. Only items that expire before best can have an earlier deadline, so
+// the subtrees rooted at items on min levels that do not are not searched.
+func (h minMaxHeap) deadlineFrom(i int, best time.Time) time.Time {
+	if i >= len(h) {
+		return best
+	}
+	if h[i].expire.Before(best) {
+		if dl := h[i].deadline(); dl.Before(best) {
+			best = dl
+		}
+	} else if minLevel(i) {
+		return best
+	}
+	best = h.deadlineFrom(2*i+1, best)
+	return h.deadlineFrom(2*i+2, best)
+}
@@ -0,0 +1,91 @@
+package timerheap
+
+import (
+	"math/rand"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Min-max heap", func() {
+	var base time.Time
+	var h *minMaxHeap
+
+	at := func(i int) time.Time {
+		return base.Add(time.Duration(i) * time.Second)
+	}
+
+	// checkOrder checks that no item pops before an item on a min level above it, or after an
+	// item on a max level above it.
+	checkOrder := func() {
+		for i := 1; i < h.Len(); i++ {
+			for a := (i - 1) / 2; ; a = (a - 1) / 2 {
+				if minLevel(a) {
+					ExpectWithOffset(1, (*h)[i].before(&(*h)[a])).To(BeFalse())
+				} else {
+					ExpectWithOffset(1, (*h)[a].before(&(*h)[i])).To(BeFalse())
+				}
+				if a == 0 {
+					break
+				}
+			}
+		}
+	}
+
+	BeforeEach(func() {
+		base = time.Now()
+		h = &minMaxHeap{}
+		for i, n := range rand.Perm(100) {
+			h.push(timedItem{expire: at(n), seq: uint64(i)})
+		}
+		checkOrder()
+	})
+
+	It("pops from both ends", func() {
+		for i := 0; i < 50; i++ {
+			Expect(h.peek().expire).To(Equal(at(i)))
+			Expect(h.peekFarthest().expire).To(Equal(at(99 - i)))
+			Expect(h.pop().expire).To(Equal(at(i)))
+			Expect(h.popFarthest().expire).To(Equal(at(99 - i)))
+			checkOrder()
+		}
+		Expect(h.Len()).To(BeZero())
+		Expect(h.peekFarthest()).To(BeNil())
+	})
+
+	It("stays in order as items are removed and rescheduled", func() {
+		handles := map[int]*Handle{}
+		for i := 100; i < 200; i++ {
+			handles[i] = &Handle{}
+			h.push(timedItem{expire: at(rand.Intn(300)), seq: uint64(i), handle: handles[i]})
+		}
+		for i := 100; i < 200; i++ {
+			if i%2 == 0 {
+				h.removeHandle(handles[i])
+			} else {
+				Expect(h.lookup(handles[i])).NotTo(BeNil())
+				h.rescheduleHandle(handles[i], at(rand.Intn(300)))
+			}
+			checkOrder()
+		}
+		Expect(h.Len()).To(Equal(150))
+
+		h.removeAll(func(ti *timedItem) bool { return ti.seq%3 == 0 }, nil)
+		checkOrder()
+		for i := 101; i < 200; i += 2 {
+			if i%3 != 0 {
+				Expect(h.lookup(handles[i])).NotTo(BeNil())
+			}
+		}
+
+		var last *timedItem
+		for h.Len() > 0 {
+			ti := h.pop()
+			if last != nil {
+				Expect(ti.before(last)).To(BeFalse())
+			}
+			last = &ti
+		}
+	})
+})
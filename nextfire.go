@@ -0,0 +1,60 @@
+package timerheap
+
+import (
+	"time"
+)
+
+// NextFireChanges returns a channel that receives the scheduled time of the soonest pending
+// event whenever it changes, or the zero time when there are no pending events. This allows an
+// external event loop to recompute its poll timeout. The channel holds only the latest time, an
+// earlier time that has not been received is replaced, and initially holds the current time.
+//
+// This includes events that have popped but have not been received, so it is the same as
+// Stats.NextFire, except that it does not include child heaps. The channel is closed when the
+// heap is terminated.
+func (t *timerHeap) NextFireChanges() <-chan time.Time {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.nextFireChanges == nil {
+		t.nextFireChanges = make(chan time.Time, 1)
+		if t.terminated {
+			close(t.nextFireChanges)
+		} else {
+			t.nextFire = t.nextFireLocked()
+			t.nextFireChanges <- t.nextFire
+		}
+	}
+	return t.nextFireChanges
+}
+
+// nextFireLocked returns the scheduled time of the soonest pending event, or the zero time if
+// there are no pending events. The caller must hold the lock.
+func (t *timerHeap) nextFireLocked() time.Time {
+	var next time.Time
+	if ti := t.valueHeap.peek(); ti != nil {
+		next = ti.expire
+	}
+	if len(t.ready) > 0 && (next.IsZero() || t.ready[0].expire.Before(next)) {
+		next = t.ready[0].expire
+	}
+	return next
+}
+
+// updateNextFireLocked sends the scheduled time of the soonest pending event if it has changed
+// since it was last sent, replacing any time that has not been received. The caller must hold
+// the lock, which ensures there is room in the channel once it has been emptied.
+func (t *timerHeap) updateNextFireLocked() {
+	if t.nextFireChanges == nil || t.terminated {
+		return
+	}
+	next := t.nextFireLocked()
+	if next.Equal(t.nextFire) {
+		return
+	}
+	t.nextFire = next
+	select {
+	case <-t.nextFireChanges:
+	default:
+	}
+	t.nextFireChanges <- next
+}
@@ -0,0 +1,63 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Next fire notifications", func() {
+	var th timerheap.TimerHeap
+
+	BeforeEach(func() {
+		th = timerheap.New()
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("notifies when the soonest deadline changes", func() {
+		changes := th.NextFireChanges()
+
+		By("Checking the initial time is the zero time")
+		Expect(changes).To(Receive(BeZero()))
+
+		By("adding an event")
+		later := time.Now().Add(time.Hour)
+		Expect(th.PushEventAt(later, testdata{index: 1})).To(Succeed())
+		Eventually(changes, "1s", "1ms").Should(Receive(BeTemporally("==", later)))
+
+		By("adding a later event that does not change the soonest deadline")
+		Expect(th.PushEventAt(later.Add(time.Hour), testdata{index: 2})).To(Succeed())
+		Consistently(changes, "100ms", "10ms").ShouldNot(Receive())
+
+		By("adding a sooner event")
+		sooner := time.Now().Add(50 * time.Millisecond)
+		Expect(th.PushEventAt(sooner, testdata{index: 3})).To(Succeed())
+		Eventually(changes, "1s", "1ms").Should(Receive(BeTemporally("==", sooner)))
+
+		By("receiving the sooner event")
+		Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive())
+		Eventually(changes, "1s", "1ms").Should(Receive(BeTemporally("==", later)))
+	})
+
+	It("holds only the latest time", func() {
+		changes := th.NextFireChanges()
+		for i := 0; i < 5; i++ {
+			Expect(th.PushEvent(time.Duration(5-i)*time.Hour, testdata{index: i})).To(Succeed())
+			time.Sleep(10 * time.Millisecond)
+		}
+		Expect(changes).To(Receive(BeTemporally("~", time.Now().Add(time.Hour), time.Second)))
+		Expect(changes).NotTo(Receive())
+	})
+
+	It("closes the channel on termination", func() {
+		changes := th.NextFireChanges()
+		th.Terminate()
+		Eventually(changes).Should(BeClosed())
+	})
+})
@@ -0,0 +1,206 @@
+package timerheap
+
+import (
+	"time"
+)
+
+// Option is used to configure a TimerHeap when calling New.
+type Option func(*timerHeap)
+
+// WithTimedResults configures the TimerHeap to send a TimedResult on the results channel
+// rather than the bare pushed value. This provides the scheduled and fired times of each
+// event without the caller needing to store them in the value.
+func WithTimedResults() Option {
+	return func(t *timerHeap) {
+		t.timedResults = true
+	}
+}
+
+// WithExpvar publishes the heap Stats as an expvar with the supplied name, making them
+// available on /debug/vars. The name must not clash with other expvars in the process, but
+// may be reused by a new heap once the previous heap with that name has been terminated.
+func WithExpvar(name string) Option {
+	return func(t *timerHeap) {
+		t.expvarName = name
+	}
+}
+
+// WithLogger configures the heap to log debug and warning messages about pushes, pops, late
+// deliveries and termination. A *slog.Logger may be used directly. By default a delivery is
+// logged as late if it is received more than 100ms after its scheduled time, this may be
+// changed with WithLateDeliveryHandler.
+func WithLogger(l Logger) Option {
+	return func(t *timerHeap) {
+		t.log = l
+	}
+}
+
+// WithLateDeliveryHandler configures the heap to call the handler whenever an event is
+// received from the results channel more than threshold after its scheduled time. The
+// TimedResult passed to the handler has FiredAt set to the time the event was received, so
+// the lateness includes any time spent waiting for the consumer.
+//
+// The handler is called from the event goroutine and should not block. The handler may be
+// nil, in which case only the threshold used for logging late deliveries is updated.
+func WithLateDeliveryHandler(threshold time.Duration, handler func(TimedResult)) Option {
+	return func(t *timerHeap) {
+		t.lateThreshold = threshold
+		t.lateHandler = handler
+	}
+}
+
+// WithTypeRegistry configures the heap to validate pushed values against the registry. Values
+// of registered types are checked with the validator supplied when the type was registered. If
+// strict is true, pushing a value of an unregistered type fails with ErrUnregisteredType.
+func WithTypeRegistry(r *TypeRegistry, strict bool) Option {
+	return func(t *timerHeap) {
+		t.types = r
+		t.strictTypes = strict
+	}
+}
+
+// WithStrictDeadlines configures the heap to reject events that are already due, rather than
+// firing them immediately. Pushing an event with a duration that is not positive, or with an
+// expiration time that is not in the future, fails with ErrPastDeadline, which catches callers
+// that compute negative durations by mistake. Events restored from a saved heap, a
+// write-ahead log or a store may be overdue and are not rejected, nor are the timers of
+// AfterChan.
+func WithStrictDeadlines() Option {
+	return func(t *timerHeap) {
+		t.strictDeadlines = true
+	}
+}
+
+// WithMinDelay sets the shortest delay an event is pushed with. An event pushed to pop sooner
+// than d from now, including one that is already due, pops d from now instead, so that a
+// consumer that pushes events again with no delay cannot keep the heap busy. Clamped events are
+// counted in Stats.Clamped. Events that are rejected with WithStrictDeadlines are not clamped,
+// and events restored from a saved heap, a write-ahead log or a store keep their times.
+func WithMinDelay(d time.Duration) Option {
+	return func(t *timerHeap) {
+		t.minDelay = d
+	}
+}
+
+// WithQuantization rounds the expiration time of each event pushed up to the next multiple of
+// boundary since the zero time, such as the next whole second or minute, so that events
+// scheduled by many producers for around the same time pop together. Times already on a
+// boundary are not changed. The not-after time of an event is not rounded, so an event whose
+// window does not include a boundary is discarded. Events restored from a saved heap, a
+// write-ahead log or a store keep their times, and AfterChan timers are not rounded.
+func WithQuantization(boundary time.Duration) Option {
+	return func(t *timerHeap) {
+		t.quantum = boundary
+	}
+}
+
+// WithMaxPending limits the number of pending events the heap may hold. Once the limit is
+// reached, pushing an event fails with ErrFull until an event has been delivered. This may be
+// changed with WithOverflowPolicy.
+func WithMaxPending(n int) Option {
+	return func(t *timerHeap) {
+		t.maxPending = n
+	}
+}
+
+// WithDeadLetters configures the heap to report events that will never be delivered on the
+// DeadLetters channel. See DeadLetterReason for the reasons an event may be dead-lettered.
+func WithDeadLetters() Option {
+	return func(t *timerHeap) {
+		t.deadLetters = newQueue[DeadLetter](0)
+	}
+}
+
+// WithMaxWait limits how long the heap waits before processing the heap again, even if no
+// event is due, so that the timer for an event that is far in the future is re-armed at least
+// every d. This limits how late an event can pop if the timer is affected by a clock anomaly.
+func WithMaxWait(d time.Duration) Option {
+	return func(t *timerHeap) {
+		t.maxWait = d
+	}
+}
+
+// WithCoalescing pops each event along with the events due within window after it, so that
+// events due close together are delivered back to back after a single timer pop, rather than the
+// timer being armed for each of them. Events may therefore pop up to window before their
+// scheduled time, including events pushed with a not-before time.
+func WithCoalescing(window time.Duration) Option {
+	return func(t *timerHeap) {
+		t.coalesce = window
+	}
+}
+
+// WithTick processes the heap at fixed ticks of the interval, delivering the events that became
+// due since the previous tick at each tick, rather than as each event becomes due. Events pop up
+// to the interval late, in return for far fewer timer operations and wakeups when many events are
+// pending. Ticks are aligned to multiples of the interval since the zero time, and the heap only
+// wakes for ticks at which an event is due.
+func WithTick(interval time.Duration) Option {
+	return func(t *timerHeap) {
+		t.tick = interval
+	}
+}
+
+// WithPrecision makes the heap wait on its timer until spin before the next event is due, and
+// then spin for the rest of the wait, so that events pop within tens of microseconds of their
+// scheduled time rather than within the millisecond or so of a timer. This uses a CPU for up to
+// spin before each event pops, so spin should be no longer than the typical timer error, for
+// example 1ms. Heaps run by a Dispatcher are not affected.
+func WithPrecision(spin time.Duration) Option {
+	return func(t *timerHeap) {
+		t.spin = spin
+	}
+}
+
+// PushOption is used to configure an individual event when pushing it to a TimerHeap.
+type PushOption func(*timedItem)
+
+// WithStaleAfter limits how late the event may be delivered. If the event cannot be delivered
+// within d of its scheduled time (for example because the consumer is not reading the results
+// channel) it is discarded rather than delivered late, and sent to the dead letter channel if
+// there is one. This sets the not-after time of the event, see PushEventWindow.
+func WithStaleAfter(d time.Duration) PushOption {
+	return func(ti *timedItem) {
+		ti.notAfter = ti.expire.Add(d)
+	}
+}
+
+// WithPriorityClass sets the priority class of the event. Events are popped in time order, but
+// when several events have already expired, for example because the consumer stalled, those
+// with a higher priority class are delivered first even if they were scheduled later. Events
+// with the same priority class are delivered in time order. The default priority class is 0,
+// negative classes may be used for events that should yield to the default.
+//
+// Without WithNonBlockingDelivery, the single event that has popped and is waiting to be
+// received is not overtaken, the priority class applies to the events behind it.
+func WithPriorityClass(class int) PushOption {
+	return func(ti *timedItem) {
+		ti.priority = class
+	}
+}
+
+// WithTiebreak orders the event among the events with exactly the same expiration time, so
+// that a batch of events scheduled for the same instant pops in an order set by the caller.
+// Events with a higher tiebreak pop first, and events with the same tiebreak pop in the order
+// they were pushed. The default tiebreak is 0. Unlike WithPriorityClass, the tiebreak does not
+// affect events with different expiration times, even once they have all expired.
+func WithTiebreak(tiebreak int) PushOption {
+	return func(ti *timedItem) {
+		ti.tiebreak = tiebreak
+	}
+}
+
+// WithNonBlockingDelivery configures the heap so that a consumer that is not reading the
+// results channel does not delay later events. Events that pop while the consumer is not
+// ready are buffered, in the order they popped, and the heap continues to pop later events
+// on time. By default only a single popped event is held until it is received.
+//
+// If maxBuffered is greater than 0 and the buffer is full, the oldest buffered event in the
+// lowest priority class is dropped to make room. Dropped events are counted in Stats.Dropped and sent to the dead
+// letter channel if there is one.
+func WithNonBlockingDelivery(maxBuffered int) Option {
+	return func(t *timerHeap) {
+		t.nonBlocking = true
+		t.maxBuffered = maxBuffered
+	}
+}
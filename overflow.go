@@ -0,0 +1,103 @@
+package timerheap
+
+// OverflowPolicy determines what happens when an event is pushed to a heap that already holds
+// the maximum number of pending events configured with WithMaxPending.
+type OverflowPolicy int
+
+const (
+	// OverflowReject fails the push with ErrFull. This is the default.
+	OverflowReject OverflowPolicy = iota
+	// OverflowDropSoonest drops the pending event that is due to pop soonest.
+	OverflowDropSoonest
+	// OverflowDropFarthest drops the pending event that is due to pop last. This may be the
+	// event being pushed. The heap is also trimmed back to the limit, dropping the events that
+	// are due to pop last, when events moved into it by Merge, SplitWhere or Transfer take it
+	// over the limit.
+	OverflowDropFarthest
+	// OverflowBlock blocks the push until an event has been delivered or the heap is
+	// terminated, in which case the push fails with ErrTerminated, or quiesced, in which case
+	// it fails with ErrQuiescing.
+	OverflowBlock
+)
+
+// WithOverflowPolicy sets the policy used when pushing to a full heap. This has no effect
+// unless WithMaxPending is also used.
+//
+// Events that have already popped and are waiting to be received are never dropped. If there
+// are no other events to drop, the event being pushed is dropped. Dropped events are
+// counted in Stats.Dropped and sent to the dead letter channel if there is one.
+func WithOverflowPolicy(p OverflowPolicy) Option {
+	return func(t *timerHeap) {
+		t.overflow = p
+	}
+}
+
+// makeRoom applies the overflow policy for a push of the new item to a full heap. It returns
+// the item that was dropped, which may be the new item, or nil if nothing was dropped. The
+// caller must hold the lock.
+func (t *timerHeap) makeRoom(ti *timedItem) (*timedItem, error) {
+	switch t.overflow {
+	case OverflowDropSoonest:
+		if t.valueHeap.Len() == 0 {
+			return ti, nil
+		}
+		dropped := t.valueHeap.pop()
+		return &dropped, nil
+	case OverflowDropFarthest:
+		// The new item has not been assigned a sequence number yet, but will pop after any
+		// item with the same expiration.
+		far, last := t.latestLocked()
+		if far == nil || !ti.expire.Before(far.expire) {
+			return ti, nil
+		}
+		dropped := t.removeLatestLocked(far, last)
+		return &dropped, nil
+	case OverflowBlock:
+		// Pushes blocked here hold gate, so they stop waiting once the heap is terminating or
+		// quiescing, rather than holding up Terminate or Quiesce until there is space.
+		for t.pendingLocked() >= t.maxPending {
+			if t.terminated || t.closing.Load() {
+				return nil, ErrTerminated
+			}
+			if t.quiescing.Load() && ti.stored == 0 {
+				return nil, ErrQuiescing
+			}
+			t.space.Wait()
+		}
+		if t.terminated {
+			return nil, ErrTerminated
+		}
+		return nil, nil
+	default:
+		return nil, ErrFull
+	}
+}
+
+// trimLocked drops the events that are due to pop last while the heap holds more than the
+// maximum number of pending events, if the overflow policy is OverflowDropFarthest, and returns
+// them to be dead-lettered with dropTrimmed. Events that have popped are never dropped. The
+// caller must hold the lock.
+func (t *timerHeap) trimLocked() []timedItem {
+	if t.maxPending <= 0 || t.overflow != OverflowDropFarthest {
+		return nil
+	}
+	var trimmed []timedItem
+	for t.pendingLocked() > t.maxPending {
+		far, last := t.latestLocked()
+		if far == nil {
+			break
+		}
+		trimmed = append(trimmed, t.removeLatestLocked(far, last))
+		t.dropped++
+	}
+	return trimmed
+}
+
+// dropTrimmed sends the events dropped by trimLocked to the dead letter queue.
+func (t *timerHeap) dropTrimmed(trimmed []timedItem) {
+	for _, ti := range trimmed {
+		t.log.Warn("Dropped event, heap is full", "seq", ti.seq, "expire", ti.expire)
+		t.fault(FaultDropped, "event dropped, heap is full", nil)
+		t.deadLetter(ti, DeadLetterFull)
+	}
+}
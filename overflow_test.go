@@ -0,0 +1,155 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("timer heap overflow policy tests", func() {
+
+	var th timerheap.TimerHeap
+	var now time.Time
+
+	// fill creates a heap with the overflow policy, and fills it with an event one minute in
+	// the future followed by three events one, two and three hours in the future.
+	fill := func(p timerheap.OverflowPolicy) {
+		th = timerheap.New(timerheap.WithMaxPending(4), timerheap.WithOverflowPolicy(p))
+		now = time.Now()
+		Expect(th.PushEventAt(now.Add(time.Minute), testdata{index: 0})).To(Succeed())
+		for i := 1; i <= 3; i++ {
+			Expect(th.PushEventAt(now.Add(time.Duration(i)*time.Hour), testdata{index: i})).To(Succeed())
+		}
+	}
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("drops the soonest event", func() {
+		fill(timerheap.OverflowDropSoonest)
+		Expect(th.PushEventAt(now.Add(30*time.Minute), testdata{index: 4})).To(Succeed())
+		s := th.Stats()
+		Expect(s.Pending).To(Equal(4))
+		Expect(s.Dropped).To(Equal(uint64(1)))
+		Expect(s.NextFire).To(Equal(now.Add(30 * time.Minute)))
+	})
+
+	It("does not drop an event that has popped", func() {
+		fill(timerheap.OverflowDropSoonest)
+
+		By("pushing an event that pops immediately, and pausing for it to pop")
+		Expect(th.PushEventAt(now, testdata{index: 4})).To(Succeed())
+		time.Sleep(100 * time.Millisecond)
+
+		By("pushing another event and checking the popped event is kept")
+		Expect(th.PushEventAt(now.Add(time.Second), testdata{index: 5})).To(Succeed())
+		Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(Equal(testdata{index: 4})))
+		Eventually(th.TimedEvent(), "2s", "10ms").Should(Receive(Equal(testdata{index: 5})))
+		Expect(th.Stats().Dropped).To(Equal(uint64(2)))
+	})
+
+	It("drops the farthest event", func() {
+		fill(timerheap.OverflowDropFarthest)
+
+		By("pushing an event that is not the farthest")
+		Expect(th.PushEventAt(now.Add(30*time.Minute), testdata{index: 4})).To(Succeed())
+		s := th.Stats()
+		Expect(s.Pending).To(Equal(4))
+		Expect(s.Dropped).To(Equal(uint64(1)))
+
+		By("pushing an event that is the farthest")
+		Expect(th.PushEventAt(now.Add(10*time.Hour), testdata{index: 5})).To(Succeed())
+		s = th.Stats()
+		Expect(s.Pending).To(Equal(4))
+		Expect(s.Dropped).To(Equal(uint64(2)))
+		Expect(s.Pushed).To(Equal(uint64(6)))
+	})
+
+	It("trims the farthest events when events are moved into the heap", func() {
+		th = timerheap.New(
+			timerheap.WithMaxPending(4),
+			timerheap.WithOverflowPolicy(timerheap.OverflowDropFarthest),
+			timerheap.WithDeadLetters(),
+		)
+		now = time.Now()
+		other := timerheap.New()
+		for i := 0; i < 6; i++ {
+			heap := th
+			if i%2 == 1 {
+				heap = other
+			}
+			Expect(heap.PushEventAt(now.Add(time.Duration(i)*time.Hour), testdata{index: i})).To(Succeed())
+		}
+		Expect(th.Merge(other)).To(Succeed())
+
+		By("checking the two farthest events were dead-lettered")
+		for _, i := range []int{5, 4} {
+			var dl timerheap.DeadLetter
+			Eventually(th.DeadLetters(), "1s").Should(Receive(&dl))
+			Expect(dl.Value).To(Equal(testdata{index: i}))
+			Expect(dl.Reason).To(Equal(timerheap.DeadLetterFull))
+		}
+		s := th.Stats()
+		Expect(s.Pending).To(Equal(4))
+		Expect(s.Dropped).To(Equal(uint64(2)))
+		value, _, _ := th.PeekLatest()
+		Expect(value).To(Equal(testdata{index: 3}))
+	})
+
+	It("trims a heap split with a limit", func() {
+		th = timerheap.New()
+		now = time.Now()
+		for i := 0; i < 6; i++ {
+			Expect(th.PushEventAt(now.Add(time.Duration(i)*time.Hour), testdata{index: i})).To(Succeed())
+		}
+		split := th.SplitWhere(func(interface{}) bool { return true },
+			timerheap.WithMaxPending(2), timerheap.WithOverflowPolicy(timerheap.OverflowDropFarthest))
+		defer split.Terminate()
+		Expect(th.Stats().Pending).To(BeZero())
+		Expect(split.Stats().Pending).To(Equal(2))
+		value, _, _ := split.PeekLatest()
+		Expect(value).To(Equal(testdata{index: 1}))
+	})
+
+	It("blocks until there is space", func() {
+		th = timerheap.New(timerheap.WithMaxPending(1), timerheap.WithOverflowPolicy(timerheap.OverflowBlock))
+		Expect(th.PushEvent(0, testdata{index: 0})).To(Succeed())
+
+		By("pushing to the full heap in the background")
+		done := make(chan error)
+		go func() {
+			done <- th.PushEvent(0, testdata{index: 1})
+		}()
+		Consistently(done, "100ms", "10ms").ShouldNot(Receive())
+
+		By("Receiving an event and checking the push completes")
+		var value interface{}
+		Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(&value))
+		Expect(value).To(Equal(testdata{index: 0}))
+		Eventually(done, "1s", "10ms").Should(Receive(BeNil()))
+		Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(&value))
+		Expect(value).To(Equal(testdata{index: 1}))
+	})
+
+	It("fails a blocked push when the heap is terminated", func() {
+		th = timerheap.New(timerheap.WithMaxPending(1), timerheap.WithOverflowPolicy(timerheap.OverflowBlock))
+		Expect(th.PushEvent(time.Hour, testdata{index: 0})).To(Succeed())
+
+		done := make(chan error)
+		go func() {
+			done <- th.PushEvent(0, testdata{index: 1})
+		}()
+		Consistently(done, "100ms", "10ms").ShouldNot(Receive())
+		th.Terminate()
+		Eventually(done, "1s", "10ms").Should(Receive(Equal(timerheap.ErrTerminated)))
+	})
+
+	It("rejects the push by default", func() {
+		th = timerheap.New(timerheap.WithMaxPending(1))
+		Expect(th.PushEvent(time.Hour, testdata{index: 0})).To(Succeed())
+		Expect(th.PushEvent(0, testdata{index: 1})).To(Equal(timerheap.ErrFull))
+	})
+})
@@ -0,0 +1,338 @@
+package timerheap
+
+import (
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// pairingHeap is a pairing heap of timedItems. Each item is held in a node, and the children of
+// a node never pop before it. Pushing, merging heaps and moving an item earlier are constant
+// time, popping is amortized logarithmic.
+type pairingHeap struct {
+	root *pairingNode
+	n    int
+}
+
+// pairingNode holds an item in a pairingHeap. The children of a node are held in a list,
+// starting with child and linked by next. prev is the previous node in the list, or the parent
+// for the first child.
+type pairingNode struct {
+	item  timedItem
+	child *pairingNode
+	next  *pairingNode
+	prev  *pairingNode
+}
+
+var _ backend = &pairingHeap{}
+
+// pairingNodes holds unused nodes for reuse, to avoid an allocation for every push.
+var pairingNodes = sync.Pool{
+	New: func() interface{} {
+		return &pairingNode{}
+	},
+}
+
+func (h *pairingHeap) Len() int { return h.n }
+
+func (h *pairingHeap) push(ti timedItem) {
+	n := pairingNodes.Get().(*pairingNode)
+	n.item = ti
+	if ti.handle != nil {
+		ti.handle.node = n
+	}
+	h.pushNode(n)
+}
+
+func (h *pairingHeap) pushAll(items []timedItem) {
+	// Pushing is constant time, so there is nothing to gain from building the heap in one pass.
+	for _, ti := range items {
+		h.push(ti)
+	}
+}
+
+func (h *pairingHeap) peek() *timedItem {
+	if h.root == nil {
+		return nil
+	}
+	return &h.root.item
+}
+
+func (h *pairingHeap) pop() timedItem {
+	return h.release(h.root)
+}
+
+func (h *pairingHeap) peekFarthest() *timedItem {
+	if far := h.farthest(); far != nil {
+		return &far.item
+	}
+	return nil
+}
+
+func (h *pairingHeap) popFarthest() timedItem {
+	return h.release(h.farthest())
+}
+
+func (h *pairingHeap) removeWhere(match func(ti *timedItem) bool) (timedItem, bool) {
+	var found *pairingNode
+	h.walk(func(n *pairingNode) bool {
+		if found == nil && match(&n.item) {
+			found = n
+		}
+		return found == nil
+	})
+	if found == nil {
+		return timedItem{}, false
+	}
+	return h.release(found), true
+}
+
+func (h *pairingHeap) removeAll(match func(ti *timedItem) bool, dst []timedItem) []timedItem {
+	var found []*pairingNode
+	h.walk(func(n *pairingNode) bool {
+		if match(&n.item) {
+			found = append(found, n)
+		}
+		return true
+	})
+	for _, n := range found {
+		dst = append(dst, h.release(n))
+	}
+	return dst
+}
+
+func (h *pairingHeap) first(match func(ti *timedItem) bool) *timedItem {
+	// A node never pops after its children, so the children of a matching node, and of a node
+	// that pops after the match found so far, need not be searched.
+	var found *timedItem
+	h.walk(func(n *pairingNode) bool {
+		if found != nil && found.before(&n.item) {
+			return false
+		}
+		if match(&n.item) {
+			found = &n.item
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+func (h *pairingHeap) appendTo(dst []timedItem) []timedItem {
+	h.walk(func(n *pairingNode) bool {
+		dst = append(dst, n.item)
+		return true
+	})
+	return dst
+}
+
+func (h *pairingHeap) shift(d time.Duration) {
+	h.walk(func(n *pairingNode) bool {
+		n.item.shift(d)
+		return true
+	})
+}
+
+func (h *pairingHeap) deadline(best time.Time) time.Time {
+	// A node never expires after its children, so the children of a node that does not expire
+	// before the best deadline so far cannot have an earlier deadline.
+	h.walk(func(n *pairingNode) bool {
+		if !n.item.expire.Before(best) {
+			return false
+		}
+		if dl := n.item.deadline(); dl.Before(best) {
+			best = dl
+		}
+		return true
+	})
+	return best
+}
+
+func (h *pairingHeap) grow(n int) {
+	// Each item is held in its own node, taken from the shared pool as it is pushed.
+}
+
+func (h *pairingHeap) shrink(min int) {
+	// The nodes of popped items are returned to the shared pool as they pop.
+}
+
+func (h *pairingHeap) footprint() (int, uintptr) {
+	// There is room for exactly the items held, one to a node.
+	return h.n, uintptr(h.n) * unsafe.Sizeof(pairingNode{})
+}
+
+func (h *pairingHeap) lookup(hd *Handle) *timedItem {
+	// The node of a handle is not cleared when its item leaves the heap, and may since have
+	// been reused for another item.
+	if n := hd.node; n != nil && n.item.handle == hd {
+		return &n.item
+	}
+	return nil
+}
+
+func (h *pairingHeap) removeHandle(hd *Handle) timedItem {
+	return h.release(hd.node)
+}
+
+func (h *pairingHeap) rescheduleHandle(hd *Handle, expire time.Time) {
+	h.reschedule(hd.node, expire)
+}
+
+// farthest returns the node holding the item that pops last, or nil if the heap is empty. The
+// last item must be a leaf, but the leaves are not held together, so every node is visited.
+func (h *pairingHeap) farthest() *pairingNode {
+	var far *pairingNode
+	h.walk(func(n *pairingNode) bool {
+		if n.child == nil && (far == nil || far.item.before(&n.item)) {
+			far = n
+		}
+		return true
+	})
+	return far
+}
+
+// pushNode adds a detached node to the heap.
+func (h *pairingHeap) pushNode(n *pairingNode) {
+	h.n++
+	if h.root == nil {
+		h.root = n
+		return
+	}
+	h.root = link(h.root, n)
+}
+
+// remove removes the node from the heap and returns its item.
+func (h *pairingHeap) remove(n *pairingNode) timedItem {
+	if n == h.root {
+		h.root = mergePairs(n.child)
+	} else {
+		h.cut(n)
+		if sub := mergePairs(n.child); sub != nil {
+			h.root = link(h.root, sub)
+		}
+	}
+	h.n--
+	return n.item
+}
+
+// release removes the node from the heap, returns it to the pool of unused nodes, and returns
+// its item. Nodes that are still referenced elsewhere must be removed with remove instead.
+func (h *pairingHeap) release(n *pairingNode) timedItem {
+	ti := h.remove(n)
+	*n = pairingNode{}
+	pairingNodes.Put(n)
+	return ti
+}
+
+// reschedule changes the expiration time of the node. Moving a node earlier is constant time,
+// moving it later requires it to be removed and pushed again.
+func (h *pairingHeap) reschedule(n *pairingNode, expire time.Time) {
+	if expire.After(n.item.expire) {
+		h.remove(n)
+		*n = pairingNode{item: n.item}
+		n.item.expire = expire
+		h.pushNode(n)
+		return
+	}
+	n.item.expire = expire
+	if n != h.root {
+		h.cut(n)
+		h.root = link(h.root, n)
+	}
+}
+
+// meld moves all the items of the other heap into this heap, leaving the other heap empty.
+func (h *pairingHeap) meld(other *pairingHeap) {
+	if other.root != nil {
+		if h.root == nil {
+			h.root = other.root
+		} else {
+			h.root = link(h.root, other.root)
+		}
+	}
+	h.n += other.n
+	*other = pairingHeap{}
+}
+
+// cut detaches a node that is not the root, along with its children, from its parent.
+func (h *pairingHeap) cut(n *pairingNode) {
+	if n.prev.child == n {
+		n.prev.child = n.next
+	} else {
+		n.prev.next = n.next
+	}
+	if n.next != nil {
+		n.next.prev = n.prev
+	}
+	n.next = nil
+	n.prev = nil
+}
+
+// walk calls fn for each node in the heap, parents before children. The children of a node are
+// only visited if fn returns true.
+func (h *pairingHeap) walk(fn func(n *pairingNode) bool) {
+	if h.root == nil {
+		return
+	}
+	stack := []*pairingNode{h.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if fn(n) {
+			for c := n.child; c != nil; c = c.next {
+				stack = append(stack, c)
+			}
+		}
+	}
+}
+
+// link combines two detached nodes, making the one that pops later the first child of the
+// other, and returns the combined node.
+func link(a, b *pairingNode) *pairingNode {
+	if b.item.before(&a.item) {
+		a, b = b, a
+	}
+	b.prev = a
+	b.next = a.child
+	if a.child != nil {
+		a.child.prev = b
+	}
+	a.child = b
+	return a
+}
+
+// mergePairs combines a list of sibling nodes into a single detached node, or nil if the list
+// is empty. The siblings are linked in pairs from the left, and then the pairs are linked from
+// the right.
+func mergePairs(first *pairingNode) *pairingNode {
+	var pairs *pairingNode
+	for first != nil {
+		a := first
+		b := a.next
+		if b == nil {
+			first = nil
+		} else {
+			first = b.next
+			b.next, b.prev = nil, nil
+		}
+		a.next, a.prev = nil, nil
+		if b != nil {
+			a = link(a, b)
+		}
+		// Build the list of pairs in reverse, so the second pass runs from the right.
+		a.next = pairs
+		pairs = a
+	}
+	if pairs == nil {
+		return nil
+	}
+	root := pairs
+	pairs, root.next = root.next, nil
+	for pairs != nil {
+		next := pairs.next
+		pairs.next = nil
+		root = link(root, pairs)
+		pairs = next
+	}
+	return root
+}
@@ -0,0 +1,83 @@
+package timerheap
+
+import (
+	"math/rand"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pairing heap", func() {
+	var base time.Time
+	var h *pairingHeap
+
+	at := func(i int) time.Time {
+		return base.Add(time.Duration(i) * time.Second)
+	}
+
+	// popAll pops every item and returns the expiration offsets in the order they popped.
+	popAll := func(h *pairingHeap) []int {
+		var order []int
+		for h.Len() > 0 {
+			order = append(order, int(h.pop().expire.Sub(base)/time.Second))
+		}
+		return order
+	}
+
+	BeforeEach(func() {
+		base = time.Now()
+		h = &pairingHeap{}
+	})
+
+	It("melds two heaps", func() {
+		other := &pairingHeap{}
+		for _, i := range rand.Perm(20) {
+			if i%2 == 0 {
+				h.push(timedItem{expire: at(i)})
+			} else {
+				other.push(timedItem{expire: at(i)})
+			}
+		}
+		h.meld(other)
+		Expect(other.Len()).To(BeZero())
+		Expect(h.Len()).To(Equal(20))
+		Expect(popAll(h)).To(Equal(seqInts(0, 19)))
+	})
+
+	It("reschedules items earlier and later", func() {
+		nodes := map[int]*pairingNode{}
+		for _, i := range rand.Perm(20) {
+			nodes[i] = &pairingNode{item: timedItem{expire: at(i)}}
+			h.pushNode(nodes[i])
+		}
+		// Pop a few to give the heap some structure.
+		Expect(h.pop().expire).To(Equal(at(0)))
+		Expect(h.pop().expire).To(Equal(at(1)))
+
+		h.reschedule(nodes[15], at(2).Add(-time.Millisecond))
+		h.reschedule(nodes[5], at(30))
+		h.reschedule(nodes[2], at(25))
+
+		var order []time.Time
+		for h.Len() > 0 {
+			order = append(order, h.pop().expire)
+		}
+		Expect(order).To(HaveLen(18))
+		Expect(order[0]).To(Equal(at(2).Add(-time.Millisecond)))
+		Expect(order[len(order)-2]).To(Equal(at(25)))
+		Expect(order[len(order)-1]).To(Equal(at(30)))
+		for i := 1; i < len(order); i++ {
+			Expect(order[i].Before(order[i-1])).To(BeFalse())
+		}
+	})
+})
+
+// seqInts returns the integers from first to last inclusive.
+func seqInts(first, last int) []int {
+	var s []int
+	for i := first; i <= last; i++ {
+		s = append(s, i)
+	}
+	return s
+}
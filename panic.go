@@ -0,0 +1,69 @@
+package timerheap
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// RecoveredPanic describes a panic recovered from a callback called by a TimerHeap.
+type RecoveredPanic struct {
+	// The value of the event the callback was called for, or nil for timers used internally by
+	// helpers such as TimeoutManager.
+	Value interface{}
+	// Panic is the value passed to panic.
+	Panic interface{}
+	// Stack is the stack trace of the goroutine at the point of the panic.
+	Stack []byte
+}
+
+// WithPanicHandler sets the handler for panics recovered from callbacks. Panics in the functions
+// called while processing events, such as the callbacks of TimeoutManager and RetransmitTimers,
+// middleware, and the hooks and late delivery handler, are always recovered and logged so that
+// one failing callback does not stop the heap, or the dispatcher running it, from delivering
+// every other event. An event whose delivery panics is treated as delivered. Recovered panics
+// are counted in Stats.Panics.
+//
+// The handler is called on the goroutine processing the heap and must not block. It may be
+// nil, in which case panics are only logged and counted.
+func WithPanicHandler(handler func(RecoveredPanic)) Option {
+	return func(t *timerHeap) {
+		t.panicHandler = handler
+	}
+}
+
+// protect calls fn, recovering and reporting any panic. It returns false if fn panicked.
+func (t *timerHeap) protect(ti timedItem, fn func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+			t.recovered(ti, r)
+		}
+	}()
+	fn()
+	return true
+}
+
+// recovered reports a panic recovered from a callback for the item.
+func (t *timerHeap) recovered(ti timedItem, r interface{}) {
+	p := RecoveredPanic{
+		Panic: r,
+		Stack: debug.Stack(),
+	}
+	if ti.deliver == nil {
+		p.Value = ti.value
+	}
+	t.log.Warn("Recovered panic in callback", "seq", ti.seq, "panic", r)
+	err, ok := r.(error)
+	if !ok {
+		err = fmt.Errorf("%v", r)
+	}
+	t.fault(FaultPanic, "recovered panic in callback", err)
+
+	t.lock.Lock()
+	t.panics++
+	t.lock.Unlock()
+
+	if t.panicHandler != nil {
+		t.panicHandler(p)
+	}
+}
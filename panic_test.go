@@ -0,0 +1,86 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("panic recovery", func() {
+	var th timerheap.TimerHeap
+	var panics chan timerheap.RecoveredPanic
+
+	BeforeEach(func() {
+		panics = make(chan timerheap.RecoveredPanic, 10)
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("keeps delivering events after a callback panics", func() {
+		th = timerheap.New(timerheap.WithPanicHandler(func(p timerheap.RecoveredPanic) {
+			panics <- p
+		}))
+		expired := make(chan int, 10)
+		m := timerheap.NewTimeoutManager(th, func(id int) {
+			if id == 1 {
+				panic("boom")
+			}
+			expired <- id
+		})
+		defer m.Close()
+		Expect(m.SetDeadline(1, 10*time.Millisecond)).To(Succeed())
+		Expect(m.SetDeadline(2, 30*time.Millisecond)).To(Succeed())
+
+		var p timerheap.RecoveredPanic
+		Eventually(panics, "1s").Should(Receive(&p))
+		Expect(p.Panic).To(Equal("boom"))
+		Expect(p.Value).To(BeNil())
+		Expect(p.Stack).NotTo(BeEmpty())
+		Eventually(expired, "1s").Should(Receive(Equal(2)))
+
+		Expect(th.PushEvent(0, 3)).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(3)))
+		Expect(th.Stats().Panics).To(Equal(uint64(1)))
+	})
+
+	It("treats an event whose middleware panics as delivered", func() {
+		explode := func(next timerheap.Handler) timerheap.Handler {
+			return func(value interface{}, md timerheap.Metadata) {
+				if value == 1 {
+					panic("boom")
+				}
+				next(value, md)
+			}
+		}
+		th = timerheap.New(timerheap.WithMiddleware(explode), timerheap.WithPanicHandler(func(p timerheap.RecoveredPanic) {
+			panics <- p
+		}))
+		Expect(th.PushEvent(0, 1)).To(Succeed())
+		Expect(th.PushEvent(10*time.Millisecond, 2)).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(2)))
+
+		var p timerheap.RecoveredPanic
+		Expect(panics).To(Receive(&p))
+		Expect(p.Value).To(Equal(1))
+		Eventually(func() timerheap.Stats { return th.Stats() }, "1s").Should(And(
+			HaveField("Pending", 0),
+			HaveField("Delivered", uint64(2)),
+		))
+	})
+
+	It("recovers panics without a handler", func() {
+		th = timerheap.New(timerheap.WithHooks(timerheap.Hooks{
+			OnFire: func(timerheap.TimedResult) {
+				panic("boom")
+			},
+		}))
+		Expect(th.PushEvent(0, 1)).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		Expect(th.Stats().Panics).To(Equal(uint64(1)))
+	})
+})
@@ -0,0 +1,183 @@
+package timerheap
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// saveVersion is the version of the format written by Save.
+const saveVersion = 1
+
+// savedHeader is written at the start of the saved events.
+type savedHeader struct {
+	Version int
+	Count   int
+}
+
+// savedEvent is a pending event as written by Save. The value is encoded separately with gob,
+// and decoded into the type registered under Type.
+type savedEvent struct {
+	Expire   time.Time
+	NotAfter time.Time
+	Priority int
+	Tiebreak int
+	Topic    string
+	Type     string
+	Value    []byte
+	// Key is the idempotency key of the event, see WithKey.
+	Key string
+	// Metadata is the metadata attached to the event, see WithMetadata.
+	Metadata Metadata
+}
+
+// Save writes the pending events to w, so that they can be restored with Load, for example
+// after a restart. Each value is encoded with encoding/gob and is saved along with the name
+// its type is registered under in the TypeRegistry of the heap, which is used to decode it.
+// Saving fails with ErrUnregisteredType if any value has an unregistered type.
+//
+// Events that have popped but have not been received are included. Events created by
+// AfterChan are not saved. The heap continues to run, Save does not remove the events.
+func (t *timerHeap) Save(w io.Writer) error {
+	if t.types == nil {
+		return ErrNoTypeRegistry
+	}
+
+	t.lock.Lock()
+	t.drainPushedLocked()
+	items := t.valueHeap.appendTo(append([]timedItem(nil), t.ready...))
+	t.lock.Unlock()
+
+	// Save in the order the events pop, so that events with the same expiration are loaded in
+	// the same order.
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].before(&items[j])
+	})
+	events := make([]savedEvent, 0, len(items))
+	for _, ti := range items {
+		if ti.deliver != nil {
+			continue
+		}
+		ev, err := t.types.encode(ti)
+		if err != nil {
+			return err
+		}
+		events = append(events, ev)
+	}
+
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(savedHeader{Version: saveVersion, Count: len(events)}); err != nil {
+		return err
+	}
+	for i := range events {
+		if err := enc.Encode(&events[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load reads events written by Save from r and pushes them to the heap, in addition to any
+// events already pending. Each value is decoded into the type registered under the saved name
+// in the TypeRegistry of the heap. Events whose scheduled time has passed pop immediately.
+//
+// If an error occurs, the events read before the error have been pushed.
+func (t *timerHeap) Load(r io.Reader) error {
+	if t.types == nil {
+		return ErrNoTypeRegistry
+	}
+
+	dec := gob.NewDecoder(r)
+	var hdr savedHeader
+	if err := dec.Decode(&hdr); err != nil {
+		return err
+	}
+	if hdr.Version != saveVersion {
+		return fmt.Errorf("timerheap: unsupported saved events version %d", hdr.Version)
+	}
+	for i := 0; i < hdr.Count; i++ {
+		var ev savedEvent
+		if err := dec.Decode(&ev); err != nil {
+			return err
+		}
+		ti, err := t.types.decode(ev)
+		if err != nil {
+			return err
+		}
+		if err := t.restore(ti); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encode converts an item to a savedEvent, encoding the value with gob.
+func (r *TypeRegistry) encode(ti timedItem) (savedEvent, error) {
+	name, ok := r.Name(ti.value)
+	if !ok {
+		return savedEvent{}, fmt.Errorf("%w: %T", ErrUnregisteredType, ti.value)
+	}
+	var value bytes.Buffer
+	if err := gob.NewEncoder(&value).Encode(ti.value); err != nil {
+		return savedEvent{}, fmt.Errorf("timerheap: cannot encode %s value: %w", name, err)
+	}
+	return savedEvent{
+		Expire:   ti.expire,
+		NotAfter: ti.notAfter,
+		Priority: ti.priority,
+		Tiebreak: ti.tiebreak,
+		Topic:    ti.topic,
+		Type:     name,
+		Value:    value.Bytes(),
+		Key:      ti.key,
+		Metadata: ti.metadata,
+	}, nil
+}
+
+// decode converts a savedEvent to an item, decoding the value into the registered type.
+func (r *TypeRegistry) decode(ev savedEvent) (timedItem, error) {
+	typ, ok := r.typeOf(ev.Type)
+	if !ok {
+		return timedItem{}, fmt.Errorf("%w: %s", ErrUnregisteredType, ev.Type)
+	}
+	value := reflect.New(typ)
+	if err := gob.NewDecoder(bytes.NewReader(ev.Value)).DecodeValue(value); err != nil {
+		return timedItem{}, fmt.Errorf("timerheap: cannot decode %s value: %w", ev.Type, err)
+	}
+	return timedItem{
+		expire:   ev.Expire,
+		notAfter: ev.NotAfter,
+		priority: ev.Priority,
+		tiebreak: ev.Tiebreak,
+		topic:    ev.Topic,
+		value:    value.Elem().Interface(),
+		key:      ev.Key,
+		metadata: ev.Metadata,
+	}, nil
+}
+
+// marshal encodes an item as a single gob-encoded savedEvent, as held by a Store.
+func (r *TypeRegistry) marshal(ti timedItem) ([]byte, error) {
+	ev, err := r.encode(ti)
+	if err != nil {
+		return nil, err
+	}
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(ev); err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+// unmarshal decodes an item encoded by marshal.
+func (r *TypeRegistry) unmarshal(data []byte) (timedItem, error) {
+	var ev savedEvent
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&ev); err != nil {
+		return timedItem{}, err
+	}
+	return r.decode(ev)
+}
@@ -0,0 +1,72 @@
+package timerheap_test
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+type retry struct {
+	ID      string
+	Attempt int
+}
+
+var _ = Describe("Save and Load", func() {
+	var registry *timerheap.TypeRegistry
+	var th, restored timerheap.TimerHeap
+
+	BeforeEach(func() {
+		registry = timerheap.NewTypeRegistry()
+		Expect(registry.Register("retry", retry{}, nil)).To(Succeed())
+		Expect(registry.Register("id", "", nil)).To(Succeed())
+		th = timerheap.New(timerheap.WithTypeRegistry(registry, false))
+		restored = timerheap.New(timerheap.WithTypeRegistry(registry, false))
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+		restored.Terminate()
+	})
+
+	It("restores the pending events", func() {
+		expire := time.Now().Add(100 * time.Millisecond)
+		Expect(th.PushEventAt(expire, retry{ID: "a", Attempt: 2})).To(Succeed())
+		Expect(th.PushEventAt(expire, "b")).To(Succeed())
+		Expect(th.PushEventAt(expire.Add(-50*time.Millisecond), retry{ID: "c"}, timerheap.WithTopic("retries"))).To(Succeed())
+		Expect(th.AfterChan(time.Hour)).NotTo(BeNil())
+
+		By("saving the events and loading them into another heap")
+		var buf bytes.Buffer
+		Expect(th.Save(&buf)).To(Succeed())
+		Expect(restored.Load(&buf)).To(Succeed())
+		Expect(restored.Stats().Pending).To(Equal(3))
+
+		By("Checking the events are delivered at the same times and in the same order")
+		var value interface{}
+		Eventually(restored.TimedEventFor("retries"), "1s", "1ms").Should(Receive(&value))
+		Expect(value).To(Equal(retry{ID: "c"}))
+		Eventually(restored.TimedEvent(), "1s", "1ms").Should(Receive(&value))
+		Expect(value).To(Equal(retry{ID: "a", Attempt: 2}))
+		Expect(time.Now()).To(BeTemporally(">=", expire))
+		Eventually(restored.TimedEvent(), "1s", "1ms").Should(Receive(&value))
+		Expect(value).To(Equal("b"))
+	})
+
+	It("fails to save values of unregistered types", func() {
+		Expect(th.PushEvent(time.Hour, testdata{index: 1})).To(Succeed())
+		err := th.Save(&bytes.Buffer{})
+		Expect(errors.Is(err, timerheap.ErrUnregisteredType)).To(BeTrue())
+	})
+
+	It("fails without a type registry", func() {
+		plain := timerheap.New()
+		defer plain.Terminate()
+		Expect(plain.Save(&bytes.Buffer{})).To(Equal(timerheap.ErrNoTypeRegistry))
+		Expect(plain.Load(&bytes.Buffer{})).To(Equal(timerheap.ErrNoTypeRegistry))
+	})
+})
@@ -0,0 +1,108 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Priority classes", func() {
+	var th timerheap.TimerHeap
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	// pushBacklog pushes a backlog of events that expire together, with a critical event
+	// scheduled last, and stalls until they have all expired.
+	pushBacklog := func() {
+		By("adding low priority events scheduled before a critical one")
+		Expect(th.PushEvent(50*time.Millisecond, testdata{index: 1}, timerheap.WithPriorityClass(-1))).To(Succeed())
+		Expect(th.PushEvent(60*time.Millisecond, testdata{index: 2})).To(Succeed())
+		Expect(th.PushEvent(70*time.Millisecond, testdata{index: 3})).To(Succeed())
+		Expect(th.PushEvent(80*time.Millisecond, testdata{index: 4}, timerheap.WithPriorityClass(1))).To(Succeed())
+
+		By("Pausing without reading the results channel until all the events have expired")
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	expectOrder := func(indexes ...int) {
+		for _, index := range indexes {
+			var value interface{}
+			Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(&value))
+			Expect(value).To(Equal(testdata{index: index}))
+		}
+	}
+
+	It("delivers expired events by priority class when blocking", func() {
+		th = timerheap.New()
+		pushBacklog()
+
+		By("Checking the event that popped first is not overtaken")
+		expectOrder(1, 4, 2, 3)
+	})
+
+	It("delivers expired events by priority class when not blocking", func() {
+		th = timerheap.New(timerheap.WithNonBlockingDelivery(0))
+		pushBacklog()
+		expectOrder(4, 2, 3, 1)
+	})
+
+	It("drops the oldest event in the lowest priority class when the buffer is full", func() {
+		th = timerheap.New(timerheap.WithNonBlockingDelivery(2), timerheap.WithDeadLetters())
+		pushBacklog()
+		expectOrder(4, 3)
+
+		var dl timerheap.DeadLetter
+		Eventually(th.DeadLetters(), "1s", "10ms").Should(Receive(&dl))
+		Expect(dl.Value).To(Equal(testdata{index: 1}))
+		Eventually(th.DeadLetters(), "1s", "10ms").Should(Receive(&dl))
+		Expect(dl.Value).To(Equal(testdata{index: 2}))
+	})
+
+	It("drains a large backlog by priority class and still cancels events by handle", func() {
+		th = timerheap.New()
+		expire := time.Now().Add(100 * time.Millisecond)
+		h := &timerheap.Handle{}
+		for i := 0; i < 2000; i++ {
+			opts := []timerheap.PushOption{timerheap.WithPriorityClass(i % 4)}
+			if i == 1999 {
+				opts = append(opts, timerheap.WithHandle(h))
+			}
+			Expect(th.PushEventAt(expire, testdata{index: i}, opts...)).To(Succeed())
+		}
+		time.Sleep(time.Until(expire) + 50*time.Millisecond)
+
+		// The events pop by class, and in the order they were pushed within each class.
+		expectOrder(3)
+		Expect(h.Cancel()).To(BeTrue())
+		var want, got []int
+		for class := 3; class >= 0; class-- {
+			for i := class; i < 2000; i += 4 {
+				if i != 3 && i != 1999 {
+					want = append(want, i)
+				}
+			}
+		}
+		for len(got) < len(want) {
+			select {
+			case value := <-th.TimedEvent():
+				got = append(got, value.(testdata).index)
+			case <-time.After(time.Second):
+				Fail("timed out waiting for the backlog")
+			}
+		}
+		Expect(got).To(Equal(want))
+		Consistently(th.TimedEvent(), "50ms").ShouldNot(Receive())
+	})
+
+	It("delivers events that have not expired in time order", func() {
+		th = timerheap.New()
+		Expect(th.PushEvent(50*time.Millisecond, testdata{index: 1})).To(Succeed())
+		Expect(th.PushEvent(150*time.Millisecond, testdata{index: 2}, timerheap.WithPriorityClass(1))).To(Succeed())
+		expectOrder(1, 2)
+	})
+})
@@ -0,0 +1,51 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("WithQuantization", func() {
+	It("rounds expiration times up to the boundary", func() {
+		th := timerheap.New(timerheap.WithQuantization(time.Minute))
+		defer th.Terminate()
+
+		base := time.Now().Truncate(time.Minute).Add(time.Hour)
+		Expect(th.PushEventAt(base.Add(time.Second), "a")).To(Succeed())
+		Expect(th.PushEventAt(base.Add(59*time.Second), "b")).To(Succeed())
+		Expect(th.PushEventAt(base, "c")).To(Succeed())
+
+		var expires []time.Time
+		for _, ev := range th.Snapshot() {
+			expires = append(expires, ev.ScheduledAt)
+		}
+		Expect(expires).To(ConsistOf(
+			BeTemporally("==", base.Add(time.Minute)),
+			BeTemporally("==", base.Add(time.Minute)),
+			BeTemporally("==", base),
+		))
+	})
+
+	It("fires events from different producers together", func() {
+		th := timerheap.New(timerheap.WithQuantization(50*time.Millisecond), timerheap.WithTimedResults())
+		defer th.Terminate()
+		Expect(th.PushEvent(time.Millisecond, "a")).To(Succeed())
+		Expect(th.PushEvent(2*time.Millisecond, "b")).To(Succeed())
+
+		var first, second timerheap.TimedResult
+		Eventually(th.TimedEvent(), "1s").Should(Receive(&first))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(&second))
+		Expect(first.ScheduledAt).To(Equal(second.ScheduledAt))
+		Expect(first.ScheduledAt).To(Equal(first.ScheduledAt.Truncate(50 * time.Millisecond)))
+	})
+
+	It("does not round AfterChan timers", func() {
+		th := timerheap.New(timerheap.WithQuantization(time.Hour))
+		defer th.Terminate()
+		Eventually(th.AfterChan(time.Millisecond), "1s").Should(BeClosed())
+	})
+})
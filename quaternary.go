@@ -0,0 +1,113 @@
+package timerheap
+
+import (
+	"time"
+)
+
+// quaternaryHeap is a 4-ary min-heap held in a slice. The children of the item at index i are
+// at indexes 4i+1 to 4i+4.
+type quaternaryHeap []timedItem
+
+var _ backend = &quaternaryHeap{}
+
+func (h quaternaryHeap) Len() int { return len(h) }
+
+func (h *quaternaryHeap) push(ti timedItem) {
+	*h = append(*h, ti)
+	placed(*h, len(*h)-1)
+	siftUp(*h, len(*h)-1, 4)
+}
+
+func (h *quaternaryHeap) pushAll(items []timedItem) {
+	pushAll((*[]timedItem)(h), items, 4)
+}
+
+func (h *quaternaryHeap) peek() *timedItem {
+	if len(*h) == 0 {
+		return nil
+	}
+	return &(*h)[0]
+}
+
+func (h *quaternaryHeap) pop() timedItem {
+	return removeAt((*[]timedItem)(h), 0, 4)
+}
+
+func (h quaternaryHeap) peekFarthest() *timedItem {
+	if i := h.farthest(); i >= 0 {
+		return &h[i]
+	}
+	return nil
+}
+
+func (h *quaternaryHeap) popFarthest() timedItem {
+	return removeAt((*[]timedItem)(h), h.farthest(), 4)
+}
+
+func (h *quaternaryHeap) removeWhere(match func(ti *timedItem) bool) (timedItem, bool) {
+	return removeWhere((*[]timedItem)(h), match, 4)
+}
+
+func (h *quaternaryHeap) removeAll(match func(ti *timedItem) bool, dst []timedItem) []timedItem {
+	return removeAll((*[]timedItem)(h), match, 4, dst)
+}
+
+func (h quaternaryHeap) first(match func(ti *timedItem) bool) *timedItem {
+	if i := firstWhere(h, 0, 4, match, -1); i >= 0 {
+		return &h[i]
+	}
+	return nil
+}
+
+func (h *quaternaryHeap) appendTo(dst []timedItem) []timedItem {
+	return append(dst, *h...)
+}
+
+func (h quaternaryHeap) shift(d time.Duration) {
+	for i := range h {
+		h[i].shift(d)
+	}
+}
+
+func (h quaternaryHeap) deadline(best time.Time) time.Time {
+	return heapDeadline(h, 0, 4, best)
+}
+
+func (h *quaternaryHeap) grow(n int) {
+	grow((*[]timedItem)(h), n)
+}
+
+func (h *quaternaryHeap) shrink(min int) {
+	shrink((*[]timedItem)(h), min)
+}
+
+func (h quaternaryHeap) footprint() (int, uintptr) {
+	return footprint(h)
+}
+
+func (h quaternaryHeap) lookup(hd *Handle) *timedItem {
+	return lookupHandle(h, hd)
+}
+
+func (h *quaternaryHeap) removeHandle(hd *Handle) timedItem {
+	return removeAt((*[]timedItem)(h), hd.index, 4)
+}
+
+func (h quaternaryHeap) rescheduleHandle(hd *Handle, expire time.Time) {
+	rescheduleAt(h, hd.index, 4, expire)
+}
+
+// farthest returns the index of the item that would be popped last, or -1 if the heap is
+// empty. The last item must be a leaf, so only the leaves are searched.
+func (h quaternaryHeap) farthest() int {
+	if len(h) == 0 {
+		return -1
+	}
+	far := (len(h) + 2) / 4
+	for i := far + 1; i < len(h); i++ {
+		if h[far].before(&h[i]) {
+			far = i
+		}
+	}
+	return far
+}
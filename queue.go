@@ -0,0 +1,123 @@
+package timerheap
+
+import (
+	"sync"
+)
+
+// queue is a FIFO of values that are forwarded to the out channel by a dedicated goroutine, so
+// that adding a value never blocks. If limit is greater than 0 the queue holds at most limit
+// values, and the oldest value is dropped to make room for a new one. This does not include
+// the value the forwarding goroutine is currently offering on the out channel.
+type queue[T any] struct {
+	lock    sync.Mutex
+	items   []T
+	limit   int
+	dropped uint64
+	closed  bool
+	stopped bool
+	// notify is used to wake the forwarding goroutine when the queue is updated. It is of
+	// capacity 1 because only a single backed-up notification is needed.
+	notify chan struct{}
+	// done is closed to terminate the forwarding goroutine immediately.
+	done chan struct{}
+	out  chan T
+}
+
+func newQueue[T any](limit int) *queue[T] {
+	q := &queue[T]{
+		limit:  limit,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		out:    make(chan T),
+	}
+	go q.run()
+	return q
+}
+
+// add appends the value to the queue. Values added after the queue is closed or stopped are
+// discarded.
+func (q *queue[T]) add(v T) {
+	q.lock.Lock()
+	if q.closed || q.stopped {
+		q.lock.Unlock()
+		return
+	}
+	if q.limit > 0 && len(q.items) >= q.limit {
+		var zero T
+		q.items[0] = zero
+		q.items = q.items[1:]
+		q.dropped++
+	}
+	q.items = append(q.items, v)
+	q.lock.Unlock()
+	q.wake()
+}
+
+// close marks the queue as closed, the out channel is closed once the queue is empty.
+func (q *queue[T]) close() {
+	q.lock.Lock()
+	q.closed = true
+	q.lock.Unlock()
+	q.wake()
+}
+
+// stop discards any queued values and closes the out channel.
+func (q *queue[T]) stop() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if !q.stopped {
+		q.stopped = true
+		q.items = nil
+		close(q.done)
+	}
+}
+
+// droppedCount returns the number of values dropped because the queue was full.
+func (q *queue[T]) droppedCount() uint64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.dropped
+}
+
+// events returns the out channel.
+func (q *queue[T]) events() <-chan T {
+	return q.out
+}
+
+func (q *queue[T]) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *queue[T]) run() {
+	defer close(q.out)
+	for {
+		q.lock.Lock()
+		if len(q.items) == 0 {
+			closed := q.closed
+			q.lock.Unlock()
+			if closed {
+				return
+			}
+			select {
+			case <-q.notify:
+				continue
+			case <-q.done:
+				return
+			}
+		}
+		v := q.items[0]
+		var zero T
+		q.items[0] = zero
+		q.items = q.items[1:]
+		q.lock.Unlock()
+
+		select {
+		case q.out <- v:
+		case <-q.done:
+			return
+		}
+	}
+}
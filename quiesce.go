@@ -0,0 +1,20 @@
+package timerheap
+
+import (
+	"context"
+)
+
+// Quiesce stops the heap accepting new events, while the pending events continue to fire as
+// normal. Once Quiesce returns, every push either completed before the call or fails with
+// ErrQuiescing, so an instance that is being replaced can stop taking new schedules while the
+// events it already holds are delivered. Events loaded from the Store of the heap are already
+// scheduled, and are still pushed. Quiescing cannot be undone, the heap is stopped with
+// Terminate, or TerminateContext, as usual.
+//
+// This does not include child heaps.
+func (t *timerHeap) Quiesce() {
+	t.quiescing.Store(true)
+	// Wait for pushes that started before the call, as terminate does. Pushes blocked waiting
+	// for space fail with ErrQuiescing.
+	_ = t.awaitPushes(context.Background())
+}
@@ -0,0 +1,109 @@
+package timerheap_test
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Quiesce", func() {
+	It("rejects new events while the pending events continue to fire", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		Expect(th.PushEvent(10*time.Millisecond, "a")).To(Succeed())
+		Expect(th.PushEvent(20*time.Millisecond, "b")).To(Succeed())
+
+		th.Quiesce()
+		Expect(th.PushEvent(0, "c")).To(MatchError(timerheap.ErrQuiescing))
+		Expect(th.PushEventAt(time.Now(), "c")).To(MatchError(timerheap.ErrQuiescing))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("a")))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("b")))
+		Eventually(th.Idle(), "1s").Should(BeClosed())
+		Expect(th.Stats().Pending).To(BeZero())
+	})
+
+	It("drops the handle of a rejected event", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		th.Quiesce()
+		h := &timerheap.Handle{}
+		Expect(th.PushEvent(0, "a", timerheap.WithHandle(h))).To(MatchError(timerheap.ErrQuiescing))
+		Expect(h.State()).To(Equal(timerheap.EventDropped))
+	})
+
+	It("releases the key of a rejected event", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		th.Quiesce()
+		Expect(th.PushEvent(0, "a", timerheap.WithKey("k"))).To(MatchError(timerheap.ErrQuiescing))
+		Expect(th.Contains(func(interface{}) bool { return true })).To(BeFalse())
+	})
+
+	It("delivers every event that was accepted", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		var pushed int
+		var lock sync.Mutex
+		var wg sync.WaitGroup
+		for p := 0; p < 4; p++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for i := 0; i < 200; i++ {
+					err := th.PushEvent(0, i)
+					lock.Lock()
+					if err == nil {
+						pushed++
+					} else {
+						Expect(err).To(MatchError(timerheap.ErrQuiescing))
+					}
+					lock.Unlock()
+				}
+			}()
+		}
+		time.Sleep(100 * time.Microsecond)
+		th.Quiesce()
+		Expect(th.PushEvent(0, "late")).To(MatchError(timerheap.ErrQuiescing))
+		wg.Wait()
+
+		for i := 0; i < pushed; i++ {
+			<-th.TimedEvent()
+		}
+		Eventually(th.Idle(), "1s").Should(BeClosed())
+	})
+
+	It("fails a push blocked waiting for space", func() {
+		th := timerheap.New(
+			timerheap.WithMaxPending(1),
+			timerheap.WithOverflowPolicy(timerheap.OverflowBlock),
+		)
+		defer th.Terminate()
+		Expect(th.PushEvent(0, "stuck")).To(Succeed())
+		pushed := make(chan error, 1)
+		go func() {
+			pushed <- th.PushEvent(0, "blocked")
+		}()
+		Consistently(pushed, "50ms").ShouldNot(Receive())
+
+		quiesced := make(chan struct{})
+		go func() {
+			defer close(quiesced)
+			th.Quiesce()
+		}()
+		Eventually(quiesced, "1s").Should(BeClosed())
+		Expect(pushed).To(Receive(MatchError(timerheap.ErrQuiescing)))
+		Expect(th.TimedEvent()).To(Receive(Equal("stuck")))
+	})
+
+	It("is reported as terminated once terminated", func() {
+		th := timerheap.New()
+		th.Quiesce()
+		th.Terminate()
+		Expect(th.PushEvent(0, "a")).To(MatchError(timerheap.ErrTerminated))
+	})
+})
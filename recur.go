@@ -0,0 +1,270 @@
+package timerheap
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// GapPolicy determines when a recurring event fires on a day that the clocks go forward past
+// its time, so that the time does not occur, see Recurrence.
+type GapPolicy int
+
+const (
+	// GapShift fires the event later by the length of the gap, for example at 3:30 for an
+	// event at 2:30 when the clocks go forward from 2:00 to 3:00. This is the default.
+	GapShift GapPolicy = iota
+	// GapSkip does not fire the event on that day.
+	GapSkip
+)
+
+func (p GapPolicy) String() string {
+	switch p {
+	case GapShift:
+		return "shift"
+	case GapSkip:
+		return "skip"
+	default:
+		return "unknown"
+	}
+}
+
+// OverlapPolicy determines when a recurring event fires on a day that the clocks go back past
+// its time, so that the time occurs twice, see Recurrence.
+type OverlapPolicy int
+
+const (
+	// OverlapFirst fires the event at the first of the two times. This is the default.
+	OverlapFirst OverlapPolicy = iota
+	// OverlapSecond fires the event at the second of the two times.
+	OverlapSecond
+	// OverlapBoth fires the event at both times.
+	OverlapBoth
+)
+
+func (p OverlapPolicy) String() string {
+	switch p {
+	case OverlapFirst:
+		return "first"
+	case OverlapSecond:
+		return "second"
+	case OverlapBoth:
+		return "both"
+	default:
+		return "unknown"
+	}
+}
+
+// Recurrence is a time of day on the wall clock of a location at which an event recurs, every
+// day or on certain days of the week. Each occurrence is computed in the location, so the event
+// stays at the same local time when the clocks change, rather than drifting by an hour as it
+// would with a fixed interval of 24 hours.
+type Recurrence struct {
+	// At is the time of day, as the time on the wall clock since midnight.
+	At time.Duration
+	// Weekdays are the days of the week the event recurs on, or every day if empty.
+	Weekdays []time.Weekday
+	// Location is the location of the wall clock. The default of nil is treated as UTC.
+	Location *time.Location
+	// Zone, if set, gives the location of the wall clock in place of Location. It is looked
+	// up for each occurrence, so a Zone that is reloaded applies from the next occurrence
+	// computed, see ZoneSource. An occurrence that Recur has already pushed keeps its time.
+	Zone ZoneSource
+	// Gap and Overlap determine when the event fires on the days the clocks change.
+	Gap     GapPolicy
+	Overlap OverlapPolicy
+}
+
+// Next returns the first occurrence after the time, or the zero time if the event never occurs.
+func (r Recurrence) Next(after time.Time) time.Time {
+	loc := r.location()
+	y, m, d := after.In(loc).Date()
+	// Start from the previous day, since the time of day may be later than 24 hours after
+	// midnight on a day the clocks go back, and look ahead far enough to cover a week in which
+	// every other occurrence is skipped.
+	for i := -1; i <= 8; i++ {
+		day := time.Date(y, m, d+i, 0, 0, 0, 0, time.UTC)
+		if !r.on(day.Weekday()) {
+			continue
+		}
+		for _, at := range r.occurrences(day.Year(), day.Month(), day.Day(), loc) {
+			if at.After(after) {
+				return at
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// location returns the location of the wall clock.
+func (r Recurrence) location() *time.Location {
+	if r.Zone != nil {
+		return zoneLocation(r.Zone)
+	}
+	return zoneLocation(FixedZone(r.Location))
+}
+
+// on returns true if the event recurs on the day of the week.
+func (r Recurrence) on(day time.Weekday) bool {
+	if len(r.Weekdays) == 0 {
+		return true
+	}
+	for _, w := range r.Weekdays {
+		if w == day {
+			return true
+		}
+	}
+	return false
+}
+
+// occurrences returns the times the event fires on the day, in order, applying the gap and
+// overlap policies.
+func (r Recurrence) occurrences(y int, m time.Month, d int, loc *time.Location) []time.Time {
+	// The wall clock time as if it were UTC. The instants at which the wall clock reads this
+	// time are found by taking off each UTC offset in use around the day, and keeping those
+	// instants at which that offset is in use.
+	wall := wallClock(y, m, d, r.At, time.UTC)
+	_, before := wall.Add(-24 * time.Hour).In(loc).Zone()
+	_, after := wall.Add(24 * time.Hour).In(loc).Zone()
+	var times []time.Time
+	for _, offset := range []int{before, after} {
+		at := wall.Add(-time.Duration(offset) * time.Second).In(loc)
+		if _, in := at.Zone(); in == offset && (len(times) == 0 || !times[0].Equal(at)) {
+			times = append(times, at)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool {
+		return times[i].Before(times[j])
+	})
+
+	switch {
+	case len(times) == 0 && r.Gap == GapShift:
+		// The clocks went forward, so the offset before the change gives the time shifted
+		// by the length of the gap.
+		return []time.Time{wall.Add(-time.Duration(before) * time.Second).In(loc)}
+	case len(times) == 2 && r.Overlap == OverlapFirst:
+		return times[:1]
+	case len(times) == 2 && r.Overlap == OverlapSecond:
+		return times[1:]
+	}
+	return times
+}
+
+// Recurring is an event pushed by Recur.
+type Recurring struct {
+	th    TimerHeap
+	r     Recurrence
+	value interface{}
+	opts  []PushOption
+	// lock protects next, stopped and err. done is closed once the recurrence has ended.
+	lock    sync.Mutex
+	next    time.Time
+	stopped bool
+	err     error
+	done    chan struct{}
+}
+
+// Recur pushes the value to the heap at each occurrence of the recurrence, with the push
+// options, until it is stopped or a push fails. Each occurrence is pushed in advance, when the
+// previous one fires, along with a timer that is not delivered on the results channel to push
+// the occurrence after it. Recurrences that never occur end immediately.
+//
+// The key given with WithKey is suffixed with the time of each occurrence, so that each
+// occurrence has its own key and an occurrence that has already been pushed, for example by
+// another instance, is not pushed again. A handle refers to a single event, so a recurrence
+// pushed with WithHandle ends immediately with ErrHandleUnsupported.
+func Recur(th TimerHeap, r Recurrence, value interface{}, opts ...PushOption) *Recurring {
+	rc := &Recurring{
+		th:    th,
+		r:     r,
+		value: value,
+		opts:  opts,
+		done:  make(chan struct{}),
+	}
+	var probe timedItem
+	for _, opt := range opts {
+		opt(&probe)
+	}
+	if probe.handle != nil {
+		rc.end(ErrHandleUnsupported)
+		return rc
+	}
+	rc.schedule(time.Now())
+	return rc
+}
+
+// Next returns the time of the occurrence that has been pushed, or the zero time if the
+// recurrence has ended.
+func (rc *Recurring) Next() time.Time {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	if rc.stopped {
+		return time.Time{}
+	}
+	return rc.next
+}
+
+// Stop ends the recurrence. The occurrence that has already been pushed still fires.
+func (rc *Recurring) Stop() {
+	rc.end(nil)
+}
+
+// Done returns a channel that is closed once the recurrence has ended.
+func (rc *Recurring) Done() <-chan struct{} {
+	return rc.done
+}
+
+// Err returns the error of the push that ended the recurrence, or nil if it was stopped, never
+// occurs, or has not ended.
+func (rc *Recurring) Err() error {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	return rc.err
+}
+
+// schedule pushes the first occurrence after the time, and the timer that schedules the
+// occurrence after that.
+func (rc *Recurring) schedule(after time.Time) {
+	rc.lock.Lock()
+	if rc.stopped {
+		rc.lock.Unlock()
+		return
+	}
+	next := rc.r.Next(after)
+	rc.next = next
+	rc.lock.Unlock()
+	if next.IsZero() {
+		rc.end(nil)
+		return
+	}
+
+	opts := append(rc.opts[:len(rc.opts):len(rc.opts)], func(ti *timedItem) {
+		if ti.key != "" {
+			ti.key += "@" + next.UTC().Format(time.RFC3339Nano)
+		}
+	})
+	err := rc.th.PushEventAt(next, rc.value, opts...)
+	if err == nil {
+		err = rc.th.PushEventAt(next, nil, func(ti *timedItem) {
+			ti.deliver = func(interface{}) {
+				// Pushing may block, so it is not done on the event goroutine.
+				go rc.schedule(next)
+			}
+		})
+	}
+	if err != nil {
+		rc.end(err)
+	}
+}
+
+// end ends the recurrence, if it has not already ended.
+func (rc *Recurring) end(err error) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	if rc.stopped {
+		return
+	}
+	rc.stopped = true
+	rc.err = err
+	close(rc.done)
+}
@@ -0,0 +1,134 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Recurrence", func() {
+	var ny *time.Location
+
+	BeforeEach(func() {
+		var err error
+		if ny, err = time.LoadLocation("America/New_York"); err != nil {
+			Skip("time zone database is not available")
+		}
+	})
+
+	local := func(day time.Month, d, hour, min int) time.Time {
+		return time.Date(2024, day, d, hour, min, 0, 0, ny)
+	}
+
+	It("keeps the local time across the clocks changing", func() {
+		r := timerheap.Recurrence{At: 9 * time.Hour, Location: ny}
+		// The clocks went forward on 10 March and back on 3 November 2024.
+		first := r.Next(local(time.March, 9, 12, 0))
+		Expect(first).To(BeTemporally("==", local(time.March, 10, 9, 0)))
+		second := r.Next(first)
+		Expect(second).To(BeTemporally("==", local(time.March, 11, 9, 0)))
+		Expect(second.Sub(first)).To(Equal(24 * time.Hour))
+		Expect(first.Sub(r.Next(local(time.March, 8, 12, 0)))).To(Equal(23 * time.Hour))
+
+		autumn := r.Next(local(time.November, 1, 12, 0))
+		Expect(r.Next(autumn).Sub(autumn)).To(Equal(25 * time.Hour))
+	})
+
+	It("applies the gap policy to a time that does not occur", func() {
+		r := timerheap.Recurrence{At: 2*time.Hour + 30*time.Minute, Location: ny}
+		Expect(r.Next(local(time.March, 10, 0, 0))).To(BeTemporally("==", local(time.March, 10, 3, 30)))
+		r.Gap = timerheap.GapSkip
+		Expect(r.Next(local(time.March, 10, 0, 0))).To(BeTemporally("==", local(time.March, 11, 2, 30)))
+	})
+
+	It("applies the overlap policy to a time that occurs twice", func() {
+		first := time.Date(2024, time.November, 3, 5, 30, 0, 0, time.UTC)
+		second := first.Add(time.Hour)
+		r := timerheap.Recurrence{At: time.Hour + 30*time.Minute, Location: ny}
+		start := local(time.November, 3, 0, 0)
+		Expect(r.Next(start)).To(BeTemporally("==", first))
+		Expect(r.Next(first)).To(BeTemporally("==", local(time.November, 4, 1, 30)))
+
+		r.Overlap = timerheap.OverlapSecond
+		Expect(r.Next(start)).To(BeTemporally("==", second))
+
+		r.Overlap = timerheap.OverlapBoth
+		Expect(r.Next(start)).To(BeTemporally("==", first))
+		Expect(r.Next(first)).To(BeTemporally("==", second))
+		Expect(r.Next(second)).To(BeTemporally("==", local(time.November, 4, 1, 30)))
+	})
+
+	It("recurs on the days of the week", func() {
+		r := timerheap.Recurrence{
+			At:       9 * time.Hour,
+			Weekdays: []time.Weekday{time.Monday, time.Thursday},
+			Location: ny,
+		}
+		// 4 March 2024 was a Monday.
+		Expect(r.Next(local(time.March, 4, 9, 0))).To(BeTemporally("==", local(time.March, 7, 9, 0)))
+		Expect(r.Next(local(time.March, 7, 9, 0))).To(BeTemporally("==", local(time.March, 11, 9, 0)))
+	})
+})
+
+var _ = Describe("Recur", func() {
+	It("pushes the value at each occurrence until stopped", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+
+		now := time.Now().UTC()
+		soon := now.Add(50 * time.Millisecond)
+		r := timerheap.Recurrence{At: soon.Sub(now.Truncate(24 * time.Hour))}
+		rc := timerheap.Recur(th, r, "tick")
+		Expect(rc.Next()).To(BeTemporally("~", soon, time.Millisecond))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("tick")))
+		Eventually(rc.Next, "1s").Should(BeTemporally("~", soon.Add(24*time.Hour), time.Millisecond))
+		Expect(th.Stats().Pending).To(Equal(2))
+
+		rc.Stop()
+		Expect(rc.Done()).To(BeClosed())
+		Expect(rc.Err()).NotTo(HaveOccurred())
+		Expect(rc.Next()).To(BeZero())
+	})
+
+	It("gives each occurrence its own key", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+
+		now := time.Now().UTC()
+		soon := now.Add(50 * time.Millisecond)
+		r := timerheap.Recurrence{At: soon.Sub(now.Truncate(24 * time.Hour))}
+		rc := timerheap.Recur(th, r, "tick", timerheap.WithKey("daily"))
+		defer rc.Stop()
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("tick")))
+		Eventually(rc.Next, "1s").Should(BeTemporally("~", soon.Add(24*time.Hour), time.Millisecond))
+		// The next occurrence is pending rather than dropped as a duplicate of the first.
+		Eventually(func() int { return th.Stats().Pending }, "1s").Should(Equal(2))
+		Expect(th.Contains(func(v interface{}) bool { return v == "tick" })).To(BeTrue())
+
+		// Recurring again with the same key does not push the occurrence twice.
+		again := timerheap.Recur(th, r, "tick", timerheap.WithKey("daily"))
+		defer again.Stop()
+		Expect(again.Err()).NotTo(HaveOccurred())
+		Expect(th.Stats().Pending).To(Equal(3))
+	})
+
+	It("rejects a handle", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		rc := timerheap.Recur(th, timerheap.Recurrence{At: time.Hour}, "tick", timerheap.WithHandle(&timerheap.Handle{}))
+		Expect(rc.Done()).To(BeClosed())
+		Expect(rc.Err()).To(MatchError(timerheap.ErrHandleUnsupported))
+		Expect(th.Stats().Pending).To(BeZero())
+	})
+
+	It("ends when a push fails", func() {
+		th := timerheap.New()
+		th.Terminate()
+		rc := timerheap.Recur(th, timerheap.Recurrence{At: time.Hour}, "tick")
+		Expect(rc.Done()).To(BeClosed())
+		Expect(rc.Err()).To(MatchError(timerheap.ErrTerminated))
+	})
+})
@@ -0,0 +1,180 @@
+package timerheap
+
+import (
+	"sync"
+	"time"
+)
+
+// Refilled is delivered by TokenBuckets when tokens are added to a bucket.
+type Refilled struct {
+	Bucket string
+	// Tokens is the number of tokens in the bucket after the refill.
+	Tokens int
+}
+
+// BucketConfig is the size and refill rate of a token bucket.
+type BucketConfig struct {
+	// Capacity is the maximum number of tokens the bucket holds.
+	Capacity int
+	// Tokens is the number of tokens added each refill. The default of 0 is treated as 1.
+	Tokens int
+	// Interval is the time between refills.
+	Interval time.Duration
+}
+
+// TokenBuckets holds a set of independent token buckets, refilled by timers scheduled on a heap
+// without being delivered on its results channel. A refill is only scheduled for a bucket while
+// it is below capacity, so idle buckets cost nothing beyond their entry in the set.
+type TokenBuckets struct {
+	th TimerHeap
+	// lock protects buckets and the state of each bucket.
+	lock    sync.Mutex
+	buckets map[string]*bucket
+	closed  bool
+	out     *queue[Refilled]
+}
+
+type bucket struct {
+	config BucketConfig
+	tokens int
+	// next is when the next refill is due, or zero if no refill is scheduled.
+	next time.Time
+}
+
+// NewTokenBuckets returns an empty set of token buckets using the heap for the refills.
+func NewTokenBuckets(th TimerHeap) *TokenBuckets {
+	return &TokenBuckets{
+		th:      th,
+		buckets: map[string]*bucket{},
+		out:     newQueue[Refilled](0),
+	}
+}
+
+// C returns the channel the refills are delivered on. Refills are queued without limit, so a
+// slow consumer does not delay the heap.
+func (b *TokenBuckets) C() <-chan Refilled {
+	return b.out.out
+}
+
+// Add adds a full bucket, replacing any existing bucket with the same name.
+func (b *TokenBuckets) Add(name string, config BucketConfig) error {
+	if config.Tokens == 0 {
+		config.Tokens = 1
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return ErrTerminated
+	}
+	b.buckets[name] = &bucket{config: config, tokens: config.Capacity}
+	return nil
+}
+
+// Remove removes the bucket. A refill already scheduled for it is discarded when it pops.
+func (b *TokenBuckets) Remove(name string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.buckets, name)
+}
+
+// Tokens returns the number of tokens in the bucket, or 0 if there is no such bucket.
+func (b *TokenBuckets) Tokens(name string) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if bk, ok := b.buckets[name]; ok {
+		return bk.tokens
+	}
+	return 0
+}
+
+// Take removes n tokens from the bucket, returning false without removing any if there are fewer
+// than n tokens or there is no such bucket. Taking tokens from a full bucket schedules its refill.
+// A bucket left below capacity without a refill scheduled, because a refill could not be
+// scheduled when the previous one popped, has its refill scheduled by the next call to Take.
+func (b *TokenBuckets) Take(name string, n int) (bool, error) {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return false, ErrTerminated
+	}
+	bk, ok := b.buckets[name]
+	if !ok {
+		b.lock.Unlock()
+		return false, nil
+	}
+	taken := bk.tokens >= n
+	if taken {
+		bk.tokens -= n
+	}
+	schedule := bk.next.IsZero() && bk.tokens < bk.config.Capacity
+	if schedule {
+		bk.next = time.Now().Add(bk.config.Interval)
+	}
+	b.lock.Unlock()
+
+	if schedule {
+		if err := b.schedule(name, bk, bk.config.Interval); err != nil {
+			// Without a refill the tokens could never be replaced, so put them back.
+			b.lock.Lock()
+			if taken {
+				bk.tokens += n
+			}
+			bk.next = time.Time{}
+			b.lock.Unlock()
+			return false, err
+		}
+	}
+	return taken, nil
+}
+
+// schedule pushes the next refill of the bucket.
+func (b *TokenBuckets) schedule(name string, bk *bucket, d time.Duration) error {
+	return push(b.th, d, nil, func(interface{}) {
+		b.refill(name, bk)
+	})
+}
+
+// refill adds tokens to the bucket, and schedules the next refill if it is still below
+// capacity. The next refill is due an interval after this one was due, rather than after it
+// popped, so the refill rate does not drift.
+func (b *TokenBuckets) refill(name string, bk *bucket) {
+	b.lock.Lock()
+	if b.closed || b.buckets[name] != bk {
+		b.lock.Unlock()
+		return
+	}
+	bk.tokens += bk.config.Tokens
+	if bk.tokens > bk.config.Capacity {
+		bk.tokens = bk.config.Capacity
+	}
+	tokens := bk.tokens
+	var d time.Duration
+	if tokens < bk.config.Capacity {
+		bk.next = bk.next.Add(bk.config.Interval)
+		d = time.Until(bk.next)
+	} else {
+		bk.next = time.Time{}
+	}
+	b.lock.Unlock()
+
+	b.out.add(Refilled{Bucket: name, Tokens: tokens})
+	if tokens < bk.config.Capacity {
+		// This is called on the goroutine processing the heap, so the push must not block. If it
+		// fails the bucket is left without a refill scheduled until Take is next called.
+		if err := b.schedule(name, bk, d); err != nil {
+			b.lock.Lock()
+			bk.next = time.Time{}
+			b.lock.Unlock()
+		}
+	}
+}
+
+// Close discards the scheduled refills, and closes the channel once the delivered refills have
+// been received. Calls to Add and Take after Close fail with ErrTerminated.
+func (b *TokenBuckets) Close() {
+	b.lock.Lock()
+	b.closed = true
+	b.buckets = map[string]*bucket{}
+	b.lock.Unlock()
+	b.out.close()
+}
@@ -0,0 +1,115 @@
+package timerheap_test
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+// failingHeap is a heap whose pushes fail while fail is set.
+type failingHeap struct {
+	timerheap.TimerHeap
+	fail atomic.Bool
+}
+
+var errPushFailed = errors.New("push failed")
+
+func (h *failingHeap) PushEvent(d time.Duration, v interface{}, opts ...timerheap.PushOption) error {
+	if h.fail.Load() {
+		return errPushFailed
+	}
+	return h.TimerHeap.PushEvent(d, v, opts...)
+}
+
+var _ = Describe("TokenBuckets", func() {
+	var th timerheap.TimerHeap
+	var b *timerheap.TokenBuckets
+
+	BeforeEach(func() {
+		th = timerheap.New()
+		b = timerheap.NewTokenBuckets(th)
+	})
+
+	AfterEach(func() {
+		b.Close()
+		th.Terminate()
+	})
+
+	It("refills a bucket until it is full", func() {
+		Expect(b.Add("a", timerheap.BucketConfig{Capacity: 2, Interval: 50 * time.Millisecond})).To(Succeed())
+		Expect(b.Take("a", 2)).To(BeTrue())
+		Expect(b.Take("a", 1)).To(BeFalse())
+		Eventually(b.C(), "1s").Should(Receive(Equal(timerheap.Refilled{Bucket: "a", Tokens: 1})))
+		Eventually(b.C(), "1s").Should(Receive(Equal(timerheap.Refilled{Bucket: "a", Tokens: 2})))
+		Consistently(b.C(), "150ms").ShouldNot(Receive())
+		Expect(b.Tokens("a")).To(Equal(2))
+	})
+
+	It("adds the configured number of tokens up to the capacity", func() {
+		Expect(b.Add("a", timerheap.BucketConfig{Capacity: 5, Tokens: 3, Interval: 20 * time.Millisecond})).To(Succeed())
+		Expect(b.Take("a", 4)).To(BeTrue())
+		Eventually(b.C(), "1s").Should(Receive(Equal(timerheap.Refilled{Bucket: "a", Tokens: 4})))
+		Eventually(b.C(), "1s").Should(Receive(Equal(timerheap.Refilled{Bucket: "a", Tokens: 5})))
+	})
+
+	It("refills many buckets independently", func() {
+		for i := 0; i < 1000; i++ {
+			name := strconv.Itoa(i)
+			Expect(b.Add(name, timerheap.BucketConfig{Capacity: 1, Interval: 50 * time.Millisecond})).To(Succeed())
+			if i%2 == 0 {
+				Expect(b.Take(name, 1)).To(BeTrue())
+			}
+		}
+		for i := 0; i < 500; i++ {
+			var r timerheap.Refilled
+			Eventually(b.C(), "1s").Should(Receive(&r))
+			n, err := strconv.Atoi(r.Bucket)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n % 2).To(Equal(0))
+		}
+		Consistently(b.C(), "100ms").ShouldNot(Receive())
+	})
+
+	It("discards refills for removed buckets", func() {
+		Expect(b.Add("a", timerheap.BucketConfig{Capacity: 1, Interval: 20 * time.Millisecond})).To(Succeed())
+		Expect(b.Take("a", 1)).To(BeTrue())
+		b.Remove("a")
+		Consistently(b.C(), "100ms").ShouldNot(Receive())
+		Expect(b.Take("a", 1)).To(BeFalse())
+	})
+
+	It("fails once closed", func() {
+		b.Close()
+		Eventually(b.C(), "1s").Should(BeClosed())
+		_, err := b.Take("a", 1)
+		Expect(err).To(Equal(timerheap.ErrTerminated))
+		Expect(b.Add("a", timerheap.BucketConfig{Capacity: 1})).To(Equal(timerheap.ErrTerminated))
+	})
+
+	It("schedules a refill that could not be scheduled when tokens are next taken", func() {
+		h := &failingHeap{TimerHeap: th}
+		b.Close()
+		b = timerheap.NewTokenBuckets(h)
+		Expect(b.Add("a", timerheap.BucketConfig{Capacity: 2, Interval: 20 * time.Millisecond})).To(Succeed())
+		Expect(b.Take("a", 2)).To(BeTrue())
+
+		By("Failing to schedule the refill after the first one")
+		h.fail.Store(true)
+		Eventually(b.C(), "1s").Should(Receive(Equal(timerheap.Refilled{Bucket: "a", Tokens: 1})))
+		Consistently(b.C(), "100ms").ShouldNot(Receive())
+		_, err := b.Take("a", 2)
+		Expect(err).To(MatchError(errPushFailed))
+		Expect(b.Tokens("a")).To(Equal(1))
+
+		By("Checking taking tokens schedules the refill once pushes succeed")
+		h.fail.Store(false)
+		Expect(b.Take("a", 2)).To(BeFalse())
+		Eventually(b.C(), "1s").Should(Receive(Equal(timerheap.Refilled{Bucket: "a", Tokens: 2})))
+	})
+})
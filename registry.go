@@ -0,0 +1,97 @@
+package timerheap
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// TypeRegistry is a set of named payload types, each with an optional validator. A registry
+// is attached to a heap with the WithTypeRegistry option, and may be shared between heaps.
+type TypeRegistry struct {
+	lock  sync.RWMutex
+	types map[reflect.Type]*registeredType
+	names map[string]*registeredType
+}
+
+type registeredType struct {
+	name     string
+	typ      reflect.Type
+	validate func(interface{}) error
+}
+
+// NewTypeRegistry returns an empty TypeRegistry.
+func NewTypeRegistry() *TypeRegistry {
+	return &TypeRegistry{
+		types: map[reflect.Type]*registeredType{},
+		names: map[string]*registeredType{},
+	}
+}
+
+// Register adds the type of the example value to the registry under the supplied name. The
+// validate function is optional, if supplied it is called with each pushed value of this
+// type and the push fails if it returns an error. Each type and name may only be registered
+// once.
+func (r *TypeRegistry) Register(name string, example interface{}, validate func(interface{}) error) error {
+	typ := reflect.TypeOf(example)
+	if typ == nil {
+		return fmt.Errorf("timerheap: cannot register nil as type %q", name)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.names[name]; ok {
+		return fmt.Errorf("timerheap: type name %q is already registered", name)
+	}
+	if rt, ok := r.types[typ]; ok {
+		return fmt.Errorf("timerheap: type %v is already registered as %q", typ, rt.name)
+	}
+	rt := &registeredType{name: name, typ: typ, validate: validate}
+	r.types[typ] = rt
+	r.names[name] = rt
+	return nil
+}
+
+// Name returns the name the type of the value is registered under.
+func (r *TypeRegistry) Name(value interface{}) (string, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	rt, ok := r.types[reflect.TypeOf(value)]
+	if !ok {
+		return "", false
+	}
+	return rt.name, true
+}
+
+// typeOf returns the type registered under the name.
+func (r *TypeRegistry) typeOf(name string) (reflect.Type, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	rt, ok := r.names[name]
+	if !ok {
+		return nil, false
+	}
+	return rt.typ, true
+}
+
+// check validates the value against its registered type. Values of unregistered types are
+// rejected if strict is set.
+func (r *TypeRegistry) check(value interface{}, strict bool) error {
+	r.lock.RLock()
+	rt, ok := r.types[reflect.TypeOf(value)]
+	r.lock.RUnlock()
+
+	if !ok {
+		if strict {
+			return fmt.Errorf("%w: %T", ErrUnregisteredType, value)
+		}
+		return nil
+	}
+	if rt.validate == nil {
+		return nil
+	}
+	if err := rt.validate(value); err != nil {
+		return fmt.Errorf("timerheap: invalid %s value: %w", rt.name, err)
+	}
+	return nil
+}
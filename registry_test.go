@@ -0,0 +1,62 @@
+package timerheap_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("timer heap type registry tests", func() {
+
+	var r *timerheap.TypeRegistry
+	var th timerheap.TimerHeap
+
+	BeforeEach(func() {
+		r = timerheap.NewTypeRegistry()
+		Expect(r.Register("testdata", testdata{}, func(v interface{}) error {
+			if v.(testdata).index < 0 {
+				return errors.New("negative index")
+			}
+			return nil
+		})).To(Succeed())
+		Expect(r.Register("string", "", nil)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("rejects duplicate registrations", func() {
+		th = timerheap.New()
+		Expect(r.Register("testdata", 0, nil)).NotTo(Succeed())
+		Expect(r.Register("other", testdata{}, nil)).NotTo(Succeed())
+		Expect(r.Register("nil", nil, nil)).NotTo(Succeed())
+
+		name, ok := r.Name(testdata{})
+		Expect(ok).To(BeTrue())
+		Expect(name).To(Equal("testdata"))
+		_, ok = r.Name(0)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("validates registered types and allows unregistered types when not strict", func() {
+		th = timerheap.New(timerheap.WithTypeRegistry(r, false))
+		Expect(th.PushEvent(time.Hour, testdata{index: 1})).To(Succeed())
+		Expect(th.PushEvent(time.Hour, testdata{index: -1})).NotTo(Succeed())
+		Expect(th.PushEvent(time.Hour, "hello")).To(Succeed())
+		Expect(th.PushEvent(time.Hour, 10)).To(Succeed())
+		Expect(th.Stats().Pending).To(Equal(3))
+	})
+
+	It("rejects unregistered types when strict", func() {
+		th = timerheap.New(timerheap.WithTypeRegistry(r, true))
+		Expect(th.PushEvent(time.Hour, testdata{index: 1})).To(Succeed())
+		Expect(th.PushEvent(time.Hour, "hello")).To(Succeed())
+		err := th.PushEvent(time.Hour, 10)
+		Expect(errors.Is(err, timerheap.ErrUnregisteredType)).To(BeTrue())
+		Expect(th.Stats().Pending).To(Equal(2))
+	})
+})
@@ -0,0 +1,65 @@
+package timerheap
+
+// Remove removes a pending event with the value, as compared with ==, returning false if there
+// is no such event. If more than one event has the value only one of them is removed. The value
+// must be comparable, use RemoveFunc to find values that are not.
+//
+// Only the events held by the heap are searched. Events that have popped but not been received
+// are not removed, nor are the events of a bolt-backed heap that are beyond the loaded window,
+// or those of a clustered heap that is not the leader. A removed event is cancelled, see
+// Handle.Cancel.
+func (t *timerHeap) Remove(value interface{}) bool {
+	return t.RemoveFunc(func(v interface{}) bool {
+		return v == value
+	})
+}
+
+// RemoveFunc removes a pending event whose value match returns true for, returning false if
+// there is no such event. It is otherwise the same as Remove. The match function is called with
+// the heap locked, so it must not call the heap.
+func (t *timerHeap) RemoveFunc(match func(value interface{}) bool) bool {
+	return t.removePending(func() (timedItem, bool) {
+		return t.valueHeap.removeWhere(func(ti *timedItem) bool {
+			// Items with their own delivery function are internal to the heap, and an item
+			// waiting to be acknowledged has already fired.
+			return ti.deliver == nil && ti.attempt == 0 && match(ti.value)
+		})
+	})
+}
+
+// removeKey removes the pending event with the key, see WithKey, returning false if there is no
+// such event. It is otherwise the same as Remove.
+func (t *timerHeap) removeKey(key string) bool {
+	return t.removePending(func() (timedItem, bool) {
+		return t.valueHeap.removeWhere(func(ti *timedItem) bool {
+			return ti.deliver == nil && ti.attempt == 0 && ti.key == key
+		})
+	})
+}
+
+// removePending removes the pending item returned by remove, which is called with the lock held,
+// and reports it as cancelled. It returns false if remove finds no item.
+func (t *timerHeap) removePending(remove func() (timedItem, bool)) bool {
+	t.lock.Lock()
+	t.drainPushedLocked()
+	ti, ok := remove()
+	if ok {
+		t.space.Signal()
+		if !t.terminated {
+			// The heap may need to wake up later, or be idle, now the item has gone.
+			t.wake()
+		}
+	}
+	t.lock.Unlock()
+	if !ok {
+		return false
+	}
+
+	if t.debug {
+		t.log.Debug("Cancelled event", "seq", ti.seq, "expire", ti.expire)
+	}
+	ti.handle.finish(EventCancelled)
+	t.retired(ti)
+	t.reportCancelled(ti)
+	return true
+}
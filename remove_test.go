@@ -0,0 +1,59 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Remove", func() {
+	var th timerheap.TimerHeap
+
+	BeforeEach(func() {
+		th = timerheap.New()
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("removes a pending event by value", func() {
+		h := &timerheap.Handle{}
+		Expect(th.PushEvent(20*time.Millisecond, testdata{index: 1}, timerheap.WithHandle(h))).To(Succeed())
+		Expect(th.PushEvent(30*time.Millisecond, testdata{index: 2})).To(Succeed())
+		Expect(th.Remove(testdata{index: 1})).To(BeTrue())
+		Expect(th.Remove(testdata{index: 1})).To(BeFalse())
+		Expect(h.State()).To(Equal(timerheap.EventCancelled))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(testdata{index: 2})))
+		Consistently(th.TimedEvent(), "50ms").ShouldNot(Receive())
+	})
+
+	It("removes one event at a time when several have the value", func() {
+		Expect(th.PushEvent(time.Hour, "a")).To(Succeed())
+		Expect(th.PushEvent(2*time.Hour, "a")).To(Succeed())
+		Expect(th.Remove("a")).To(BeTrue())
+		Expect(th.Stats().Pending).To(Equal(1))
+		Expect(th.Remove("a")).To(BeTrue())
+		Expect(th.Remove("a")).To(BeFalse())
+		Expect(th.Stats().Pending).To(BeZero())
+	})
+
+	It("removes events whose values are not comparable with a function", func() {
+		Expect(th.PushEvent(time.Hour, []int{1, 2})).To(Succeed())
+		Expect(th.PushEvent(time.Hour, []int{3})).To(Succeed())
+		Expect(th.RemoveFunc(func(v interface{}) bool {
+			s, ok := v.([]int)
+			return ok && len(s) == 1
+		})).To(BeTrue())
+		Expect(th.Stats().Pending).To(Equal(1))
+	})
+
+	It("does not remove internal timers", func() {
+		ch := th.AfterChan(10 * time.Millisecond)
+		Expect(th.RemoveFunc(func(interface{}) bool { return true })).To(BeFalse())
+		Eventually(ch, "1s").Should(BeClosed())
+	})
+})
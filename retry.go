@@ -0,0 +1,91 @@
+package timerheap
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy determines the delays between the attempts made by Retry. The delay after the
+// first attempt is InitialDelay, and each delay after that is Multiplier times the previous
+// delay, up to MaxDelay.
+type RetryPolicy struct {
+	// InitialDelay is the delay between the first and second attempts.
+	InitialDelay time.Duration
+	// MaxDelay is the maximum delay between attempts, or 0 if there is no maximum.
+	MaxDelay time.Duration
+	// Multiplier is the factor each delay is larger than the previous one by. The default
+	// of 0 is treated as 2.
+	Multiplier float64
+	// Jitter is the fraction of each delay that is random, between 0 and 1. A delay d is
+	// replaced by a random delay between d*(1-Jitter) and d, so that clients failing at the
+	// same time do not retry in lockstep.
+	Jitter float64
+	// MaxAttempts is the maximum number of attempts, or 0 if there is no limit.
+	MaxAttempts int
+}
+
+// maxDuration is the longest time.Duration.
+const maxDuration time.Duration = math.MaxInt64
+
+// Delay returns the delay between the attempt and the next one, where the first attempt is
+// attempt 1. Delays too long to be held in a time.Duration are limited to the longest one.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	if p.InitialDelay <= 0 {
+		return 0
+	}
+	m := p.Multiplier
+	if m == 0 {
+		m = 2
+	}
+	limit := maxDuration
+	if p.MaxDelay > 0 {
+		limit = p.MaxDelay
+	}
+	// The delay is compared with the limit before converting it, since a delay that does not
+	// fit in a time.Duration does not convert to one. float64(maxDuration) rounds up, so any
+	// smaller delay converts.
+	d := limit
+	if f := float64(p.InitialDelay) * math.Pow(m, float64(attempt-1)); f < float64(limit) {
+		d = time.Duration(f)
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(float64(d) * p.Jitter * rand.Float64())
+	}
+	return d
+}
+
+// Retry calls fn with the attempt number, starting at 1, until it succeeds or the maximum
+// number of attempts have failed, waiting between attempts as set by the policy. The attempts
+// are scheduled on the heap without being delivered on its results channel, and each attempt
+// is called in its own goroutine.
+//
+// The returned channel receives the error from the last attempt if every attempt fails, or the
+// error from the heap if an attempt cannot be scheduled, for example because it is full. The
+// channel is closed once the retries have finished, without receiving a value if fn succeeded.
+func Retry(th TimerHeap, fn func(attempt int) error, policy RetryPolicy) <-chan error {
+	failed := make(chan error, 1)
+	var attempt func(n int, d time.Duration)
+	attempt = func(n int, d time.Duration) {
+		err := push(th, d, nil, func(interface{}) {
+			go func() {
+				err := fn(n)
+				switch {
+				case err == nil:
+					close(failed)
+				case policy.MaxAttempts > 0 && n >= policy.MaxAttempts:
+					failed <- err
+					close(failed)
+				default:
+					attempt(n+1, policy.Delay(n))
+				}
+			}()
+		})
+		if err != nil {
+			failed <- err
+			close(failed)
+		}
+	}
+	attempt(1, 0)
+	return failed
+}
@@ -0,0 +1,101 @@
+package timerheap_test
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Retry", func() {
+	var th timerheap.TimerHeap
+	errFailed := errors.New("failed")
+
+	BeforeEach(func() {
+		th = timerheap.New()
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("retries until the function succeeds", func() {
+		var lock sync.Mutex
+		var times []time.Time
+		done := timerheap.Retry(th, func(attempt int) error {
+			lock.Lock()
+			defer lock.Unlock()
+			times = append(times, time.Now())
+			if attempt < 3 {
+				return errFailed
+			}
+			return nil
+		}, timerheap.RetryPolicy{InitialDelay: 20 * time.Millisecond})
+
+		Eventually(done).Should(BeClosed())
+		Expect(done).NotTo(Receive())
+		lock.Lock()
+		defer lock.Unlock()
+		Expect(times).To(HaveLen(3))
+		Expect(times[1].Sub(times[0])).To(BeNumerically(">=", 20*time.Millisecond))
+		Expect(times[2].Sub(times[1])).To(BeNumerically(">=", 40*time.Millisecond))
+	})
+
+	It("reports the last error once the attempts are exhausted", func() {
+		var lock sync.Mutex
+		attempts := 0
+		done := timerheap.Retry(th, func(attempt int) error {
+			lock.Lock()
+			defer lock.Unlock()
+			attempts = attempt
+			return errFailed
+		}, timerheap.RetryPolicy{InitialDelay: time.Millisecond, MaxAttempts: 4})
+
+		Eventually(done).Should(Receive(Equal(errFailed)))
+		Eventually(done).Should(BeClosed())
+		lock.Lock()
+		defer lock.Unlock()
+		Expect(attempts).To(Equal(4))
+	})
+
+	It("reports an error if an attempt cannot be scheduled", func() {
+		full := timerheap.New(timerheap.WithMaxPending(1))
+		defer full.Terminate()
+		Expect(full.PushEvent(time.Hour, 1)).To(Succeed())
+		done := timerheap.Retry(full, func(int) error { return nil }, timerheap.RetryPolicy{})
+		Eventually(done).Should(Receive(Equal(timerheap.ErrFull)))
+	})
+
+	It("computes capped exponential delays with jitter", func() {
+		p := timerheap.RetryPolicy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second, Multiplier: 3}
+		Expect(p.Delay(1)).To(Equal(100 * time.Millisecond))
+		Expect(p.Delay(2)).To(Equal(300 * time.Millisecond))
+		Expect(p.Delay(3)).To(Equal(900 * time.Millisecond))
+		Expect(p.Delay(4)).To(Equal(time.Second))
+		Expect(p.Delay(1000)).To(Equal(time.Second))
+
+		p.Jitter = 0.5
+		for i := 0; i < 100; i++ {
+			Expect(p.Delay(4)).To(BeNumerically("~", 750*time.Millisecond, 250*time.Millisecond))
+		}
+	})
+
+	It("limits the delays of later attempts without overflowing", func() {
+		p := timerheap.RetryPolicy{InitialDelay: time.Second}
+		Expect(p.Delay(34)).To(Equal(time.Duration(1<<33) * time.Second))
+		for _, attempt := range []int{35, 36, 64, 1000, 1 << 20} {
+			Expect(p.Delay(attempt)).To(Equal(time.Duration(math.MaxInt64)), "attempt %d", attempt)
+		}
+
+		p.MaxDelay = time.Hour
+		p.Jitter = 0.5
+		for _, attempt := range []int{35, 64, 1000} {
+			Expect(p.Delay(attempt)).To(BeNumerically("~", 45*time.Minute, 15*time.Minute), "attempt %d", attempt)
+		}
+	})
+})
@@ -0,0 +1,248 @@
+package timerheap
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultMaxRTO bounds the timeout as it is backed off if the config has no maximum. RFC 6298
+// allows a maximum of no less than 60 seconds.
+const defaultMaxRTO = 60 * time.Second
+
+// RTOConfig sets the retransmission timeouts used by RetransmitTimers.
+type RTOConfig struct {
+	// Initial is the timeout of a stream before SetRTO is called for it.
+	Initial time.Duration
+	// Min and Max bound the timeout set with SetRTO, and Max bounds the timeout as it is backed
+	// off. A Max of 0 means there is no maximum for SetRTO, and the timeout is backed off up to
+	// 60 seconds, or the timeout set if that is longer.
+	Min time.Duration
+	Max time.Duration
+}
+
+// RetransmitTimers multiplexes a retransmission timer for each of a set of streams over a heap,
+// without the timers being delivered on its results channel. When the timer of a stream expires,
+// its retransmission timeout (RTO) is doubled, up to the maximum, and the timer is started again
+// with the new timeout, until it is stopped or restarted.
+//
+// Restarting a running timer does not push an event to the heap, unless the timer is due
+// sooner than it was. Each stream has at most one timer pending, which is pushed again for the
+// remaining time if the timer was restarted since it was pushed, so restarting the timer on
+// every acknowledgement is cheap.
+type RetransmitTimers[K comparable] struct {
+	th      TimerHeap
+	config  RTOConfig
+	expired func(K, int)
+	// lock protects streams and gen. Each stream records the generation it was created with,
+	// so that the timers of a stream that has since been removed are ignored.
+	lock    sync.Mutex
+	streams map[K]*rtoStream
+	gen     uint64
+	closed  bool
+}
+
+type rtoStream struct {
+	gen     uint64
+	rto     time.Duration
+	backoff int
+	// at is when the timer expires, or zero if it is stopped.
+	at time.Time
+	// due is when the pending timer pops, or zero if there is none.
+	due time.Time
+}
+
+// NewRetransmitTimers returns a RetransmitTimers calling expired with the stream whose timer
+// expired, and the number of times it has expired in a row since its timeout was last set with
+// SetRTO. The function is called on the goroutine processing the heap, so it must not block.
+func NewRetransmitTimers[K comparable](th TimerHeap, config RTOConfig, expired func(id K, backoff int)) *RetransmitTimers[K] {
+	return &RetransmitTimers[K]{
+		th:      th,
+		config:  config,
+		expired: expired,
+		streams: map[K]*rtoStream{},
+	}
+}
+
+// Arm starts the timer of the stream with its current timeout, unless it is already running.
+func (r *RetransmitTimers[K]) Arm(id K) error {
+	return r.start(id, false)
+}
+
+// Restart starts the timer of the stream with its current timeout, whether or not it is already
+// running.
+func (r *RetransmitTimers[K]) Restart(id K) error {
+	return r.start(id, true)
+}
+
+// Stop stops the timer of the stream, keeping its timeout, and returns false if it was not
+// running.
+func (r *RetransmitTimers[K]) Stop(id K) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	s, ok := r.streams[id]
+	if !ok || s.at.IsZero() {
+		return false
+	}
+	s.at = time.Time{}
+	return true
+}
+
+// SetRTO sets the timeout of the stream, for example from a new round trip time estimate, and
+// resets its backoff. A running timer is not changed until it is next started.
+func (r *RetransmitTimers[K]) SetRTO(id K, rto time.Duration) error {
+	if rto < r.config.Min {
+		rto = r.config.Min
+	}
+	if r.config.Max > 0 && rto > r.config.Max {
+		rto = r.config.Max
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return ErrTerminated
+	}
+	s := r.streamLocked(id)
+	s.rto, s.backoff = rto, 0
+	return nil
+}
+
+// RTO returns the current timeout of the stream, including any backoff.
+func (r *RetransmitTimers[K]) RTO(id K) time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if s, ok := r.streams[id]; ok {
+		return s.rto
+	}
+	return r.config.Initial
+}
+
+// Remove stops the timer of the stream and forgets its timeout.
+func (r *RetransmitTimers[K]) Remove(id K) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.streams, id)
+}
+
+// Close removes all the streams. Calls to Arm, Restart and SetRTO after Close fail with
+// ErrTerminated. The heap is not terminated, and the pending timers are discarded when they pop.
+func (r *RetransmitTimers[K]) Close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.closed = true
+	r.streams = map[K]*rtoStream{}
+}
+
+// streamLocked returns the stream, creating it if necessary. The caller must hold the lock.
+func (r *RetransmitTimers[K]) streamLocked(id K) *rtoStream {
+	s, ok := r.streams[id]
+	if !ok {
+		r.gen++
+		s = &rtoStream{gen: r.gen, rto: r.config.Initial}
+		r.streams[id] = s
+	}
+	return s
+}
+
+func (r *RetransmitTimers[K]) start(id K, restart bool) error {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return ErrTerminated
+	}
+	s := r.streamLocked(id)
+	if !restart && !s.at.IsZero() {
+		r.lock.Unlock()
+		return nil
+	}
+	s.at = time.Now().Add(s.rto)
+	gen, at, ok := r.dueLocked(s)
+	r.lock.Unlock()
+	if !ok {
+		return nil
+	}
+	if err := r.schedule(id, gen, at); err != nil {
+		r.lock.Lock()
+		if s.due.Equal(at) {
+			s.at, s.due = time.Time{}, time.Time{}
+		}
+		r.lock.Unlock()
+		return err
+	}
+	return nil
+}
+
+// dueLocked records that a timer is to be pushed for the stream, and returns the generation of
+// the stream and when the timer pops. It returns false if the pending timer pops soon enough
+// already. The caller must hold the lock.
+func (r *RetransmitTimers[K]) dueLocked(s *rtoStream) (uint64, time.Time, bool) {
+	if !s.due.IsZero() && !s.due.After(s.at) {
+		return 0, time.Time{}, false
+	}
+	s.due = s.at
+	return s.gen, s.at, true
+}
+
+// schedule pushes a timer for the stream to pop at the supplied time.
+func (r *RetransmitTimers[K]) schedule(id K, gen uint64, at time.Time) error {
+	return push(r.th, time.Until(at), nil, func(interface{}) {
+		r.fire(id, gen, at)
+	})
+}
+
+// backoffLocked returns the timeout after backing off from the supplied timeout. The caller
+// must hold the lock.
+func (r *RetransmitTimers[K]) backoffLocked(rto time.Duration) time.Duration {
+	max := r.config.Max
+	if max <= 0 {
+		// Without a maximum the timeout is not shortened, but doubling it must stop before
+		// it overflows.
+		max = defaultMaxRTO
+		if rto > max {
+			return rto
+		}
+	}
+	if rto > max/2 {
+		return max
+	}
+	return rto * 2
+}
+
+// fire handles a timer for a stream, backing off and restarting the timer if it has expired, or
+// pushing the timer again if it was restarted since the timer was pushed.
+func (r *RetransmitTimers[K]) fire(id K, gen uint64, due time.Time) {
+	r.lock.Lock()
+	s, ok := r.streams[id]
+	if !ok || s.gen != gen || !s.due.Equal(due) {
+		// The stream was removed, or this timer was superseded by an earlier one.
+		r.lock.Unlock()
+		return
+	}
+	s.due = time.Time{}
+	if s.at.IsZero() {
+		r.lock.Unlock()
+		return
+	}
+	var backoff int
+	expired := !time.Now().Before(s.at)
+	if expired {
+		s.rto = r.backoffLocked(s.rto)
+		s.backoff++
+		backoff = s.backoff
+		s.at = time.Now().Add(s.rto)
+	}
+	_, at, _ := r.dueLocked(s)
+	r.lock.Unlock()
+
+	// This is called on the goroutine processing the heap, so the push must not block. If it
+	// fails the timer is stopped, as it can no longer be tracked.
+	if err := r.schedule(id, gen, at); err != nil {
+		r.lock.Lock()
+		if s.due.Equal(at) {
+			s.at, s.due = time.Time{}, time.Time{}
+		}
+		r.lock.Unlock()
+	}
+	if expired {
+		r.expired(id, backoff)
+	}
+}
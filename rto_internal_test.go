@@ -0,0 +1,55 @@
+package timerheap
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RetransmitTimers backoff", func() {
+	// expire makes the timer of the stream expire as if its pending timer had popped.
+	expire := func(r *RetransmitTimers[string], id string) {
+		r.lock.Lock()
+		s := r.streamLocked(id)
+		s.at = time.Now().Add(-time.Millisecond)
+		s.due = s.at
+		gen, due := s.gen, s.due
+		r.lock.Unlock()
+		r.fire(id, gen, due)
+	}
+
+	It("backs off repeatedly without overflowing", func() {
+		th := New()
+		defer th.Terminate()
+		var backoffs int
+		r := NewRetransmitTimers(th, RTOConfig{Initial: time.Second}, func(id string, backoff int) {
+			backoffs = backoff
+		})
+		defer r.Close()
+
+		for i := 1; i <= 100; i++ {
+			expire(r, "a")
+			Expect(r.RTO("a")).To(BeNumerically(">", 0), "backoff %d", i)
+			Expect(r.RTO("a")).To(BeNumerically("<=", defaultMaxRTO), "backoff %d", i)
+		}
+		Expect(backoffs).To(Equal(100))
+		Expect(r.RTO("a")).To(Equal(defaultMaxRTO))
+
+		By("Checking a longer timeout is kept")
+		Expect(r.SetRTO("a", 2*time.Minute)).To(Succeed())
+		expire(r, "a")
+		Expect(r.RTO("a")).To(Equal(2 * time.Minute))
+	})
+
+	It("backs off up to the maximum", func() {
+		th := New()
+		defer th.Terminate()
+		r := NewRetransmitTimers(th, RTOConfig{Initial: time.Second, Max: 5 * time.Second}, func(string, int) {})
+		defer r.Close()
+		for _, rto := range []time.Duration{2, 4, 5, 5} {
+			expire(r, "a")
+			Expect(r.RTO("a")).To(Equal(rto * time.Second))
+		}
+	})
+})
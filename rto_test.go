@@ -0,0 +1,104 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("RetransmitTimers", func() {
+	type expiry struct {
+		id      string
+		backoff int
+		at      time.Time
+	}
+	var th timerheap.TimerHeap
+	var r *timerheap.RetransmitTimers[string]
+	var expired chan expiry
+
+	BeforeEach(func() {
+		th = timerheap.New()
+		expired = make(chan expiry, 100)
+		r = timerheap.NewRetransmitTimers(th, timerheap.RTOConfig{
+			Initial: 20 * time.Millisecond,
+			Min:     10 * time.Millisecond,
+			Max:     80 * time.Millisecond,
+		}, func(id string, backoff int) {
+			expired <- expiry{id, backoff, time.Now()}
+		})
+	})
+
+	AfterEach(func() {
+		r.Close()
+		th.Terminate()
+	})
+
+	It("backs off the timeout each time the timer expires", func() {
+		start := time.Now()
+		Expect(r.Arm("a")).To(Succeed())
+		var e expiry
+		for i, total := range []time.Duration{20, 60, 140, 220} {
+			Eventually(expired, "1s").Should(Receive(&e))
+			Expect(e.id).To(Equal("a"))
+			Expect(e.backoff).To(Equal(i + 1))
+			Expect(e.at.Sub(start)).To(BeNumerically(">=", total*time.Millisecond))
+		}
+		Expect(r.RTO("a")).To(Equal(80 * time.Millisecond))
+	})
+
+	It("does not expire a timer that is restarted", func() {
+		Expect(r.Arm("a")).To(Succeed())
+		for i := 0; i < 5; i++ {
+			time.Sleep(10 * time.Millisecond)
+			Expect(r.Restart("a")).To(Succeed())
+			Expect(r.Arm("a")).To(Succeed())
+		}
+		Expect(expired).NotTo(Receive())
+		Expect(r.Stop("a")).To(BeTrue())
+		Expect(r.Stop("a")).To(BeFalse())
+		Consistently(expired, "100ms").ShouldNot(Receive())
+		Expect(r.RTO("a")).To(Equal(20 * time.Millisecond))
+	})
+
+	It("resets the backoff when the timeout is set", func() {
+		Expect(r.Arm("a")).To(Succeed())
+		Eventually(expired, "1s").Should(Receive())
+		Expect(r.Stop("a")).To(BeTrue())
+		Expect(r.RTO("a")).To(Equal(40 * time.Millisecond))
+
+		Expect(r.SetRTO("a", time.Millisecond)).To(Succeed())
+		Expect(r.RTO("a")).To(Equal(10 * time.Millisecond))
+		Expect(r.SetRTO("a", time.Second)).To(Succeed())
+		Expect(r.RTO("a")).To(Equal(80 * time.Millisecond))
+		Expect(r.SetRTO("a", 30*time.Millisecond)).To(Succeed())
+		Expect(r.Restart("a")).To(Succeed())
+		var e expiry
+		Eventually(expired, "1s").Should(Receive(&e))
+		Expect(e.backoff).To(Equal(1))
+		Expect(r.RTO("a")).To(Equal(60 * time.Millisecond))
+	})
+
+	It("multiplexes the timers of many streams", func() {
+		Expect(r.Arm("a")).To(Succeed())
+		Expect(r.SetRTO("b", 10*time.Millisecond)).To(Succeed())
+		Expect(r.Arm("b")).To(Succeed())
+		Expect(r.Arm("c")).To(Succeed())
+		r.Remove("c")
+		var e expiry
+		Eventually(expired, "1s").Should(Receive(&e))
+		Expect(e.id).To(Equal("b"))
+		r.Remove("b")
+		Eventually(expired, "1s").Should(Receive(&e))
+		Expect(e.id).To(Equal("a"))
+		r.Remove("a")
+		Consistently(expired, "150ms").ShouldNot(Receive())
+	})
+
+	It("fails to start timers once closed", func() {
+		r.Close()
+		Expect(r.Arm("a")).To(Equal(timerheap.ErrTerminated))
+	})
+})
@@ -0,0 +1,40 @@
+package timerheap
+
+// WithSequenceNumbers includes a sequence number in each event delivered on the results channel,
+// along with the sequence number of the event delivered on the channel before it, so that a
+// consumer can detect the events it missed. The numbers are carried in the TimedResult of the
+// event, see WithTimedResults, or its Delivery, see WithAck, so the option has no effect unless
+// the heap is created with one of those.
+//
+// Each fired event takes the next sequence number, starting at 1, as it leaves the queue of
+// events waiting to be delivered, so the events delivered on the channel have increasing
+// sequence numbers. An event that fires but is not delivered, because it is dropped from a full
+// delivery buffer, passes its not-after time, is dropped by middleware or has been delivered the
+// maximum number of times, takes a sequence number that is never delivered. A consumer whose
+// event has a previous sequence number other than that of the last event it received missed the
+// events in between, for example because they were dropped or received by another consumer. The
+// previous sequence number is zero for the first event delivered by the heap. An event
+// delivered again because it was not acknowledged takes a new sequence number, and its attempt
+// shows that it was delivered before.
+func WithSequenceNumbers() Option {
+	return func(t *timerHeap) {
+		t.sequenced = true
+	}
+}
+
+// sequence sets the sequence numbers of the value to deliver for the event at the head of the
+// ready queue, if it is a TimedResult and the heap was created with WithSequenceNumbers. It
+// must only be called by the event goroutine.
+func (t *timerHeap) sequence(value interface{}) interface{} {
+	if r, ok := value.(TimedResult); ok && t.sequenced {
+		r.Seq, r.PrevSeq = t.lastSeq+1, t.lastDelivered
+		return r
+	}
+	return value
+}
+
+// missedLocked takes a sequence number for an event that fired but is not delivered, see
+// WithSequenceNumbers. The caller must hold the lock, and be the event goroutine.
+func (t *timerHeap) missedLocked() {
+	t.lastSeq++
+}
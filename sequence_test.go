@@ -0,0 +1,115 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Sequence numbers", func() {
+	It("includes the sequence number of the previous delivery", func() {
+		th := timerheap.New(timerheap.WithTimedResults(), timerheap.WithSequenceNumbers())
+		defer th.Terminate()
+		Expect(th.PushEvent(20*time.Millisecond, "a")).To(Succeed())
+		Expect(th.PushEvent(10*time.Millisecond, "b")).To(Succeed())
+		Expect(th.PushEvent(30*time.Millisecond, "c")).To(Succeed())
+
+		var results []timerheap.TimedResult
+		for i := 0; i < 3; i++ {
+			results = append(results, (<-th.TimedEvent()).(timerheap.TimedResult))
+		}
+		for i, value := range []string{"b", "a", "c"} {
+			Expect(results[i].Value).To(Equal(value))
+			Expect(results[i].Seq).To(Equal(uint64(i + 1)))
+			Expect(results[i].PrevSeq).To(Equal(uint64(i)))
+		}
+	})
+
+	It("reveals the events received by another consumer", func() {
+		th := timerheap.New(timerheap.WithTimedResults(), timerheap.WithSequenceNumbers())
+		defer th.Terminate()
+		for i := 0; i < 3; i++ {
+			Expect(th.PushEvent(time.Duration(i)*time.Millisecond, i)).To(Succeed())
+		}
+		first := (<-th.TimedEvent()).(timerheap.TimedResult)
+		<-th.TimedEvent()
+		third := (<-th.TimedEvent()).(timerheap.TimedResult)
+		Expect(third.PrevSeq).NotTo(Equal(first.Seq))
+	})
+
+	It("leaves a gap for the events dropped from a full buffer", func() {
+		th := timerheap.New(timerheap.WithTimedResults(), timerheap.WithSequenceNumbers(), timerheap.WithNonBlockingDelivery(1))
+		defer th.Terminate()
+		for i := 0; i < 3; i++ {
+			Expect(th.PushEvent(0, i)).To(Succeed())
+		}
+		Eventually(func() uint64 { return th.Stats().Dropped }).Should(Equal(uint64(2)))
+
+		var r timerheap.TimedResult
+		Eventually(th.TimedEvent(), "1s").Should(Receive(&r))
+		Expect(r.Value).To(Equal(2))
+		Expect(r.Seq).To(Equal(uint64(3)))
+		Expect(r.PrevSeq).To(BeZero())
+		Expect(th.PushEvent(0, 3)).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(&r))
+		Expect(r.Seq).To(Equal(uint64(4)))
+		Expect(r.PrevSeq).To(Equal(uint64(3)))
+	})
+
+	It("leaves a gap for the events discarded as stale", func() {
+		th := timerheap.New(timerheap.WithTimedResults(), timerheap.WithSequenceNumbers())
+		defer th.Terminate()
+		Expect(th.PushEvent(0, 1, timerheap.WithStaleAfter(10*time.Millisecond))).To(Succeed())
+		Expect(th.PushEvent(time.Millisecond, 2)).To(Succeed())
+		Eventually(func() uint64 { return th.Stats().Expired }).Should(Equal(uint64(1)))
+
+		var r timerheap.TimedResult
+		Eventually(th.TimedEvent(), "1s").Should(Receive(&r))
+		Expect(r.Value).To(Equal(2))
+		Expect(r.Seq).To(Equal(uint64(2)))
+		Expect(r.PrevSeq).To(BeZero())
+	})
+
+	It("numbers the events in the order they are delivered", func() {
+		th := timerheap.New(timerheap.WithTimedResults(), timerheap.WithSequenceNumbers(), timerheap.WithNonBlockingDelivery(0))
+		defer th.Terminate()
+		for i := 0; i < 3; i++ {
+			Expect(th.PushEvent(time.Duration(i)*time.Millisecond, i)).To(Succeed())
+		}
+		Expect(th.PushEvent(5*time.Millisecond, 3, timerheap.WithPriorityClass(1))).To(Succeed())
+		time.Sleep(50 * time.Millisecond)
+
+		for i := 1; i <= 4; i++ {
+			var r timerheap.TimedResult
+			Eventually(th.TimedEvent(), "1s").Should(Receive(&r))
+			Expect(r.Seq).To(Equal(uint64(i)))
+			Expect(r.PrevSeq).To(Equal(uint64(i - 1)))
+		}
+	})
+
+	It("gives a redelivered event a new sequence number", func() {
+		th := timerheap.New(timerheap.WithAck(10*time.Millisecond), timerheap.WithSequenceNumbers())
+		defer th.Terminate()
+		Expect(th.PushEvent(0, 1)).To(Succeed())
+		first := (<-th.TimedEvent()).(*timerheap.Delivery)
+		second := (<-th.TimedEvent()).(*timerheap.Delivery)
+		Expect(second.Attempt).To(Equal(2))
+		Expect(second.Seq).To(Equal(first.Seq + 1))
+		Expect(second.PrevSeq).To(Equal(first.Seq))
+		Expect(second.Ack()).To(Succeed())
+	})
+
+	It("does not include sequence numbers by default", func() {
+		th := timerheap.New(timerheap.WithTimedResults())
+		defer th.Terminate()
+		Expect(th.PushEvent(0, 1)).To(Succeed())
+		Expect(th.PushEvent(0, 2)).To(Succeed())
+		<-th.TimedEvent()
+		r := (<-th.TimedEvent()).(timerheap.TimedResult)
+		Expect(r.Seq).To(BeZero())
+		Expect(r.PrevSeq).To(BeZero())
+	})
+})
@@ -0,0 +1,242 @@
+// Package session tracks sessions that expire after an idle timeout, or once they reach a
+// maximum lifetime, with the expirations driven by a timerheap.TimerHeap.
+//
+// Touching a session does not push an event to the heap. Each session has at most one idle
+// timer pending, and when it pops, the timer is pushed again if the session has been touched
+// since it was pushed, so that busy sessions cost no more than idle ones.
+package session
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+// Reason is the reason a session expired.
+type Reason int
+
+const (
+	// Idle means the session was not touched within the idle timeout.
+	Idle Reason = iota
+	// Lifetime means the session reached its maximum lifetime.
+	Lifetime
+)
+
+func (r Reason) String() string {
+	switch r {
+	case Idle:
+		return "idle"
+	case Lifetime:
+		return "lifetime"
+	}
+	return fmt.Sprintf("Reason(%d)", int(r))
+}
+
+// Expiry is sent when a session expires.
+type Expiry struct {
+	ID     string
+	Reason Reason
+	// Started is when the session was started.
+	Started time.Time
+	// LastActive is when the session was last touched, or started if it was never touched.
+	LastActive time.Time
+}
+
+// Manager tracks sessions with a sliding idle timeout and an absolute maximum lifetime. It is
+// safe for concurrent use.
+type Manager struct {
+	th          timerheap.TimerHeap
+	topic       string
+	idleTimeout time.Duration
+	maxLifetime time.Duration
+	// lock protects sessions and gen. Each session records the generation it was started with,
+	// so that the timers of a session that has since ended, or been started again, are ignored.
+	lock     sync.Mutex
+	sessions map[string]*state
+	gen      uint64
+	closed   bool
+	expiries chan Expiry
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+type state struct {
+	gen        uint64
+	started    time.Time
+	lastActive time.Time
+}
+
+// timer is the event pushed to the heap for a session.
+type timer struct {
+	id     string
+	gen    uint64
+	reason Reason
+}
+
+// NewManager returns a Manager using the heap for its expirations. A session expires once it has
+// not been touched for idleTimeout, or once maxLifetime has passed since it started, where zero
+// disables either limit. The timers are pushed with a topic unique to the manager, so the heap
+// can be shared with other users.
+func NewManager(th timerheap.TimerHeap, idleTimeout, maxLifetime time.Duration) *Manager {
+	m := &Manager{
+		th:          th,
+		idleTimeout: idleTimeout,
+		maxLifetime: maxLifetime,
+		sessions:    map[string]*state{},
+		expiries:    make(chan Expiry),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	m.topic = fmt.Sprintf("session/%p", m)
+	go m.run()
+	return m
+}
+
+// Expiries returns the channel the expired sessions are sent on. The expirations are buffered
+// by the heap while the channel is not being received from. The channel is closed by Close.
+func (m *Manager) Expiries() <-chan Expiry {
+	return m.expiries
+}
+
+// Start starts a session with the ID, replacing any existing session with the same ID.
+func (m *Manager) Start(id string) error {
+	now := time.Now()
+	m.lock.Lock()
+	if m.closed {
+		m.lock.Unlock()
+		return timerheap.ErrTerminated
+	}
+	m.gen++
+	s := &state{gen: m.gen, started: now, lastActive: now}
+	m.sessions[id] = s
+	m.lock.Unlock()
+
+	var err error
+	if m.idleTimeout > 0 {
+		err = m.push(m.idleTimeout, timer{id: id, gen: s.gen, reason: Idle})
+	}
+	if err == nil && m.maxLifetime > 0 {
+		err = m.push(m.maxLifetime, timer{id: id, gen: s.gen, reason: Lifetime})
+	}
+	if err != nil {
+		m.lock.Lock()
+		if m.sessions[id] == s {
+			delete(m.sessions, id)
+		}
+		m.lock.Unlock()
+	}
+	return err
+}
+
+// Touch records activity on the session, restarting its idle timeout. It returns false if there
+// is no such session.
+func (m *Manager) Touch(id string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	s, ok := m.sessions[id]
+	if ok {
+		s.lastActive = time.Now()
+	}
+	return ok
+}
+
+// End ends the session without it expiring, returning false if there is no such session.
+func (m *Manager) End(id string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, ok := m.sessions[id]
+	delete(m.sessions, id)
+	return ok
+}
+
+// Active returns whether there is a session with the ID.
+func (m *Manager) Active(id string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, ok := m.sessions[id]
+	return ok
+}
+
+// Len returns the number of sessions.
+func (m *Manager) Len() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.sessions)
+}
+
+// Close ends all the sessions, and closes the expiries channel. Calls to Start after Close fail
+// with timerheap.ErrTerminated. The heap is not terminated, and the pending timers are discarded
+// when they pop.
+func (m *Manager) Close() {
+	m.lock.Lock()
+	if m.closed {
+		m.lock.Unlock()
+		return
+	}
+	m.closed = true
+	m.sessions = map[string]*state{}
+	m.lock.Unlock()
+	close(m.done)
+	<-m.stopped
+	close(m.expiries)
+	go func() {
+		// Drain the timers still to pop, so that they are not buffered by the heap.
+		for range m.th.TimedEventFor(m.topic) {
+		}
+	}()
+}
+
+func (m *Manager) push(d time.Duration, tm timer) error {
+	return m.th.PushEvent(d, tm, timerheap.WithTopic(m.topic))
+}
+
+// run processes the timers until the manager is closed.
+func (m *Manager) run() {
+	defer close(m.stopped)
+	events := m.th.TimedEventFor(m.topic)
+	for {
+		select {
+		case <-m.done:
+			return
+		case v, ok := <-events:
+			if !ok {
+				return
+			}
+			e, ok := m.fire(v.(timer))
+			if !ok {
+				continue
+			}
+			select {
+			case m.expiries <- e:
+			case <-m.done:
+				return
+			}
+		}
+	}
+}
+
+// fire handles a timer for a session, returning the expiry if the session expired.
+func (m *Manager) fire(tm timer) (Expiry, bool) {
+	m.lock.Lock()
+	s, ok := m.sessions[tm.id]
+	if !ok || s.gen != tm.gen {
+		m.lock.Unlock()
+		return Expiry{}, false
+	}
+	if tm.reason == Idle {
+		deadline := s.lastActive.Add(m.idleTimeout)
+		if remaining := time.Until(deadline); remaining > 0 {
+			m.lock.Unlock()
+			// The session was touched since the timer was pushed, so wait for the rest of the
+			// idle timeout. If the timer cannot be pushed the session is left to expire at its
+			// maximum lifetime, if it has one.
+			_ = m.push(remaining, tm)
+			return Expiry{}, false
+		}
+	}
+	delete(m.sessions, tm.id)
+	m.lock.Unlock()
+	return Expiry{ID: tm.id, Reason: tm.reason, Started: s.started, LastActive: s.lastActive}, true
+}
@@ -0,0 +1,96 @@
+package session_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+	"github.com/robbrockbank/timerheap/session"
+)
+
+var _ = Describe("Manager", func() {
+	var th timerheap.TimerHeap
+	var m *session.Manager
+
+	BeforeEach(func() {
+		th = timerheap.New()
+		m = session.NewManager(th, 60*time.Millisecond, 300*time.Millisecond)
+	})
+
+	AfterEach(func() {
+		m.Close()
+		th.Terminate()
+	})
+
+	It("expires idle sessions", func() {
+		Expect(m.Start("a")).To(Succeed())
+		Expect(m.Active("a")).To(BeTrue())
+		var e session.Expiry
+		Eventually(m.Expiries(), "1s").Should(Receive(&e))
+		Expect(e.ID).To(Equal("a"))
+		Expect(e.Reason).To(Equal(session.Idle))
+		Expect(e.LastActive.Sub(e.Started)).To(BeZero())
+		Expect(m.Active("a")).To(BeFalse())
+	})
+
+	It("slides the idle timeout when a session is touched", func() {
+		Expect(m.Start("a")).To(Succeed())
+		start := time.Now()
+		for i := 0; i < 4; i++ {
+			time.Sleep(30 * time.Millisecond)
+			Expect(m.Touch("a")).To(BeTrue())
+		}
+		var e session.Expiry
+		Eventually(m.Expiries(), "1s").Should(Receive(&e))
+		Expect(e.Reason).To(Equal(session.Idle))
+		Expect(time.Since(start)).To(BeNumerically(">=", 180*time.Millisecond))
+		Expect(e.LastActive).To(BeTemporally(">", e.Started))
+	})
+
+	It("expires busy sessions at their maximum lifetime", func() {
+		Expect(m.Start("a")).To(Succeed())
+		start := time.Now()
+		received := make(chan session.Expiry, 1)
+		go func() {
+			defer GinkgoRecover()
+			e, ok := <-m.Expiries()
+			if ok {
+				received <- e
+			}
+		}()
+		for m.Touch("a") {
+			time.Sleep(20 * time.Millisecond)
+		}
+		var e session.Expiry
+		Eventually(received, "1s").Should(Receive(&e))
+		Expect(e.Reason).To(Equal(session.Lifetime))
+		Expect(time.Since(start)).To(BeNumerically(">=", 300*time.Millisecond))
+	})
+
+	It("does not expire ended sessions", func() {
+		Expect(m.Start("a")).To(Succeed())
+		Expect(m.End("a")).To(BeTrue())
+		Expect(m.End("a")).To(BeFalse())
+		Expect(m.Touch("a")).To(BeFalse())
+		Consistently(m.Expiries(), "150ms").ShouldNot(Receive())
+	})
+
+	It("ignores the timers of a session started again", func() {
+		Expect(m.Start("a")).To(Succeed())
+		time.Sleep(40 * time.Millisecond)
+		Expect(m.Start("a")).To(Succeed())
+		restarted := time.Now()
+		var e session.Expiry
+		Eventually(m.Expiries(), "1s").Should(Receive(&e))
+		Expect(time.Since(restarted)).To(BeNumerically(">=", 60*time.Millisecond))
+		Expect(m.Len()).To(BeZero())
+	})
+
+	It("fails to start sessions once closed", func() {
+		m.Close()
+		Eventually(m.Expiries()).Should(BeClosed())
+		Expect(m.Start("a")).To(Equal(timerheap.ErrTerminated))
+	})
+})
@@ -0,0 +1,61 @@
+package timerheap
+
+import (
+	"sync"
+)
+
+// WithShards spreads pushes over n staging shards, each with its own lock, to reduce lock
+// contention when many goroutines push concurrently. Pushed events are held in their shard
+// until the event goroutine moves them onto the heap, which it does in batches whenever it
+// wakes up. Events are assigned to the shards in turn and are still delivered in time order,
+// with events scheduled for the same time delivered in the order they were pushed.
+//
+// Sharding has no effect if WithMaxPending is also used, since the limit must be checked
+// against the whole heap under a single lock.
+func WithShards(n int) Option {
+	return func(t *timerHeap) {
+		if n > 1 {
+			t.shards = make([]shard, n)
+		}
+	}
+}
+
+// shard holds pushed items until the event goroutine moves them onto the heap.
+type shard struct {
+	lock  sync.Mutex
+	items []timedItem
+}
+
+// pushSharded adds the item to the next shard in turn, only taking the lock for that shard.
+// The event goroutine is woken when a shard goes from empty to non-empty, since it empties
+// every shard each time it wakes.
+func (t *timerHeap) pushSharded(ti timedItem) {
+	s := &t.shards[ti.seq%uint64(len(t.shards))]
+	s.lock.Lock()
+	s.items = append(s.items, ti)
+	first := len(s.items) == 1
+	s.lock.Unlock()
+
+	if first {
+		t.wake()
+	}
+}
+
+// drainShardsLocked moves the items held in the shards onto the heap. The caller must hold the
+// heap lock, which is always taken before a shard lock.
+func (t *timerHeap) drainShardsLocked() {
+	for i := range t.shards {
+		s := &t.shards[i]
+		s.lock.Lock()
+		for j, ti := range s.items {
+			t.valueHeap.push(ti)
+			t.pushed++
+			if ti.priority != 0 {
+				t.prioritised = true
+			}
+			s.items[j] = timedItem{}
+		}
+		s.items = s.items[:0]
+		s.lock.Unlock()
+	}
+}
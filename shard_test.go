@@ -0,0 +1,79 @@
+package timerheap_test
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Sharded pushes", func() {
+	testConcurrentPushes(timerheap.WithShards(4))
+})
+
+var _ = Describe("Lock-free pushes", func() {
+	testConcurrentPushes()
+})
+
+// testConcurrentPushes tests pushing to a heap without a limit on the number of pending events,
+// which stages pushed events before they are added to the heap.
+func testConcurrentPushes(opts ...timerheap.Option) {
+	var th timerheap.TimerHeap
+
+	BeforeEach(func() {
+		th = timerheap.New(opts...)
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("delivers events pushed concurrently in time order", func() {
+		By("pushing events from several goroutines")
+		start := time.Now().Add(500 * time.Millisecond)
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for i := g; i < 100; i += 4 {
+					Expect(th.PushEventAt(start.Add(time.Duration(99-i)*time.Millisecond), testdata{index: i})).To(Succeed())
+				}
+			}(g)
+		}
+		wg.Wait()
+		Expect(th.Stats().Pushed).To(BeEquivalentTo(100))
+
+		By("Checking the events are received latest index first")
+		for i := 99; i >= 0; i-- {
+			var value interface{}
+			Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(&value))
+			Expect(value).To(Equal(testdata{index: i}))
+		}
+	})
+
+	It("delivers events with the same expiration in the order they were pushed", func() {
+		expire := time.Now().Add(50 * time.Millisecond)
+		for i := 0; i < 10; i++ {
+			Expect(th.PushEventAt(expire, testdata{index: i})).To(Succeed())
+		}
+		for i := 0; i < 10; i++ {
+			var value interface{}
+			Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(&value))
+			Expect(value).To(Equal(testdata{index: i}))
+		}
+	})
+
+	It("wakes up for an event pushed before the next one due", func() {
+		Expect(th.PushEvent(time.Hour, testdata{index: 1})).To(Succeed())
+		Expect(th.PushEvent(10*time.Millisecond, testdata{index: 2})).To(Succeed())
+
+		var value interface{}
+		Eventually(th.TimedEvent(), "500ms", "1ms").Should(Receive(&value))
+		Expect(value).To(Equal(testdata{index: 2}))
+	})
+}
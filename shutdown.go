@@ -0,0 +1,117 @@
+package timerheap
+
+import (
+	"context"
+	"time"
+)
+
+// drainWaiter is a call to TerminateContext waiting for the events that had expired when it
+// was made to be delivered.
+type drainWaiter struct {
+	// due is the time of the call, events that expire after it are not waited for.
+	due time.Time
+	// done is closed once the expired events have been delivered, or the heap is terminated.
+	done chan struct{}
+}
+
+// TerminateContext stops the heap once the events that have already expired have been
+// delivered, or once the context is done, whichever is first. Pushes fail with ErrTerminated
+// from the start of the call. Events that expire later, and the expired events that are still
+// undelivered when the context is done, are handled as with Terminate.
+//
+// It returns nil if the expired events were all delivered, or the context error if the heap was
+// stopped without delivering them. Unlike waiting on Idle or Flush before terminating, this
+// does not hang on a consumer that has stopped receiving.
+func (t *timerHeap) TerminateContext(ctx context.Context) error {
+	// Stop accepting pushes before waiting, see terminate.
+	t.closing.Store(true)
+	if err := t.awaitPushes(ctx); err != nil {
+		t.Terminate()
+		return err
+	}
+
+	t.lock.Lock()
+	t.drainPushedLocked()
+	w := &drainWaiter{
+		due:  t.stamp(time.Now()),
+		done: make(chan struct{}),
+	}
+	if t.terminated || t.drainedLocked(w.due) {
+		close(w.done)
+	} else {
+		t.drains = append(t.drains, w)
+	}
+	t.lock.Unlock()
+
+	var err error
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		select {
+		case <-w.done:
+		default:
+			err = ctx.Err()
+		}
+	}
+	t.Terminate()
+	return err
+}
+
+// TerminateTimeout is TerminateContext with a context that is done after the given duration.
+func (t *timerHeap) TerminateTimeout(d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return t.TerminateContext(ctx)
+}
+
+// awaitPushes waits for the pushes that are in progress to complete, once closing or quiescing
+// has been set, or until the context is done. Pushes blocked waiting for space are woken so
+// that they see the flag and fail.
+func (t *timerHeap) awaitPushes(ctx context.Context) error {
+	t.lock.Lock()
+	t.space.Broadcast()
+	t.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.gate.Lock()
+		t.gate.Unlock()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// checkDrainsLocked releases the calls to TerminateContext whose expired events have all been
+// delivered, or all calls if the heap has been terminated. The caller must hold the lock.
+func (t *timerHeap) checkDrainsLocked() {
+	if len(t.drains) == 0 {
+		return
+	}
+	remaining := t.drains[:0]
+	for _, w := range t.drains {
+		if t.terminated || t.drainedLocked(w.due) {
+			close(w.done)
+		} else {
+			remaining = append(remaining, w)
+		}
+	}
+	for i := len(remaining); i < len(t.drains); i++ {
+		t.drains[i] = nil
+	}
+	t.drains = remaining
+}
+
+// drainedLocked returns true if no pending event expires at or before due. Pushed events must
+// have been moved onto the heap. The caller must hold the lock.
+func (t *timerHeap) drainedLocked(due time.Time) bool {
+	if len(t.ready) > 0 {
+		return false
+	}
+	next := t.valueHeap.peek()
+	return next == nil || next.expire.After(due)
+}
@@ -0,0 +1,53 @@
+package timerheap
+
+import (
+	"time"
+)
+
+// WithSlack sets how late the event may pop, so that it can pop along with other events rather
+// than the heap waking for it alone. The event pops at some time between its expiration time and
+// slack after it, and events without slack still pop on time. This overrides the slack set for
+// the heap with WithDefaultSlack.
+func WithSlack(slack time.Duration) PushOption {
+	return func(ti *timedItem) {
+		ti.slack = slack
+	}
+}
+
+// WithDefaultSlack sets the slack of the events pushed without WithSlack, see WithSlack.
+func WithDefaultSlack(slack time.Duration) Option {
+	return func(t *timerHeap) {
+		t.slack = slack
+	}
+}
+
+// deadline returns the latest time the item may pop.
+func (ti *timedItem) deadline() time.Time {
+	return ti.expire.Add(ti.slack)
+}
+
+// wakeLocked returns the time the heap next needs to wake to pop the item at the top of the heap.
+// This is the earliest deadline of the items, which is the expiration time of the top item unless
+// items have slack. The caller must hold the lock.
+func (t *timerHeap) wakeLocked(next *timedItem) time.Time {
+	if !t.slacked.Load() {
+		return next.expire
+	}
+	return t.valueHeap.deadline(next.deadline())
+}
+
+// heapDeadline returns the earliest deadline of the items of a d-ary heap in the subtree rooted at
+// index i, or best if none is earlier. Only items that expire before best can have an earlier
+// deadline, and since a parent never expires after its children only those items are visited.
+func heapDeadline(h []timedItem, i, d int, best time.Time) time.Time {
+	if i >= len(h) || !h[i].expire.Before(best) {
+		return best
+	}
+	if dl := h[i].deadline(); dl.Before(best) {
+		best = dl
+	}
+	for c := d*i + 1; c <= d*i+d && c < len(h); c++ {
+		best = heapDeadline(h, c, d, best)
+	}
+	return best
+}
@@ -0,0 +1,66 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Slack", func() {
+	receive := func(th timerheap.TimerHeap) timerheap.TimedResult {
+		var r timerheap.TimedResult
+		EventuallyWithOffset(1, th.TimedEvent(), "1s", "1ms").Should(Receive(&r))
+		return r
+	}
+
+	DescribeTable("pops tolerant events along with tight ones",
+		func(b timerheap.BackendType) {
+			th := timerheap.New(
+				timerheap.WithBackend(b),
+				timerheap.WithDefaultSlack(100*time.Millisecond),
+				timerheap.WithNonBlockingDelivery(0),
+				timerheap.WithTimedResults(),
+			)
+			defer th.Terminate()
+			for i := 0; i < 5; i++ {
+				Expect(th.PushEvent(time.Duration(i+1)*5*time.Millisecond, i)).To(Succeed())
+			}
+			Expect(th.PushEvent(40*time.Millisecond, 5, timerheap.WithSlack(0))).To(Succeed())
+
+			first := receive(th)
+			Expect(first.Value).To(Equal(0))
+			Expect(first.Lateness).To(BeNumerically(">=", 30*time.Millisecond))
+			for i := 1; i < 6; i++ {
+				r := receive(th)
+				Expect(r.Value).To(Equal(i))
+				Expect(r.FiredAt).To(Equal(first.FiredAt))
+			}
+		},
+		Entry("binary heap", timerheap.BinaryHeap),
+		Entry("quaternary heap", timerheap.QuaternaryHeap),
+		Entry("pairing heap", timerheap.PairingHeap),
+		Entry("min-max heap", timerheap.MinMaxHeap),
+	)
+
+	It("pops tolerant events by their deadline", func() {
+		th := timerheap.New(timerheap.WithNonBlockingDelivery(0), timerheap.WithTimedResults())
+		defer th.Terminate()
+		Expect(th.PushEvent(10*time.Millisecond, 0, timerheap.WithSlack(50*time.Millisecond))).To(Succeed())
+		Expect(th.PushEvent(40*time.Millisecond, 1, timerheap.WithSlack(50*time.Millisecond))).To(Succeed())
+		Expect(th.PushEvent(100*time.Millisecond, 2, timerheap.WithSlack(50*time.Millisecond))).To(Succeed())
+
+		first := receive(th)
+		Expect(first.Value).To(Equal(0))
+		Expect(first.Lateness).To(BeNumerically(">=", 50*time.Millisecond))
+		second := receive(th)
+		Expect(second.Value).To(Equal(1))
+		Expect(second.FiredAt).To(Equal(first.FiredAt))
+		third := receive(th)
+		Expect(third.Value).To(Equal(2))
+		Expect(third.FiredAt).To(BeTemporally(">", first.FiredAt))
+	})
+})
@@ -0,0 +1,72 @@
+package timerheap
+
+import (
+	"sort"
+	"time"
+)
+
+// ScheduledEvent is a pending event, as returned by Snapshot.
+type ScheduledEvent struct {
+	// The value that was pushed.
+	Value interface{}
+	// The time the event is scheduled to pop.
+	ScheduledAt time.Time
+	// The latest time the event may be delivered, or the zero time if there is no limit.
+	NotAfter time.Time
+	// The priority class, tiebreak and topic of the event, and the metadata attached to it.
+	Priority int
+	Tiebreak int
+	Topic    string
+	Metadata Metadata
+	// Popped is set if the event has popped and is waiting to be received.
+	Popped bool
+}
+
+// Snapshot returns the pending events in the order they are due to be delivered, starting with
+// those that have popped and are waiting to be received. The events are copied with the heap
+// locked, so the snapshot is consistent. Events created by AfterChan are not included.
+func (t *timerHeap) Snapshot() []ScheduledEvent {
+	items, popped := t.pendingItems()
+	events := make([]ScheduledEvent, len(items))
+	for i, ti := range items {
+		events[i] = ScheduledEvent{
+			Value:       ti.value,
+			ScheduledAt: ti.expire,
+			NotAfter:    ti.notAfter,
+			Priority:    ti.priority,
+			Tiebreak:    ti.tiebreak,
+			Topic:       ti.topic,
+			Metadata:    ti.metadata,
+			Popped:      i < popped,
+		}
+	}
+	return events
+}
+
+// pendingItems returns a copy of the pending items, other than those with their own delivery
+// function, in the order they are due to be delivered, along with the number of items at the
+// start that have popped.
+func (t *timerHeap) pendingItems() ([]timedItem, int) {
+	t.lock.Lock()
+	t.drainPushedLocked()
+	popped := len(t.ready)
+	items := t.valueHeap.appendTo(append([]timedItem(nil), t.ready...))
+	t.lock.Unlock()
+
+	// The ready items are already in the order they will be received.
+	sort.Slice(items[popped:], func(i, j int) bool {
+		return items[popped+i].before(&items[popped+j])
+	})
+	n, ready := 0, 0
+	for i, ti := range items {
+		if ti.deliver != nil {
+			continue
+		}
+		if i < popped {
+			ready++
+		}
+		items[n] = ti
+		n++
+	}
+	return items[:n], ready
+}
@@ -0,0 +1,35 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Snapshot", func() {
+	It("returns the pending events in delivery order", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		Expect(th.Snapshot()).To(BeEmpty())
+
+		now := time.Now()
+		md := timerheap.Metadata{"tenant": "a"}
+		Expect(th.PushEventAt(now.Add(2*time.Hour), 3, timerheap.WithTopic("t"))).To(Succeed())
+		Expect(th.PushEventWindow(now.Add(time.Hour), now.Add(3*time.Hour), 2, timerheap.WithMetadata(md))).To(Succeed())
+		Expect(th.PushEventAt(now.Add(-time.Second), 1)).To(Succeed())
+		th.AfterChan(time.Minute)
+		Eventually(func() bool {
+			s := th.Snapshot()
+			return len(s) > 0 && s[0].Popped
+		}, "1s").Should(BeTrue())
+
+		Expect(th.Snapshot()).To(Equal([]timerheap.ScheduledEvent{
+			{Value: 1, ScheduledAt: now.Add(-time.Second), Popped: true},
+			{Value: 2, ScheduledAt: now.Add(time.Hour), NotAfter: now.Add(3 * time.Hour), Metadata: md},
+			{Value: 3, ScheduledAt: now.Add(2 * time.Hour), Topic: "t"},
+		}))
+	})
+})
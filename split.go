@@ -0,0 +1,51 @@
+package timerheap
+
+// SplitWhere moves the pending events whose value match returns true for into a new heap,
+// created with the supplied options, and returns the new heap, so that a subset of the events
+// can be handed to another consumer. The events are moved at once, with the heap locked, and
+// keep their expiration times and handles. The match function is called with the heap locked,
+// so it must not call the heap.
+//
+// As with RemoveFunc, events that have popped but not been received, and those awaiting
+// acknowledgement, are not moved. No events are moved from a heap that has been terminated, or
+// that is durable, bolt-backed or clustered, since these hold their events outside the heap.
+func (t *timerHeap) SplitWhere(match func(value interface{}) bool, opts ...Option) TimerHeap {
+	n := New(opts...).(*timerHeap)
+	if t.persistent() {
+		return n
+	}
+
+	t.lock.Lock()
+	if t.terminated {
+		t.lock.Unlock()
+		return n
+	}
+	t.drainPushedLocked()
+	items := t.valueHeap.removeAll(func(ti *timedItem) bool {
+		return ti.deliver == nil && ti.attempt == 0 && match(ti.value)
+	}, nil)
+	if len(items) > 0 {
+		t.space.Broadcast()
+		t.wake()
+	}
+	// The events are pushed to the new heap before this one is unlocked, so that their handles
+	// are moved before they can be found missing from this heap. Nothing else can hold the lock
+	// of the new heap yet, so holding both cannot deadlock.
+	n.lock.Lock()
+	duplicates, trimmed := n.adoptLocked(items)
+	n.lock.Unlock()
+	t.lock.Unlock()
+	n.dropDuplicates(duplicates)
+	n.dropTrimmed(trimmed)
+
+	for _, ti := range items {
+		if ti.key != "" {
+			// The key is now held by the new heap.
+			t.dedup.release(ti.key)
+		}
+	}
+	if t.debug {
+		t.log.Debug("Split events into new heap", "count", len(items))
+	}
+	return n
+}
@@ -0,0 +1,96 @@
+package timerheap_test
+
+import (
+	"math/rand"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("SplitWhere", func() {
+	odd := func(v interface{}) bool {
+		i, ok := v.(int)
+		return ok && i%2 == 1
+	}
+	values := func(h timerheap.TimerHeap) []interface{} {
+		var vs []interface{}
+		for _, ev := range h.Snapshot() {
+			vs = append(vs, ev.Value)
+		}
+		return vs
+	}
+
+	DescribeTable("moves the matching events into a new heap",
+		func(b timerheap.BackendType) {
+			th := timerheap.New(timerheap.WithBackend(b))
+			defer th.Terminate()
+			start := time.Now().Add(50 * time.Millisecond)
+			for _, i := range rand.Perm(200) {
+				Expect(th.PushEventAt(start.Add(time.Duration(i)*time.Millisecond), i)).To(Succeed())
+			}
+
+			split := th.SplitWhere(odd)
+			defer split.Terminate()
+			Expect(th.Stats().Pending).To(Equal(100))
+			Expect(split.Stats().Pending).To(Equal(100))
+			for i := 0; i < 200; i++ {
+				h := th
+				if i%2 == 1 {
+					h = split
+				}
+				Eventually(h.TimedEvent(), "1s", "1ms").Should(Receive(Equal(i)))
+			}
+		},
+		Entry("binary heap", timerheap.BinaryHeap),
+		Entry("4-ary heap", timerheap.QuaternaryHeap),
+		Entry("pairing heap", timerheap.PairingHeap),
+		Entry("min-max heap", timerheap.MinMaxHeap),
+	)
+
+	It("keeps the order of events with the same expiration time", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		start := time.Now().Add(time.Hour)
+		for i := 9; i >= 0; i-- {
+			Expect(th.PushEventAt(start, i)).To(Succeed())
+		}
+		split := th.SplitWhere(odd)
+		defer split.Terminate()
+		Expect(values(th)).To(Equal([]interface{}{8, 6, 4, 2, 0}))
+		Expect(values(split)).To(Equal([]interface{}{9, 7, 5, 3, 1}))
+	})
+
+	It("creates the new heap with the options and moves handles and keys", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		h := &timerheap.Handle{}
+		Expect(th.PushEvent(10*time.Millisecond, 1, timerheap.WithHandle(h), timerheap.WithKey("a"))).To(Succeed())
+		Expect(th.PushEvent(20*time.Millisecond, 2)).To(Succeed())
+
+		split := th.SplitWhere(odd, timerheap.WithTimedResults())
+		defer split.Terminate()
+		var r interface{}
+		Eventually(split.TimedEvent(), "1s").Should(Receive(&r))
+		Expect(r).To(BeAssignableToTypeOf(timerheap.TimedResult{}))
+		Expect(r.(timerheap.TimedResult).Value).To(Equal(1))
+		Eventually(h.State, "1s").Should(Equal(timerheap.EventFired))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(2)))
+
+		Expect(th.PushEvent(0, 3, timerheap.WithKey("a"))).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(3)))
+	})
+
+	It("returns an empty heap when nothing matches", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		Expect(th.PushEvent(time.Hour, 2)).To(Succeed())
+		split := th.SplitWhere(odd)
+		defer split.Terminate()
+		Expect(split.Stats().Pending).To(BeZero())
+		Expect(th.Stats().Pending).To(Equal(1))
+	})
+})
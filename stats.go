@@ -0,0 +1,108 @@
+package timerheap
+
+import (
+	"time"
+)
+
+// Stats is a snapshot of the state of a TimerHeap, as returned by Stats().
+type Stats struct {
+	// The number of events that have been pushed but not yet delivered.
+	Pending int
+	// The total number of events pushed.
+	Pushed uint64
+	// The total number of events received from the results channel.
+	Delivered uint64
+	// The total number of events discarded because they could not be delivered before their
+	// not-after time.
+	Expired uint64
+	// The total number of events dropped because the heap was full.
+	Dropped uint64
+	// The number of times the slow consumer watchdog has tripped.
+	SlowConsumerTrips uint64
+	// The number of wall clock jumps detected, see WithClockJumpPolicy.
+	ClockJumps uint64
+	// The number of times the system resumed from a suspend, see WithSuspendPolicy.
+	Suspends uint64
+	// The number of panics recovered from callbacks, see WithPanicHandler.
+	Panics uint64
+	// The number of events pushed with a delay shorter than the minimum, which were delayed
+	// to the minimum, see WithMinDelay.
+	Clamped uint64
+	// The maximum lateness observed for a delivered event. This is measured from the
+	// scheduled time to the time the event was received from the results channel, so it
+	// includes any time spent waiting for the consumer.
+	MaxLateness time.Duration
+	// The lateness of the most recently delivered event, measured in the same way as
+	// MaxLateness.
+	LastLateness time.Duration
+	// The time the next event is scheduled to pop, or the zero time if there are no
+	// pending events.
+	NextFire time.Time
+	// How late events fired, if the heap was created with WithLatencyHistogram. The
+	// histograms of child heaps are only included if they have the same bounds.
+	Latency LatencyHistogram
+	// The data structure holding the pending events, as set with WithBackend or selected by
+	// WithAdaptiveBackend. This is the backend of the heap itself, not of any child heaps.
+	Backend BackendType
+}
+
+// Stats returns the stats of the heap, aggregated with the stats of any child heaps.
+func (t *timerHeap) Stats() Stats {
+	s, children := t.ownStats()
+	for _, c := range children {
+		s.add(c.Stats())
+	}
+	return s
+}
+
+// ownStats returns the stats of this heap excluding any children, and the current set of
+// children.
+func (t *timerHeap) ownStats() (Stats, []*timerHeap) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// Include any pushed items that have not yet been moved onto the heap.
+	t.drainPushedLocked()
+	s := Stats{
+		Pending:           t.pendingLocked(),
+		Pushed:            t.pushed,
+		Delivered:         t.deliveries,
+		Expired:           t.expired,
+		Dropped:           t.dropped,
+		SlowConsumerTrips: t.slowConsumer,
+		ClockJumps:        t.clockJumps,
+		Suspends:          t.suspends,
+		Panics:            t.panics,
+		Clamped:           t.clamped.Load(),
+		MaxLateness:       t.maxLateness,
+		LastLateness:      t.lastLateness,
+		Latency:           t.latency.snapshot(),
+		Backend:           t.backendType,
+	}
+	s.NextFire = t.nextFireLocked()
+	return s, t.childList()
+}
+
+// add aggregates the stats of a child heap into these stats. Counts are summed, and the
+// lateness and next fire time are taken from whichever heap is the latest or soonest. The
+// last lateness is not aggregated since the order of deliveries across heaps is not known, nor
+// is the backend.
+func (s *Stats) add(c Stats) {
+	s.Pending += c.Pending
+	s.Pushed += c.Pushed
+	s.Delivered += c.Delivered
+	s.Expired += c.Expired
+	s.Dropped += c.Dropped
+	s.SlowConsumerTrips += c.SlowConsumerTrips
+	s.ClockJumps += c.ClockJumps
+	s.Suspends += c.Suspends
+	s.Panics += c.Panics
+	s.Clamped += c.Clamped
+	if c.MaxLateness > s.MaxLateness {
+		s.MaxLateness = c.MaxLateness
+	}
+	s.Latency.add(c.Latency)
+	if !c.NextFire.IsZero() && (s.NextFire.IsZero() || c.NextFire.Before(s.NextFire)) {
+		s.NextFire = c.NextFire
+	}
+}
@@ -0,0 +1,51 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("timer heap stats tests", func() {
+
+	var th timerheap.TimerHeap
+
+	BeforeEach(func() {
+		th = timerheap.New()
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("has empty stats for a new heap", func() {
+		Expect(th.Stats()).To(Equal(timerheap.Stats{}))
+	})
+
+	It("tracks pushed, pending and delivered events", func() {
+		By("adding a past event and two future events")
+		now := time.Now()
+		th.PushEventAt(now.Add(-time.Second), 0)
+		th.PushEventAt(now.Add(time.Hour), 1)
+		th.PushEventAt(now.Add(2*time.Hour), 2)
+
+		By("Checking the stats before anything is received")
+		Eventually(func() time.Time { return th.Stats().NextFire }).Should(Equal(now.Add(-time.Second)))
+		s := th.Stats()
+		Expect(s.Pending).To(Equal(3))
+		Expect(s.Pushed).To(Equal(uint64(3)))
+		Expect(s.Delivered).To(BeZero())
+		Expect(s.MaxLateness).To(BeZero())
+
+		By("Receiving the past event and checking the stats")
+		Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive())
+		Eventually(func() uint64 { return th.Stats().Delivered }).Should(Equal(uint64(1)))
+		s = th.Stats()
+		Expect(s.Pending).To(Equal(2))
+		Expect(s.Pushed).To(Equal(uint64(3)))
+		Expect(s.MaxLateness).To(BeNumerically(">=", time.Second))
+		Expect(s.NextFire).To(Equal(now.Add(time.Hour)))
+	})
+})
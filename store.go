@@ -0,0 +1,190 @@
+package timerheap
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+)
+
+// Store holds the events of a heap outside of it, so that pending events survive a restart or
+// are shared between replicas, see NewWithStore. Stores are provided by the boltstore and
+// cluster packages.
+//
+// Every pushed event is put in the store, which decides whether the heap holds the event now.
+// Events that are not held are pushed to the heap by the store later, through the Loader it is
+// started with. Events are deleted from the store once they have been delivered, dropped or
+// discarded.
+type Store interface {
+	// Start is called once the heap is running, with the Loader the store pushes its events
+	// to the heap through. If it fails the heap is terminated, and the store is not closed.
+	Start(l Loader) error
+	// Put stores a pushed event, assigning its ID, and returns true if the heap should hold
+	// the event now. It fails with ErrTerminated once the store is closed, and with
+	// ErrDuplicateKey if the store claims the key of the event and it is already claimed, in
+	// which case the push is ignored.
+	Put(ev *StoredEvent) (bool, error)
+	// Delete removes an event that has completed at the time done.
+	Delete(ev StoredEvent, done time.Time) error
+	// Close stops the store pushing events to the heap, once the heap is terminated. Events
+	// that are still pending remain in the store.
+	Close() error
+}
+
+// StoredEvent is an event held in a Store.
+type StoredEvent struct {
+	// ID identifies the event in the store, and is assigned by Put.
+	ID uint64
+	// Expire is the time the event was stored to pop at, which orders the events in the store.
+	Expire time.Time
+	// Key is the idempotency key of the event, see WithKey. It is only set on the events passed
+	// to Put and Delete, the store finds the key of a loaded event with Loader.Key.
+	Key string
+	// Data is the event encoded with the TypeRegistry of the heap.
+	Data []byte
+}
+
+// Loader is the heap a Store has been started with.
+type Loader interface {
+	// Load pushes an event from the store to the heap. Its key must already have been claimed
+	// by the store. Events that cannot be decoded are reported and not pushed.
+	Load(ev StoredEvent)
+	// Discard removes the events loaded from the store from the heap without delivering them,
+	// releasing their keys, when the store is no longer responsible for delivering them. Events
+	// that have already popped are still delivered.
+	Discard()
+	// Key returns the idempotency key of an encoded event, or the empty string if it has none.
+	Key(data []byte) (string, error)
+	// ClaimKey claims the key of an event, returning false if an event with the key is pending
+	// or completed recently, see WithKey.
+	ClaimKey(key string) bool
+	// ReleaseKey releases a claimed key that was not used.
+	ReleaseKey(key string)
+	// RememberKey records a key that was claimed by an event that completed at the time done.
+	RememberKey(key string, done time.Time)
+	// KeyRetention returns how long the keys of completed events are remembered, see
+	// WithDedupRetention.
+	KeyRetention() time.Duration
+	// Logger returns the logger of the heap.
+	Logger() Logger
+	// Fault logs and reports a failure of the store, see FaultPersistence.
+	Fault(detail string, err error)
+}
+
+// NewWithStore creates a heap that holds its events in the store. The heap must be configured
+// with a TypeRegistry, which is used to encode and decode the values, see Save.
+//
+// Events pending when the heap is terminated remain in the store, and are not sent to the dead
+// letter channel unless the heap held them. Stats, Idle, Flush, Save and MarshalJSON only cover
+// the events held by the heap, as does the limit set with WithMaxPending. Handles cannot be
+// used, and pushes with one fail with ErrHandleUnsupported.
+//
+// If an error is returned the store has not been started, and the caller should close it.
+func NewWithStore(s Store, opts ...Option) (TimerHeap, error) {
+	t := newTimerHeap()
+	t.configure(opts)
+	if t.types == nil {
+		t.launch()
+		t.Terminate()
+		return nil, ErrNoTypeRegistry
+	}
+	t.store = s
+	t.launch()
+	if err := s.Start(storeLoader{t}); err != nil {
+		// The store was not started, so it is not closed on terminating.
+		t.store = nil
+		t.Terminate()
+		return nil, err
+	}
+	return t, nil
+}
+
+// storeLoader is the Loader of a heap.
+type storeLoader struct {
+	t *timerHeap
+}
+
+func (l storeLoader) Load(ev StoredEvent) {
+	t := l.t
+	ti, err := t.types.unmarshal(ev.Data)
+	if err != nil {
+		t.log.Warn("Failed to load stored event", "id", ev.ID, "error", err)
+		t.fault(FaultPersistence, "failed to load stored event", err)
+		return
+	}
+	ti.stored, ti.storedExpire = ev.ID, ev.Expire
+	if err := t.restore(ti); err != nil {
+		t.log.Warn("Failed to push stored event", "id", ev.ID, "error", err)
+		t.fault(FaultPersistence, "failed to push stored event", err)
+	}
+}
+
+func (l storeLoader) Discard() {
+	t := l.t
+	t.lock.Lock()
+	t.drainPushedLocked()
+	for t.valueHeap.Len() > 0 {
+		if ti := t.valueHeap.pop(); ti.key != "" {
+			t.dedup.release(ti.key)
+		}
+	}
+	t.space.Broadcast()
+	t.wake()
+	t.lock.Unlock()
+}
+
+func (l storeLoader) Key(data []byte) (string, error) {
+	var ev savedEvent
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&ev); err != nil {
+		return "", err
+	}
+	return ev.Key, nil
+}
+
+func (l storeLoader) ClaimKey(key string) bool {
+	return l.t.dedup.claim(key)
+}
+
+func (l storeLoader) ReleaseKey(key string) {
+	l.t.dedup.release(key)
+}
+
+func (l storeLoader) RememberKey(key string, done time.Time) {
+	l.t.dedup.remember(key, done)
+}
+
+func (l storeLoader) KeyRetention() time.Duration {
+	return l.t.dedup.retention
+}
+
+func (l storeLoader) Logger() Logger {
+	return l.t.log
+}
+
+func (l storeLoader) Fault(detail string, err error) {
+	l.t.log.Warn("Event store failed", "detail", detail, "error", err)
+	l.t.fault(FaultPersistence, detail, err)
+}
+
+// putStored puts a pushed item in the store, returning true if the heap should hold it now.
+func (t *timerHeap) putStored(ti *timedItem) (bool, error) {
+	value, err := t.types.marshal(*ti)
+	if err != nil {
+		return false, err
+	}
+	ev := &StoredEvent{Expire: ti.expire, Key: ti.key, Data: value}
+	hold, err := t.store.Put(ev)
+	if err != nil {
+		return false, err
+	}
+	ti.stored, ti.storedExpire = ev.ID, ev.Expire
+	return hold, nil
+}
+
+// deleteStored deletes a completed item from the store.
+func (t *timerHeap) deleteStored(ti timedItem, done time.Time) {
+	ev := StoredEvent{ID: ti.stored, Expire: ti.storedExpire, Key: ti.key}
+	if err := t.store.Delete(ev, done); err != nil {
+		t.log.Warn("Failed to delete stored event", "id", ti.stored, "error", err)
+		t.fault(FaultPersistence, "failed to delete stored event", err)
+	}
+}
@@ -0,0 +1,72 @@
+package timerheap
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// memStore is a Store that holds every event, recording the events that have not been deleted
+// by their id and the expiration they were put with.
+type memStore struct {
+	lock   sync.Mutex
+	nextID uint64
+	events map[uint64]time.Time
+}
+
+func (s *memStore) Start(l Loader) error {
+	return nil
+}
+
+func (s *memStore) Put(ev *StoredEvent) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.nextID++
+	ev.ID = s.nextID
+	s.events[ev.ID] = ev.Expire
+	return true, nil
+}
+
+func (s *memStore) Delete(ev StoredEvent, done time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if expire, ok := s.events[ev.ID]; ok && expire.Equal(ev.Expire) {
+		delete(s.events, ev.ID)
+	}
+	return nil
+}
+
+func (s *memStore) Close() error {
+	return nil
+}
+
+// stored returns the number of events in the store.
+func (s *memStore) stored() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.events)
+}
+
+// newMemStoreHeap creates a heap holding its int events in a memStore.
+func newMemStoreHeap(opts ...Option) (*timerHeap, *memStore) {
+	registry := NewTypeRegistry()
+	ExpectWithOffset(1, registry.Register("int", 0, nil)).To(Succeed())
+	s := &memStore{events: map[uint64]time.Time{}}
+	th, err := NewWithStore(s, append(opts, WithTypeRegistry(registry, true))...)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	return th.(*timerHeap), s
+}
+
+var _ = Describe("Stores", func() {
+	It("deletes the events that are delivered", func() {
+		th, s := newMemStoreHeap()
+		defer th.Terminate()
+		Expect(th.PushEvent(10*time.Millisecond, 1)).To(Succeed())
+		Expect(th.PushEvent(time.Hour, 2)).To(Succeed())
+		Expect(s.stored()).To(Equal(2))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		Eventually(s.stored).Should(Equal(1))
+	})
+})
@@ -0,0 +1,64 @@
+package timerheap_test
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("WithStrictDeadlines", func() {
+	var th timerheap.TimerHeap
+
+	BeforeEach(func() {
+		th = timerheap.New(timerheap.WithStrictDeadlines())
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("rejects events that are already due", func() {
+		Expect(th.PushEvent(0, "zero")).To(MatchError(timerheap.ErrPastDeadline))
+		Expect(th.PushEvent(-time.Second, "negative")).To(MatchError(timerheap.ErrPastDeadline))
+		Expect(th.PushEventAt(time.Now().Add(-time.Minute), "past")).To(MatchError(timerheap.ErrPastDeadline))
+		Expect(th.PushEventWindow(time.Now().Add(-time.Minute), time.Now().Add(time.Minute), "window")).To(MatchError(timerheap.ErrPastDeadline))
+		Expect(th.Stats().Pending).To(BeZero())
+	})
+
+	It("accepts events in the future", func() {
+		Expect(th.PushEvent(time.Millisecond, "a")).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("a")))
+	})
+
+	It("drops the handle and releases the key of a rejected event", func() {
+		h := &timerheap.Handle{}
+		Expect(th.PushEvent(0, "a", timerheap.WithHandle(h), timerheap.WithKey("k"))).To(MatchError(timerheap.ErrPastDeadline))
+		Expect(h.State()).To(Equal(timerheap.EventDropped))
+		Expect(th.PushEvent(time.Millisecond, "b", timerheap.WithKey("k"))).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("b")))
+	})
+
+	It("does not reject AfterChan timers", func() {
+		Eventually(th.AfterChan(0), "1s").Should(BeClosed())
+	})
+
+	It("restores overdue events", func() {
+		registry := timerheap.NewTypeRegistry()
+		Expect(registry.Register("id", "", nil)).To(Succeed())
+		saved := timerheap.New(timerheap.WithTypeRegistry(registry, false))
+		defer saved.Terminate()
+		Expect(saved.PushEvent(20*time.Millisecond, "overdue")).To(Succeed())
+		var buf bytes.Buffer
+		Expect(saved.Save(&buf)).To(Succeed())
+		time.Sleep(30 * time.Millisecond)
+
+		restored := timerheap.New(timerheap.WithTypeRegistry(registry, false), timerheap.WithStrictDeadlines())
+		defer restored.Terminate()
+		Expect(restored.Load(&buf)).To(Succeed())
+		Eventually(restored.TimedEvent(), "1s").Should(Receive(Equal("overdue")))
+	})
+})
@@ -0,0 +1,196 @@
+package timerheap
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Subscription receives a copy of every event fired by a TimerHeap. Subscriptions are created
+// with Subscribe or SubscribeFrom.
+type Subscription struct {
+	t *timerHeap
+	f feed
+	// offset is the offset in the fired log of the last event received, see Offset.
+	offset atomic.Uint64
+}
+
+// feed sends the events fired by the heap to a subscriber. It is a queue, or a logReader if the
+// heap has a fired log.
+type feed interface {
+	// add sends the event to the subscriber. Events added after the feed is closed or
+	// stopped are discarded.
+	add(v interface{})
+	// close closes the events channel once the events already added have been sent.
+	close()
+	// stop closes the events channel without sending any more events.
+	stop()
+	droppedCount() uint64
+	events() <-chan interface{}
+}
+
+// Subscribe adds a subscriber that receives a copy of every event fired by the heap. While
+// there are subscribers, fired events are sent to the subscribers instead of the TimedEvent
+// channel.
+//
+// Each subscriber has its own buffer so that a slow subscriber does not delay the heap or
+// the other subscribers. If buffer is greater than 0, the subscriber buffers at most that
+// many events in addition to the one currently offered on the subscription channel, and the
+// oldest buffered event is dropped to make room for a new one. If buffer is 0 the buffer is
+// unbounded. If the heap has a fired log, see WithFiredLog, buffer is ignored and the
+// subscriber reads the events from the log instead, so no event is dropped unless the
+// subscriber falls behind the retention period, in which case the subscription channel is
+// closed.
+//
+// The subscription channel is closed when the subscriber unsubscribes, or once all buffered
+// events have been received after the heap is terminated.
+func (t *timerHeap) Subscribe(buffer int) *Subscription {
+	s, _ := t.subscribe(buffer, nil)
+	return s
+}
+
+// SubscribeFrom adds a subscriber that resumes from the offset in the fired log of a heap
+// created with WithFiredLog, typically the Offset of an earlier subscription. The subscriber
+// first receives the retained events after the offset, and then every event fired by the heap
+// in the same way as for Subscribe. An offset of 0 resumes from the first event fired by the
+// heap.
+//
+// If some of the events after the offset are no longer retained, the offset is beyond the last
+// fired event, or the heap has no fired log, SubscribeFrom returns ErrOffsetUnavailable.
+func (t *timerHeap) SubscribeFrom(offset uint64, buffer int) (*Subscription, error) {
+	if t.firedLog == nil {
+		return nil, ErrOffsetUnavailable
+	}
+	return t.subscribe(buffer, &offset)
+}
+
+// subscribe adds a subscriber, which first receives the logged events after the offset if
+// there is one.
+func (t *timerHeap) subscribe(buffer int, from *uint64) (*Subscription, error) {
+	s := &Subscription{t: t}
+	if l := t.firedLog; l != nil {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		if from == nil {
+			s.offset.Store(l.next - 1)
+		} else {
+			if err := l.availableLocked(*from); err != nil {
+				return nil, err
+			}
+			s.offset.Store(*from)
+		}
+		s.f = newLogReader(l, &s.offset)
+	} else {
+		s.f = newQueue[interface{}](buffer)
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.terminated {
+		s.f.close()
+		return s, nil
+	}
+	t.subscribers = append(t.subscribers, s)
+
+	// Wake the event goroutine, an event waiting on the results channel can now be sent to
+	// the subscribers.
+	t.wake()
+	return s, nil
+}
+
+// Events returns the channel the subscriber receives events on.
+func (s *Subscription) Events() <-chan interface{} {
+	return s.f.events()
+}
+
+// Offset returns the offset in the fired log of the last event received from the subscription
+// channel, or the offset the subscription started from if none has been received, see
+// WithFiredLog. A later subscription resuming from this offset with SubscribeFrom receives the
+// events this subscriber has not. The offset only advances over events that were received, so
+// it stays at the last event received if the subscriber falls behind the retention period. It
+// is updated just after each event is received, so an event received immediately before
+// calling Offset may be received again when resuming, use the Offset of the FiredEvent to avoid
+// this. It is 0 if the heap has no fired log.
+func (s *Subscription) Offset() uint64 {
+	return s.offset.Load()
+}
+
+// Dropped returns the number of events dropped because the subscriber buffer was full, or if the
+// heap has a fired log, the number of events that were no longer retained by the time the
+// subscriber reached them.
+func (s *Subscription) Dropped() uint64 {
+	return s.f.droppedCount()
+}
+
+// Unsubscribe removes the subscriber from the heap. Any buffered events are discarded and the
+// subscription channel is closed.
+func (s *Subscription) Unsubscribe() {
+	t := s.t
+	if l := t.firedLog; l != nil {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+	}
+	t.lock.Lock()
+	for i, sub := range t.subscribers {
+		if sub == s {
+			t.subscribers = append(t.subscribers[:i], t.subscribers[i+1:]...)
+			break
+		}
+	}
+	t.lock.Unlock()
+	s.f.stop()
+}
+
+// fansOutLocked returns true if fired events are sent to the subscribers rather than the
+// results channel, because there are subscribers or the heap has a fired log. The caller must
+// hold the lock.
+func (t *timerHeap) fansOutLocked() bool {
+	return len(t.subscribers) > 0 || t.firedLog != nil
+}
+
+// takeFanoutLocked removes all items from the ready queue if they are sent to the subscribers,
+// appending them to fanout and the current subscribers to subscribers. The caller must hold the
+// lock.
+func (t *timerHeap) takeFanoutLocked(fanout []timedItem, subscribers []*Subscription) ([]timedItem, []*Subscription) {
+	if !t.fansOutLocked() || len(t.ready) == 0 {
+		return fanout, subscribers
+	}
+	fanout = append(fanout, t.ready...)
+	for i := range t.ready {
+		t.ready[i] = timedItem{}
+	}
+	t.ready = t.ready[:0]
+	return fanout, append(subscribers, t.subscribers...)
+}
+
+// fanOut sends a copy of the item to each subscriber. If the heap has a fired log, the item is
+// recorded in the log and sent to the subscribers at the time it is recorded instead.
+func (t *timerHeap) fanOut(ti timedItem, subscribers []*Subscription) {
+	if v, ok := t.handle(ti); ok {
+		if l := t.firedLog; l != nil {
+			l.lock.Lock()
+			v = l.appendLocked(v, time.Now())
+			for _, s := range t.subscribers {
+				s.f.add(v)
+			}
+			l.lock.Unlock()
+		} else {
+			for _, s := range subscribers {
+				s.f.add(v)
+			}
+		}
+	}
+	t.recordDelivery(ti)
+}
+
+// takeSubscribers removes and returns all of the subscribers.
+func (t *timerHeap) takeSubscribers() []*Subscription {
+	if l := t.firedLog; l != nil {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	subscribers := t.subscribers
+	t.subscribers = nil
+	return subscribers
+}
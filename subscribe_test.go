@@ -0,0 +1,196 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("timer heap subscription tests", func() {
+
+	var th timerheap.TimerHeap
+
+	BeforeEach(func() {
+		th = timerheap.New()
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("sends a copy of each event to every subscriber", func() {
+		s1 := th.Subscribe(0)
+		s2 := th.Subscribe(0)
+
+		By("adding a set of events")
+		for i := 0; i < 10; i++ {
+			Expect(th.PushEvent(time.Duration(i)*10*time.Millisecond, i)).To(Succeed())
+		}
+
+		By("Checking both subscribers receive every event in order")
+		for i := 0; i < 10; i++ {
+			Eventually(s1.Events(), "1s", "10ms").Should(Receive(Equal(i)))
+		}
+		for i := 0; i < 10; i++ {
+			Eventually(s2.Events(), "1s", "10ms").Should(Receive(Equal(i)))
+		}
+		Expect(th.TimedEvent()).NotTo(Receive())
+		Expect(th.Stats().Delivered).To(Equal(uint64(10)))
+	})
+
+	It("drops the oldest events for a subscriber with a full buffer", func() {
+		s1 := th.Subscribe(2)
+		s2 := th.Subscribe(0)
+
+		By("adding a set of events and waiting for the unbounded subscriber to get them")
+		for i := 0; i < 5; i++ {
+			Expect(th.PushEvent(0, i)).To(Succeed())
+		}
+		for i := 0; i < 5; i++ {
+			Eventually(s2.Events(), "1s", "10ms").Should(Receive(Equal(i)))
+		}
+
+		By("Checking the bounded subscriber only has the last events")
+		var values []interface{}
+		var value interface{}
+		for len(values) == 0 || values[len(values)-1] != 4 {
+			Eventually(s1.Events(), "1s", "10ms").Should(Receive(&value))
+			values = append(values, value)
+		}
+		Expect(len(values)).To(BeNumerically("<=", 3))
+		Expect(uint64(len(values)) + s1.Dropped()).To(Equal(uint64(5)))
+	})
+
+	It("reverts to the results channel once all subscribers have unsubscribed", func() {
+		s := th.Subscribe(0)
+		Expect(th.PushEvent(0, 1)).To(Succeed())
+		Eventually(s.Events(), "1s", "10ms").Should(Receive(Equal(1)))
+
+		By("Unsubscribing and checking the subscription channel is closed")
+		s.Unsubscribe()
+		Eventually(s.Events()).Should(BeClosed())
+
+		By("Checking events are delivered on the results channel")
+		Expect(th.PushEvent(0, 2)).To(Succeed())
+		Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(Equal(2)))
+	})
+
+	It("hands an event waiting on the results channel to a new subscriber", func() {
+		Expect(th.PushEvent(0, 1)).To(Succeed())
+		time.Sleep(100 * time.Millisecond)
+		s := th.Subscribe(0)
+		Eventually(s.Events(), "1s", "10ms").Should(Receive(Equal(1)))
+	})
+
+	It("closes subscription channels once drained after termination", func() {
+		s := th.Subscribe(0)
+		Expect(th.PushEvent(0, 1)).To(Succeed())
+		Eventually(func() uint64 { return th.Stats().Delivered }).Should(Equal(uint64(1)))
+		th.Terminate()
+		Eventually(s.Events(), "1s", "10ms").Should(Receive(Equal(1)))
+		Eventually(s.Events()).Should(BeClosed())
+	})
+
+	Context("with a fired log", func() {
+		BeforeEach(func() {
+			th.Terminate()
+			th = timerheap.New(timerheap.WithFiredLog(time.Minute))
+		})
+
+		It("resumes a subscription from its offset", func() {
+			s1 := th.Subscribe(0)
+			Expect(th.PushEvent(0, 0)).To(Succeed())
+			Eventually(s1.Events(), "1s", "10ms").Should(Receive(Equal(timerheap.FiredEvent{Offset: 1, Value: 0})))
+			Eventually(s1.Offset).Should(Equal(uint64(1)))
+			s1.Unsubscribe()
+
+			By("Firing events while there are no subscribers")
+			for i := 1; i < 4; i++ {
+				Expect(th.PushEvent(0, i)).To(Succeed())
+			}
+			Eventually(func() uint64 { return th.Stats().Delivered }).Should(Equal(uint64(4)))
+			Expect(th.TimedEvent()).NotTo(Receive())
+
+			By("Resuming and checking the missed events are received before new ones")
+			s2, err := th.SubscribeFrom(s1.Offset(), 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(th.PushEvent(0, 4)).To(Succeed())
+			for i := 1; i < 5; i++ {
+				Eventually(s2.Events(), "1s", "10ms").Should(Receive(Equal(timerheap.FiredEvent{Offset: uint64(i + 1), Value: i})))
+			}
+			Eventually(s2.Offset).Should(Equal(uint64(5)))
+		})
+
+		It("starts new subscriptions at the latest offset", func() {
+			Expect(th.PushEvent(0, 0)).To(Succeed())
+			Eventually(func() uint64 { return th.Stats().Delivered }).Should(Equal(uint64(1)))
+			s := th.Subscribe(0)
+			Expect(s.Offset()).To(Equal(uint64(1)))
+			Expect(th.PushEvent(0, 1)).To(Succeed())
+			Eventually(s.Events(), "1s", "10ms").Should(Receive(Equal(timerheap.FiredEvent{Offset: 2, Value: 1})))
+		})
+
+		It("rejects offsets that are not retained", func() {
+			th.Terminate()
+			th = timerheap.New(timerheap.WithFiredLog(50 * time.Millisecond))
+			Expect(th.PushEvent(0, 0)).To(Succeed())
+			Eventually(func() uint64 { return th.Stats().Delivered }).Should(Equal(uint64(1)))
+			time.Sleep(100 * time.Millisecond)
+			Expect(th.PushEvent(0, 1)).To(Succeed())
+			Eventually(func() uint64 { return th.Stats().Delivered }).Should(Equal(uint64(2)))
+
+			_, err := th.SubscribeFrom(0, 0)
+			Expect(err).To(MatchError(timerheap.ErrOffsetUnavailable))
+			_, err = th.SubscribeFrom(3, 0)
+			Expect(err).To(MatchError(timerheap.ErrOffsetUnavailable))
+			s, err := th.SubscribeFrom(1, 0)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(s.Events(), "1s", "10ms").Should(Receive(Equal(timerheap.FiredEvent{Offset: 2, Value: 1})))
+		})
+
+		It("replays more events than the subscriber buffer holds", func() {
+			for i := 0; i < 10; i++ {
+				Expect(th.PushEvent(0, i)).To(Succeed())
+			}
+			Eventually(func() uint64 { return th.Stats().Delivered }).Should(Equal(uint64(10)))
+
+			s, err := th.SubscribeFrom(0, 1)
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < 10; i++ {
+				Eventually(s.Events(), "1s", "10ms").Should(Receive(Equal(timerheap.FiredEvent{Offset: uint64(i + 1), Value: i})))
+			}
+			Expect(s.Dropped()).To(BeZero())
+		})
+
+		It("does not advance the offset past events the subscriber missed", func() {
+			th.Terminate()
+			th = timerheap.New(timerheap.WithFiredLog(50 * time.Millisecond))
+			s := th.Subscribe(1)
+			for i := 0; i < 3; i++ {
+				Expect(th.PushEvent(0, i)).To(Succeed())
+			}
+			Eventually(s.Events(), "1s", "10ms").Should(Receive(Equal(timerheap.FiredEvent{Offset: 1, Value: 0})))
+			Eventually(func() uint64 { return th.Stats().Delivered }).Should(Equal(uint64(3)))
+
+			By("Falling behind the retention period")
+			time.Sleep(100 * time.Millisecond)
+			Expect(th.PushEvent(0, 3)).To(Succeed())
+			Eventually(func() uint64 { return th.Stats().Delivered }).Should(Equal(uint64(4)))
+			// The event offered on the subscription channel was retained when it was read from
+			// the log, and is still received.
+			Eventually(s.Events(), "1s", "10ms").Should(Receive(Equal(timerheap.FiredEvent{Offset: 2, Value: 1})))
+			Eventually(s.Events(), "1s", "10ms").Should(BeClosed())
+			Expect(s.Dropped()).To(Equal(uint64(1)))
+			Expect(s.Offset()).To(Equal(uint64(2)))
+			_, err := th.SubscribeFrom(s.Offset(), 0)
+			Expect(err).To(MatchError(timerheap.ErrOffsetUnavailable))
+		})
+	})
+
+	It("does not resume subscriptions without a fired log", func() {
+		_, err := th.SubscribeFrom(0, 0)
+		Expect(err).To(MatchError(timerheap.ErrOffsetUnavailable))
+	})
+})
@@ -0,0 +1,70 @@
+package timerheap
+
+import (
+	"time"
+)
+
+// SuspendPolicy determines how a heap handles the events that were due while the system was
+// suspended, see WithSuspendPolicy.
+type SuspendPolicy int
+
+const (
+	// SuspendIgnore handles a suspend as the wall clock jumping forward, according to the
+	// clock jump policy. This is the default.
+	SuspendIgnore SuspendPolicy = iota
+	// SuspendFireMissed pops the events that were due while the system was suspended as soon
+	// as it resumes, in the order they were due.
+	SuspendFireMissed
+	// SuspendRespace pops the events that were due while the system was suspended in the order
+	// they were due, spaced apart by the interval set with WithSuspendPolicy, starting as soon
+	// as the system resumes. This avoids a burst of events after a long suspend.
+	SuspendRespace
+)
+
+func (p SuspendPolicy) String() string {
+	switch p {
+	case SuspendIgnore:
+		return "ignore"
+	case SuspendFireMissed:
+		return "fire missed"
+	case SuspendRespace:
+		return "respace"
+	default:
+		return "unknown"
+	}
+}
+
+// minSuspend is the shortest suspend that is handled according to the suspend policy.
+const minSuspend = time.Second
+
+// WithSuspendPolicy sets how the heap handles the events that were due while the system was
+// suspended, for example a laptop sleeping. The spacing is the interval between the missed events
+// with SuspendRespace. Events that were not due by the time the system resumed pop at their
+// wall clock time, and suspends are logged.
+//
+// The monotonic clock the time package uses does not advance while the system is suspended, so
+// without a policy, events pushed with a duration pop late by the time spent suspended while
+// events pushed at a wall clock time do not. On Linux a suspend is detected by comparing the
+// monotonic clock with the time since boot, on other platforms the wall clock jumping forward is
+// handled as a suspend.
+func WithSuspendPolicy(policy SuspendPolicy, spacing time.Duration) Option {
+	return func(t *timerHeap) {
+		t.suspendPolicy = policy
+		t.suspendSpacing = spacing
+	}
+}
+
+// respaceLocked reschedules the events that are due, so that they pop in the order they were due
+// spaced apart by the suspend spacing, starting now. The caller must hold the lock.
+func (t *timerHeap) respaceLocked(now time.Time) {
+	var missed []timedItem
+	for next := t.valueHeap.peek(); next != nil && !next.expire.After(now); next = t.valueHeap.peek() {
+		missed = append(missed, t.valueHeap.pop())
+	}
+	at := now.Round(0)
+	for _, ti := range missed {
+		ti.shift(at.Sub(ti.expire))
+		t.valueHeap.push(ti)
+		at = at.Add(t.suspendSpacing)
+	}
+}
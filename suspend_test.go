@@ -0,0 +1,93 @@
+package timerheap
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Suspend", func() {
+	// simulateSuspend makes the heap see the system as having been suspended for d the next
+	// time it checks the clock, with the pending events as they would be had d passed.
+	simulateSuspend := func(t *timerHeap, d time.Duration) {
+		Eventually(func() bool {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+			return !t.clock.mono.IsZero()
+		}).Should(BeTrue())
+		t.lock.Lock()
+		t.drainPushedLocked()
+		t.valueHeap.shift(-d)
+		t.clock.wall = t.clock.wall.Add(-d)
+		t.clock.boot -= d
+		t.lock.Unlock()
+		t.wake()
+	}
+
+	It("fires the missed events in order", func() {
+		th := New(
+			WithSuspendPolicy(SuspendFireMissed, 0),
+			WithClockJumpPolicy(ClockJumpHoldDurations, time.Second),
+		)
+		defer th.Terminate()
+		Expect(th.PushEvent(time.Hour, 1)).To(Succeed())
+		Expect(th.PushEvent(3*time.Hour, 3)).To(Succeed())
+		Expect(th.PushEvent(time.Hour+time.Minute, 2)).To(Succeed())
+
+		simulateSuspend(th.(*timerHeap), 2*time.Hour)
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(2)))
+		Consistently(th.TimedEvent(), "100ms").ShouldNot(Receive())
+
+		stats := th.Stats()
+		Expect(stats.Suspends).To(Equal(uint64(1)))
+		Expect(stats.ClockJumps).To(BeZero())
+		Expect(stats.NextFire.Sub(time.Now())).To(BeNumerically("~", time.Hour, time.Second))
+	})
+
+	It("respaces the missed events", func() {
+		th := New(WithSuspendPolicy(SuspendRespace, 100*time.Millisecond), WithTimedResults())
+		defer th.Terminate()
+		for i := 0; i < 3; i++ {
+			Expect(th.PushEvent(time.Hour+time.Duration(i)*time.Millisecond, i)).To(Succeed())
+		}
+
+		simulateSuspend(th.(*timerHeap), 2*time.Hour)
+		var first TimedResult
+		Eventually(th.TimedEvent(), "1s").Should(Receive(&first))
+		Expect(first.Value).To(Equal(0))
+		for i := 1; i < 3; i++ {
+			var r TimedResult
+			Eventually(th.TimedEvent(), "1s").Should(Receive(&r))
+			Expect(r.Value).To(Equal(i))
+			Expect(r.FiredAt.Sub(first.FiredAt)).To(BeNumerically(">=", time.Duration(i)*100*time.Millisecond))
+		}
+	})
+
+	It("deletes the stored events it has respaced", func() {
+		th, s := newMemStoreHeap(WithSuspendPolicy(SuspendRespace, 10*time.Millisecond))
+		defer th.Terminate()
+		Expect(th.PushEvent(time.Hour, 1)).To(Succeed())
+		Expect(th.PushEvent(time.Hour, 2)).To(Succeed())
+
+		simulateSuspend(th, 2*time.Hour)
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(2)))
+		Eventually(s.stored).Should(BeZero())
+	})
+
+	It("ignores suspends without a policy", func() {
+		th := New(WithClockJumpPolicy(ClockJumpHoldDurations, time.Second))
+		defer th.Terminate()
+		Expect(th.PushEvent(time.Hour, 1)).To(Succeed())
+		Expect(th.PushEvent(3*time.Hour, 2)).To(Succeed())
+
+		// The suspend is handled as a jump, so the events are shifted to hold their durations.
+		simulateSuspend(th.(*timerHeap), 2*time.Hour)
+		Consistently(th.TimedEvent(), "100ms").ShouldNot(Receive())
+		stats := th.Stats()
+		Expect(stats.Suspends).To(BeZero())
+		Expect(stats.ClockJumps).To(Equal(uint64(1)))
+	})
+})
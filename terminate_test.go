@@ -0,0 +1,222 @@
+package timerheap_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Terminate", func() {
+	DescribeTable("closes the results channel so that consumers can range over it",
+		func(newHeap func() (timerheap.TimerHeap, func())) {
+			th, cleanup := newHeap()
+			defer cleanup()
+
+			received := make(chan int, 100)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for v := range th.TimedEvent() {
+					received <- v.(int)
+				}
+			}()
+
+			for i := 0; i < 10; i++ {
+				Expect(th.PushEvent(time.Duration(i)*time.Millisecond, i)).To(Succeed())
+			}
+			Expect(th.PushEvent(time.Hour, 10)).To(Succeed())
+			Eventually(received, "1s").Should(HaveLen(10))
+			th.Terminate()
+			Eventually(done, "1s").Should(BeClosed())
+			Expect(received).To(HaveLen(10))
+		},
+		Entry("event goroutine", func() (timerheap.TimerHeap, func()) {
+			return timerheap.New(), func() {}
+		}),
+		Entry("dispatcher", func() (timerheap.TimerHeap, func()) {
+			d := timerheap.NewDispatcher()
+			return timerheap.New(timerheap.WithDispatcher(d)), d.Terminate
+		}),
+	)
+
+	It("does not send on the results channel while terminating", func() {
+		// Each heap has events popping as it is terminated, so that the event goroutine is
+		// delivering when it is told to stop.
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			th := timerheap.New(timerheap.WithNonBlockingDelivery(0))
+			for j := 0; j < 100; j++ {
+				Expect(th.PushEvent(time.Duration(j)*10*time.Microsecond, j)).To(Succeed())
+			}
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for range th.TimedEvent() {
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				time.Sleep(500 * time.Microsecond)
+				th.Terminate()
+			}()
+		}
+		wg.Wait()
+	})
+
+	DescribeTable("accounts for every push that races with termination",
+		func(opts ...timerheap.Option) {
+			for round := 0; round < 20; round++ {
+				th := timerheap.New(append(opts, timerheap.WithDeadLetters())...)
+				var pushed, failed, deadLettered int64
+				var lock sync.Mutex
+				var wg sync.WaitGroup
+				for p := 0; p < 8; p++ {
+					wg.Add(1)
+					go func() {
+						defer GinkgoRecover()
+						defer wg.Done()
+						for i := 0; i < 200; i++ {
+							err := th.PushEvent(time.Hour, i)
+							lock.Lock()
+							if err == nil {
+								pushed++
+							} else {
+								Expect(err).To(MatchError(timerheap.ErrTerminated))
+								failed++
+							}
+							lock.Unlock()
+						}
+					}()
+				}
+				time.Sleep(time.Duration(round*50) * time.Microsecond)
+				th.Terminate()
+				wg.Wait()
+				for range th.DeadLetters() {
+					deadLettered++
+				}
+				Expect(pushed + failed).To(Equal(int64(8 * 200)))
+				Expect(deadLettered).To(Equal(pushed))
+				Expect(th.PushEvent(0, "late")).To(MatchError(timerheap.ErrTerminated))
+			}
+		},
+		Entry("intake queue"),
+		Entry("shards", timerheap.WithShards(4)),
+		Entry("limited heap", timerheap.WithMaxPending(1000), timerheap.WithOverflowPolicy(timerheap.OverflowBlock)),
+		Entry("dispatcher", timerheap.WithDispatcher(timerheap.NewDispatcher())),
+	)
+})
+
+var _ = Describe("TerminateContext", func() {
+	deadLetters := func(th timerheap.TimerHeap) []interface{} {
+		var values []interface{}
+		for dl := range th.DeadLetters() {
+			values = append(values, dl.Value)
+		}
+		return values
+	}
+
+	It("delivers the expired events before terminating", func() {
+		th := timerheap.New(timerheap.WithDeadLetters())
+		for i := 0; i < 10; i++ {
+			Expect(th.PushEvent(0, i)).To(Succeed())
+		}
+		Expect(th.PushEvent(time.Hour, "later")).To(Succeed())
+
+		var received []interface{}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for v := range th.TimedEvent() {
+				time.Sleep(time.Millisecond)
+				received = append(received, v)
+			}
+		}()
+		Expect(th.TerminateContext(context.Background())).To(Succeed())
+		Eventually(done, "1s").Should(BeClosed())
+		Expect(received).To(HaveLen(10))
+		Expect(deadLetters(th)).To(Equal([]interface{}{"later"}))
+	})
+
+	It("gives up on a consumer that is not receiving", func() {
+		th := timerheap.New(timerheap.WithDeadLetters())
+		Expect(th.PushEvent(0, "stuck")).To(Succeed())
+		start := time.Now()
+		Expect(th.TerminateTimeout(50 * time.Millisecond)).To(MatchError(context.DeadlineExceeded))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(deadLetters(th)).To(Equal([]interface{}{"stuck"}))
+	})
+
+	It("rejects pushes while draining", func() {
+		th := timerheap.New()
+		Expect(th.PushEvent(0, "stuck")).To(Succeed())
+		ctx, cancel := context.WithCancel(context.Background())
+		result := make(chan error, 1)
+		go func() {
+			result <- th.TerminateContext(ctx)
+		}()
+		Eventually(func() error {
+			return th.PushEvent(0, "late")
+		}, "1s").Should(MatchError(timerheap.ErrTerminated))
+		Consistently(result).ShouldNot(Receive())
+		// A late push may have succeeded before the call, and is delivered along with the
+		// stuck event.
+		Expect(th.TimedEvent()).To(Receive(Equal("stuck")))
+		go func() {
+			for range th.TimedEvent() {
+			}
+		}()
+		Eventually(result, "1s").Should(Receive(BeNil()))
+		cancel()
+	})
+
+	It("does not hang on a push blocked waiting for space", func() {
+		th := timerheap.New(
+			timerheap.WithMaxPending(1),
+			timerheap.WithOverflowPolicy(timerheap.OverflowBlock),
+		)
+		Expect(th.PushEvent(0, "stuck")).To(Succeed())
+		pushed := make(chan error, 1)
+		go func() {
+			pushed <- th.PushEvent(0, "blocked")
+		}()
+		Consistently(pushed, "50ms").ShouldNot(Receive())
+
+		start := time.Now()
+		Expect(th.TerminateTimeout(100 * time.Millisecond)).To(MatchError(context.DeadlineExceeded))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Eventually(pushed, "1s").Should(Receive(MatchError(timerheap.ErrTerminated)))
+	})
+
+	It("returns at once if the heap has been terminated", func() {
+		th := timerheap.New()
+		Expect(th.PushEvent(0, "stuck")).To(Succeed())
+		th.Terminate()
+		Expect(th.TerminateContext(context.Background())).To(Succeed())
+	})
+
+	It("drains a heap run by a dispatcher", func() {
+		d := timerheap.NewDispatcher()
+		defer d.Terminate()
+		th := timerheap.New(timerheap.WithDispatcher(d))
+		for i := 0; i < 5; i++ {
+			Expect(th.PushEvent(0, i)).To(Succeed())
+		}
+		count := 0
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for range th.TimedEvent() {
+				count++
+			}
+		}()
+		Expect(th.TerminateTimeout(time.Second)).To(Succeed())
+		Eventually(done, "1s").Should(BeClosed())
+		Expect(count).To(Equal(5))
+	})
+})
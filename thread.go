@@ -0,0 +1,45 @@
+package timerheap
+
+import (
+	"runtime"
+)
+
+// WithLockedThread runs the event goroutine of the heap on its own OS thread, using
+// runtime.LockOSThread, so that popping events is not delayed by other goroutines being
+// scheduled on the same thread. If priority is not 0, the nice value of the thread is also set to
+// priority, where negative values raise the priority of the thread and usually need privileges.
+// Setting the priority is only supported on Linux, a failure to set it is logged.
+//
+// Heaps run by a Dispatcher are not affected, see WithDispatcherLockedThread.
+func WithLockedThread(priority int) Option {
+	return func(t *timerHeap) {
+		t.thread = &threadConfig{priority: priority}
+	}
+}
+
+// DispatcherOption is used to configure a Dispatcher when creating it with NewDispatcher.
+type DispatcherOption func(*Dispatcher)
+
+// WithDispatcherLockedThread runs the goroutine of the dispatcher on its own OS thread with the
+// priority, as WithLockedThread does for a heap.
+func WithDispatcherLockedThread(priority int) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.thread = &threadConfig{priority: priority}
+	}
+}
+
+// threadConfig is the configuration of the OS thread a goroutine is locked to.
+type threadConfig struct {
+	priority int
+}
+
+// lock locks the calling goroutine to its OS thread and sets the priority of the thread. The
+// thread is never unlocked, so it exits along with the goroutine rather than being reused with a
+// changed priority.
+func (c *threadConfig) lock() error {
+	runtime.LockOSThread()
+	if c.priority == 0 {
+		return nil
+	}
+	return setThreadPriority(c.priority)
+}
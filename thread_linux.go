@@ -0,0 +1,10 @@
+package timerheap
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// setThreadPriority sets the nice value of the calling thread.
+func setThreadPriority(priority int) error {
+	return unix.Setpriority(unix.PRIO_PROCESS, unix.Gettid(), priority)
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package timerheap
+
+// setThreadPriority is not supported on this platform.
+func setThreadPriority(priority int) error {
+	return ErrThreadPriorityUnsupported
+}
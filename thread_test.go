@@ -0,0 +1,36 @@
+package timerheap_test
+
+import (
+	"runtime"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Locked threads", func() {
+	It("runs a heap on a locked thread", func() {
+		log := &testLogger{}
+		th := timerheap.New(timerheap.WithLockedThread(5), timerheap.WithLogger(log))
+		Expect(th.PushEvent(10*time.Millisecond, 1)).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		th.Terminate()
+
+		_, warn := log.messages()
+		if runtime.GOOS == "linux" {
+			Expect(warn).To(BeEmpty())
+		} else {
+			Expect(warn).To(ContainElement("Failed to set thread priority"))
+		}
+	})
+
+	It("runs a dispatcher on a locked thread", func() {
+		d := timerheap.NewDispatcher(timerheap.WithDispatcherLockedThread(0))
+		defer d.Terminate()
+		th := timerheap.New(timerheap.WithDispatcher(d))
+		Expect(th.PushEvent(10*time.Millisecond, 1)).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+	})
+})
@@ -0,0 +1,143 @@
+package timerheap
+
+import (
+	"sync"
+	"time"
+)
+
+// ThrottleEdge selects which values a Throttler delivers for each interval.
+type ThrottleEdge int
+
+const (
+	// ThrottleLeading delivers the first value signalled for a key immediately, if no value
+	// has been delivered for the key within the interval.
+	ThrottleLeading ThrottleEdge = 1 << iota
+	// ThrottleTrailing delivers the latest value signalled for a key during the interval at
+	// the end of the interval.
+	ThrottleTrailing
+)
+
+// Throttled is a value delivered by a Throttler.
+type Throttled struct {
+	Key   string
+	Value interface{}
+}
+
+// Throttler delivers at most one value per key per interval. Which values are delivered is set
+// by the edges, with both edges a burst of signals delivers the first value immediately and the
+// latest value at the end of the interval. The trailing edge timers are scheduled on a heap
+// without being delivered on its results channel.
+type Throttler struct {
+	th       TimerHeap
+	interval time.Duration
+	edges    ThrottleEdge
+	// lock protects windows, which holds the state of each key that has an interval running.
+	lock    sync.Mutex
+	windows map[string]*throttleWindow
+	closed  bool
+	out     *queue[Throttled]
+}
+
+// throttleWindow is an interval running for a key, and the latest value signalled during it if
+// it is to be delivered at the end.
+type throttleWindow struct {
+	value   interface{}
+	pending bool
+}
+
+// NewThrottler returns a Throttler that delivers at most one value per key per interval, on
+// the selected edges.
+func NewThrottler(th TimerHeap, interval time.Duration, edges ThrottleEdge) *Throttler {
+	return &Throttler{
+		th:       th,
+		interval: interval,
+		edges:    edges,
+		windows:  map[string]*throttleWindow{},
+		out:      newQueue[Throttled](0),
+	}
+}
+
+// C returns the channel the values are delivered on. Values are queued without limit, so a
+// slow consumer does not delay the heap.
+func (t *Throttler) C() <-chan Throttled {
+	return t.out.out
+}
+
+// Signal offers a value for the key, which is delivered immediately, at the end of the current
+// interval, or not at all, depending on the edges of the throttler.
+func (t *Throttler) Signal(key string, value interface{}) error {
+	t.lock.Lock()
+	if t.closed {
+		t.lock.Unlock()
+		return ErrTerminated
+	}
+	if w, ok := t.windows[key]; ok {
+		if t.edges&ThrottleTrailing != 0 {
+			w.value, w.pending = value, true
+		}
+		t.lock.Unlock()
+		return nil
+	}
+	w := &throttleWindow{}
+	leading := t.edges&ThrottleLeading != 0
+	if !leading && t.edges&ThrottleTrailing != 0 {
+		w.value, w.pending = value, true
+	}
+	t.windows[key] = w
+	t.lock.Unlock()
+
+	if err := t.startWindow(key); err != nil {
+		t.lock.Lock()
+		delete(t.windows, key)
+		t.lock.Unlock()
+		return err
+	}
+	if leading {
+		t.out.add(Throttled{Key: key, Value: value})
+	}
+	return nil
+}
+
+// startWindow schedules the end of an interval for the key.
+func (t *Throttler) startWindow(key string) error {
+	return push(t.th, t.interval, nil, func(interface{}) {
+		t.endWindow(key)
+	})
+}
+
+// endWindow delivers the trailing value for the key, if there is one, in which case another
+// interval is started so that the next value is not delivered within the interval.
+func (t *Throttler) endWindow(key string) {
+	t.lock.Lock()
+	w, ok := t.windows[key]
+	if !ok {
+		t.lock.Unlock()
+		return
+	}
+	if !w.pending {
+		delete(t.windows, key)
+		t.lock.Unlock()
+		return
+	}
+	value := w.value
+	w.value, w.pending = nil, false
+	t.lock.Unlock()
+
+	t.out.add(Throttled{Key: key, Value: value})
+	// This is called on the goroutine processing the heap, so the push must not block.
+	if err := t.startWindow(key); err != nil {
+		t.lock.Lock()
+		delete(t.windows, key)
+		t.lock.Unlock()
+	}
+}
+
+// Close discards the pending trailing values, and closes the channel once the delivered values
+// have been received. Signals after Close fail with ErrTerminated.
+func (t *Throttler) Close() {
+	t.lock.Lock()
+	t.closed = true
+	t.windows = map[string]*throttleWindow{}
+	t.lock.Unlock()
+	t.out.close()
+}
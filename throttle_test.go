@@ -0,0 +1,77 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Throttler", func() {
+	var th timerheap.TimerHeap
+	var t *timerheap.Throttler
+
+	BeforeEach(func() {
+		th = timerheap.New()
+	})
+
+	AfterEach(func() {
+		t.Close()
+		th.Terminate()
+	})
+
+	It("delivers the first and latest values of a burst with both edges", func() {
+		t = timerheap.NewThrottler(th, 100*time.Millisecond, timerheap.ThrottleLeading|timerheap.ThrottleTrailing)
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			Expect(t.Signal("a", i)).To(Succeed())
+		}
+		Eventually(t.C(), "1s").Should(Receive(Equal(timerheap.Throttled{Key: "a", Value: 0})))
+		Eventually(t.C(), "1s").Should(Receive(Equal(timerheap.Throttled{Key: "a", Value: 2})))
+		Expect(time.Since(start)).To(BeNumerically(">=", 100*time.Millisecond))
+		Consistently(t.C(), "250ms").ShouldNot(Receive())
+	})
+
+	It("delivers at most one value per interval", func() {
+		t = timerheap.NewThrottler(th, 100*time.Millisecond, timerheap.ThrottleLeading|timerheap.ThrottleTrailing)
+		Expect(t.Signal("a", 0)).To(Succeed())
+		Expect(t.Signal("a", 1)).To(Succeed())
+		Eventually(t.C(), "1s").Should(Receive())
+		Eventually(t.C(), "1s").Should(Receive())
+		first := time.Now()
+		// The trailing value started another interval, so this is held until it ends.
+		Expect(t.Signal("a", 2)).To(Succeed())
+		Eventually(t.C(), "1s").Should(Receive(Equal(timerheap.Throttled{Key: "a", Value: 2})))
+		Expect(time.Since(first)).To(BeNumerically(">=", 80*time.Millisecond))
+	})
+
+	It("only delivers the first value with the leading edge", func() {
+		t = timerheap.NewThrottler(th, 50*time.Millisecond, timerheap.ThrottleLeading)
+		Expect(t.Signal("a", 0)).To(Succeed())
+		Expect(t.Signal("a", 1)).To(Succeed())
+		Eventually(t.C(), "1s").Should(Receive(Equal(timerheap.Throttled{Key: "a", Value: 0})))
+		Consistently(t.C(), "150ms").ShouldNot(Receive())
+		Expect(t.Signal("a", 2)).To(Succeed())
+		Eventually(t.C(), "1s").Should(Receive(Equal(timerheap.Throttled{Key: "a", Value: 2})))
+	})
+
+	It("only delivers the latest value with the trailing edge", func() {
+		t = timerheap.NewThrottler(th, 50*time.Millisecond, timerheap.ThrottleTrailing)
+		Expect(t.Signal("a", 0)).To(Succeed())
+		Expect(t.Signal("b", 1)).To(Succeed())
+		Expect(t.Signal("a", 2)).To(Succeed())
+		Consistently(t.C(), "30ms").ShouldNot(Receive())
+		Eventually(t.C(), "1s").Should(Receive(Equal(timerheap.Throttled{Key: "a", Value: 2})))
+		Eventually(t.C(), "1s").Should(Receive(Equal(timerheap.Throttled{Key: "b", Value: 1})))
+	})
+
+	It("discards pending values when closed", func() {
+		t = timerheap.NewThrottler(th, 50*time.Millisecond, timerheap.ThrottleTrailing)
+		Expect(t.Signal("a", 1)).To(Succeed())
+		t.Close()
+		Eventually(t.C(), "1s").Should(BeClosed())
+		Expect(t.Signal("a", 2)).To(Equal(timerheap.ErrTerminated))
+	})
+})
@@ -0,0 +1,70 @@
+package timerheap_test
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Tiebreaks", func() {
+	expectOrder := func(th timerheap.TimerHeap, values ...string) {
+		for _, v := range values {
+			Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(v)))
+		}
+	}
+
+	DescribeTable("orders events with the same expiration by tiebreak, then as pushed",
+		func(b timerheap.BackendType) {
+			th := timerheap.New(timerheap.WithBackend(b))
+			defer th.Terminate()
+
+			at := time.Now().Add(20 * time.Millisecond)
+			Expect(th.PushEventAt(at, "a")).To(Succeed())
+			Expect(th.PushEventAt(at, "b", timerheap.WithTiebreak(5))).To(Succeed())
+			Expect(th.PushEventAt(at, "c", timerheap.WithTiebreak(-1))).To(Succeed())
+			Expect(th.PushEventAt(at, "d", timerheap.WithTiebreak(5))).To(Succeed())
+			Expect(th.PushEventAt(at, "e")).To(Succeed())
+			expectOrder(th, "b", "d", "a", "e", "c")
+		},
+		Entry("binary heap", timerheap.BinaryHeap),
+		Entry("4-ary heap", timerheap.QuaternaryHeap),
+		Entry("pairing heap", timerheap.PairingHeap),
+		Entry("min-max heap", timerheap.MinMaxHeap),
+	)
+
+	It("does not reorder events with different expirations", func() {
+		th := timerheap.New()
+		defer th.Terminate()
+		at := time.Now().Add(20 * time.Millisecond)
+		Expect(th.PushEventAt(at.Add(time.Nanosecond), "later", timerheap.WithTiebreak(10))).To(Succeed())
+		Expect(th.PushEventAt(at, "first")).To(Succeed())
+		time.Sleep(50 * time.Millisecond)
+		expectOrder(th, "first", "later")
+	})
+
+	It("is included in snapshots and saved events", func() {
+		registry := timerheap.NewTypeRegistry()
+		Expect(registry.Register("id", "", nil)).To(Succeed())
+		th := timerheap.New(timerheap.WithTypeRegistry(registry, false))
+		defer th.Terminate()
+		at := time.Now().Add(50 * time.Millisecond)
+		Expect(th.PushEventAt(at, "a")).To(Succeed())
+		Expect(th.PushEventAt(at, "b", timerheap.WithTiebreak(1))).To(Succeed())
+		events := th.Snapshot()
+		Expect(events).To(HaveLen(2))
+		Expect(events[0].Value).To(Equal("b"))
+		Expect(events[0].Tiebreak).To(Equal(1))
+
+		var buf bytes.Buffer
+		Expect(th.Save(&buf)).To(Succeed())
+		restored := timerheap.New(timerheap.WithTypeRegistry(registry, false))
+		defer restored.Terminate()
+		Expect(restored.Load(&buf)).To(Succeed())
+		expectOrder(restored, "b", "a")
+	})
+})
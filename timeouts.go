@@ -0,0 +1,152 @@
+package timerheap
+
+import (
+	"sync"
+	"time"
+)
+
+// TimeoutManager tracks a deadline for each of a set of IDs, such as network connections, and
+// calls a function for each ID whose deadline passes. The deadlines are scheduled on a heap
+// without being delivered on its results channel.
+//
+// Touching an ID does not push an event to the heap. Each ID has at most one timer pending,
+// which is pushed again for the remaining time if the deadline was moved later since it was
+// pushed, so frequently touched IDs cost no more than idle ones.
+type TimeoutManager[K comparable] struct {
+	th      TimerHeap
+	expired func(K)
+	// lock protects deadlines and gen. Each deadline records the generation it was set with, so
+	// that the timers of a deadline that has since been cleared are ignored.
+	lock      sync.Mutex
+	deadlines map[K]*deadline
+	gen       uint64
+	closed    bool
+}
+
+type deadline struct {
+	gen     uint64
+	timeout time.Duration
+	at      time.Time
+	// due is when the earliest pending timer for the deadline pops.
+	due time.Time
+}
+
+// NewTimeoutManager returns a TimeoutManager calling expired with each ID whose deadline passes.
+// The function is called on the goroutine processing the heap, so it must not block.
+func NewTimeoutManager[K comparable](th TimerHeap, expired func(id K)) *TimeoutManager[K] {
+	return &TimeoutManager[K]{
+		th:        th,
+		expired:   expired,
+		deadlines: map[K]*deadline{},
+	}
+}
+
+// SetDeadline sets the deadline for the ID to timeout from now, and the timeout Touch restarts
+// the deadline with.
+func (m *TimeoutManager[K]) SetDeadline(id K, timeout time.Duration) error {
+	at := time.Now().Add(timeout)
+	m.lock.Lock()
+	if m.closed {
+		m.lock.Unlock()
+		return ErrTerminated
+	}
+	dl, ok := m.deadlines[id]
+	if !ok {
+		m.gen++
+		dl = &deadline{gen: m.gen}
+		m.deadlines[id] = dl
+	}
+	dl.timeout, dl.at = timeout, at
+	if ok && !dl.due.After(at) {
+		// The pending timer pops before the deadline, and is pushed again for the rest.
+		m.lock.Unlock()
+		return nil
+	}
+	dl.due = at
+	gen := dl.gen
+	m.lock.Unlock()
+
+	if err := m.schedule(id, gen, at); err != nil {
+		m.lock.Lock()
+		if cur, ok := m.deadlines[id]; ok && cur.gen == gen {
+			delete(m.deadlines, id)
+		}
+		m.lock.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Touch restarts the deadline for the ID with the timeout it was last set with, returning false
+// if the ID has no deadline.
+func (m *TimeoutManager[K]) Touch(id K) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	dl, ok := m.deadlines[id]
+	if ok {
+		dl.at = time.Now().Add(dl.timeout)
+	}
+	return ok
+}
+
+// ClearDeadline removes the deadline for the ID, returning false if it had none.
+func (m *TimeoutManager[K]) ClearDeadline(id K) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, ok := m.deadlines[id]
+	delete(m.deadlines, id)
+	return ok
+}
+
+// Len returns the number of IDs with a deadline.
+func (m *TimeoutManager[K]) Len() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.deadlines)
+}
+
+// schedule pushes a timer for the deadline to pop at the supplied time.
+func (m *TimeoutManager[K]) schedule(id K, gen uint64, at time.Time) error {
+	return push(m.th, time.Until(at), nil, func(interface{}) {
+		m.fire(id, gen, at)
+	})
+}
+
+// fire handles a timer for a deadline, calling the expired function if the deadline has passed,
+// or pushing the timer again if the deadline was moved later.
+func (m *TimeoutManager[K]) fire(id K, gen uint64, due time.Time) {
+	m.lock.Lock()
+	dl, ok := m.deadlines[id]
+	if !ok || dl.gen != gen || !dl.due.Equal(due) {
+		// The deadline was cleared, or this timer was superseded by an earlier one.
+		m.lock.Unlock()
+		return
+	}
+	if time.Now().Before(dl.at) {
+		dl.due = dl.at
+		at := dl.at
+		m.lock.Unlock()
+		// This is called on the goroutine processing the heap, so the push must not block. If
+		// it fails the deadline is removed without expiring, as it can no longer be tracked.
+		if err := m.schedule(id, gen, at); err != nil {
+			m.lock.Lock()
+			if cur, ok := m.deadlines[id]; ok && cur.gen == gen {
+				delete(m.deadlines, id)
+			}
+			m.lock.Unlock()
+		}
+		return
+	}
+	delete(m.deadlines, id)
+	m.lock.Unlock()
+	m.expired(id)
+}
+
+// Close removes all the deadlines. Calls to SetDeadline after Close fail with ErrTerminated.
+// The heap is not terminated, and the pending timers are discarded when they pop.
+func (m *TimeoutManager[K]) Close() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.closed = true
+	m.deadlines = map[K]*deadline{}
+}
@@ -0,0 +1,94 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("TimeoutManager", func() {
+	var th timerheap.TimerHeap
+	var m *timerheap.TimeoutManager[int]
+	var expired chan int
+
+	BeforeEach(func() {
+		th = timerheap.New()
+		expired = make(chan int, 10000)
+		m = timerheap.NewTimeoutManager(th, func(id int) {
+			expired <- id
+		})
+	})
+
+	AfterEach(func() {
+		m.Close()
+		th.Terminate()
+	})
+
+	It("calls the function once a deadline passes", func() {
+		start := time.Now()
+		Expect(m.SetDeadline(1, 50*time.Millisecond)).To(Succeed())
+		Expect(m.SetDeadline(2, 20*time.Millisecond)).To(Succeed())
+		Eventually(expired, "1s").Should(Receive(Equal(2)))
+		Eventually(expired, "1s").Should(Receive(Equal(1)))
+		Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+		Expect(m.Len()).To(BeZero())
+	})
+
+	It("restarts the deadline when touched", func() {
+		start := time.Now()
+		Expect(m.SetDeadline(1, 60*time.Millisecond)).To(Succeed())
+		for i := 0; i < 4; i++ {
+			time.Sleep(30 * time.Millisecond)
+			Expect(m.Touch(1)).To(BeTrue())
+		}
+		Eventually(expired, "1s").Should(Receive(Equal(1)))
+		Expect(time.Since(start)).To(BeNumerically(">=", 180*time.Millisecond))
+		Expect(m.Touch(1)).To(BeFalse())
+	})
+
+	It("moves a deadline earlier", func() {
+		Expect(m.SetDeadline(1, time.Second)).To(Succeed())
+		Expect(m.SetDeadline(1, 20*time.Millisecond)).To(Succeed())
+		Eventually(expired, "500ms").Should(Receive(Equal(1)))
+	})
+
+	It("moves a deadline later", func() {
+		start := time.Now()
+		Expect(m.SetDeadline(1, 20*time.Millisecond)).To(Succeed())
+		Expect(m.SetDeadline(1, 100*time.Millisecond)).To(Succeed())
+		Eventually(expired, "1s").Should(Receive(Equal(1)))
+		Expect(time.Since(start)).To(BeNumerically(">=", 100*time.Millisecond))
+		Consistently(expired, "100ms").ShouldNot(Receive())
+	})
+
+	It("does not call the function for cleared deadlines", func() {
+		Expect(m.SetDeadline(1, 20*time.Millisecond)).To(Succeed())
+		Expect(m.ClearDeadline(1)).To(BeTrue())
+		Expect(m.ClearDeadline(1)).To(BeFalse())
+		Consistently(expired, "100ms").ShouldNot(Receive())
+	})
+
+	It("tracks many deadlines", func() {
+		for i := 0; i < 10000; i++ {
+			Expect(m.SetDeadline(i, 5*time.Second)).To(Succeed())
+		}
+		for i := 0; i < 9990; i++ {
+			Expect(m.ClearDeadline(i)).To(BeTrue())
+		}
+		for i := 9990; i < 10000; i++ {
+			Expect(m.SetDeadline(i, 20*time.Millisecond)).To(Succeed())
+		}
+		for i := 9990; i < 10000; i++ {
+			Eventually(expired, "1s").Should(Receive(BeNumerically(">=", 9990)))
+		}
+		Consistently(expired, "100ms").ShouldNot(Receive())
+	})
+
+	It("fails to set deadlines once closed", func() {
+		m.Close()
+		Expect(m.SetDeadline(1, time.Second)).To(Equal(timerheap.ErrTerminated))
+	})
+})
@@ -1,175 +1,1190 @@
 package timerheap
 
 import (
-	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type TimerHeap interface {
-	PushEvent(popAfter time.Duration, value interface{})
+	PushEvent(popAfter time.Duration, value interface{}, opts ...PushOption) error
+	PushEventAt(expire time.Time, value interface{}, opts ...PushOption) error
+	PushEventWindow(notBefore, notAfter time.Time, value interface{}, opts ...PushOption) error
+	PushEventCtx(ctx context.Context, popAfter time.Duration, value interface{}, opts ...PushOption) error
+	Remove(value interface{}) bool
+	RemoveFunc(match func(value interface{}) bool) bool
+	Contains(match func(value interface{}) bool) bool
+	Find(match func(value interface{}) bool) (interface{}, time.Time, bool)
+	PeekLatest() (interface{}, time.Time, bool)
+	PopLatest() (interface{}, time.Time, bool)
+	AfterChan(d time.Duration) <-chan struct{}
 	TimedEvent() <-chan interface{}
+	TimedEventFor(topic string) <-chan interface{}
+	DeadLetters() <-chan DeadLetter
+	Errors() <-chan error
+	Subscribe(buffer int) *Subscription
+	SubscribeFrom(offset uint64, buffer int) (*Subscription, error)
+	Stats() Stats
+	MemoryStats() MemoryStats
+	Idle() <-chan struct{}
+	Flush(ctx context.Context) error
+	Save(w io.Writer) error
+	Load(r io.Reader) error
+	MarshalJSON() ([]byte, error)
+	Dump(w io.Writer) error
+	String() string
+	Snapshot() []ScheduledEvent
+	Merge(other TimerHeap) error
+	SplitWhere(match func(value interface{}) bool, opts ...Option) TimerHeap
+	Transfer(h *Handle, to TimerHeap) error
+	TransferKey(key string, to TimerHeap) error
+	NextFireChanges() <-chan time.Time
+	NewChild(opts ...Option) TimerHeap
+	Quiesce()
 	Terminate()
+	TerminateContext(ctx context.Context) error
+	TerminateTimeout(d time.Duration) error
 }
 
-func New() TimerHeap {
+func New(opts ...Option) TimerHeap {
+	t := newTimerHeap()
+	t.start(opts)
+	return t
+}
+
+// newTimerHeap returns a heap with the default configuration. The heap is not started.
+func newTimerHeap() *timerHeap {
 	t := &timerHeap{
-		wakeup:  make(chan struct{}, 1),
-		exit:    make(chan struct{}, 0),
-		results: make(chan interface{}, 0),
+		wakeup:    make(chan struct{}, 1),
+		exit:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+		results:   make(chan interface{}, 0),
+		log:       nopLogger{},
+		valueHeap: &timedItemHeap{},
+		children:  map[*timerHeap]struct{}{},
+		topics:    map[string]*queue[interface{}]{},
+		dedup:     newDedup(),
+
+		lateThreshold: defaultLateThreshold,
 	}
-	go t.run()
+	t.space = sync.NewCond(&t.lock)
+	t.nearest.Store(math.MaxInt64)
 	return t
 }
 
+// start applies the options to the heap and starts the event goroutine.
+func (t *timerHeap) start(opts []Option) {
+	t.configure(opts)
+	t.launch()
+}
+
+// configure applies the options to the heap.
+func (t *timerHeap) configure(opts []Option) {
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.adaptive != nil {
+		t.backendType = selectBackend(*t.adaptive)
+		t.valueHeap = newBackend(t.backendType)
+		t.log.Debug("Selected backend", "backend", t.backendType)
+	}
+	if t.sequenced && !t.timedResults && t.ackTimeout == 0 {
+		t.log.Warn("Sequence numbers are only delivered with timed results or acknowledgements")
+	}
+	if t.capacity > 0 {
+		// The backend is only known once all the options have been applied.
+		t.valueHeap.grow(t.capacity)
+	}
+	_, nop := t.log.(nopLogger)
+	t.debug = !nop
+}
+
+// launch starts processing the heap once it has been configured.
+func (t *timerHeap) launch() {
+	if t.expvarName != "" {
+		publishExpvar(t.expvarName, t)
+	}
+	if t.dispatcher != nil {
+		t.results = make(chan interface{}, 1)
+		t.dispatcher.add(t)
+		return
+	}
+	go t.run()
+}
+
+// TimedResult is sent on the results channel in place of the pushed value when the heap is
+// created with the WithTimedResults option.
+type TimedResult struct {
+	// The value that was pushed.
+	Value interface{}
+	// The time the event was scheduled to pop.
+	ScheduledAt time.Time
+	// The time the event popped and became ready to deliver on the results channel.
+	FiredAt time.Time
+	// How late the event fired, this is FiredAt - ScheduledAt.
+	Lateness time.Duration
+	// The metadata attached to the event, see WithMetadata.
+	Metadata Metadata
+	// The sequence number of the event, and of the event delivered on the results channel
+	// before it, if the heap was created with WithSequenceNumbers.
+	Seq     uint64
+	PrevSeq uint64
+}
+
 type timerHeap struct {
 	// Lock to protect access to the heap structure.
-	lock      sync.Mutex
-	valueHeap timedItemHeap
+	lock sync.Mutex
+	// valueHeap holds the pending items, see backend, and backendType is its type. adaptive, if
+	// set, holds the hints for selecting the backend when the heap is configured, see
+	// WithAdaptiveBackend.
+	valueHeap   backend
+	backendType BackendType
+	adaptive    *BackendHints
 	// wakeup channel is used to wakeup the event goroutine when a new item that is potentially
 	// earlier than the existing one has been added. It is of capacity 1 because we only need
 	// a single backed-up wakeup call.
 	wakeup chan struct{}
-	// exit is used to terminate the event goroutine immediately.
-	exit chan struct{}
+	// closing is set once the heap starts terminating, after which pushes fail. Pushes hold
+	// gate for reading while they check closing and stage the item, so that once terminate
+	// has set closing and acquired gate for writing, no further item can be staged.
+	closing atomic.Bool
+	gate    sync.RWMutex
+	// quiescing is set once the heap stops accepting new events, see Quiesce. It is checked
+	// under gate in the same way as closing.
+	quiescing atomic.Bool
+	// exit is closed to terminate the event goroutine immediately, and stopped is closed by
+	// the event goroutine once it has stopped and closed the results channel.
+	exit    chan struct{}
+	stopped chan struct{}
 	// results channel, events are added to this channel when their associated timer pops.
 	results chan interface{}
+	// nextSeq is the insertion sequence number assigned to the next pushed item. It is used
+	// to order items with identical expiration times. This is updated atomically since
+	// sharded pushes do not hold the lock.
+	nextSeq atomic.Uint64
+	// timedResults indicates whether events are delivered wrapped in a TimedResult.
+	timedResults bool
+	// sequenced indicates whether the sequence numbers of the events are delivered, see
+	// WithSequenceNumbers. lastSeq is the sequence number taken by the last event to leave the
+	// ready queue, whether or not it was delivered, and lastDelivered is that of the last event
+	// delivered on the results channel. They are only changed by the event goroutine, with the
+	// lock held.
+	sequenced     bool
+	lastSeq       uint64
+	lastDelivered uint64
+	// middleware is the chain each delivered event is passed through, see WithMiddleware.
+	middleware []Middleware
+	// hooks are called at each stage of the life of an event, see WithHooks.
+	hooks Hooks
+	// panicHandler is called with panics recovered from callbacks, see WithPanicHandler.
+	panicHandler func(RecoveredPanic)
+	// handles is set once an event with a handle has been pushed, see WithHandle.
+	handles atomic.Bool
+	// router sets the topic of events pushed without one, see WithRouter.
+	router func(value interface{}, md Metadata) string
+	// expvarName is the name the heap stats are published under, or empty if not published.
+	expvarName string
+	// log is used to log debug and warning messages. debug is set if a logger is configured,
+	// and is checked before logging debug messages for each event to avoid boxing the args.
+	log   Logger
+	debug bool
+	// lateThreshold is the lateness above which a delivery is considered late.
+	lateThreshold time.Duration
+	// lateHandler, if set, is called for each late delivery.
+	lateHandler func(TimedResult)
+	// types, if set, is used to validate pushed values. If strictTypes is set, values of
+	// unregistered types are rejected.
+	types       *TypeRegistry
+	strictTypes bool
+	// strictDeadlines is set if pushing an event that is already due fails, see
+	// WithStrictDeadlines.
+	strictDeadlines bool
+	// minDelay is the shortest delay an event is pushed with, see WithMinDelay.
+	minDelay time.Duration
+	// blackouts are the windows during which no items pop, see WithBlackouts.
+	blackouts []Blackout
+	// quantum is the boundary the expiration times of events are rounded up to, see
+	// WithQuantization.
+	quantum time.Duration
+	// parent is the heap this heap was created from by NewChild, and children are the heaps
+	// created from this one.
+	parent   *timerHeap
+	children map[*timerHeap]struct{}
+	// capacity is the number of events to preallocate room for, see WithCapacity.
+	capacity int
+	// mergeInto is the heap the pending events are moved to when this heap is terminated by
+	// Merge, or nil.
+	mergeInto *timerHeap
+	// maxPending is the maximum number of pending events, or 0 if there is no limit. The
+	// overflow policy determines what happens when pushing to a full heap, and space is
+	// used to wait for space when the policy is OverflowBlock.
+	maxPending int
+	overflow   OverflowPolicy
+	space      *sync.Cond
+	// deadLetters, if set, queues events that will not be delivered.
+	deadLetters *queue[DeadLetter]
+	// faults, if set, queues internal anomalies, see WithErrors.
+	faults *queue[error]
+	// terminated is set when the heap is terminated.
+	terminated bool
+	// terminateOnce ensures the termination processing is only performed once.
+	terminateOnce sync.Once
+	// ready is the queue of items that have popped from the heap and are waiting to be
+	// delivered. This is only updated by the event goroutine. In blocking mode this holds at
+	// most one item, in non-blocking mode it holds up to maxBuffered items, or is unbounded
+	// if maxBuffered is 0.
+	ready       []timedItem
+	nonBlocking bool
+	maxBuffered int
+	// prioritised is set once an item with a priority class has been pushed. classes is set
+	// once an expired item has had to be popped by priority class, at which point it replaces
+	// the backend, see classedBackend.
+	prioritised bool
+	classes     *classedBackend
+	// maxWait, if set, is the longest the heap waits before it is processed again.
+	maxWait time.Duration
+	// coalesce, if set, is how far ahead of their expiration time events may pop, so that
+	// events due close together pop together.
+	coalesce time.Duration
+	// tick, if set, is the interval the heap is processed at, see WithTick.
+	tick time.Duration
+	// slack is the slack of events pushed without their own, and slacked is set once an event
+	// with slack has been pushed.
+	slack   time.Duration
+	slacked atomic.Bool
+	// thread, if set, is the configuration of the OS thread the event goroutine is locked to.
+	thread *threadConfig
+	// spin, if set, is how long before an event is due the event goroutine stops waiting on
+	// the timer and spins instead, see WithPrecision.
+	spin time.Duration
+	// watchdog, if set, detects a consumer that is not reading the results channel.
+	watchdog *watchdog
+	// depth, if set, reports the number of pending events crossing thresholds.
+	depth *depthGauge
+	// subscribers receive a copy of each event instead of the results channel. They are only
+	// changed with the lock of the fired log held as well, if the heap has one, see firedLog.
+	subscribers []*Subscription
+	// firedLog, if set, records the fired events for subscribers to resume from, see
+	// WithFiredLog.
+	firedLog *firedLog
+	// topics holds the queue for each topic that events with that topic are sent to.
+	topics map[string]*queue[interface{}]
+	// intake, or shards if set, hold pushed items until the event goroutine moves them onto
+	// the heap. This is not used if there is a limit on the number of pending items. nearest
+	// is the time the event goroutine next wakes up, in Unix nanoseconds.
+	intake  intake
+	shards  []shard
+	nearest atomic.Int64
+	// scratch holds the slices used by the goroutine processing the heap.
+	scratch scratch
+	// dispatcher, if set, processes the heap instead of its own event goroutine. The other
+	// dispatch fields are owned by the dispatcher, see Dispatcher.
+	dispatcher    *Dispatcher
+	dispatchWake  time.Time
+	dispatchIndex int
+	dirty         bool
+	// nextFireChanges, if set, receives the scheduled time of the soonest pending event when
+	// it changes, and nextFire is the time last sent.
+	nextFireChanges chan time.Time
+	nextFire        time.Time
+	// idle, if set, is closed when there are no pending events.
+	idle chan struct{}
+	// flushes are the calls to Flush that are waiting, and seqScan is used to scan the
+	// pending events for them.
+	flushes []*flushWaiter
+	seqScan []timedItem
+	// drains are the calls to TerminateContext waiting for the expired events to be delivered.
+	drains []*drainWaiter
+	// wal, if set, is the write-ahead log of a durable heap.
+	wal *wal
+	// store, if set, holds the events of the heap, see NewWithStore.
+	store Store
+	// ackTimeout, if set, is how long a delivered event has to be acknowledged before it is
+	// delivered again, up to maxReceives times if that is set. early holds the acknowledgements
+	// received before the events were pushed back to await acknowledgement.
+	ackTimeout  time.Duration
+	maxReceives int
+	early       map[uint64]earlyAck
+	// dedup holds the idempotency keys of the pending and recently completed events.
+	dedup *dedup
+	// clockPolicy determines how jumps in the wall clock of at least clockThreshold are
+	// handled, and leapPolicy overrides it for the steps of a leap second. suspendPolicy and
+	// suspendSpacing determine how the events missed while the system was suspended are
+	// handled, and clock is used to detect both.
+	clockPolicy    ClockJumpPolicy
+	clockThreshold time.Duration
+	leapPolicy     LeapSecondPolicy
+	suspendPolicy  SuspendPolicy
+	suspendSpacing time.Duration
+	clock          clock
+	// Counters reported by Stats.
+	pushed       uint64
+	deliveries   uint64
+	expired      uint64
+	dropped      uint64
+	slowConsumer uint64
+	clockJumps   uint64
+	suspends     uint64
+	panics       uint64
+	// clamped is updated by pushes, without holding the lock.
+	clamped      atomic.Uint64
+	maxLateness  time.Duration
+	lastLateness time.Duration
+	latency      *LatencyHistogram
 }
 
-func (t *timerHeap) PushEvent(popAfter time.Duration, value interface{}) {
-	t.lock.Lock()
-	defer t.lock.Unlock()
+func (t *timerHeap) PushEvent(popAfter time.Duration, value interface{}, opts ...PushOption) error {
+	return t.PushEventAt(time.Now().Add(popAfter), value, opts...)
+}
 
-	ti := timedItem{
-		expire: time.Now().Add(popAfter),
+func (t *timerHeap) PushEventAt(expire time.Time, value interface{}, opts ...PushOption) error {
+	return t.push(timedItem{
+		expire: expire,
 		value:  value,
+	}, opts)
+}
+
+// PushEventWindow adds an event that pops no earlier than notBefore. If the event cannot be
+// delivered by notAfter (for example because the consumer is not reading the results
+// channel) it is discarded rather than delivered late, and sent to the dead letter channel if
+// there is one.
+func (t *timerHeap) PushEventWindow(notBefore, notAfter time.Time, value interface{}, opts ...PushOption) error {
+	return t.push(timedItem{
+		expire:   notBefore,
+		notAfter: notAfter,
+		value:    value,
+	}, opts)
+}
+
+// timedItems holds items used by push, so that taking the address of the item being pushed
+// does not cause an allocation for every push.
+var timedItems = sync.Pool{
+	New: func() interface{} {
+		return &timedItem{}
+	},
+}
+
+// push adds a new event to the heap.
+func (t *timerHeap) push(item timedItem, opts []PushOption) error {
+	return t.add(item, opts, true)
+}
+
+// restore adds an event that was scheduled earlier, such as one loaded from a saved heap, a
+// write-ahead log or a store, which may be overdue.
+func (t *timerHeap) restore(item timedItem) error {
+	return t.add(item, nil, false)
+}
+
+// add adds an event to the heap. fresh is set for new events, which are subject to
+// WithStrictDeadlines, WithMinDelay and WithQuantization.
+func (t *timerHeap) add(item timedItem, opts []PushOption, fresh bool) error {
+	ti := timedItems.Get().(*timedItem)
+	*ti = item
+	defer func() {
+		*ti = timedItem{}
+		timedItems.Put(ti)
+	}()
+
+	ti.slack = t.slack
+	for _, opt := range opts {
+		opt(ti)
 	}
-	if next := t.valueHeap.peek(); next == nil || ti.expire.Before(next.expire) {
-		// This new item is either the first to be added, or expires before the first one in the
-		// heap. Send a wakeup to trigger the timer thread to recheck.
-		select {
-		case t.wakeup <- struct{}{}:
-			// Wakeup sent.
-		default:
-			// Wakeup already pending.
+	t.applyRouter(ti)
+	if ti.handle != nil {
+		if err := t.track(ti.handle); err != nil {
+			ti.handle.finish(EventDropped)
+			return err
+		}
+	}
+	if ti.slack > 0 && !t.slacked.Load() {
+		t.slacked.Store(true)
+	}
+	if fresh && t.strictDeadlines && ti.deliver == nil && !ti.expire.After(time.Now()) {
+		ti.handle.finish(EventDropped)
+		return ErrPastDeadline
+	}
+	if fresh && t.minDelay > 0 {
+		if earliest := time.Now().Add(t.minDelay); ti.expire.Before(earliest) {
+			ti.expire = earliest
+			t.clamped.Add(1)
+		}
+	}
+	if fresh && t.quantum > 0 && ti.deliver == nil {
+		ti.expire = roundUp(ti.expire, t.quantum)
+	}
+	ti.expire = t.stamp(ti.expire)
+	if !ti.notAfter.IsZero() {
+		ti.notAfter = t.stamp(ti.notAfter)
+	}
+	// Items with their own delivery function are not sent to the consumers of the heap, so
+	// their values are not checked.
+	if t.types != nil && ti.deliver == nil {
+		if err := t.types.check(ti.value, t.strictTypes); err != nil {
+			ti.handle.finish(EventDropped)
+			return err
 		}
 	}
-	heap.Push(&t.valueHeap, ti)
+	// The keys of the events of a heap with a store are claimed by the store, either when they
+	// are put in it or when they are loaded from it.
+	if ti.key != "" && ti.deliver == nil && t.store == nil {
+		if !t.dedup.claim(ti.key) {
+			t.ignoredDuplicate(ti)
+			return nil
+		}
+	}
+	t.reportScheduled(*ti)
+	if err := t.pushClaimed(ti); err != nil {
+		if errors.Is(err, ErrDuplicateKey) {
+			t.ignoredDuplicate(ti)
+			return nil
+		}
+		// The key of a new event put in a store is released by the store if the put fails.
+		if ti.key != "" && (t.store == nil || ti.stored != 0) {
+			t.dedup.release(ti.key)
+		}
+		ti.handle.finish(EventDropped)
+		return err
+	}
+	return nil
+}
+
+// ignoredDuplicate drops an item whose key is pending or completed recently, see WithKey.
+func (t *timerHeap) ignoredDuplicate(ti *timedItem) {
+	if t.debug {
+		t.log.Debug("Ignored duplicate event", "key", ti.key)
+	}
+	ti.handle.finish(EventDropped)
 }
 
+// pushClaimed pushes an item whose key, if it has one, has been claimed.
+func (t *timerHeap) pushClaimed(ti *timedItem) error {
+	t.gate.RLock()
+	defer t.gate.RUnlock()
+	if t.closing.Load() {
+		return ErrTerminated
+	}
+	if t.quiescing.Load() && ti.stored == 0 {
+		return ErrQuiescing
+	}
+	ti.seq = t.nextSeq.Add(1) - 1
+	if t.wal != nil && ti.deliver == nil {
+		// Log the event before it can pop, so that it is never logged as done first.
+		if err := t.wal.pushed(ti); err != nil {
+			return err
+		}
+	}
+	if t.store != nil && ti.deliver == nil && ti.stored == 0 {
+		// Store the event, the store decides whether the heap holds it now or loads it later.
+		// Events loaded from the store have already been assigned an id.
+		hold, err := t.putStored(ti)
+		if err != nil {
+			return err
+		}
+		if !hold {
+			if t.debug {
+				t.log.Debug("Stored event", "id", ti.stored, "expire", ti.expire)
+			}
+			return nil
+		}
+	}
+
+	if t.maxPending == 0 {
+		// There is no limit to check against the whole heap, so the push can be staged
+		// without taking the heap lock.
+		if len(t.shards) > 0 {
+			t.pushSharded(*ti)
+		} else {
+			t.pushIntake(*ti)
+		}
+		if t.debug {
+			t.log.Debug("Pushed event", "seq", ti.seq, "expire", ti.expire)
+		}
+		return nil
+	}
+
+	t.lock.Lock()
+	var dropped *timedItem
+	if t.maxPending > 0 && t.pendingLocked() >= t.maxPending {
+		var err error
+		if dropped, err = t.makeRoom(ti); err != nil {
+			t.lock.Unlock()
+			// The event was not pushed, so its key is released rather than completed.
+			if ti.key != "" {
+				t.dedup.release(ti.key)
+			}
+			t.retired(*ti)
+			return err
+		}
+		if dropped != nil {
+			t.dropped++
+		}
+	}
+	t.pushed++
+	if ti.priority != 0 {
+		t.prioritised = true
+	}
+	if dropped == ti {
+		// The new item is the one to drop.
+		t.lock.Unlock()
+		t.log.Warn("Dropped event, heap is full", "seq", ti.seq, "expire", ti.expire)
+		t.fault(FaultDropped, "event dropped, heap is full", nil)
+		t.deadLetter(*ti, DeadLetterFull)
+		return nil
+	}
+	if next := t.valueHeap.peek(); next == nil || ti.expire.Before(next.expire) || dropped != nil || t.depth != nil {
+		// This new item is either the first to be added, or expires before the first one in the
+		// heap, or an item has been dropped to make room for it, or the depth of the heap is
+		// being watched. Send a wakeup to trigger the timer thread to recheck.
+		t.wake()
+	}
+	t.valueHeap.push(*ti)
+	t.lock.Unlock()
+
+	if dropped != nil {
+		t.log.Warn("Dropped event, heap is full", "seq", dropped.seq, "expire", dropped.expire)
+		t.fault(FaultDropped, "event dropped, heap is full", nil)
+		t.deadLetter(*dropped, DeadLetterFull)
+	}
+	if t.debug {
+		t.log.Debug("Pushed event", "seq", ti.seq, "expire", ti.expire)
+	}
+	return nil
+}
+
+// TimedEvent returns the results channel, on which events are delivered as they pop. The
+// channel is closed once the heap is terminated.
 func (t *timerHeap) TimedEvent() <-chan interface{} {
 	return t.results
 }
 
+// Terminate stops the heap. Pending events are not delivered, and are dead-lettered if the
+// heap was created with WithDeadLetters. Once Terminate returns no more events are sent on the
+// results channel, and the channel has been closed, so a consumer may range over TimedEvent
+// until the heap is terminated.
+//
+// Terminate may be called while other goroutines are pushing events. Each push either
+// completes before the heap is terminated, so that its event is pending at termination, or
+// fails with ErrTerminated.
 func (t *timerHeap) Terminate() {
-	t.exit <- struct{}{}
-	close(t.wakeup)
-	close(t.exit)
-	close(t.results)
+	t.terminateOnce.Do(t.terminate)
+}
+
+func (t *timerHeap) terminate() {
+	// Wake any pushers waiting for space.
+	t.lock.Lock()
+	t.terminated = true
+	t.space.Broadcast()
+	if t.nextFireChanges != nil {
+		close(t.nextFireChanges)
+	}
+	t.checkIdleLocked()
+	t.checkFlushesLocked()
+	t.checkDrainsLocked()
+	t.lock.Unlock()
+
+	// Wait for pushes that started before the heap was terminating, so that each push either
+	// succeeds before the pending items are collected, or fails with ErrTerminated.
+	t.closing.Store(true)
+	t.gate.Lock()
+	t.gate.Unlock()
+
+	// Terminate the children first so that they have all stopped once the parent has.
+	for _, c := range t.takeChildren() {
+		c.Terminate()
+	}
+	if t.parent != nil {
+		t.parent.removeChild(t)
+	}
+	if t.expvarName != "" {
+		unpublishExpvar(t.expvarName, t)
+	}
+	if t.store != nil {
+		// Stop loading stored events before the event goroutine stops.
+		if err := t.store.Close(); err != nil {
+			t.log.Warn("Failed to close event store", "error", err)
+			t.fault(FaultPersistence, "failed to close event store", err)
+		}
+	}
+	t.log.Debug("Terminating timer heap", "pending", t.Stats().Pending)
+	if t.dispatcher != nil {
+		// The dispatcher does not send on the results channel once the heap has been
+		// terminated, so it can be closed here.
+		t.dispatcher.remove(t)
+		close(t.results)
+	} else {
+		// The event goroutine closes the results channel once it has stopped sending on it.
+		close(t.exit)
+		<-t.stopped
+	}
+	// The wakeup channel is not closed, since a wake may race with termination.
+	if t.wal != nil {
+		if err := t.wal.close(); err != nil {
+			t.log.Warn("Failed to close write-ahead log", "error", err)
+			t.fault(FaultPersistence, "failed to close write-ahead log", err)
+		}
+	}
+
+	// The event goroutine has stopped, so any remaining items will never be delivered, unless
+	// they are moved to the heap this one is merged into.
+	if t.mergeInto != nil {
+		for _, ti := range t.mergeInto.absorb(t) {
+			t.deadLetter(ti, DeadLetterTerminated)
+		}
+	} else if t.deadLetters != nil || t.hooks.OnDrop != nil || t.handles.Load() {
+		t.lock.Lock()
+		t.drainPushedLocked()
+		remaining := t.valueHeap.appendTo(append([]timedItem(nil), t.ready...))
+		t.lock.Unlock()
+		for _, ti := range remaining {
+			t.deadLetter(ti, DeadLetterTerminated)
+		}
+	}
+	if t.deadLetters != nil {
+		t.deadLetters.close()
+	}
+	if t.faults != nil {
+		t.faults.close()
+	}
+	for _, s := range t.takeSubscribers() {
+		s.f.close()
+	}
+	t.closeTopics()
+	t.log.Debug("Terminated timer heap")
 }
 
 func (t *timerHeap) run() {
-waitforitem:
+	defer func() {
+		close(t.results)
+		close(t.stopped)
+	}()
+	if t.thread != nil {
+		if err := t.thread.lock(); err != nil {
+			t.log.Warn("Failed to set thread priority", "priority", t.thread.priority, "error", err)
+		}
+	}
+
+	// The timer is used to wait for the next item in the heap to expire, or for the item being
+	// delivered to pass its not-after time. A single timer is created and reset each time it is
+	// armed. armed is the time the timer is armed for, or the zero time if it is not armed.
+	tm := time.NewTimer(time.Hour)
+	tm.Stop()
+	defer tm.Stop()
+	var armed time.Time
+
 	for {
-		var ti interface{}
-		t.lock.Lock()
-		if t.valueHeap.Len() > 0 {
-			ti = heap.Pop(&t.valueHeap)
+		now := time.Now()
+		st := t.step(now)
+
+		// Re-arm the timer if the time we need to wake up has changed. We use a channel based
+		// timer so that we can also wait for delivery, new items being added, and termination.
+		if !st.wake.Equal(armed) {
+			if !armed.IsZero() && !tm.Stop() {
+				// The timer fired but we have not received from it. Drain the channel so that
+				// the reset timer does not appear to fire immediately. This does not block, in
+				// case the channel has already been drained by the runtime.
+				select {
+				case <-tm.C:
+				default:
+				}
+			}
+			armed = st.wake
+			if !st.wake.IsZero() {
+				// In precision mode the timer is armed early, and the rest of the wait is
+				// spent spinning once it pops.
+				tm.Reset(st.wake.Sub(now) - t.spin)
+				if t.debug {
+					t.log.Debug("Armed timer", "wake", st.wake)
+				}
+			}
+		}
+		var timerC <-chan time.Time
+		if !armed.IsZero() {
+			timerC = tm.C
 		}
-		t.lock.Unlock()
 
-		if ti == nil {
-			select {
-			case <-t.exit:
-				return
-			case <-t.wakeup:
-				// Woken up, must have an item now.
-				continue waitforitem
+		select {
+		case st.results <- st.value:
+			t.delivered(st.head)
+		case <-timerC:
+			// Timer popped, recheck for expired items.
+			if t.spin > 0 {
+				spinUntil(armed)
 			}
+			armed = time.Time{}
+		case <-t.wakeup:
+			// Woken up, there is a new item that potentially expires before the one we were
+			// waiting on.
+		case <-t.exit:
+			return
 		}
+	}
+}
 
-		// Determine how long we need to wait for this item to expire.
-		tiv := ti.(timedItem)
-		wait := tiv.expire.Sub(time.Now())
+// step is the outcome of processing the heap at a point in time.
+type step struct {
+	// results is the channel to deliver value on, or nil if there is nothing to deliver. head
+	// is the item at the head of the ready queue that value is the result for.
+	results chan interface{}
+	head    timedItem
+	value   interface{}
+	// wake is the time the heap next needs processing, or the zero time if it only needs
+	// processing when something changes.
+	wake time.Time
+}
 
-		// If this item has expired, then send immediately rather than going to the extremes
-		// of creating a timer with a negative duration.
-		if wait <= 0 {
-			select {
-			case t.results <- tiv.value:
-				continue waitforitem
-			case <-t.exit:
-				return
-			}
+// scratch holds the slices used while processing the heap. Items that are popped, dropped,
+// discarded or have exhausted their deliveries are logged and dead-lettered once the lock is
+// released, items with a topic or delivery function are routed, and items to fan out are sent
+// to the subscribers. These are reused for each step, and only used by the goroutine processing
+// the heap.
+type scratch struct {
+	popped, dropped, discarded, exhausted, routed, fanout, unhandled []timedItem
+	subscribers                                                      []*Subscription
+}
+
+// step processes the heap, popping expired items and handling any that are not delivered on
+// the results channel, and returns the item to deliver and when the heap next needs processing.
+func (t *timerHeap) step(now time.Time) step {
+	s := &t.scratch
+	t.lock.Lock()
+	t.drainPushedLocked()
+	var jump, suspended time.Duration
+	var leap bool
+	if t.checksClock() {
+		jump, suspended, leap = t.checkClockLocked(now)
+	}
+	t.popExpiredLocked(now, s)
+	// Release the room left by a large drain of the heap, keeping any preallocated room.
+	t.valueHeap.shrink(t.capacity)
+	s.discarded = t.discardStaleLocked(now, s.discarded[:0])
+	s.fanout, s.subscribers = t.takeFanoutLocked(s.fanout[:0], s.subscribers[:0])
+	s.unhandled = t.unhandledReadyLocked(s.unhandled[:0])
+
+	// Determine the item to deliver, if any, and when we next need to wake up.
+	var st step
+	if len(t.ready) > 0 {
+		st.results = t.results
+		st.head = t.ready[0]
+	}
+	if next := t.valueHeap.peek(); next != nil && t.readyRoomLocked() {
+		st.wake = t.tickAfter(t.afterBlackouts(t.wakeLocked(next)))
+	}
+	t.updateNextFireLocked()
+	t.checkIdleLocked()
+	t.checkFlushesLocked()
+	t.checkDrainsLocked()
+	var pending int
+	if t.depth != nil {
+		pending = t.pendingLocked()
+	}
+	if t.setNearestLocked(st.wake) {
+		// An item was pushed since the intake queue was drained, make sure we go round
+		// again rather than waiting.
+		t.wake()
+	}
+	t.lock.Unlock()
+
+	if jump != 0 {
+		if leap {
+			t.log.Warn("Wall clock stepped for leap second", "jump", jump, "policy", t.leapPolicy)
+			t.fault(FaultClockJump, fmt.Sprintf("wall clock stepped by %s for leap second", jump), nil)
+		} else {
+			t.log.Warn("Wall clock jumped", "jump", jump, "policy", t.clockPolicy)
+			t.fault(FaultClockJump, fmt.Sprintf("wall clock jumped by %s", jump), nil)
+		}
+	}
+	if suspended != 0 {
+		t.log.Warn("Resumed from suspend", "suspended", suspended, "policy", t.suspendPolicy)
+		t.fault(FaultSuspend, fmt.Sprintf("resumed from suspend of %s", suspended), nil)
+	}
+	if t.depth != nil {
+		t.depth.check(t, pending)
+	}
+	for _, ti := range s.popped {
+		if t.debug {
+			t.log.Debug("Popped event", "seq", ti.seq, "expire", ti.expire, "lateness", now.Sub(ti.expire))
+		}
+		t.reportFired(ti)
+	}
+	for _, ti := range s.dropped {
+		t.log.Warn("Dropped event, delivery buffer is full", "seq", ti.seq, "expire", ti.expire)
+		t.fault(FaultDropped, "event dropped, delivery buffer is full", nil)
+		t.deadLetter(ti, DeadLetterFull)
+	}
+	for _, ti := range s.discarded {
+		t.log.Warn("Discarded event not delivered in time", "seq", ti.seq, "notAfter", ti.notAfter)
+		t.deadLetter(ti, DeadLetterExpired)
+	}
+	for _, ti := range s.exhausted {
+		t.log.Warn("Discarded event not acknowledged", "seq", ti.seq, "attempts", ti.attempt)
+		t.deadLetter(ti, DeadLetterMaxReceives)
+	}
+	for _, ti := range s.routed {
+		t.route(ti)
+	}
+	for _, ti := range s.fanout {
+		t.fanOut(ti, s.subscribers)
+	}
+
+	if len(s.unhandled) > 0 {
+		st.results, st.head = t.handleReady(s.unhandled)
+	}
+	if st.results != nil {
+		st.value, _ = t.handle(st.head)
+		st.value = t.sequence(st.value)
+		if t.ackTimeout > 0 {
+			st.value = t.delivery(st.head, st.value)
 		}
+		st.wake = earliest(st.wake, st.head.notAfter)
+	}
+	if t.watchdog != nil {
+		st.wake = earliest(st.wake, t.watchdog.check(t, now, st.results != nil, st.head.seq))
+	}
+	if t.checksClock() {
+		st.wake = earliest(st.wake, now.Add(clockCheckInterval))
+	}
+	if t.maxWait > 0 {
+		st.wake = earliest(st.wake, now.Add(t.maxWait))
+	}
+	return st
+}
 
-		// The event expires in the future, so use a channel based timer to wait for the event - this
-		// makes it easy to cancel if the timerheap is terminated, or a new event has been added which
-		// may have a closer expiration time.
-		tm := time.NewTimer(wait)
-
-	waitfortimer:
-		for {
-			select {
-			case <-t.exit:
-				tm.Stop()
-				return
-			case <-t.wakeup:
-				// Woken up, must have an item that potentially has a expire time less than ours.
-				t.lock.Lock()
-				if next := t.valueHeap.peek(); next != nil && next.expire.Before(tiv.expire) {
-					// The next entry on the heap is before the one we were waiting on. Add it
-					// back to the heap, cancel it's timer and reloop to pull the next item
-					// which will have a closer expiration.
-					heap.Push(&t.valueHeap, tiv)
-					t.lock.Unlock()
-					tm.Stop()
-					continue waitforitem
-				}
-				t.lock.Unlock()
-				continue waitfortimer
-			case <-tm.C:
-				select {
-				case t.results <- tiv.value:
-					continue waitforitem
-				case <-t.exit:
-					return
-				}
+// wake wakes the goroutine processing the heap, so that it processes the heap again.
+func (t *timerHeap) wake() {
+	if t.dispatcher != nil {
+		t.dispatcher.notify(t)
+		return
+	}
+	select {
+	case t.wakeup <- struct{}{}:
+		// Wakeup sent.
+	default:
+		// Wakeup already pending.
+	}
+}
+
+// tickAfter returns the first tick at or after the time in tick mode, or the time itself.
+func (t *timerHeap) tickAfter(tm time.Time) time.Time {
+	if t.tick <= 0 {
+		return tm
+	}
+	return roundUp(tm, t.tick)
+}
+
+// roundUp returns the first multiple of d since the zero time that is at or after the time.
+func roundUp(tm time.Time, d time.Duration) time.Time {
+	at := tm.Truncate(d)
+	if at.Before(tm) {
+		at = at.Add(d)
+	}
+	return at
+}
+
+// spinUntil busy waits until the time, yielding the processor to other goroutines while it waits.
+func spinUntil(tm time.Time) {
+	for time.Now().Before(tm) {
+		runtime.Gosched()
+	}
+}
+
+// earliest returns the earlier of the two times, where the zero time means no time is set.
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+// readyRoomLocked returns true if there is room to pop another item onto the ready queue. In
+// blocking mode only one item is popped at a time, unless popped items are handed to the
+// subscribers immediately. The caller must hold the lock.
+func (t *timerHeap) readyRoomLocked() bool {
+	return t.nonBlocking || len(t.ready) == 0 || t.fansOutLocked()
+}
+
+// popExpiredLocked moves expired items from the heap onto the ready queue while there is room,
+// appending them to the popped scratch slice. If the ready queue is limited and full, the
+// oldest ready items in the lowest priority class are dropped to make room, these are appended
+// to the dropped slice. Items with a topic
+// or their own delivery function are not added to the ready queue, these are appended to the
+// routed slice, and items that have been delivered the maximum number of times are appended to
+// the exhausted slice. Items due within the coalescing window are treated as expired, and in tick
+// mode only the items due by the last tick are expired. Nothing is popped during a blackout
+// window. The caller must hold the lock.
+func (t *timerHeap) popExpiredLocked(now time.Time, s *scratch) {
+	s.popped, s.dropped, s.exhausted, s.routed = s.popped[:0], s.dropped[:0], s.exhausted[:0], s.routed[:0]
+	if t.afterBlackouts(now).After(now) {
+		// Nothing pops until the blackout ends.
+		return
+	}
+	due := now.Add(t.coalesce)
+	if t.tick > 0 {
+		due = due.Truncate(t.tick)
+	}
+	for t.readyRoomLocked() {
+		ti, ok := t.popDueLocked(due)
+		if !ok {
+			break
+		}
+		ti.fired = now
+		if t.latency != nil && ti.deliver == nil {
+			t.latency.observe(now.Sub(ti.expire))
+		}
+		s.popped = append(s.popped, ti)
+		if ti.topic != "" || ti.deliver != nil {
+			s.routed = append(s.routed, ti)
+			continue
+		}
+		if t.maxReceives > 0 && ti.attempt >= t.maxReceives {
+			s.exhausted = append(s.exhausted, ti)
+			t.missedLocked()
+			continue
+		}
+		if t.maxBuffered > 0 && len(t.ready) >= t.maxBuffered {
+			t.dropped++
+			t.missedLocked()
+			if ti.priority < t.ready[len(t.ready)-1].priority {
+				// Every buffered item is more urgent than this one.
+				s.dropped = append(s.dropped, ti)
+				continue
 			}
+			s.dropped = append(s.dropped, t.removeReadyLocked(t.droppableReadyLocked()))
+		}
+		t.insertReadyLocked(ti)
+	}
+}
+
+// popDueLocked removes and returns the next expired item, if any items have expired. This is
+// the item at the top of the heap unless priority classes are in use and only a single item is
+// popped at a time, in which case it is the expired item with the highest priority class, and
+// the backend is replaced by a classedBackend the first time so that the item is found without
+// searching every expired item. The caller must hold the lock.
+func (t *timerHeap) popDueLocked(now time.Time) (timedItem, bool) {
+	if next := t.valueHeap.peek(); next == nil || next.expire.After(now) {
+		return timedItem{}, false
+	}
+	if !t.prioritised || t.nonBlocking || t.fansOutLocked() {
+		// Every expired item is popped in this pass and the ready queue orders them by
+		// priority class, so just take the top of the heap.
+		return t.valueHeap.pop(), true
+	}
+	if t.classes == nil {
+		t.classes = newClassedBackend(t.valueHeap, t.backendType)
+		t.valueHeap = t.classes
+	}
+	return t.classes.popMostUrgent(now), true
+}
+
+// insertReadyLocked adds an item to the ready queue, after any items with the same or a higher
+// priority class. When deliveries must be acknowledged, an item without a handle is given one,
+// so that its Delivery can find it in the heap while it awaits acknowledgement. The caller must
+// hold the lock.
+func (t *timerHeap) insertReadyLocked(ti timedItem) {
+	if t.ackTimeout > 0 && ti.handle == nil {
+		ti.handle = &Handle{heap: t}
+	}
+	i := len(t.ready)
+	for i > 0 && t.ready[i-1].priority < ti.priority {
+		i--
+	}
+	t.ready = append(t.ready, timedItem{})
+	copy(t.ready[i+1:], t.ready[i:])
+	t.ready[i] = ti
+}
+
+// droppableReadyLocked returns the index of the ready item to drop when the ready queue is full.
+// This is the oldest item in the lowest priority class. The caller must hold the lock.
+func (t *timerHeap) droppableReadyLocked() int {
+	i := len(t.ready) - 1
+	for i > 0 && t.ready[i-1].priority == t.ready[i].priority {
+		i--
+	}
+	return i
+}
+
+// removeReadyLocked removes and returns the item at index i of the ready queue. The caller must
+// hold the lock.
+func (t *timerHeap) removeReadyLocked(i int) timedItem {
+	if i == 0 {
+		return t.shiftReadyLocked()
+	}
+	ti := t.ready[i]
+	copy(t.ready[i:], t.ready[i+1:])
+	t.ready[len(t.ready)-1] = timedItem{}
+	t.ready = t.ready[:len(t.ready)-1]
+	return ti
+}
+
+// discardStaleLocked removes items from the head of the ready queue that have passed their
+// not-after time, appending them to discarded. The caller must hold the lock.
+func (t *timerHeap) discardStaleLocked(now time.Time, discarded []timedItem) []timedItem {
+	for len(t.ready) > 0 && !t.ready[0].notAfter.IsZero() && !now.Before(t.ready[0].notAfter) {
+		discarded = append(discarded, t.shiftReadyLocked())
+		t.space.Signal()
+		t.expired++
+		t.missedLocked()
+	}
+	return discarded
+}
+
+// shiftReadyLocked removes and returns the item at the head of the ready queue. The caller must
+// hold the lock.
+func (t *timerHeap) shiftReadyLocked() timedItem {
+	ti := t.ready[0]
+	t.ready[0] = timedItem{}
+	if len(t.ready) == 1 {
+		// Reuse the room of the emptied queue, rather than giving up the room at the head
+		// until every push and delivery has to allocate a new queue.
+		t.ready = t.ready[:0]
+	} else {
+		t.ready = t.ready[1:]
+	}
+	return ti
+}
+
+// pendingLocked returns the number of pending events, including the items that have popped but
+// not yet been delivered. The caller must hold the lock.
+func (t *timerHeap) pendingLocked() int {
+	return t.valueHeap.Len() + len(t.ready)
+}
+
+// delivered is called when the item at the head of the ready queue has been received from the
+// results channel.
+func (t *timerHeap) delivered(ti timedItem) {
+	t.lock.Lock()
+	t.lastSeq++
+	t.lastDelivered = t.lastSeq
+	t.shiftReadyLocked()
+	awaiting := t.ackTimeout > 0 && t.awaitAckLocked(ti)
+	t.lock.Unlock()
+	if !awaiting {
+		t.retired(ti)
+	}
+	ti.handle.finish(EventFired)
+	t.countDelivery(ti)
+}
+
+// recordDelivery records that an item has been delivered and is no longer pending.
+func (t *timerHeap) recordDelivery(ti timedItem) {
+	t.retired(ti)
+	ti.handle.finish(EventFired)
+	t.countDelivery(ti)
+}
+
+// countDelivery updates the stats for a delivered item, and reports late deliveries.
+func (t *timerHeap) countDelivery(ti timedItem) {
+	now := time.Now()
+	lateness := now.Sub(ti.expire)
+
+	t.lock.Lock()
+	t.space.Signal()
+	t.deliveries++
+	t.lastLateness = lateness
+	if lateness > t.maxLateness {
+		t.maxLateness = lateness
+	}
+	t.lock.Unlock()
+
+	if lateness > t.lateThreshold {
+		t.log.Warn("Late delivery of event", "seq", ti.seq, "expire", ti.expire, "lateness", lateness)
+		if t.lateHandler != nil {
+			t.protect(ti, func() {
+				t.lateHandler(TimedResult{
+					Value:       ti.value,
+					ScheduledAt: ti.expire,
+					FiredAt:     now,
+					Lateness:    lateness,
+					Metadata:    ti.metadata,
+				})
+			})
 		}
+	} else if t.debug {
+		t.log.Debug("Delivered event", "seq", ti.seq, "expire", ti.expire, "lateness", lateness)
+	}
+}
+
+// result returns the value to send on the results channel for a popped item.
+func (t *timerHeap) result(ti timedItem) interface{} {
+	if !t.timedResults {
+		return ti.value
+	}
+	return TimedResult{
+		Value:       ti.value,
+		ScheduledAt: ti.expire,
+		FiredAt:     ti.fired,
+		Lateness:    ti.fired.Sub(ti.expire),
+		Metadata:    ti.metadata,
 	}
 }
 
-// An timedItemHeap is a min-heap of timedItems, priority is based on the time.
+// An timedItemHeap is a min-heap of timedItems, priority is based on the time. Items with
+// the same expiration time are ordered by their insertion sequence number so that they are
+// popped in the order they were pushed.
 type timedItem struct {
 	expire time.Time
+	seq    uint64
 	value  interface{}
+	// notAfter is the latest time the item may be delivered, or the zero time if there is
+	// no limit.
+	notAfter time.Time
+	// fired is the time the item popped from the heap.
+	fired time.Time
+	// topic is the topic the item is delivered to, or empty if it is delivered to the
+	// results channel.
+	topic string
+	// deliver, if set, is called with the result when the item pops instead of delivering it
+	// on the results channel. It must not block.
+	deliver func(interface{})
+	// priority is the priority class of the item. Among expired items, those with a higher
+	// priority class are delivered first.
+	priority int
+	// tiebreak orders the item among the items with the same expiration, see WithTiebreak.
+	tiebreak int
+	// stored is the id of the item in the store of the heap, or 0 if it has not been stored,
+	// see Store. storedExpire is the expiration it was stored with, which identifies it in the
+	// store along with the id, since expire may change while the item is pending.
+	stored       uint64
+	storedExpire time.Time
+	// attempt is the number of times the item has been delivered without being acknowledged,
+	// see WithAck.
+	attempt int
+	// key is the idempotency key of the item, or empty if it has none, see WithKey.
+	key string
+	// slack is how late the item may pop, see WithSlack.
+	slack time.Duration
+	// metadata is the metadata attached to the item, see WithMetadata.
+	metadata Metadata
+	// handled is set once the item has popped and been passed through the middleware chain,
+	// and output is the value the chain passed on, see WithMiddleware.
+	handled bool
+	output  interface{}
+	// handle is the handle tracking the item, or nil if it has none, see WithHandle.
+	handle *Handle
 }
 type timedItemHeap []timedItem
 
-// timeItemHeap implements heap.Interface
-func (h timedItemHeap) Len() int           { return len(h) }
-func (h timedItemHeap) Less(i, j int) bool { return h[i].expire.Before(h[j].expire) }
-func (h timedItemHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
-
-// As per heap.Interface, Push appends an item after the last index.
-func (h *timedItemHeap) Push(x interface{}) {
-	*h = append(*h, x.(timedItem))
+// before returns true if the item should pop before the other item. Items with the same
+// expiration pop in order of tiebreak, highest first, and then in the order they were pushed.
+func (ti *timedItem) before(other *timedItem) bool {
+	if ti.expire.Equal(other.expire) {
+		if ti.tiebreak != other.tiebreak {
+			return ti.tiebreak > other.tiebreak
+		}
+		return ti.seq < other.seq
+	}
+	return ti.expire.Before(other.expire)
 }
 
-// As per heap.Interface, Pop removes the item at index 0.
-func (h *timedItemHeap) Pop() interface{} {
-	old := *h
-	n := len(old)
-	x := old[n-1]
-	*h = old[0 : n-1]
-	return x
-}
+func (h timedItemHeap) Len() int { return len(h) }
 
 // peek is used to look at the first entry that would be popped off the heap (which is
 // the first element in the slice).
-//
-// This uses knowledge (as defined by the heap.Pop(), that Pop is equivalent to Remove(h, 0).
 func (h *timedItemHeap) peek() *timedItem {
 	if h.Len() == 0 {
 		return nil
@@ -218,6 +218,365 @@ var _ = Describe("timer heap tests", func() {
 			Expect(ok).To(BeTrue())
 			Expect(t.index).To(Equal(1))
 		})
+
+		It("gets events with the same expiration in the order they were pushed", func() {
+			var value interface{}
+
+			By("adding a set of events with the same future expiration")
+			expire := time.Now().Add(100 * time.Millisecond)
+			for i := 0; i < 50; i++ {
+				th.PushEventAt(expire, testdata{
+					index: i, pop: expire,
+				})
+			}
+
+			By("Waiting for the events and checking they are in push order")
+			for i := 0; i < 50; i++ {
+				Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(&value))
+				t, ok := value.(testdata)
+				Expect(ok).To(BeTrue())
+				Expect(t.index).To(Equal(i))
+			}
+		})
+	})
+
+	Context("firing window", func() {
+		BeforeEach(func() {
+			th = timerheap.New()
+		})
+
+		AfterEach(func() {
+			th.Terminate()
+		})
+
+		It("delivers an event within its window", func() {
+			var value interface{}
+
+			By("adding an event with a window in the future")
+			now = time.Now()
+			th.PushEventWindow(now.Add(100*time.Millisecond), now.Add(time.Second), testdata{index: 1})
+
+			By("Checking the event is delivered at the start of the window")
+			Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(&value))
+			Expect(value).To(Equal(testdata{index: 1}))
+			Expect(time.Now().Sub(now.Add(100 * time.Millisecond))).To(BeNumerically("<", accuracy))
+		})
+
+		It("discards an event that cannot be delivered before the end of its window", func() {
+			var value interface{}
+
+			By("adding an event with a short window")
+			now = time.Now()
+			th.PushEventWindow(now, now.Add(100*time.Millisecond), testdata{index: 1})
+			th.PushEventAt(now.Add(200*time.Millisecond), testdata{index: 2})
+
+			By("Pausing without reading the results channel until the window has passed")
+			time.Sleep(300 * time.Millisecond)
+
+			By("Checking only the event without a window is received")
+			Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(&value))
+			Expect(value).To(Equal(testdata{index: 2}))
+			Consistently(th.TimedEvent(), "200ms", "10ms").ShouldNot(Receive())
+			Expect(th.Stats().Expired).To(Equal(uint64(1)))
+		})
+	})
+
+	Context("stale events", func() {
+		BeforeEach(func() {
+			th = timerheap.New(timerheap.WithDeadLetters())
+		})
+
+		AfterEach(func() {
+			th.Terminate()
+		})
+
+		It("discards an event that cannot be delivered before it is stale", func() {
+			var value interface{}
+			var dl timerheap.DeadLetter
+
+			By("adding an event that goes stale and one that does not")
+			Expect(th.PushEvent(0, testdata{index: 1}, timerheap.WithStaleAfter(100*time.Millisecond))).To(Succeed())
+			Expect(th.PushEvent(0, testdata{index: 2}, timerheap.WithStaleAfter(time.Hour))).To(Succeed())
+
+			By("Pausing without reading the results channel until the first event is stale")
+			time.Sleep(200 * time.Millisecond)
+
+			By("Checking the stale event is dead-lettered and the other is received")
+			Eventually(th.DeadLetters(), "1s", "10ms").Should(Receive(&dl))
+			Expect(dl.Value).To(Equal(testdata{index: 1}))
+			Expect(dl.Reason).To(Equal(timerheap.DeadLetterExpired))
+			Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(&value))
+			Expect(value).To(Equal(testdata{index: 2}))
+		})
+	})
+
+	Context("non-blocking delivery", func() {
+		AfterEach(func() {
+			th.Terminate()
+		})
+
+		It("continues to pop events on time while the consumer is not reading", func() {
+			var value interface{}
+			th = timerheap.New(timerheap.WithNonBlockingDelivery(0), timerheap.WithTimedResults())
+
+			By("adding a set of events")
+			for i := 0; i < 5; i++ {
+				Expect(th.PushEvent(time.Duration(i)*50*time.Millisecond, testdata{index: i})).To(Succeed())
+			}
+
+			By("Pausing without reading the results channel until they have all popped")
+			time.Sleep(300 * time.Millisecond)
+
+			By("Checking the events are received in order and each popped on time")
+			for i := 0; i < 5; i++ {
+				Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(&value))
+				r := value.(timerheap.TimedResult)
+				Expect(r.Value).To(Equal(testdata{index: i}))
+				Expect(r.Lateness).To(BeNumerically("<", accuracy))
+			}
+			Eventually(func() int { return th.Stats().Pending }).Should(BeZero())
+		})
+
+		It("delivers a later event that is not stale when an earlier one is stale", func() {
+			var value interface{}
+			th = timerheap.New(timerheap.WithNonBlockingDelivery(0))
+
+			By("adding an event that goes stale quickly and a later event that does not")
+			Expect(th.PushEvent(0, testdata{index: 0}, timerheap.WithStaleAfter(50*time.Millisecond))).To(Succeed())
+			Expect(th.PushEvent(100*time.Millisecond, testdata{index: 1}, timerheap.WithStaleAfter(time.Hour))).To(Succeed())
+
+			By("Pausing without reading the results channel until both have popped")
+			time.Sleep(200 * time.Millisecond)
+
+			Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(&value))
+			Expect(value).To(Equal(testdata{index: 1}))
+			Expect(th.Stats().Expired).To(Equal(uint64(1)))
+		})
+
+		It("drops the oldest buffered event when the buffer is full", func() {
+			var value interface{}
+			th = timerheap.New(timerheap.WithNonBlockingDelivery(2))
+
+			By("adding three events and pausing until they have all popped")
+			for i := 0; i < 3; i++ {
+				Expect(th.PushEvent(0, testdata{index: i})).To(Succeed())
+			}
+			time.Sleep(100 * time.Millisecond)
+
+			By("Checking the first event was dropped")
+			Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(&value))
+			Expect(value).To(Equal(testdata{index: 1}))
+			Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(&value))
+			Expect(value).To(Equal(testdata{index: 2}))
+			Expect(th.Stats().Dropped).To(Equal(uint64(1)))
+		})
+	})
+
+	Context("timed result delivery", func() {
+		BeforeEach(func() {
+			th = timerheap.New(timerheap.WithTimedResults())
+		})
+
+		AfterEach(func() {
+			th.Terminate()
+		})
+
+		It("wraps events in a TimedResult", func() {
+			var value interface{}
+
+			By("adding a future event and a past event")
+			now = time.Now()
+			th.PushEventAt(now.Add(100*time.Millisecond), testdata{index: 1})
+			th.PushEventAt(now.Add(-time.Second), testdata{index: 0})
+
+			By("Checking the past event is delivered late")
+			Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(&value))
+			r, ok := value.(timerheap.TimedResult)
+			Expect(ok).To(BeTrue())
+			Expect(r.Value).To(Equal(testdata{index: 0}))
+			Expect(r.ScheduledAt).To(Equal(now.Add(-time.Second)))
+			Expect(r.Lateness).To(BeNumerically(">=", time.Second))
+			Expect(r.FiredAt.Sub(r.ScheduledAt)).To(Equal(r.Lateness))
+
+			By("Checking the future event is delivered on time")
+			Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(&value))
+			r, ok = value.(timerheap.TimedResult)
+			Expect(ok).To(BeTrue())
+			Expect(r.Value).To(Equal(testdata{index: 1}))
+			Expect(r.ScheduledAt).To(Equal(now.Add(100 * time.Millisecond)))
+			Expect(r.Lateness).To(BeNumerically(">=", 0))
+			Expect(r.Lateness).To(BeNumerically("<", accuracy))
+		})
+	})
+
+	Context("late delivery alerting", func() {
+		var late chan timerheap.TimedResult
+
+		BeforeEach(func() {
+			late = make(chan timerheap.TimedResult, 10)
+			th = timerheap.New(timerheap.WithLateDeliveryHandler(200*time.Millisecond, func(r timerheap.TimedResult) {
+				late <- r
+			}))
+		})
+
+		AfterEach(func() {
+			th.Terminate()
+		})
+
+		It("calls the handler only for events received later than the threshold", func() {
+			var r timerheap.TimedResult
+
+			By("adding an event that is on time and an event that is late")
+			now = time.Now()
+			th.PushEventAt(now, testdata{index: 1})
+			th.PushEventAt(now.Add(-time.Second), testdata{index: 0})
+			Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive())
+			Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive())
+
+			By("Checking the handler is only called for the late event")
+			Eventually(late).Should(Receive(&r))
+			Expect(r.Value).To(Equal(testdata{index: 0}))
+			Expect(r.ScheduledAt).To(Equal(now.Add(-time.Second)))
+			Expect(r.Lateness).To(BeNumerically(">=", time.Second))
+			Consistently(late, "100ms", "10ms").ShouldNot(Receive())
+
+			By("Adding an event and not reading it until after the threshold")
+			th.PushEvent(0, testdata{index: 2})
+			time.Sleep(300 * time.Millisecond)
+			Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive())
+			Eventually(late).Should(Receive(&r))
+			Expect(r.Value).To(Equal(testdata{index: 2}))
+			Expect(r.Lateness).To(BeNumerically(">=", 300*time.Millisecond))
+		})
+	})
+
+	Context("maximum pending events", func() {
+		BeforeEach(func() {
+			th = timerheap.New(timerheap.WithMaxPending(3))
+		})
+
+		AfterEach(func() {
+			th.Terminate()
+		})
+
+		It("returns ErrFull once the limit is reached", func() {
+			By("adding events up to the limit")
+			for i := 0; i < 3; i++ {
+				Expect(th.PushEvent(time.Duration(i)*50*time.Millisecond, testdata{index: i})).To(Succeed())
+			}
+
+			By("Checking the next push fails")
+			Expect(th.PushEvent(0, testdata{index: 3})).To(Equal(timerheap.ErrFull))
+			Expect(th.Stats().Pending).To(Equal(3))
+
+			By("Receiving an event and checking a push now succeeds")
+			Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive())
+			Eventually(func() error {
+				return th.PushEvent(time.Hour, testdata{index: 4})
+			}, "1s", "10ms").Should(Succeed())
+			Expect(th.PushEvent(0, testdata{index: 5})).To(Equal(timerheap.ErrFull))
+		})
+	})
+
+	Context("maximum wait", func() {
+		It("re-arms the timer at least every maximum wait", func() {
+			log := &testLogger{}
+			th = timerheap.New(timerheap.WithMaxWait(20*time.Millisecond), timerheap.WithLogger(log))
+			defer th.Terminate()
+			Expect(th.PushEvent(time.Hour, testdata{index: 0})).To(Succeed())
+			Expect(th.PushEvent(100*time.Millisecond, testdata{index: 1})).To(Succeed())
+
+			Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(Equal(testdata{index: 1})))
+			Eventually(func() int {
+				debug, _ := log.messages()
+				n := 0
+				for _, msg := range debug {
+					if msg == "Armed timer" {
+						n++
+					}
+				}
+				return n
+			}, "1s", "10ms").Should(BeNumerically(">=", 5))
+			Eventually(func() int {
+				return th.Stats().Pending
+			}, "1s", "10ms").Should(Equal(1))
+		})
+	})
+
+	Context("coalescing", func() {
+		It("pops the events due within the window together", func() {
+			th = timerheap.New(
+				timerheap.WithCoalescing(10*time.Millisecond),
+				timerheap.WithNonBlockingDelivery(0),
+				timerheap.WithTimedResults(),
+			)
+			defer th.Terminate()
+			for i := 0; i < 5; i++ {
+				Expect(th.PushEvent(50*time.Millisecond+time.Duration(i)*time.Millisecond, testdata{index: i})).To(Succeed())
+			}
+			Expect(th.PushEvent(100*time.Millisecond, testdata{index: 5})).To(Succeed())
+
+			var first timerheap.TimedResult
+			Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(&first))
+			Expect(first.Value).To(Equal(testdata{index: 0}))
+			for i := 1; i < 5; i++ {
+				var r timerheap.TimedResult
+				Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(&r))
+				Expect(r.Value).To(Equal(testdata{index: i}))
+				Expect(r.FiredAt).To(Equal(first.FiredAt))
+			}
+			var last timerheap.TimedResult
+			Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(&last))
+			Expect(last.FiredAt).To(BeTemporally(">", first.FiredAt))
+		})
+	})
+
+	Context("tick mode", func() {
+		It("delivers the events due since the previous tick at each tick", func() {
+			th = timerheap.New(
+				timerheap.WithTick(50*time.Millisecond),
+				timerheap.WithNonBlockingDelivery(0),
+				timerheap.WithTimedResults(),
+			)
+			defer th.Terminate()
+
+			// Start just after a tick, so the events are due before the next one.
+			time.Sleep(time.Until(time.Now().Truncate(50 * time.Millisecond).Add(51 * time.Millisecond)))
+			for i := 0; i < 3; i++ {
+				Expect(th.PushEvent(time.Duration(i+1)*10*time.Millisecond, testdata{index: i})).To(Succeed())
+			}
+
+			var results []timerheap.TimedResult
+			for i := 0; i < 3; i++ {
+				var r timerheap.TimedResult
+				Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(&r))
+				Expect(r.Value).To(Equal(testdata{index: i}))
+				results = append(results, r)
+			}
+			tick := results[2].ScheduledAt.Truncate(50 * time.Millisecond).Add(50 * time.Millisecond)
+			for _, r := range results {
+				Expect(r.FiredAt).To(Equal(results[0].FiredAt))
+				Expect(r.FiredAt).To(BeTemporally(">=", tick))
+			}
+		})
+	})
+
+	Context("precision mode", func() {
+		It("pops events on time", func() {
+			th = timerheap.New(timerheap.WithPrecision(2*time.Millisecond), timerheap.WithTimedResults())
+			defer th.Terminate()
+			for i := 0; i < 10; i++ {
+				Expect(th.PushEvent(time.Duration(i+1)*5*time.Millisecond, testdata{index: i})).To(Succeed())
+			}
+			// The lateness is measured from when each event popped, rather than when it was
+			// received, so that it does not depend on how quickly the consumer is scheduled.
+			for i := 0; i < 10; i++ {
+				r := (<-th.TimedEvent()).(timerheap.TimedResult)
+				Expect(r.Value).To(Equal(testdata{index: i}))
+				Expect(r.FiredAt.Sub(r.ScheduledAt)).To(BeNumerically(">=", 0))
+				Expect(r.FiredAt.Sub(r.ScheduledAt)).To(BeNumerically("<", 5*time.Millisecond))
+			}
+		})
 	})
 
 	Context("termination processing", func() {
@@ -0,0 +1,69 @@
+package timerheap
+
+// WithTopic routes the event to the channel for the topic, as returned by TimedEventFor,
+// rather than to the results channel or subscribers.
+func WithTopic(topic string) PushOption {
+	return func(ti *timedItem) {
+		ti.topic = topic
+	}
+}
+
+// TimedEventFor returns the channel that events pushed with the topic are sent to when they
+// pop. Each topic channel is fed from its own unbounded buffer, so a consumer that is not
+// reading one topic does not delay events for other topics. Events for a topic are buffered
+// from when the first event pops, even if TimedEventFor has not been called yet.
+//
+// In the default blocking mode, an event without a topic that is waiting to be received from
+// the results channel delays all later events, including those with a topic. Use
+// WithNonBlockingDelivery if events without a topic are consumed independently.
+//
+// The topic channels are closed once all buffered events have been received after the heap
+// is terminated.
+func (t *timerHeap) TimedEventFor(topic string) <-chan interface{} {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.topicQueueLocked(topic).out
+}
+
+// topicQueueLocked returns the queue for the topic, creating it if necessary. The caller must
+// hold the lock.
+func (t *timerHeap) topicQueueLocked(topic string) *queue[interface{}] {
+	q, ok := t.topics[topic]
+	if !ok {
+		q = newQueue[interface{}](0)
+		if t.terminated {
+			q.close()
+		}
+		t.topics[topic] = q
+	}
+	return q
+}
+
+// route sends the item to its topic queue, or calls its delivery function.
+func (t *timerHeap) route(ti timedItem) {
+	if ti.deliver != nil {
+		t.protect(ti, func() {
+			ti.deliver(t.result(ti))
+		})
+		t.recordDelivery(ti)
+		return
+	}
+
+	t.lock.Lock()
+	q := t.topicQueueLocked(ti.topic)
+	t.lock.Unlock()
+
+	if v, ok := t.handle(ti); ok {
+		q.add(v)
+	}
+	t.recordDelivery(ti)
+}
+
+// closeTopics closes all of the topic queues.
+func (t *timerHeap) closeTopics() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, q := range t.topics {
+		q.close()
+	}
+}
@@ -0,0 +1,52 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("timer heap topic tests", func() {
+
+	var th timerheap.TimerHeap
+
+	BeforeEach(func() {
+		th = timerheap.New(timerheap.WithNonBlockingDelivery(0))
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("routes events to the channel for their topic", func() {
+		By("adding events for two topics and without a topic")
+		for i := 0; i < 5; i++ {
+			d := time.Duration(i) * 10 * time.Millisecond
+			Expect(th.PushEvent(d, i, timerheap.WithTopic("a"))).To(Succeed())
+			Expect(th.PushEvent(d, i+100, timerheap.WithTopic("b"))).To(Succeed())
+			Expect(th.PushEvent(d, i+200)).To(Succeed())
+		}
+
+		By("Checking each channel receives its events in order, regardless of the other channels")
+		for i := 0; i < 5; i++ {
+			Eventually(th.TimedEventFor("b"), "1s", "10ms").Should(Receive(Equal(i + 100)))
+		}
+		for i := 0; i < 5; i++ {
+			Eventually(th.TimedEventFor("a"), "1s", "10ms").Should(Receive(Equal(i)))
+		}
+		for i := 0; i < 5; i++ {
+			Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(Equal(i + 200)))
+		}
+	})
+
+	It("closes the topic channels once drained after termination", func() {
+		Expect(th.PushEvent(0, 1, timerheap.WithTopic("a"))).To(Succeed())
+		Eventually(func() uint64 { return th.Stats().Delivered }).Should(Equal(uint64(1)))
+		th.Terminate()
+		Eventually(th.TimedEventFor("a"), "1s", "10ms").Should(Receive(Equal(1)))
+		Eventually(th.TimedEventFor("a")).Should(BeClosed())
+		Eventually(th.TimedEventFor("b")).Should(BeClosed())
+	})
+})
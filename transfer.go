@@ -0,0 +1,80 @@
+package timerheap
+
+// Transfer moves the pending event tracked by the handle to another heap. Both heaps are locked
+// while the event is moved, so there is no point at which it could fire from either heap or be
+// lost. The event keeps its expiration time, and the handle moves with it. As with Merge the
+// other heap is trimmed if the event takes it over its limit and its overflow policy is
+// OverflowDropFarthest.
+//
+// Transfer fails with ErrNotFound if the event is not pending in this heap, including when it
+// has popped but not been received or is awaiting acknowledgement, and with ErrDuplicateKey if
+// the other heap already has a pending or recently completed event with the same key, in which
+// case the event is left in this heap. It fails with ErrMergeUnsupported and ErrTerminated in
+// the same cases as Merge, other than moving events from a heap into one of its descendants,
+// which is allowed.
+func (t *timerHeap) Transfer(h *Handle, to TimerHeap) error {
+	return t.transfer(to, func() (timedItem, bool) {
+		if ti := t.valueHeap.lookup(h); ti == nil || ti.attempt > 0 {
+			return timedItem{}, false
+		}
+		return t.valueHeap.removeHandle(h), true
+	})
+}
+
+// TransferKey moves the pending event with the key to another heap, see Transfer.
+func (t *timerHeap) TransferKey(key string, to TimerHeap) error {
+	return t.transfer(to, func() (timedItem, bool) {
+		return t.valueHeap.removeWhere(func(ti *timedItem) bool {
+			return ti.key == key && ti.deliver == nil && ti.attempt == 0
+		})
+	})
+}
+
+// transfer moves the item returned by remove, which is called with both heaps locked, to the
+// other heap.
+func (t *timerHeap) transfer(to TimerHeap, remove func() (timedItem, bool)) error {
+	o, ok := to.(*timerHeap)
+	if !ok || o == t || t.persistent() || o.persistent() {
+		return ErrMergeUnsupported
+	}
+
+	mergeLock.Lock()
+	defer mergeLock.Unlock()
+	t.lock.Lock()
+	o.lock.Lock()
+	if t.terminated || o.terminated {
+		o.lock.Unlock()
+		t.lock.Unlock()
+		return ErrTerminated
+	}
+	t.drainPushedLocked()
+	ti, ok := remove()
+	if !ok {
+		o.lock.Unlock()
+		t.lock.Unlock()
+		return ErrNotFound
+	}
+	if ti.key != "" && o.dedup.taken(ti.key) {
+		// Put the event back where it was.
+		t.valueHeap.push(ti)
+		o.lock.Unlock()
+		t.lock.Unlock()
+		return ErrDuplicateKey
+	}
+	t.space.Signal()
+	t.wake()
+	duplicates, trimmed := o.adoptLocked([]timedItem{ti})
+	o.lock.Unlock()
+	t.lock.Unlock()
+
+	if ti.key != "" {
+		// The key is now held by the other heap.
+		t.dedup.release(ti.key)
+	}
+	o.dropDuplicates(duplicates)
+	o.dropTrimmed(trimmed)
+	if t.debug {
+		t.log.Debug("Transferred event", "seq", ti.seq, "expire", ti.expire)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Transfer", func() {
+	var th, other timerheap.TimerHeap
+	var h *timerheap.Handle
+
+	BeforeEach(func() {
+		th = timerheap.New()
+		other = timerheap.New()
+		h = &timerheap.Handle{}
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+		other.Terminate()
+	})
+
+	It("moves an event by handle", func() {
+		Expect(th.PushEvent(20*time.Millisecond, 1, timerheap.WithHandle(h))).To(Succeed())
+		Expect(th.PushEvent(20*time.Millisecond, 2)).To(Succeed())
+		Expect(th.Transfer(h, other)).To(Succeed())
+		Expect(th.Transfer(h, other)).To(Equal(timerheap.ErrNotFound))
+
+		Eventually(other.TimedEvent(), "1s").Should(Receive(Equal(1)))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(2)))
+		Consistently(th.TimedEvent(), "50ms").ShouldNot(Receive())
+		Eventually(h.State, "1s").Should(Equal(timerheap.EventFired))
+	})
+
+	It("moves an event by key", func() {
+		Expect(th.PushEvent(time.Hour, 1, timerheap.WithKey("a"))).To(Succeed())
+		Expect(th.TransferKey("a", other)).To(Succeed())
+		Expect(th.TransferKey("a", other)).To(Equal(timerheap.ErrNotFound))
+		Expect(th.Stats().Pending).To(BeZero())
+
+		events := other.Snapshot()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Value).To(Equal(1))
+
+		// The key is held by the other heap.
+		Expect(other.PushEvent(time.Hour, 2, timerheap.WithKey("a"))).To(Succeed())
+		Expect(other.Stats().Pending).To(Equal(1))
+		Expect(th.PushEvent(time.Hour, 3, timerheap.WithKey("a"))).To(Succeed())
+		Expect(th.Stats().Pending).To(Equal(1))
+	})
+
+	It("cancels a transferred event through its handle", func() {
+		Expect(th.PushEvent(time.Hour, 1, timerheap.WithHandle(h))).To(Succeed())
+		Expect(th.Transfer(h, other)).To(Succeed())
+		Expect(h.Cancel()).To(BeTrue())
+		Expect(other.Stats().Pending).To(BeZero())
+	})
+
+	It("does not move an event with the key of one in the other heap", func() {
+		Expect(other.PushEvent(time.Hour, 1, timerheap.WithKey("a"))).To(Succeed())
+		Expect(th.PushEvent(time.Hour, 2, timerheap.WithKey("a"), timerheap.WithHandle(h))).To(Succeed())
+		Expect(th.Transfer(h, other)).To(MatchError(timerheap.ErrDuplicateKey))
+		Expect(th.TransferKey("a", other)).To(MatchError(timerheap.ErrDuplicateKey))
+		Expect(h.State()).To(Equal(timerheap.EventPending))
+		Expect(th.Stats().Pending).To(Equal(1))
+		Expect(other.Stats().Pending).To(Equal(1))
+
+		// The event is left where it was, and can still be cancelled through its handle.
+		Expect(h.Cancel()).To(BeTrue())
+		Expect(th.Stats().Pending).To(BeZero())
+	})
+
+	It("does not move events that have popped", func() {
+		Expect(th.PushEvent(0, 1, timerheap.WithHandle(h))).To(Succeed())
+		time.Sleep(10 * time.Millisecond)
+		Expect(th.Transfer(h, other)).To(Equal(timerheap.ErrNotFound))
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal(1)))
+	})
+
+	It("does not move events to a terminated heap", func() {
+		Expect(th.PushEvent(time.Hour, 1, timerheap.WithHandle(h))).To(Succeed())
+		other.Terminate()
+		Expect(th.Transfer(h, other)).To(Equal(timerheap.ErrTerminated))
+		Expect(th.Transfer(h, th)).To(Equal(timerheap.ErrMergeUnsupported))
+		Expect(h.State()).To(Equal(timerheap.EventPending))
+	})
+})
@@ -0,0 +1,183 @@
+// Package ttlcache provides a map whose entries expire after a per-entry TTL. The expirations
+// are driven by a timerheap.TimerHeap, rather than by a goroutine periodically scanning the
+// whole map, so the cost of expiring entries does not grow with the size of the cache.
+package ttlcache
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+// Option configures a Cache.
+type Option[K comparable, V any] func(*Cache[K, V])
+
+// WithEvictFunc sets a function called with each entry that is removed from the cache because
+// it expired. It is called from the goroutine processing the expirations, so a slow function
+// delays later expirations.
+func WithEvictFunc[K comparable, V any](fn func(key K, value V)) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.evict = fn
+	}
+}
+
+// Cache is a map whose entries expire after a per-entry TTL. It is safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	th    timerheap.TimerHeap
+	topic string
+	evict func(K, V)
+	// lock protects entries and gen. Each entry records the generation it was set with, so that
+	// the expiration of an entry that has since been replaced is ignored.
+	lock    sync.Mutex
+	entries map[K]entry[V]
+	gen     uint64
+	closed  bool
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+type entry[V any] struct {
+	value   V
+	expires time.Time
+	gen     uint64
+}
+
+// expiry is the event pushed to the heap for an entry.
+type expiry[K comparable] struct {
+	key K
+	gen uint64
+}
+
+// New returns an empty cache using the heap for its expirations. The expirations are pushed
+// with a topic unique to the cache, so the heap can be shared with other caches and users.
+func New[K comparable, V any](th timerheap.TimerHeap, opts ...Option[K, V]) *Cache[K, V] {
+	c := &Cache[K, V]{
+		th:      th,
+		entries: map[K]entry[V]{},
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	c.topic = fmt.Sprintf("ttlcache/%p", c)
+	for _, opt := range opts {
+		opt(c)
+	}
+	go c.run()
+	return c
+}
+
+// Set sets the value for the key, replacing any existing entry, to expire once the TTL has
+// passed. A TTL of zero or less means the entry does not expire. The expiration of a replaced
+// entry remains on the heap until it is due, and is then ignored.
+func (c *Cache[K, V]) Set(key K, value V, ttl time.Duration) error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return timerheap.ErrTerminated
+	}
+	c.gen++
+	e := entry[V]{value: value, gen: c.gen}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+	c.entries[key] = e
+	c.lock.Unlock()
+
+	if ttl <= 0 {
+		return nil
+	}
+	err := c.th.PushEvent(ttl, expiry[K]{key: key, gen: e.gen}, timerheap.WithTopic(c.topic))
+	if err != nil {
+		c.lock.Lock()
+		if cur, ok := c.entries[key]; ok && cur.gen == e.gen {
+			delete(c.entries, key)
+		}
+		c.lock.Unlock()
+	}
+	return err
+}
+
+// Get returns the value for the key, and whether there is an unexpired entry for it. An entry
+// is not returned once its TTL has passed, even if its expiration has not yet been processed.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	e, ok := c.entries[key]
+	if !ok || (!e.expires.IsZero() && !time.Now().Before(e.expires)) {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// Delete removes the entry for the key, returning whether there was one. The evict function is
+// not called for deleted entries.
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_, ok := c.entries[key]
+	delete(c.entries, key)
+	return ok
+}
+
+// Len returns the number of entries in the cache, including expired entries whose expiration
+// has not yet been processed.
+func (c *Cache[K, V]) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.entries)
+}
+
+// Close stops processing expirations and empties the cache. Calls to Set after Close fail with
+// timerheap.ErrTerminated. The heap is not terminated, and the pending expirations are discarded
+// when they pop.
+func (c *Cache[K, V]) Close() {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return
+	}
+	c.closed = true
+	c.entries = map[K]entry[V]{}
+	c.lock.Unlock()
+	close(c.done)
+	<-c.stopped
+	go func() {
+		// Drain the expirations still to pop, so that they are not buffered by the heap.
+		for range c.th.TimedEventFor(c.topic) {
+		}
+	}()
+}
+
+// run processes the expirations until the cache is closed.
+func (c *Cache[K, V]) run() {
+	defer close(c.stopped)
+	events := c.th.TimedEventFor(c.topic)
+	for {
+		select {
+		case <-c.done:
+			return
+		case v, ok := <-events:
+			if !ok {
+				return
+			}
+			c.expire(v.(expiry[K]))
+		}
+	}
+}
+
+// expire removes the entry the expiration is for, if it has not been replaced or deleted.
+func (c *Cache[K, V]) expire(x expiry[K]) {
+	c.lock.Lock()
+	e, ok := c.entries[x.key]
+	if !ok || e.gen != x.gen {
+		c.lock.Unlock()
+		return
+	}
+	delete(c.entries, x.key)
+	c.lock.Unlock()
+	if c.evict != nil {
+		c.evict(x.key, e.value)
+	}
+}
@@ -0,0 +1,13 @@
+package ttlcache_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestTTLCache(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ttlcache suite")
+}
@@ -0,0 +1,87 @@
+package ttlcache_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+	"github.com/robbrockbank/timerheap/ttlcache"
+)
+
+var _ = Describe("Cache", func() {
+	type evicted struct {
+		key   string
+		value int
+	}
+	var th timerheap.TimerHeap
+	var c *ttlcache.Cache[string, int]
+	var evictions chan evicted
+
+	BeforeEach(func() {
+		th = timerheap.New()
+		evictions = make(chan evicted, 10)
+		c = ttlcache.New(th, ttlcache.WithEvictFunc(func(key string, value int) {
+			evictions <- evicted{key, value}
+		}))
+	})
+
+	AfterEach(func() {
+		c.Close()
+		th.Terminate()
+	})
+
+	It("returns entries until they expire", func() {
+		Expect(c.Set("a", 1, 50*time.Millisecond)).To(Succeed())
+		Expect(c.Set("b", 2, 0)).To(Succeed())
+		v, ok := c.Get("a")
+		Expect(ok).To(BeTrue())
+		Expect(v).To(Equal(1))
+
+		Eventually(evictions, "1s").Should(Receive(Equal(evicted{"a", 1})))
+		_, ok = c.Get("a")
+		Expect(ok).To(BeFalse())
+		Expect(c.Len()).To(Equal(1))
+		v, ok = c.Get("b")
+		Expect(ok).To(BeTrue())
+		Expect(v).To(Equal(2))
+	})
+
+	It("extends the TTL of a replaced entry", func() {
+		Expect(c.Set("a", 1, 50*time.Millisecond)).To(Succeed())
+		Expect(c.Set("a", 2, 200*time.Millisecond)).To(Succeed())
+		Consistently(evictions, "150ms").ShouldNot(Receive())
+		v, ok := c.Get("a")
+		Expect(ok).To(BeTrue())
+		Expect(v).To(Equal(2))
+		Eventually(evictions, "1s").Should(Receive(Equal(evicted{"a", 2})))
+	})
+
+	It("does not evict deleted entries", func() {
+		Expect(c.Set("a", 1, 20*time.Millisecond)).To(Succeed())
+		Expect(c.Delete("a")).To(BeTrue())
+		Expect(c.Delete("a")).To(BeFalse())
+		Consistently(evictions, "100ms").ShouldNot(Receive())
+	})
+
+	It("shares a heap with other users", func() {
+		other := ttlcache.New[string, int](th)
+		defer other.Close()
+		Expect(other.Set("a", 1, 20*time.Millisecond)).To(Succeed())
+		Expect(c.Set("a", 2, time.Second)).To(Succeed())
+		Expect(th.PushEvent(10*time.Millisecond, "event")).To(Succeed())
+		Eventually(th.TimedEvent(), "1s").Should(Receive(Equal("event")))
+		Eventually(other.Len, "1s").Should(BeZero())
+		v, ok := c.Get("a")
+		Expect(ok).To(BeTrue())
+		Expect(v).To(Equal(2))
+		Expect(evictions).NotTo(Receive())
+	})
+
+	It("fails to set entries once closed", func() {
+		c.Close()
+		Expect(c.Set("a", 1, time.Second)).To(Equal(timerheap.ErrTerminated))
+		Expect(c.Len()).To(BeZero())
+	})
+})
@@ -0,0 +1,297 @@
+package timerheap
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// walCompactMin is the number of records for delivered events the write-ahead log may hold
+// before it is compacted. It is only compacted once these also outnumber the pending events.
+const walCompactMin = 1024
+
+// walRecord is a record in the write-ahead log. A record with an event is written when the
+// event is pushed, and a record without an event when it is delivered, dropped or discarded.
+// The record for a completed event with an idempotency key holds the key and the time it
+// completed, see WithKey.
+type walRecord struct {
+	Seq   uint64
+	Event *savedEvent
+	Key   string
+	Done  time.Time
+}
+
+// wal is the write-ahead log of a durable heap. It holds the pending events so that it can
+// rewrite the log without them being read back from the heap.
+type wal struct {
+	lock  sync.Mutex
+	path  string
+	types *TypeRegistry
+	dedup *dedup
+	file  *os.File
+	enc   *gob.Encoder
+	// live holds the pending events, and dead is the number of records in the log for events
+	// that are no longer pending.
+	live map[uint64]savedEvent
+	dead int
+	// replaying is set while the existing log is being replayed, when records are not synced
+	// individually.
+	replaying bool
+}
+
+// NewDurable creates a heap that records every pushed event in a write-ahead log at path, so
+// that pending events survive a restart. The heap must be configured with a TypeRegistry, which
+// is used to encode and decode the values, see Save.
+//
+// If the log exists, the events that were pending when it was last written are pushed to the
+// new heap, and events whose scheduled time has passed pop immediately. The log is rewritten
+// on start up, and is compacted as events are delivered.
+//
+// Each push is synced to disk before it returns. Deliveries are logged without syncing, so an
+// event that was delivered just before a crash may be delivered again after the restart. Events
+// pending when the heap is terminated remain in the log.
+func NewDurable(path string, opts ...Option) (TimerHeap, error) {
+	t := newTimerHeap()
+	t.configure(opts)
+	fail := func(err error) (TimerHeap, error) {
+		t.launch()
+		t.Terminate()
+		return nil, err
+	}
+	if t.types == nil {
+		return fail(ErrNoTypeRegistry)
+	}
+	events, keys, err := readWAL(path)
+	if err != nil {
+		return fail(err)
+	}
+	for _, ck := range keys {
+		t.dedup.remember(ck.key, ck.done)
+	}
+	t.wal = &wal{
+		path:      path,
+		types:     t.types,
+		dedup:     t.dedup,
+		live:      map[uint64]savedEvent{},
+		replaying: true,
+	}
+	if err := t.wal.create(); err != nil {
+		t.wal = nil
+		return fail(err)
+	}
+	t.launch()
+
+	// Push the events from the existing log, which writes them to the new log.
+	for _, ev := range events {
+		ti, err := t.types.decode(ev)
+		if err == nil {
+			err = t.restore(ti)
+		}
+		if err != nil {
+			t.Terminate()
+			return nil, err
+		}
+	}
+
+	t.wal.lock.Lock()
+	t.wal.replaying = false
+	err = t.wal.commit()
+	t.wal.lock.Unlock()
+	if err != nil {
+		t.Terminate()
+		return nil, err
+	}
+	return t, nil
+}
+
+// readWAL reads the pending events from the log at path, in the order they were pushed, and
+// the keys of the completed events. It is not an error for the log not to exist, or for the
+// last record to be incomplete.
+func readWAL(path string) ([]savedEvent, []completedKey, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	live := map[uint64]savedEvent{}
+	var keys []completedKey
+	dec := gob.NewDecoder(f)
+	for {
+		var rec walRecord
+		err := dec.Decode(&rec)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("timerheap: cannot read log %s: %w", path, err)
+		}
+		if rec.Event != nil {
+			live[rec.Seq] = *rec.Event
+			continue
+		}
+		// The records for the keys of completed events at the start of the log do not refer
+		// to a pending event.
+		if ev, ok := live[rec.Seq]; ok && ev.Key == rec.Key {
+			delete(live, rec.Seq)
+		}
+		if rec.Key != "" {
+			keys = append(keys, completedKey{key: rec.Key, done: rec.Done})
+		}
+	}
+
+	seqs := make([]uint64, 0, len(live))
+	for seq := range live {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	events := make([]savedEvent, len(seqs))
+	for i, seq := range seqs {
+		events[i] = live[seq]
+	}
+	return events, keys, nil
+}
+
+// create starts a new log in a temporary file, which replaces the log when it is committed. The
+// log starts with the keys of the recently completed events. The caller must hold the lock, or
+// have sole access to the log.
+func (w *wal) create() error {
+	f, err := os.OpenFile(w.path+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	w.file = f
+	w.enc = gob.NewEncoder(f)
+	w.dead = 0
+	for _, ck := range w.dedup.recent() {
+		if err := w.enc.Encode(walRecord{Key: ck.key, Done: ck.done}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit syncs the new log and moves it into place. The caller must hold the lock.
+func (w *wal) commit() error {
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(w.path+".tmp", w.path); err != nil {
+		return err
+	}
+	// Sync the directory so that the rename is durable.
+	dir, err := os.Open(filepath.Dir(w.path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// pushed logs a pushed item, and syncs the log unless it is being replayed.
+func (w *wal) pushed(ti *timedItem) error {
+	ev, err := w.types.encode(*ti)
+	if err != nil {
+		return err
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file == nil {
+		return ErrTerminated
+	}
+	if err := w.enc.Encode(walRecord{Seq: ti.seq, Event: &ev}); err != nil {
+		return err
+	}
+	w.live[ti.seq] = ev
+	if w.replaying {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+// done logs that an item is no longer pending, compacting the log if it holds enough records
+// for items that are no longer pending.
+func (w *wal) done(seq uint64, now time.Time) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	ev, ok := w.live[seq]
+	if !ok || w.file == nil {
+		return nil
+	}
+	rec := walRecord{Seq: seq, Key: ev.Key}
+	if ev.Key != "" {
+		rec.Done = now
+	}
+	if err := w.enc.Encode(rec); err != nil {
+		return err
+	}
+	delete(w.live, seq)
+	w.dead++
+	if w.replaying || w.dead < walCompactMin || w.dead < len(w.live) {
+		return nil
+	}
+	return w.compact()
+}
+
+// compact rewrites the log with just the pending events. The caller must hold the lock.
+func (w *wal) compact() error {
+	old := w.file
+	if err := w.create(); err != nil {
+		return err
+	}
+	old.Close()
+
+	seqs := make([]uint64, 0, len(w.live))
+	for seq := range w.live {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	for _, seq := range seqs {
+		ev := w.live[seq]
+		if err := w.enc.Encode(walRecord{Seq: seq, Event: &ev}); err != nil {
+			return err
+		}
+	}
+	return w.commit()
+}
+
+// close closes the log, after which pushes fail.
+func (w *wal) close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// retired records that an item is no longer pending because it has been delivered, dropped or
+// discarded.
+func (t *timerHeap) retired(ti timedItem) {
+	if ti.deliver != nil {
+		return
+	}
+	now := time.Now()
+	if ti.key != "" {
+		t.dedup.complete(ti.key, now)
+	}
+	if t.wal != nil {
+		if err := t.wal.done(ti.seq, now); err != nil {
+			t.log.Warn("Failed to log delivered event", "seq", ti.seq, "error", err)
+			t.fault(FaultPersistence, "failed to log delivered event", err)
+		}
+	}
+	if t.store != nil && ti.stored != 0 {
+		t.deleteStored(ti, now)
+	}
+}
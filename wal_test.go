@@ -0,0 +1,73 @@
+package timerheap_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Write-ahead log", func() {
+	var dir, path string
+	var registry *timerheap.TypeRegistry
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "timerheap")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "events.wal")
+		registry = timerheap.NewTypeRegistry()
+		Expect(registry.Register("retry", retry{}, nil)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	open := func() timerheap.TimerHeap {
+		th, err := timerheap.NewDurable(path, timerheap.WithTypeRegistry(registry, true))
+		Expect(err).NotTo(HaveOccurred())
+		return th
+	}
+
+	It("restores pending events after a restart", func() {
+		th := open()
+		Expect(th.PushEvent(10*time.Millisecond, retry{ID: "delivered"})).To(Succeed())
+		Expect(th.PushEvent(100*time.Millisecond, retry{ID: "a"})).To(Succeed())
+		Expect(th.PushEvent(150*time.Millisecond, retry{ID: "b"})).To(Succeed())
+		Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(Equal(retry{ID: "delivered"})))
+		Eventually(func() uint64 { return th.Stats().Delivered }).Should(BeEquivalentTo(1))
+		th.Terminate()
+
+		By("reopening the log and checking only the pending events are delivered")
+		th = open()
+		defer th.Terminate()
+		Expect(th.Stats().Pending).To(Equal(2))
+		Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(Equal(retry{ID: "a"})))
+		Eventually(th.TimedEvent(), "1s", "1ms").Should(Receive(Equal(retry{ID: "b"})))
+	})
+
+	It("keeps the log compact as events are delivered", func() {
+		th := open()
+		defer th.Terminate()
+		for i := 0; i < 1200; i++ {
+			Expect(th.PushEvent(0, retry{Attempt: i})).To(Succeed())
+			Eventually(th.TimedEvent(), "1s", "100us").Should(Receive())
+		}
+		Expect(th.PushEvent(time.Hour, retry{ID: "pending"})).To(Succeed())
+		Eventually(func() uint64 { return th.Stats().Delivered }).Should(BeEquivalentTo(1200))
+
+		info, err := os.Stat(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Size()).To(BeNumerically("<", 64*1024))
+	})
+
+	It("requires a type registry", func() {
+		_, err := timerheap.NewDurable(path)
+		Expect(err).To(Equal(timerheap.ErrNoTypeRegistry))
+	})
+})
@@ -0,0 +1,75 @@
+package timerheap
+
+import (
+	"fmt"
+	"time"
+)
+
+// WithSlowConsumerWatchdog configures the heap to detect a consumer that is not reading the
+// results channel. If an event is ready to be delivered but has not been received within
+// timeout, the handler is called with how long delivery has been blocked, a warning is
+// logged, and Stats.SlowConsumerTrips is incremented. The watchdog trips at most once for
+// each event.
+//
+// The handler is called from the event goroutine and should not block. The handler may be
+// nil, in which case the trip is only logged and counted.
+func WithSlowConsumerWatchdog(timeout time.Duration, handler func(blocked time.Duration)) Option {
+	return func(t *timerHeap) {
+		t.watchdog = &watchdog{
+			timeout: timeout,
+			handler: handler,
+		}
+	}
+}
+
+// watchdog tracks how long the event at the head of the ready queue has been waiting to be
+// received. It is only accessed by the event goroutine.
+type watchdog struct {
+	timeout time.Duration
+	handler func(blocked time.Duration)
+
+	// Whether there is an event waiting, its sequence number, when it started waiting and
+	// whether the watchdog has tripped for it.
+	waiting bool
+	seq     uint64
+	since   time.Time
+	tripped bool
+}
+
+// check is called by the event goroutine on each iteration, with whether there is an event
+// waiting to be delivered and its sequence number. It trips the watchdog if the event has
+// been waiting for longer than the timeout, otherwise it returns the time the watchdog would
+// trip so that the event goroutine can wake up to check again.
+func (w *watchdog) check(t *timerHeap, now time.Time, waiting bool, seq uint64) time.Time {
+	if !waiting {
+		w.waiting = false
+		return time.Time{}
+	}
+	if !w.waiting || seq != w.seq {
+		w.waiting = true
+		w.seq = seq
+		w.since = now
+		w.tripped = false
+	}
+	if w.tripped {
+		return time.Time{}
+	}
+
+	trip := w.since.Add(w.timeout)
+	if now.Before(trip) {
+		return trip
+	}
+	w.tripped = true
+	blocked := now.Sub(w.since)
+
+	t.lock.Lock()
+	t.slowConsumer++
+	t.lock.Unlock()
+
+	t.log.Warn("Slow consumer, event not received from results channel", "seq", seq, "blocked", blocked)
+	t.fault(FaultSlowConsumer, fmt.Sprintf("event not received from results channel for %s", blocked), nil)
+	if w.handler != nil {
+		w.handler(blocked)
+	}
+	return time.Time{}
+}
@@ -0,0 +1,55 @@
+package timerheap_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("timer heap slow consumer watchdog tests", func() {
+
+	var th timerheap.TimerHeap
+	var trips chan time.Duration
+
+	BeforeEach(func() {
+		trips = make(chan time.Duration, 10)
+		th = timerheap.New(timerheap.WithSlowConsumerWatchdog(100*time.Millisecond, func(blocked time.Duration) {
+			trips <- blocked
+		}))
+	})
+
+	AfterEach(func() {
+		th.Terminate()
+	})
+
+	It("does not trip when the consumer keeps up", func() {
+		for i := 0; i < 5; i++ {
+			Expect(th.PushEvent(time.Duration(i)*50*time.Millisecond, i)).To(Succeed())
+		}
+		for i := 0; i < 5; i++ {
+			Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(Equal(i)))
+		}
+		Consistently(trips, "200ms", "10ms").ShouldNot(Receive())
+	})
+
+	It("trips once for each event the consumer is slow to receive", func() {
+		var blocked time.Duration
+
+		By("adding two events and not reading them")
+		Expect(th.PushEvent(0, 0)).To(Succeed())
+		Expect(th.PushEvent(0, 1)).To(Succeed())
+
+		By("Checking the watchdog trips once")
+		Eventually(trips, "1s", "10ms").Should(Receive(&blocked))
+		Expect(blocked).To(BeNumerically(">=", 100*time.Millisecond))
+		Consistently(trips, "200ms", "10ms").ShouldNot(Receive())
+		Expect(th.Stats().SlowConsumerTrips).To(Equal(uint64(1)))
+
+		By("Receiving the first event and checking the watchdog trips for the second")
+		Eventually(th.TimedEvent(), "1s", "10ms").Should(Receive(Equal(0)))
+		Eventually(trips, "1s", "10ms").Should(Receive())
+		Expect(th.Stats().SlowConsumerTrips).To(Equal(uint64(2)))
+	})
+})
@@ -0,0 +1,100 @@
+package timerheap
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// ZoneSource gives the location of a wall clock, see Recurrence, NewBusinessHoursIn and
+// DailyBlackoutIn. The location is looked up each time an occurrence, opening or window is
+// computed, so a source that reloads its time zone database, such as a Zone, takes effect
+// without restarting.
+type ZoneSource interface {
+	Location() *time.Location
+}
+
+// FixedZone returns a source that always gives the location. A nil location is treated as UTC.
+func FixedZone(loc *time.Location) ZoneSource {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return fixedZone{loc: loc}
+}
+
+type fixedZone struct {
+	loc *time.Location
+}
+
+func (z fixedZone) Location() *time.Location {
+	return z.loc
+}
+
+// ZoneLoader loads the location with the name, such as "America/New_York", from a time zone
+// database.
+type ZoneLoader func(name string) (*time.Location, error)
+
+// SystemZones loads locations with time.LoadLocation, from the time zone database of the system.
+// A program that may run without one, for example in a container without zoneinfo, can import
+// time/tzdata to embed a copy of the database, which is used when the system has none.
+var SystemZones ZoneLoader = time.LoadLocation
+
+// ZoneDir returns a loader that reads locations from the zoneinfo files in the directory, laid
+// out as in /usr/share/zoneinfo, for example a volume that is updated with newer data.
+func ZoneDir(dir string) ZoneLoader {
+	return func(name string) (*time.Location, error) {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+		return time.LoadLocationFromTZData(name, data)
+	}
+}
+
+// Zone is a location loaded by name from a time zone database, which can be reloaded to pick up
+// updates to the database. It is safe for concurrent use.
+type Zone struct {
+	name string
+	load ZoneLoader
+	loc  atomic.Pointer[time.Location]
+}
+
+// LoadZone loads the location with the name using the loader, or SystemZones if it is nil.
+func LoadZone(name string, load ZoneLoader) (*Zone, error) {
+	if load == nil {
+		load = SystemZones
+	}
+	z := &Zone{name: name, load: load}
+	if err := z.Reload(); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// Location returns the location as last loaded.
+func (z *Zone) Location() *time.Location {
+	return z.loc.Load()
+}
+
+// Reload loads the location again, so that the schedules using the zone compute their later
+// occurrences with the updated data. If loading fails, the zone keeps the location it had.
+func (z *Zone) Reload() error {
+	loc, err := z.load(z.name)
+	if err != nil {
+		return err
+	}
+	z.loc.Store(loc)
+	return nil
+}
+
+// zoneLocation returns the location of the source, treating a nil source or location as UTC.
+func zoneLocation(z ZoneSource) *time.Location {
+	if z == nil {
+		return time.UTC
+	}
+	if loc := z.Location(); loc != nil {
+		return loc
+	}
+	return time.UTC
+}
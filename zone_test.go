@@ -0,0 +1,98 @@
+package timerheap_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/robbrockbank/timerheap"
+)
+
+var _ = Describe("Zones", func() {
+	// offset is the UTC offset, in hours, of the zone returned by the loader, and fail makes it
+	// return an error instead.
+	var offset int
+	var fail bool
+	var zone *timerheap.Zone
+
+	load := func(name string) (*time.Location, error) {
+		if fail {
+			return nil, errors.New("no data")
+		}
+		return time.FixedZone(name, offset*60*60), nil
+	}
+
+	BeforeEach(func() {
+		offset, fail = 1, false
+		var err error
+		zone, err = timerheap.LoadZone("test", load)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("computes later occurrences with the reloaded data", func() {
+		r := timerheap.Recurrence{At: 9 * time.Hour, Zone: zone}
+		after := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+		Expect(r.Next(after)).To(BeTemporally("==", time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC)))
+
+		offset = 2
+		Expect(zone.Reload()).To(Succeed())
+		Expect(r.Next(after)).To(BeTemporally("==", time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC)))
+	})
+
+	It("keeps the location if reloading fails", func() {
+		fail = true
+		Expect(zone.Reload()).To(MatchError("no data"))
+		_, secs := time.Date(2024, 3, 4, 0, 0, 0, 0, zone.Location()).Zone()
+		Expect(secs).To(Equal(60 * 60))
+
+		_, err := timerheap.LoadZone("test", load)
+		Expect(err).To(MatchError("no data"))
+	})
+
+	It("moves business hours and blackouts with the reloaded data", func() {
+		hours := timerheap.NewBusinessHoursIn(zone)
+		Expect(hours.Add(time.Monday, 9*time.Hour, 17*time.Hour)).To(Succeed())
+		blackout := timerheap.DailyBlackoutIn(2*time.Hour, time.Hour, zone)
+		monday := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+
+		Expect(hours.Next(monday)).To(BeTemporally("==", monday.Add(8*time.Hour)))
+		Expect(blackout(monday.Add(90 * time.Minute))).To(BeTemporally("==", monday.Add(2*time.Hour)))
+
+		offset = -1
+		Expect(zone.Reload()).To(Succeed())
+		Expect(hours.Next(monday)).To(BeTemporally("==", monday.Add(10*time.Hour)))
+		Expect(blackout(monday.Add(90 * time.Minute))).To(BeZero())
+		Expect(blackout(monday.Add(3 * time.Hour))).To(BeTemporally("==", monday.Add(4*time.Hour)))
+	})
+
+	It("treats a fixed zone without a location as UTC", func() {
+		r := timerheap.Recurrence{At: 9 * time.Hour, Zone: timerheap.FixedZone(nil)}
+		after := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+		Expect(r.Next(after)).To(BeTemporally("==", after.Add(9*time.Hour)))
+	})
+
+	It("loads zones from a directory of zoneinfo files", func() {
+		data, err := os.ReadFile("/usr/share/zoneinfo/America/New_York")
+		if err != nil {
+			Skip("time zone database is not available")
+		}
+		dir, err := os.MkdirTemp("", "timerheap")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		Expect(os.MkdirAll(filepath.Join(dir, "America"), 0o755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "America", "New_York"), data, 0o644)).To(Succeed())
+
+		ny, err := timerheap.LoadZone("America/New_York", timerheap.ZoneDir(dir))
+		Expect(err).NotTo(HaveOccurred())
+		r := timerheap.Recurrence{At: 9 * time.Hour, Zone: ny}
+		// New York is five hours behind UTC in winter.
+		Expect(r.Next(time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC))).To(BeTemporally("==", time.Date(2024, 1, 8, 14, 0, 0, 0, time.UTC)))
+
+		_, err = timerheap.LoadZone("Europe/Paris", timerheap.ZoneDir(dir))
+		Expect(err).To(HaveOccurred())
+	})
+})